@@ -1 +1,75 @@
 package config
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// Number of mnemonic words requested by an access challenge
+	AccessChallengeWords = 2
+	// Time to answer an access challenge
+	AccessChallengeTTL = 5 * time.Minute
+	// Failed attempts allowed per telegram id within AccessThrottleWindow
+	AccessMaxFailedAttempts int64 = 5
+	AccessThrottleWindow          = 15 * time.Minute
+)
+
+var (
+	// The MATIC price is read again once the cached one is older than that
+	MaticPriceTTL = 5 * time.Second
+	CoinGeckoURL  = getenvDefault("COINGECKO_URL", "https://api.coingecko.com/api/v3")
+	// "<asset>=<price>" pairs quoted next to CoinGecko, for development without price APIs
+	PriceFixtures = os.Getenv("PRICE_FIXTURES")
+)
+
+var (
+	// Time owners have to collect approvals and consume the request
+	ApprovalRequestTTL = 30 * time.Minute
+	// Access created through getAccess is valid for that long
+	AccessTTL = 15 * time.Minute
+)
+
+var (
+	// Accepted clock skew of signed internal requests, nonces are remembered twice as long
+	SignatureMaxSkew = 60 * time.Second
+	// HMAC secret per calling service, SERVICE_SECRETS="telegram=<secret>,bot=<secret>"
+	ServiceSecrets = ParseServiceSecrets(os.Getenv("SERVICE_SECRETS"))
+	// HMAC key of the audit log hash chain, entries can not be rewritten and hashed again without it
+	AuditSecret = os.Getenv("AUDIT_SECRET")
+	// Telegram ids of the founding owners, BOOTSTRAP_OWNERS="<tg_id>,<tg_id>"
+	BootstrapOwners = ParseTgIDs(os.Getenv("BOOTSTRAP_OWNERS"))
+)
+
+func getenvDefault(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func ParseServiceSecrets(raw string) map[string]string {
+	secrets := map[string]string{}
+	for _, _pair := range strings.Split(raw, ",") {
+		name, secret, found := strings.Cut(strings.TrimSpace(_pair), "=")
+		if !found || name == "" || secret == "" {
+			continue
+		}
+		secrets[name] = secret
+	}
+	return secrets
+}
+
+func ParseTgIDs(raw string) map[int]bool {
+	tgIDs := map[int]bool{}
+	for _, _field := range strings.Split(raw, ",") {
+		tgID, err := strconv.Atoi(strings.TrimSpace(_field))
+		if err != nil {
+			continue
+		}
+		tgIDs[tgID] = true
+	}
+	return tgIDs
+}
@@ -0,0 +1,30 @@
+package controllers
+
+import (
+	"auth/config"
+	"auth/models"
+	"common/audit"
+
+	"gorm.io/gorm"
+)
+
+// auditLog is the hash chain of auth_audit_log, keyed with AUDIT_SECRET
+func auditLog() audit.Chain {
+	return audit.Chain{Table: models.AuditEntry{}.TableName(), Key: []byte(config.AuditSecret)}
+}
+
+// AppendAudit links entry to the last one of the audit log and writes it
+func AppendAudit(entry models.AuditEntry) error {
+	return auditLog().Append(DB, audit.Entry(entry))
+}
+
+// AppendAuditTx appends entry within tx, it is rolled back together with the change it records
+func AppendAuditTx(tx *gorm.DB, entry models.AuditEntry) error {
+	return auditLog().Append(tx, audit.Entry(entry))
+}
+
+// VerifyAuditLog walks the audit log from its first entry and reports the first one that does not
+// link to its predecessor or whose content does not match its hash
+func VerifyAuditLog() (audit.Verification, error) {
+	return auditLog().Verify(DB)
+}
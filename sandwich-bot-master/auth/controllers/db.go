@@ -2,8 +2,11 @@ package controllers
 
 import (
 	"auth/models"
+	"auth/utils"
 	"fmt"
+	"log"
 	"os"
+	"strings"
 
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
@@ -11,6 +14,23 @@ import (
 
 var DB *gorm.DB
 
+// Models are migrated on every start
+var Models = []interface{}{
+	&models.User{},
+	&models.Role{},
+	&models.Telegram{},
+	&models.Mnemonic{},
+	&models.MnemonicWord{},
+	&models.Access{},
+	&models.AccessChallenge{},
+	&models.AccessAttempt{},
+	&models.QuorumPolicy{},
+	&models.ApprovalRequest{},
+	&models.Approval{},
+	&models.Permission{},
+	&models.AuditEntry{},
+}
+
 func ConnectDatabase() {
 	var err error
 
@@ -31,11 +51,57 @@ func ConnectDatabase() {
 		panic("Failed to connect to database!")
 	}
 
-	DB.AutoMigrate(
-		&models.User{},
-		&models.Role{},
-		&models.Telegram{},
-		&models.Mnemonic{},
-		&models.Access{},
-	)
+	DB.AutoMigrate(Models...)
+
+	migrateMnemonicPhrases()
+}
+
+// Replaces legacy plaintext phrases with per-word salted hashes
+func migrateMnemonicPhrases() {
+	if !DB.Migrator().HasColumn(&models.Mnemonic{}, "phrase") {
+		return
+	}
+
+	type legacyMnemonic struct {
+		ID     uint
+		Phrase string
+	}
+
+	var migrated int
+	if err := DB.Transaction(func(tx *gorm.DB) error {
+		var legacy []legacyMnemonic
+		if err := tx.Table(models.Mnemonic{}.TableName()).Select("id, phrase").Where("phrase IS NOT NULL").Scan(&legacy).Error; err != nil {
+			return err
+		}
+
+		for _, _m := range legacy {
+			mnemonicID := _m.ID
+			words := []models.MnemonicWord{}
+			for _i, _w := range strings.Fields(_m.Phrase) {
+				salt, hash, err := utils.HashMnemonicWord(_w)
+				if err != nil {
+					return err
+				}
+				words = append(words, models.MnemonicWord{
+					MnemonicID: &mnemonicID,
+					Index:      _i + 1,
+					Salt:       salt,
+					Hash:       hash,
+				})
+			}
+			if len(words) == 0 {
+				continue
+			}
+			if err := tx.Create(&words).Error; err != nil {
+				return err
+			}
+			migrated++
+		}
+
+		return tx.Migrator().DropColumn(&models.Mnemonic{}, "phrase")
+	}); err != nil {
+		log.Fatalf("Error migrating legacy mnemonic phrases: %v", err)
+	}
+
+	log.Printf("Migrated %d legacy mnemonic phrases to hashed words", migrated)
 }
@@ -8,7 +8,7 @@ import (
 
 func Seed() {
 	_true := true
-	// _false := false
+	_false := false
 
 	roles := []models.Role{
 		{Title: "guest", Weight: 1, Active: models.Active{Active: &_true}},
@@ -21,4 +21,50 @@ func Seed() {
 		Columns:   []clause.Column{{Name: "title"}},
 		DoUpdates: clause.AssignmentColumns([]string{"weight", "active"}),
 	}).Create(&roles)
+
+	// wallet, kill switch, owner and quorum changes need two owners, interfaces.MinMultisigApprovals keeps
+	// older databases seeded with one at two as well. Owners raise quorum through update_quorum_policy requests
+	policies := []models.QuorumPolicy{
+		{Action: "default", Required: 1, RoleTitle: "owner", Active: models.Active{Active: &_true}},
+		{Action: "set_main_wallet", Required: 2, RoleTitle: "owner", Active: models.Active{Active: &_true}},
+		{Action: "set_withdrawal_wallet", Required: 2, RoleTitle: "owner", Active: models.Active{Active: &_true}},
+		{Action: "rotate_main_wallet", Required: 2, RoleTitle: "owner", Active: models.Active{Active: &_true}},
+		{Action: "rotate_withdrawal_wallet", Required: 2, RoleTitle: "owner", Active: models.Active{Active: &_true}},
+		{Action: "set_kill_switch_on", Required: 2, RoleTitle: "owner", Active: models.Active{Active: &_true}},
+		{Action: "set_kill_switch_off", Required: 2, RoleTitle: "owner", Active: models.Active{Active: &_true}},
+		{Action: "update_quorum_policy", Required: 2, RoleTitle: "owner", Active: models.Active{Active: &_true}},
+		{Action: "manage_owners", Required: 2, RoleTitle: "owner", Active: models.Active{Active: &_true}},
+		// profit sweeps need a second owner besides the one asking for it
+		{Action: "sweep_profit", Required: 1, RoleTitle: "owner", ExcludeRequester: &_true, Active: models.Active{Active: &_true}},
+	}
+
+	DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "action"}},
+		DoNothing: true,
+	}).Create(&policies)
+
+	// weights match seeded roles: 1 guest, 100 admin, 1000 owner
+	permissions := []models.Permission{
+		{Action: "list_contracts", MinWeight: 1, RequireAccess: &_true, Description: "List and browse contracts, coins and DEXs"},
+		{Action: "find_contract", MinWeight: 100, RequireAccess: &_true, Description: "Look up a contract by address"},
+		{Action: "manage_contracts", MinWeight: 100, RequireAccess: &_true, Description: "Whitelist, blacklist, add and delete contracts"},
+		{Action: "update_settings", MinWeight: 100, RequireAccess: &_true, Description: "Change bot settings"},
+		{Action: "view_wallets", MinWeight: 100, RequireAccess: &_true, Description: "View system wallets"},
+		{Action: "view_nodes", MinWeight: 100, RequireAccess: &_true, Description: "View RPC node pool health"},
+		{Action: "kill_switch_menu", MinWeight: 100, RequireAccess: &_false, Description: "Open the kill switch menu"},
+		{Action: "receive_alerts", MinWeight: 100, RequireAccess: &_false, Description: "Subscribe to bot event alerts"},
+		{Action: "set_wallet", MinWeight: 1000, RequireAccess: &_false, Description: "Request main or withdrawal wallet change or rotation"},
+		{Action: "sweep_profit", MinWeight: 1000, RequireAccess: &_false, Description: "Request a profit sweep to the withdrawal wallet"},
+		{Action: "manage_allowances", MinWeight: 1000, RequireAccess: &_true, Description: "List and revoke token allowances of system wallets"},
+		{Action: "set_kill_switch", MinWeight: 1000, RequireAccess: &_false, Description: "Request kill switch toggle"},
+		{Action: "approve_request", MinWeight: 1000, RequireAccess: &_false, Description: "Approve or reject owner approval requests"},
+		{Action: "manage_roles", MinWeight: 1000, RequireAccess: &_true, Description: "Grant and revoke roles, deactivate users"},
+		{Action: "manage_permissions", MinWeight: 1000, RequireAccess: &_true, Description: "Change permission weights"},
+		{Action: "view_audit_log", MinWeight: 1000, RequireAccess: &_false, Description: "View, verify and export the audit logs"},
+	}
+
+	DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "action"}},
+		DoNothing: true,
+	}).Create(&permissions)
 }
@@ -0,0 +1,196 @@
+package interfaces
+
+import (
+	"auth/config"
+	"auth/controllers"
+	"auth/models"
+	"auth/types"
+	"auth/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrTooManyAttempts = errors.New("Too many failed attempts. Please try again later.")
+
+func failedAccessAttempts(tx *gorm.DB, tgID int) (int64, error) {
+	var count int64
+	err := tx.Model(&models.AccessAttempt{}).
+		Where("tg_id = ? AND (success IS NULL OR success = false) AND created_at > ?", tgID, time.Now().Add(-config.AccessThrottleWindow)).
+		Count(&count).Error
+	return count, err
+}
+
+func CreateAccessChallenge(_data []byte) (int, interface{}, string, error) {
+	var payload types.CreateAccessChallengeType
+
+	if err := utils.Parse(_data, &payload); err != nil {
+		return http.StatusBadRequest, nil, "", err
+	}
+
+	failed, err := failedAccessAttempts(controllers.DB, *payload.TgID)
+	if err != nil {
+		return http.StatusInternalServerError, nil, "", err
+	}
+	if failed >= config.AccessMaxFailedAttempts {
+		return http.StatusTooManyRequests, nil, "", ErrTooManyAttempts
+	}
+
+	var user models.User
+	if err := controllers.DB.Model(&models.User{}).
+		Joins("JOIN auth_user_telegram telegram ON telegram.user_id = auth_users.id").
+		Where("telegram.tg_id = ? AND (auth_users.active IS NULL OR auth_users.active = true)", *payload.TgID).
+		First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return http.StatusNotFound, nil, "", errors.New("User not found")
+		}
+		return http.StatusInternalServerError, nil, "", err
+	}
+
+	var wordsCount int64
+	if err := controllers.DB.Model(&models.MnemonicWord{}).
+		Joins("JOIN auth_user_mnemonics mnemonic ON mnemonic.id = auth_user_mnemonic_words.mnemonic_id").
+		Where("mnemonic.user_id = ?", user.ID).
+		Count(&wordsCount).Error; err != nil {
+		return http.StatusInternalServerError, nil, "", err
+	}
+	if wordsCount == 0 {
+		return http.StatusNotFound, nil, "", errors.New("Mnemonic not found")
+	}
+
+	indexes, err := utils.RandomIndexes(config.AccessChallengeWords, int(wordsCount))
+	if err != nil {
+		return http.StatusInternalServerError, nil, "", err
+	}
+	indexesJSON, err := json.Marshal(indexes)
+	if err != nil {
+		return http.StatusInternalServerError, nil, "", err
+	}
+
+	uid, err := utils.RandomToken(16)
+	if err != nil {
+		return http.StatusInternalServerError, nil, "", err
+	}
+
+	challenge := models.AccessChallenge{
+		Uid:       uid,
+		UserID:    &user.ID,
+		TgID:      payload.TgID,
+		Indexes:   indexesJSON,
+		ExpiresAt: time.Now().Add(config.AccessChallengeTTL),
+	}
+
+	if err := controllers.DB.Create(&challenge).Error; err != nil {
+		return http.StatusInternalServerError, nil, "", err
+	}
+
+	response := types.APIResponseAccessChallengeType{
+		ChallengeID: challenge.Uid,
+		Indexes:     indexes,
+		ExpiresAt:   challenge.ExpiresAt,
+	}
+
+	return http.StatusCreated, response, fmt.Sprintf("Please provide words from mnemonic phrase at indexes %v", indexes), nil
+}
+
+func VerifyAccessChallenge(_data []byte) (int, interface{}, string, error) {
+	var payload types.VerifyAccessChallengeType
+
+	if err := utils.Parse(_data, &payload); err != nil {
+		return http.StatusBadRequest, nil, "", err
+	}
+
+	var verified bool
+	var challenge models.AccessChallenge
+	if err := controllers.DB.Transaction(func(tx *gorm.DB) error {
+		// answers of one telegram account are verified one at a time, so concurrent guesses all see
+		// the attempts recorded before them
+		var telegram models.Telegram
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&telegram, "tg_id = ?", *payload.TgID).Error; err != nil {
+			return err
+		}
+
+		failed, err := failedAccessAttempts(tx, *payload.TgID)
+		if err != nil {
+			return err
+		}
+		if failed >= config.AccessMaxFailedAttempts {
+			return ErrTooManyAttempts
+		}
+
+		// a challenge can be answered only once
+		if err := tx.First(&challenge, "uid = ? AND tg_id = ? AND (used IS NULL OR used = false)", *payload.ChallengeID, *payload.TgID).Error; err != nil {
+			return err
+		}
+
+		_true := true
+		if err := tx.Model(&challenge).Update("used", &_true).Error; err != nil {
+			return err
+		}
+
+		if time.Now().After(challenge.ExpiresAt) {
+			return nil
+		}
+
+		var indexes []int
+		if err := json.Unmarshal(challenge.Indexes, &indexes); err != nil {
+			return err
+		}
+
+		if len(indexes) == len(payload.Words) {
+			var mnemonic models.Mnemonic
+			if err := tx.Preload("Words").First(&mnemonic, "user_id = ?", *challenge.UserID).Error; err != nil {
+				return err
+			}
+
+			provided := map[int]string{}
+			for _i, _index := range indexes {
+				provided[_index] = payload.Words[_i]
+			}
+			verified = verifyMnemonicWords(mnemonic.Words, provided)
+		}
+
+		attempt := models.AccessAttempt{
+			TgID:        payload.TgID,
+			ChallengeID: &challenge.ID,
+			Success:     &verified,
+		}
+		if err := tx.Create(&attempt).Error; err != nil {
+			return err
+		}
+
+		if verified {
+			access := models.Access{
+				UserID: challenge.UserID,
+			}
+			if err := tx.Create(&access).Error; err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}); err != nil {
+		if errors.Is(err, ErrTooManyAttempts) {
+			return http.StatusTooManyRequests, nil, "", err
+		}
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return http.StatusNotFound, nil, "", errors.New("Challenge not found or already used")
+		}
+		return http.StatusInternalServerError, nil, "", err
+	}
+
+	if time.Now().After(challenge.ExpiresAt) {
+		return http.StatusGone, nil, "", errors.New("Challenge expired. Please request access again.")
+	}
+
+	if !verified {
+		return http.StatusForbidden, nil, "", errors.New("Provided details are incorrect.")
+	}
+
+	return http.StatusCreated, nil, "Access created successfully.", nil
+}
@@ -0,0 +1,132 @@
+package interfaces
+
+import (
+	"auth/config"
+	"auth/controllers"
+	"auth/models"
+	"auth/types"
+	"auth/utils"
+	"net/http"
+	"testing"
+	"time"
+)
+
+var testMnemonic = []string{"abandon", "ability", "able"}
+
+// createMnemonic stores words as the mnemonic of userID, indexes start at 1
+func createMnemonic(t *testing.T, userID uint, words ...string) {
+	t.Helper()
+	mnemonic := models.Mnemonic{UserID: &userID}
+	for _i, _word := range words {
+		salt, hash, err := utils.HashMnemonicWord(_word)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mnemonic.Words = append(mnemonic.Words, models.MnemonicWord{Index: _i + 1, Salt: salt, Hash: hash})
+	}
+	if err := controllers.DB.Create(&mnemonic).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func createChallenge(t *testing.T, tgID int) types.APIResponseAccessChallengeType {
+	t.Helper()
+	code, response, err := call(t, CreateAccessChallenge, map[string]interface{}{"tg_id": tgID})
+	if code != http.StatusCreated {
+		t.Fatalf("create challenge: %d %v", code, err)
+	}
+	return response.(types.APIResponseAccessChallengeType)
+}
+
+// answerChallenge answers with the words at the asked indexes, or with a wrong word for each
+func answerChallenge(t *testing.T, tgID int, challenge types.APIResponseAccessChallengeType, correct bool) int {
+	t.Helper()
+	words := []string{}
+	for _, _index := range challenge.Indexes {
+		word := "zoo"
+		if correct {
+			word = " " + testMnemonic[_index-1] + " "
+		}
+		words = append(words, word)
+	}
+	code, _, _ := call(t, VerifyAccessChallenge, map[string]interface{}{"tg_id": tgID, "challenge_id": challenge.ChallengeID, "words": words})
+	return code
+}
+
+func TestAccessChallenge(t *testing.T) {
+	newTestDB(t)
+	createMnemonic(t, createUser(t, 1, false, "user"), testMnemonic...)
+
+	challenge := createChallenge(t, 1)
+	if len(challenge.Indexes) != config.AccessChallengeWords {
+		t.Fatalf("indexes: %v", challenge.Indexes)
+	}
+	if code := answerChallenge(t, 1, challenge, true); code != http.StatusCreated {
+		t.Fatalf("verify: %d", code)
+	}
+	var accesses int64
+	controllers.DB.Model(&models.Access{}).Count(&accesses)
+	if accesses != 1 {
+		t.Fatalf("%d accesses", accesses)
+	}
+
+	// a challenge is answered once, and only by the account it was given to
+	if code := answerChallenge(t, 1, challenge, true); code != http.StatusNotFound {
+		t.Fatalf("answered twice: %d", code)
+	}
+	createUser(t, 2, false, "user")
+	if code := answerChallenge(t, 2, createChallenge(t, 1), true); code != http.StatusNotFound {
+		t.Fatalf("answered by another account: %d", code)
+	}
+}
+
+func TestAccessChallengeExpiry(t *testing.T) {
+	newTestDB(t)
+	createMnemonic(t, createUser(t, 1, false, "user"), testMnemonic...)
+
+	challenge := createChallenge(t, 1)
+	controllers.DB.Model(&models.AccessChallenge{}).Where("uid = ?", challenge.ChallengeID).Update("expires_at", time.Now().Add(-time.Second))
+	if code := answerChallenge(t, 1, challenge, true); code != http.StatusGone {
+		t.Fatalf("expired challenge answered: %d", code)
+	}
+	// an expired challenge is spent all the same
+	if code := answerChallenge(t, 1, challenge, true); code != http.StatusNotFound {
+		t.Fatalf("expired challenge answered again: %d", code)
+	}
+	var accesses int64
+	controllers.DB.Model(&models.Access{}).Count(&accesses)
+	if accesses != 0 {
+		t.Fatalf("%d accesses", accesses)
+	}
+}
+
+func TestAccessChallengeThrottle(t *testing.T) {
+	newTestDB(t)
+	createMnemonic(t, createUser(t, 1, false, "user"), testMnemonic...)
+	createMnemonic(t, createUser(t, 2, false, "user"), testMnemonic...)
+
+	// a challenge handed out before the lock is refused after it as well
+	pending := createChallenge(t, 1)
+	for _i := int64(0); _i < config.AccessMaxFailedAttempts; _i++ {
+		if code := answerChallenge(t, 1, createChallenge(t, 1), false); code != http.StatusForbidden {
+			t.Fatalf("wrong answer %d: %d", _i, code)
+		}
+	}
+	if code, _, err := call(t, CreateAccessChallenge, map[string]interface{}{"tg_id": 1}); code != http.StatusTooManyRequests {
+		t.Fatalf("challenge after %d failures: %d %v", config.AccessMaxFailedAttempts, code, err)
+	}
+	if code := answerChallenge(t, 1, pending, true); code != http.StatusTooManyRequests {
+		t.Fatalf("answer after %d failures: %d", config.AccessMaxFailedAttempts, code)
+	}
+
+	// the lock is per telegram account
+	if code := answerChallenge(t, 2, createChallenge(t, 2), true); code != http.StatusCreated {
+		t.Fatalf("other account: %d", code)
+	}
+
+	// failures age out of the window
+	controllers.DB.Model(&models.AccessAttempt{}).Where("tg_id = ?", 1).Update("created_at", time.Now().Add(-config.AccessThrottleWindow-time.Minute))
+	if code := answerChallenge(t, 1, createChallenge(t, 1), true); code != http.StatusCreated {
+		t.Fatalf("after the window: %d", code)
+	}
+}
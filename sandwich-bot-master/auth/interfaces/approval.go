@@ -0,0 +1,553 @@
+package interfaces
+
+import (
+	"auth/config"
+	"auth/controllers"
+	"auth/models"
+	"auth/types"
+	"auth/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// Policy applied to actions without their own policy
+	DefaultQuorumAction = "default"
+	// Approved requests with this action change quorum policies
+	UpdateQuorumPolicyAction = "update_quorum_policy"
+	// Approved requests with this action grant, revoke, activate or deactivate an owner
+	ManageOwnersAction = "manage_owners"
+)
+
+// MinMultisigApprovals is the least number of owners that approve a multisig action, whatever its
+// policy says, so a single owner cannot move wallets or toggle the kill switch alone
+const MinMultisigApprovals = 2
+
+var multisigActions = map[string]bool{
+	"set_main_wallet":          true,
+	"set_withdrawal_wallet":    true,
+	"rotate_main_wallet":       true,
+	"rotate_withdrawal_wallet": true,
+	"set_kill_switch_on":       true,
+	"set_kill_switch_off":      true,
+	ManageOwnersAction:         true,
+	// lowering any policy is as sensitive as the actions it guards
+	UpdateQuorumPolicyAction: true,
+}
+
+// boundPayload lists the payload keys a request is approved for. They are required when the request
+// is created and have to match when it is consumed, owners never approve a blank cheque
+var boundPayload = map[string][]string{
+	"set_main_wallet":       {"address"},
+	"set_withdrawal_wallet": {"address"},
+	// change is grant, revoke, activate or deactivate
+	ManageOwnersAction:       {"target_user_id", "change"},
+	UpdateQuorumPolicyAction: {"action", "required"},
+	// one approval moves one sweep
+	"sweep_profit": {"sweep_id"},
+}
+
+var (
+	ErrApprovalRequestNotFound = errors.New("Approval request not found")
+	ErrApprovalNotPermitted    = errors.New("Owner role and active access are required to approve requests")
+	ErrApprovalClosed          = errors.New("Approval request is not pending anymore")
+	ErrQuorumUnreachable       = errors.New("Quorum cannot be reached with current number of owners")
+	ErrQuorumBelowMinimum      = fmt.Errorf("Multisig actions need at least %d approvals", MinMultisigApprovals)
+	ErrQuorumBelowOne          = errors.New("Every action needs at least one approval")
+	ErrApprovalPayloadMismatch = errors.New("Approval request was approved for a different payload")
+)
+
+// requiredApprovals raises the quorum of multisig actions to MinMultisigApprovals
+func requiredApprovals(action string, required int) int {
+	if multisigActions[action] && required < MinMultisigApprovals {
+		return MinMultisigApprovals
+	}
+	return required
+}
+
+// checkQuorumChange rejects a policy that drops below one approval, or below MinMultisigApprovals for
+// multisig actions
+func checkQuorumChange(change types.QuorumPolicyPayloadType) error {
+	if change.Action == nil || change.Required == nil {
+		return errors.New("action and required are required in the payload of " + UpdateQuorumPolicyAction)
+	}
+	if *change.Required < 1 {
+		return ErrQuorumBelowOne
+	}
+	if requiredApprovals(*change.Action, *change.Required) != *change.Required {
+		return ErrQuorumBelowMinimum
+	}
+	return nil
+}
+
+// checkBoundPayload makes sure every bound key of action is set in payload
+func checkBoundPayload(action string, payload map[string]interface{}) error {
+	for _, _key := range boundPayload[action] {
+		if value := payload[_key]; value == nil || fmt.Sprint(value) == "" {
+			return fmt.Errorf("%s is required in the payload of %s", _key, action)
+		}
+	}
+	return nil
+}
+
+// matchBoundPayload compares the bound keys of an approved request with the values it is consumed for
+func matchBoundPayload(request *models.ApprovalRequest, payload map[string]interface{}) error {
+	keys := boundPayload[request.Action]
+	if len(keys) == 0 {
+		return nil
+	}
+
+	var approved map[string]interface{}
+	if err := json.Unmarshal(request.Payload, &approved); err != nil {
+		return err
+	}
+	for _, _key := range keys {
+		if approved[_key] == nil || payload[_key] == nil || !strings.EqualFold(fmt.Sprint(approved[_key]), fmt.Sprint(payload[_key])) {
+			return ErrApprovalPayloadMismatch
+		}
+	}
+	return nil
+}
+
+func retrieveQuorumPolicy(tx *gorm.DB, action string) (*models.QuorumPolicy, error) {
+	var policies []models.QuorumPolicy
+	if err := tx.Where("action IN ? AND (active IS NULL OR active = true)", []string{action, DefaultQuorumAction}).Find(&policies).Error; err != nil {
+		return nil, err
+	}
+
+	var policy *models.QuorumPolicy
+	for _i := range policies {
+		if policies[_i].Action == action || policy == nil {
+			policy = &policies[_i]
+		}
+	}
+	if policy == nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return policy, nil
+}
+
+// ownersQuery selects active users holding roleTitle
+func ownersQuery(tx *gorm.DB, roleTitle string) *gorm.DB {
+	return tx.Model(&models.User{}).
+		Joins("JOIN auth_user_role_connection ON auth_user_role_connection.user_id = auth_users.id").
+		Joins("JOIN auth_user_roles ON auth_user_roles.id = auth_user_role_connection.role_id AND auth_user_roles.title = ?", roleTitle).
+		Where("auth_users.active IS NULL OR auth_users.active = true")
+}
+
+// withAccess narrows ownersQuery to users who passed getAccess recently
+func withAccess(tx *gorm.DB) *gorm.DB {
+	return tx.Where("EXISTS (SELECT 1 FROM auth_user_access WHERE auth_user_access.user_id = auth_users.id AND auth_user_access.created_at > ?)", time.Now().Add(-config.AccessTTL))
+}
+
+func isApprover(tx *gorm.DB, userID uint, roleTitle string) (bool, error) {
+	var count int64
+	if err := withAccess(ownersQuery(tx, roleTitle)).Where("auth_users.id = ?", userID).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// expireApprovalRequest flips open requests past their deadline
+func expireApprovalRequest(tx *gorm.DB, request *models.ApprovalRequest) error {
+	if request.Status != models.ApprovalPending && request.Status != models.ApprovalApproved {
+		return nil
+	}
+	if time.Now().Before(request.ExpiresAt) {
+		return nil
+	}
+	request.Status = models.ApprovalExpired
+	return tx.Model(request).Update("status", models.ApprovalExpired).Error
+}
+
+func RetrieveQuorumPolicy(_data []byte) (int, interface{}, string, error) {
+	var payload types.RetrieveQuorumPolicyType
+
+	if err := utils.Parse(_data, &payload); err != nil {
+		return http.StatusBadRequest, nil, "", err
+	}
+
+	query := controllers.DB.Model(&models.QuorumPolicy{})
+	if payload.Action != nil {
+		query = query.Where("action = ?", *payload.Action)
+	}
+
+	var policies []models.QuorumPolicy
+	if err := query.Order("action").Find(&policies).Error; err != nil {
+		return http.StatusInternalServerError, nil, "", err
+	}
+
+	return http.StatusOK, policies, "", nil
+}
+
+func UpdateQuorumPolicy(_data []byte) (int, interface{}, string, error) {
+	var payload types.UpdateQuorumPolicyType
+
+	if err := utils.Parse(_data, &payload); err != nil {
+		return http.StatusBadRequest, nil, "", err
+	}
+
+	var policy models.QuorumPolicy
+	code, err := consumeApprovalRequest(*payload.UserID, *payload.RequestID, UpdateQuorumPolicyAction, func(tx *gorm.DB, request *models.ApprovalRequest) error {
+		var change types.QuorumPolicyPayloadType
+		if err := json.Unmarshal(request.Payload, &change); err != nil {
+			return err
+		}
+		if err := checkQuorumChange(change); err != nil {
+			return err
+		}
+
+		var owners int64
+		if err := ownersQuery(tx, "owner").Count(&owners).Error; err != nil {
+			return err
+		}
+		if int64(*change.Required) > owners {
+			return ErrQuorumUnreachable
+		}
+
+		_true := true
+		policy = models.QuorumPolicy{
+			Action:    *change.Action,
+			Required:  *change.Required,
+			RoleTitle: "owner",
+			UpdatedBy: payload.UserID,
+			Active:    models.Active{Active: &_true},
+		}
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "action"}},
+			DoUpdates: clause.AssignmentColumns([]string{"required", "updated_by", "active", "updated_at"}),
+		}).Create(&policy).Error
+	})
+	if err != nil {
+		if errors.Is(err, ErrQuorumUnreachable) || errors.Is(err, ErrQuorumBelowMinimum) || errors.Is(err, ErrQuorumBelowOne) {
+			return http.StatusConflict, nil, "", err
+		}
+		return code, nil, "", err
+	}
+
+	return http.StatusOK, policy, fmt.Sprintf("Quorum for %s is set to %d.", policy.Action, policy.Required), nil
+}
+
+func CreateApprovalRequest(_data []byte) (int, interface{}, string, error) {
+	var payload types.CreateApprovalRequestType
+
+	if err := utils.Parse(_data, &payload); err != nil {
+		return http.StatusBadRequest, nil, "", err
+	}
+
+	if err := checkBoundPayload(*payload.Action, payload.Payload); err != nil {
+		return http.StatusBadRequest, nil, "", err
+	}
+
+	requestPayload, err := json.Marshal(payload.Payload)
+	if err != nil {
+		return http.StatusBadRequest, nil, "", err
+	}
+
+	// owners are not asked to approve a policy that could never be applied
+	if *payload.Action == UpdateQuorumPolicyAction {
+		var change types.QuorumPolicyPayloadType
+		if err := json.Unmarshal(requestPayload, &change); err != nil {
+			return http.StatusBadRequest, nil, "", err
+		}
+		if err := checkQuorumChange(change); err != nil {
+			return http.StatusBadRequest, nil, "", err
+		}
+	}
+
+	var request models.ApprovalRequest
+	if err := controllers.DB.Transaction(func(tx *gorm.DB) error {
+		policy, err := retrieveQuorumPolicy(tx, *payload.Action)
+		if err != nil {
+			return err
+		}
+
+		permitted, err := isApprover(tx, *payload.UserID, policy.RoleTitle)
+		if err != nil {
+			return err
+		}
+		if !permitted {
+			return ErrApprovalNotPermitted
+		}
+
+		var owners int64
+		if err := ownersQuery(tx, policy.RoleTitle).Count(&owners).Error; err != nil {
+			return err
+		}
+		excludeRequester := policy.ExcludeRequester != nil && *policy.ExcludeRequester
+		if excludeRequester {
+			owners--
+		}
+		required := requiredApprovals(*payload.Action, policy.Required)
+		if int64(required) > owners {
+			return ErrQuorumUnreachable
+		}
+
+		uid, err := utils.RandomToken(16)
+		if err != nil {
+			return err
+		}
+
+		// the requester approves their own request
+		_true := true
+		request = models.ApprovalRequest{
+			Uid:              "apr-" + uid,
+			Action:           *payload.Action,
+			Payload:          requestPayload,
+			RequestedBy:      payload.UserID,
+			RequestedTg:      payload.TgID,
+			Required:         required,
+			ExcludeRequester: excludeRequester,
+			Status:           models.ApprovalPending,
+			ExpiresAt:        time.Now().Add(config.ApprovalRequestTTL),
+			Approvals: []models.Approval{
+				{UserID: payload.UserID, TgID: payload.TgID, Approved: &_true},
+			},
+		}
+		if request.Required <= 1 && !request.ExcludeRequester {
+			request.Status = models.ApprovalApproved
+		}
+
+		return tx.Create(&request).Error
+	}); err != nil {
+		switch {
+		case errors.Is(err, ErrApprovalNotPermitted):
+			return http.StatusForbidden, nil, "", err
+		case errors.Is(err, ErrQuorumUnreachable):
+			return http.StatusConflict, nil, "", err
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return http.StatusNotFound, nil, "", errors.New("Quorum policy not found")
+		}
+		return http.StatusInternalServerError, nil, "", err
+	}
+
+	collected := len(request.Approvals)
+	if request.ExcludeRequester {
+		collected = 0
+	}
+	return http.StatusCreated, request, fmt.Sprintf("Approval request %s created, %d of %d approvals collected.", request.Uid, collected, request.Required), nil
+}
+
+func RetrieveApprovalRequest(_data []byte) (int, interface{}, string, error) {
+	var payload types.RetrieveApprovalRequestType
+
+	if err := utils.Parse(_data, &payload); err != nil {
+		return http.StatusBadRequest, nil, "", err
+	}
+
+	var request models.ApprovalRequest
+	if err := controllers.DB.Preload("Approvals").First(&request, "uid = ?", *payload.RequestID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return http.StatusNotFound, nil, "", ErrApprovalRequestNotFound
+		}
+		return http.StatusInternalServerError, nil, "", err
+	}
+
+	if err := expireApprovalRequest(controllers.DB, &request); err != nil {
+		return http.StatusInternalServerError, nil, "", err
+	}
+
+	return http.StatusOK, request, "", nil
+}
+
+func ApproveRequest(_data []byte) (int, interface{}, string, error) {
+	return decideApprovalRequest(_data, true)
+}
+
+func RejectRequest(_data []byte) (int, interface{}, string, error) {
+	return decideApprovalRequest(_data, false)
+}
+
+// decideApprovalRequest records a single owner decision. One rejection closes the request.
+func decideApprovalRequest(_data []byte, approved bool) (int, interface{}, string, error) {
+	var payload types.DecideApprovalRequestType
+
+	if err := utils.Parse(_data, &payload); err != nil {
+		return http.StatusBadRequest, nil, "", err
+	}
+
+	var request models.ApprovalRequest
+	expired := false
+	if err := controllers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&request, "uid = ?", *payload.RequestID).Error; err != nil {
+			return err
+		}
+
+		if err := expireApprovalRequest(tx, &request); err != nil {
+			return err
+		}
+		// the expiry is kept, refusing the decision would roll it back
+		if request.Status == models.ApprovalExpired {
+			expired = true
+			return nil
+		}
+		if request.Status != models.ApprovalPending {
+			return ErrApprovalClosed
+		}
+
+		policy, err := retrieveQuorumPolicy(tx, request.Action)
+		if err != nil {
+			return err
+		}
+		permitted, err := isApprover(tx, *payload.UserID, policy.RoleTitle)
+		if err != nil {
+			return err
+		}
+		if !permitted {
+			return ErrApprovalNotPermitted
+		}
+
+		approval := models.Approval{
+			ApprovalRequestID: &request.ID,
+			UserID:            payload.UserID,
+			TgID:              payload.TgID,
+			Approved:          &approved,
+		}
+		// each owner decides once
+		if result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&approval); result.Error != nil {
+			return result.Error
+		} else if result.RowsAffected == 0 {
+			return errors.New("You have already decided on this request")
+		}
+
+		if !approved {
+			request.Status = models.ApprovalRejected
+			return tx.Model(&request).Update("status", request.Status).Error
+		}
+
+		approvalsQuery := tx.Model(&models.Approval{}).Where("approval_request_id = ? AND approved = true", request.ID)
+		if request.ExcludeRequester {
+			approvalsQuery = approvalsQuery.Where("user_id <> ?", *request.RequestedBy)
+		}
+		var approvals int64
+		if err := approvalsQuery.Count(&approvals).Error; err != nil {
+			return err
+		}
+		if approvals >= int64(request.Required) {
+			request.Status = models.ApprovalApproved
+			return tx.Model(&request).Update("status", request.Status).Error
+		}
+
+		return nil
+	}); err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return http.StatusNotFound, nil, "", ErrApprovalRequestNotFound
+		case errors.Is(err, ErrApprovalNotPermitted):
+			return http.StatusForbidden, nil, "", err
+		case errors.Is(err, ErrApprovalClosed):
+			return http.StatusGone, nil, "", err
+		}
+		return http.StatusConflict, nil, "", err
+	}
+
+	if expired {
+		return http.StatusGone, nil, "", ErrApprovalClosed
+	}
+
+	if err := controllers.DB.Preload("Approvals").First(&request, request.ID).Error; err != nil {
+		return http.StatusInternalServerError, nil, "", err
+	}
+
+	return http.StatusOK, request, fmt.Sprintf("Approval request %s is %s.", request.Uid, request.Status), nil
+}
+
+func ConsumeApprovalRequest(_data []byte) (int, interface{}, string, error) {
+	var payload types.ConsumeApprovalRequestType
+
+	if err := utils.Parse(_data, &payload); err != nil {
+		return http.StatusBadRequest, nil, "", err
+	}
+
+	var consumed models.ApprovalRequest
+	code, err := consumeApprovalRequest(*payload.UserID, *payload.RequestID, *payload.Action, func(tx *gorm.DB, request *models.ApprovalRequest) error {
+		if err := matchBoundPayload(request, payload.Payload); err != nil {
+			return err
+		}
+		// the consumer learns who approved, e.g. the bot records the owner who confirmed a sweep
+		if err := tx.Find(&request.Approvals, "approval_request_id = ?", request.ID).Error; err != nil {
+			return err
+		}
+		consumed = *request
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, ErrApprovalPayloadMismatch) {
+			return http.StatusConflict, nil, "", err
+		}
+		return code, nil, "", err
+	}
+
+	return http.StatusOK, consumed, "Approval request consumed.", nil
+}
+
+// CancelApprovalRequests closes every pending and approved request when the kill switch is turned on,
+// requests to turn it off again stay open
+func CancelApprovalRequests(_data []byte) (int, interface{}, string, error) {
+	var payload types.CancelApprovalRequestsType
+
+	if err := utils.Parse(_data, &payload); err != nil {
+		return http.StatusBadRequest, nil, "", err
+	}
+
+	result := controllers.DB.Model(&models.ApprovalRequest{}).
+		Where("status IN ? AND action <> ?", []models.ApprovalStatusType{models.ApprovalPending, models.ApprovalApproved}, "set_kill_switch_off").
+		Update("status", models.ApprovalCancelled)
+	if result.Error != nil {
+		return http.StatusInternalServerError, nil, "", result.Error
+	}
+
+	return http.StatusOK, map[string]interface{}{"cancelled": result.RowsAffected}, fmt.Sprintf("%d approval requests cancelled: %s.", result.RowsAffected, *payload.Reason), nil
+}
+
+// consumeApprovalRequest marks an approved request as used by its requester and runs apply in the same transaction
+func consumeApprovalRequest(userID uint, uid, action string, apply func(tx *gorm.DB, request *models.ApprovalRequest) error) (int, error) {
+	var request models.ApprovalRequest
+	expired := false
+	if err := controllers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&request, "uid = ? AND action = ? AND requested_by = ?", uid, action, userID).Error; err != nil {
+			return err
+		}
+
+		if time.Now().After(request.ExpiresAt) && request.Status == models.ApprovalApproved {
+			expired = true
+			return nil
+		}
+		if request.Status != models.ApprovalApproved {
+			return ErrApprovalClosed
+		}
+
+		now := time.Now()
+		request.Status = models.ApprovalConsumed
+		request.ConsumedAt = &now
+		if err := tx.Model(&request).Updates(map[string]interface{}{"status": request.Status, "consumed_at": request.ConsumedAt}).Error; err != nil {
+			return err
+		}
+
+		return apply(tx, &request)
+	}); err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return http.StatusNotFound, ErrApprovalRequestNotFound
+		case errors.Is(err, ErrApprovalClosed):
+			return http.StatusConflict, errors.New("Approval request is not approved or already used")
+		}
+		return http.StatusInternalServerError, err
+	}
+
+	if expired {
+		if err := expireApprovalRequest(controllers.DB, &request); err != nil {
+			return http.StatusInternalServerError, err
+		}
+		return http.StatusGone, errors.New("Approval request expired")
+	}
+
+	return http.StatusOK, nil
+}
@@ -0,0 +1,211 @@
+package interfaces
+
+import (
+	"auth/controllers"
+	"auth/models"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// createRequest opens an approval request of userID and returns its uid
+func createRequest(t *testing.T, userID uint, action string, payload map[string]interface{}) (string, models.ApprovalRequest) {
+	t.Helper()
+	code, response, err := call(t, CreateApprovalRequest, map[string]interface{}{"user_id": userID, "action": action, "payload": payload})
+	if err != nil || code != http.StatusCreated {
+		t.Fatalf("create %s: %d %v", action, code, err)
+	}
+	request := response.(models.ApprovalRequest)
+	return request.Uid, request
+}
+
+func policyRequired(t *testing.T, action string) int {
+	t.Helper()
+	var policy models.QuorumPolicy
+	if err := controllers.DB.First(&policy, "action = ?", action).Error; err != nil {
+		t.Fatal(err)
+	}
+	return policy.Required
+}
+
+func TestSingleOwnerCannotLowerQuorum(t *testing.T) {
+	newTestDB(t)
+	first := createUser(t, 1, true, "owner")
+	second := createUser(t, 2, true, "owner")
+	controllers.DB.Model(&models.QuorumPolicy{}).Where("action = ?", DefaultQuorumAction).Update("required", 2)
+	// databases seeded before update_quorum_policy became a multisig action hold it at one
+	controllers.DB.Model(&models.QuorumPolicy{}).Where("action = ?", UpdateQuorumPolicyAction).Update("required", 1)
+
+	uid, request := createRequest(t, first, UpdateQuorumPolicyAction, map[string]interface{}{"action": DefaultQuorumAction, "required": 1})
+	if request.Required != MinMultisigApprovals || request.Status != models.ApprovalPending {
+		t.Fatalf("request: required %d, %s", request.Required, request.Status)
+	}
+	if code, _, err := call(t, UpdateQuorumPolicy, map[string]interface{}{"user_id": first, "request_id": uid}); code != http.StatusConflict {
+		t.Fatalf("applied without a second owner: %d %v", code, err)
+	}
+	if required := policyRequired(t, DefaultQuorumAction); required != 2 {
+		t.Fatalf("default quorum changed to %d", required)
+	}
+
+	// a second owner makes it
+	if code, _, err := call(t, ApproveRequest, map[string]interface{}{"user_id": second, "request_id": uid}); code != http.StatusOK {
+		t.Fatalf("approve: %d %v", code, err)
+	}
+	if code, _, err := call(t, UpdateQuorumPolicy, map[string]interface{}{"user_id": first, "request_id": uid}); code != http.StatusOK {
+		t.Fatalf("update: %d %v", code, err)
+	}
+	if required := policyRequired(t, DefaultQuorumAction); required != 1 {
+		t.Fatalf("default quorum is %d", required)
+	}
+}
+
+func TestQuorumPolicyFloor(t *testing.T) {
+	newTestDB(t)
+	first := createUser(t, 1, true, "owner")
+
+	tests := []struct {
+		action   string
+		required interface{}
+		err      error
+	}{
+		{"sweep_profit", 0, ErrQuorumBelowOne},
+		{DefaultQuorumAction, -1, ErrQuorumBelowOne},
+		{"set_kill_switch_on", 1, ErrQuorumBelowMinimum},
+		{UpdateQuorumPolicyAction, 1, ErrQuorumBelowMinimum},
+	}
+	for _, _test := range tests {
+		code, _, err := call(t, CreateApprovalRequest, map[string]interface{}{
+			"user_id": first, "action": UpdateQuorumPolicyAction, "payload": map[string]interface{}{"action": _test.action, "required": _test.required},
+		})
+		if code != http.StatusBadRequest || !errors.Is(err, _test.err) {
+			t.Fatalf("%s at %v: %d %v", _test.action, _test.required, code, err)
+		}
+	}
+
+	// a request approved before the floor was checked on creation is still refused when applied
+	controllers.DB.Create(&models.ApprovalRequest{
+		Uid: "apr-zero", Action: UpdateQuorumPolicyAction, Payload: []byte(`{"action":"sweep_profit","required":0}`),
+		RequestedBy: &first, Required: 2, Status: models.ApprovalApproved, ExpiresAt: time.Now().Add(time.Minute),
+	})
+	if code, _, err := call(t, UpdateQuorumPolicy, map[string]interface{}{"user_id": first, "request_id": "apr-zero"}); code != http.StatusConflict || !errors.Is(err, ErrQuorumBelowOne) {
+		t.Fatalf("applied a zero quorum: %d %v", code, err)
+	}
+	if required := policyRequired(t, "sweep_profit"); required != 1 {
+		t.Fatalf("sweep_profit quorum is %d", required)
+	}
+}
+
+func TestManageOwnersNeedsQuorum(t *testing.T) {
+	newTestDB(t)
+	owner := createUser(t, 1, true, "owner")
+	guest := createUser(t, 2, true, "guest")
+
+	// a single owner cannot appoint the next one
+	code, _, err := call(t, CreateApprovalRequest, map[string]interface{}{
+		"user_id": owner, "action": ManageOwnersAction, "payload": map[string]interface{}{"target_user_id": guest, "change": "grant"},
+	})
+	if code != http.StatusConflict || !errors.Is(err, ErrQuorumUnreachable) {
+		t.Fatalf("one owner: %d %v", code, err)
+	}
+
+	// nor does a deactivated owner count towards the quorum
+	inactive := createUser(t, 3, true, "owner")
+	controllers.DB.Model(&models.User{}).Where("id = ?", inactive).Update("active", false)
+	code, _, err = call(t, CreateApprovalRequest, map[string]interface{}{
+		"user_id": owner, "action": ManageOwnersAction, "payload": map[string]interface{}{"target_user_id": guest, "change": "grant"},
+	})
+	if code != http.StatusConflict || !errors.Is(err, ErrQuorumUnreachable) {
+		t.Fatalf("one active owner: %d %v", code, err)
+	}
+}
+
+func TestDeactivatedOwnerCannotApprove(t *testing.T) {
+	newTestDB(t)
+	first := createUser(t, 1, true, "owner")
+	second := createUser(t, 2, true, "owner")
+	third := createUser(t, 3, true, "owner")
+	uid, _ := createRequest(t, first, "set_kill_switch_on", nil)
+
+	controllers.DB.Model(&models.User{}).Where("id = ?", third).Update("active", false)
+	if code, _, err := call(t, ApproveRequest, map[string]interface{}{"user_id": third, "request_id": uid}); code != http.StatusForbidden || !errors.Is(err, ErrApprovalNotPermitted) {
+		t.Fatalf("deactivated owner approved: %d %v", code, err)
+	}
+	// neither does an owner whose access ran out
+	controllers.DB.Model(&models.Access{}).Where("user_id = ?", second).Update("created_at", time.Now().Add(-2*time.Hour))
+	if code, _, err := call(t, ApproveRequest, map[string]interface{}{"user_id": second, "request_id": uid}); code != http.StatusForbidden {
+		t.Fatalf("owner without access approved: %d %v", code, err)
+	}
+
+	var request models.ApprovalRequest
+	controllers.DB.First(&request, "uid = ?", uid)
+	if request.Status != models.ApprovalPending {
+		t.Fatalf("request is %s", request.Status)
+	}
+}
+
+func TestApprovalRequestExpiry(t *testing.T) {
+	newTestDB(t)
+	first := createUser(t, 1, true, "owner")
+	second := createUser(t, 2, true, "owner")
+	pending, _ := createRequest(t, first, "set_kill_switch_on", nil)
+	approved, _ := createRequest(t, first, "set_kill_switch_off", nil)
+	if code, _, err := call(t, ApproveRequest, map[string]interface{}{"user_id": second, "request_id": approved}); code != http.StatusOK {
+		t.Fatalf("approve: %d %v", code, err)
+	}
+	controllers.DB.Model(&models.ApprovalRequest{}).Where("uid IN ?", []string{pending, approved}).Update("expires_at", time.Now().Add(-time.Second))
+
+	if code, _, err := call(t, ApproveRequest, map[string]interface{}{"user_id": second, "request_id": pending}); code != http.StatusGone || !errors.Is(err, ErrApprovalClosed) {
+		t.Fatalf("approved an expired request: %d %v", code, err)
+	}
+	payload := map[string]interface{}{"user_id": first, "request_id": approved, "action": "set_kill_switch_off"}
+	if code, _, err := call(t, ConsumeApprovalRequest, payload); code != http.StatusGone {
+		t.Fatalf("consumed an expired request: %d %v", code, err)
+	}
+
+	var requests []models.ApprovalRequest
+	controllers.DB.Order("id").Find(&requests)
+	for _, _request := range requests {
+		if _request.Status != models.ApprovalExpired {
+			t.Fatalf("request %s is %s", _request.Uid, _request.Status)
+		}
+	}
+}
+
+func TestSweepApprovalBoundToSweep(t *testing.T) {
+	newTestDB(t)
+	requester := createUser(t, 1, true, "owner")
+	approver := createUser(t, 2, true, "owner")
+
+	if code, _, err := call(t, CreateApprovalRequest, map[string]interface{}{"user_id": requester, "action": "sweep_profit"}); code != http.StatusBadRequest {
+		t.Fatalf("created an unbound sweep approval: %d %v", code, err)
+	}
+	uid, request := createRequest(t, requester, "sweep_profit", map[string]interface{}{"sweep_id": "swp-1"})
+	if request.Status != models.ApprovalPending {
+		t.Fatalf("requester approved their own sweep: %s", request.Status)
+	}
+	if code, _, err := call(t, ApproveRequest, map[string]interface{}{"user_id": approver, "request_id": uid}); code != http.StatusOK {
+		t.Fatalf("approve: %d %v", code, err)
+	}
+
+	consume := func(payload map[string]interface{}) (int, interface{}, error) {
+		return call(t, ConsumeApprovalRequest, map[string]interface{}{"user_id": requester, "request_id": uid, "action": "sweep_profit", "payload": payload})
+	}
+	for _, _payload := range []map[string]interface{}{nil, {"sweep_id": "swp-2"}} {
+		if code, _, err := consume(_payload); code != http.StatusConflict || !errors.Is(err, ErrApprovalPayloadMismatch) {
+			t.Fatalf("consumed for %v: %d %v", _payload, code, err)
+		}
+	}
+
+	code, response, err := consume(map[string]interface{}{"sweep_id": "swp-1"})
+	if code != http.StatusOK {
+		t.Fatalf("consume: %d %v", code, err)
+	}
+	consumed := response.(models.ApprovalRequest)
+	if len(consumed.Approvals) != 2 {
+		t.Fatalf("approvals: %+v", consumed.Approvals)
+	}
+	if code, _, _ := consume(map[string]interface{}{"sweep_id": "swp-1"}); code != http.StatusConflict {
+		t.Fatalf("consumed twice: %d", code)
+	}
+}
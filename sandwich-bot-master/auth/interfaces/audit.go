@@ -0,0 +1,104 @@
+package interfaces
+
+import (
+	"auth/controllers"
+	"auth/models"
+	"auth/types"
+	"auth/utils"
+	"common/audit"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	ViewAuditLogAction = "view_audit_log"
+	// rows of one CSV export, newest first
+	auditExportLimit = 10000
+)
+
+func auditQuery(payload types.RetrieveAuditLogType) *gorm.DB {
+	query := controllers.DB.Model(&models.AuditEntry{})
+	if payload.AuditUserID != nil {
+		query = query.Where("user_id = ?", *payload.AuditUserID)
+	}
+	if payload.Action != nil && *payload.Action != "" {
+		query = query.Where("action = ?", *payload.Action)
+	}
+	return query
+}
+
+// parseAuditRequest binds an audit log request of a user allowed to read it
+func parseAuditRequest(_data []byte) (types.RetrieveAuditLogType, int, error) {
+	var payload types.RetrieveAuditLogType
+
+	if err := utils.Parse(_data, &payload); err != nil {
+		return payload, http.StatusBadRequest, err
+	}
+
+	if err := requirePermission(controllers.DB, *payload.UserID, ViewAuditLogAction); err != nil {
+		if errors.Is(err, ErrPermissionDenied) || errors.Is(err, gorm.ErrRecordNotFound) {
+			return payload, http.StatusForbidden, ErrPermissionDenied
+		}
+		return payload, http.StatusInternalServerError, err
+	}
+	return payload, http.StatusOK, nil
+}
+
+// RetrieveAuditLog lists audit entries newest first, filtered by audit_user_id and action
+func RetrieveAuditLog(_data []byte) (int, interface{}, string, error) {
+	payload, code, err := parseAuditRequest(_data)
+	if err != nil {
+		return code, nil, "", err
+	}
+
+	var entries []models.AuditEntry
+	if err := auditQuery(payload).Order("id DESC").Limit(payload.Limit).Offset(payload.Offset).Find(&entries).Error; err != nil {
+		return http.StatusInternalServerError, nil, "", err
+	}
+
+	return http.StatusOK, entries, "", nil
+}
+
+func VerifyAuditLog(_data []byte) (int, interface{}, string, error) {
+	if _, code, err := parseAuditRequest(_data); err != nil {
+		return code, nil, "", err
+	}
+
+	verification, err := controllers.VerifyAuditLog()
+	if err != nil {
+		return http.StatusInternalServerError, nil, "", err
+	}
+
+	return http.StatusOK, verification, "", nil
+}
+
+// ExportAuditLog answers with the filtered audit entries as CSV, oldest first
+func ExportAuditLog(_data []byte) (int, interface{}, string, error) {
+	payload, code, err := parseAuditRequest(_data)
+	if err != nil {
+		return code, nil, "", err
+	}
+
+	var entries []audit.Entry
+	if err := auditQuery(payload).Order("id DESC").Limit(auditExportLimit).Find(&entries).Error; err != nil {
+		return http.StatusInternalServerError, nil, "", err
+	}
+	for _i, _j := 0, len(entries)-1; _i < _j; _i, _j = _i+1, _j-1 {
+		entries[_i], entries[_j] = entries[_j], entries[_i]
+	}
+
+	content, err := audit.CSV(entries)
+	if err != nil {
+		return http.StatusInternalServerError, nil, "", err
+	}
+
+	return http.StatusOK, &utils.File{
+		Name:        fmt.Sprintf("auth_audit_log_%s.csv", time.Now().UTC().Format("20060102T150405Z")),
+		ContentType: "text/csv",
+		Content:     content,
+	}, "", nil
+}
@@ -0,0 +1,73 @@
+package interfaces
+
+import (
+	"auth/controllers"
+	"auth/models"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestDB points controllers.DB at a migrated and seeded in-memory database for the duration of the test
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := fmt.Sprintf("file:%s?mode=memory&cache=shared", strings.ReplaceAll(t.Name(), "/", "_"))
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// one connection keeps the shared in-memory database alive and serializes writers
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(controllers.Models...); err != nil {
+		t.Fatal(err)
+	}
+
+	previous := controllers.DB
+	controllers.DB = db
+	t.Cleanup(func() {
+		controllers.DB = previous
+		sqlDB.Close()
+	})
+	controllers.Seed()
+	return db
+}
+
+// createUser stores a user with a telegram id and roles, access grants a fresh getAccess
+func createUser(t *testing.T, tgID int, access bool, roles ...string) uint {
+	t.Helper()
+	user := models.User{Telegram: []models.Telegram{{TgID: &tgID}}}
+	if len(roles) > 0 {
+		if err := controllers.DB.Find(&user.Role, "title IN ?", roles).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := controllers.DB.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	if access {
+		if err := controllers.DB.Create(&models.Access{UserID: &user.ID}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	return user.ID
+}
+
+// call runs a handler with payload encoded the way the gin Wrapper passes it
+func call(t *testing.T, handler func([]byte) (int, interface{}, string, error), payload map[string]interface{}) (int, interface{}, error) {
+	t.Helper()
+	data, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, response, _, err := handler(data)
+	return code, response, err
+}
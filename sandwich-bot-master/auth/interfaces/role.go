@@ -0,0 +1,461 @@
+package interfaces
+
+import (
+	"auth/config"
+	"auth/controllers"
+	"auth/models"
+	"auth/types"
+	"auth/utils"
+	"common/audit"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	ManageRolesAction       = "manage_roles"
+	ManagePermissionsAction = "manage_permissions"
+	// Audit log action of an owner appointed through BOOTSTRAP_OWNERS
+	BootstrapOwnerAction = "bootstrap_owner"
+)
+
+var (
+	ErrPermissionDenied  = errors.New("Action not permitted")
+	ErrLastOwners        = errors.New("Change would leave fewer owners than required by quorum policies")
+	ErrOwnerUnapproved   = fmt.Errorf("Owner changes need an approved %s request", ManageOwnersAction)
+	errUserOrRoleMissing = errors.New("User or role not found")
+)
+
+// hasOwnerRole tells whether userID holds the owner role, active or not
+func hasOwnerRole(tx *gorm.DB, userID uint) (bool, error) {
+	var count int64
+	err := tx.Table("auth_user_role_connection").
+		Joins("JOIN auth_user_roles ON auth_user_roles.id = auth_user_role_connection.role_id AND auth_user_roles.title = ?", "owner").
+		Where("auth_user_role_connection.user_id = ?", userID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// bootstrapOwner appoints the founding owners, nobody holds the role to approve them yet. Until
+// MinMultisigApprovals users hold the owner role, a user registering with a telegram id listed in
+// BOOTSTRAP_OWNERS is granted it. From then on owners only change through manage_owners requests
+func bootstrapOwner(tx *gorm.DB, user *models.User, tgID int) error {
+	if !config.BootstrapOwners[tgID] {
+		return nil
+	}
+
+	var owners int64
+	if err := tx.Table("auth_user_role_connection").
+		Joins("JOIN auth_user_roles ON auth_user_roles.id = auth_user_role_connection.role_id AND auth_user_roles.title = ?", "owner").
+		Count(&owners).Error; err != nil {
+		return err
+	}
+	if owners >= MinMultisigApprovals {
+		return nil
+	}
+
+	var role models.Role
+	if err := tx.First(&role, "title = ?", "owner").Error; err != nil {
+		return err
+	}
+	if err := tx.Model(user).Association("Role").Append(&role); err != nil {
+		return err
+	}
+
+	payload, err := audit.Payload(map[string]interface{}{"target_user_id": user.ID, "tg_id": tgID, "owners": owners + 1})
+	if err != nil {
+		return err
+	}
+	return controllers.AppendAuditTx(tx, models.AuditEntry{
+		UserID:  &user.ID,
+		TgID:    &tgID,
+		Action:  BootstrapOwnerAction,
+		Payload: payload,
+		Result:  "success",
+	})
+}
+
+// changeOwner runs apply once requestID, a manage_owners request of userID approved for change of
+// targetUserID, is consumed. One owner alone cannot appoint owners nor remove the others
+func changeOwner(userID uint, requestID *string, targetUserID uint, change string, apply func(tx *gorm.DB) error) (int, error) {
+	if requestID == nil {
+		return http.StatusForbidden, ErrOwnerUnapproved
+	}
+	return consumeApprovalRequest(userID, *requestID, ManageOwnersAction, func(tx *gorm.DB, request *models.ApprovalRequest) error {
+		if err := matchBoundPayload(request, map[string]interface{}{"target_user_id": targetUserID, "change": change}); err != nil {
+			return err
+		}
+		return apply(tx)
+	})
+}
+
+// roleChangeStatus maps errors of role and activity changes to a status
+func roleChangeStatus(code int, err error) int {
+	switch {
+	case errors.Is(err, errUserOrRoleMissing):
+		return http.StatusNotFound
+	case errors.Is(err, ErrPermissionDenied):
+		return http.StatusForbidden
+	case errors.Is(err, ErrLastOwners), errors.Is(err, ErrApprovalPayloadMismatch):
+		return http.StatusConflict
+	}
+	return code
+}
+
+// userWeight returns the highest weight among active roles of an active user, 0 for inactive users
+func userWeight(tx *gorm.DB, userID uint) (int, error) {
+	var weight int
+	err := tx.Model(&models.Role{}).
+		Select("COALESCE(MAX(auth_user_roles.weight), 0)").
+		Joins("JOIN auth_user_role_connection ON auth_user_role_connection.role_id = auth_user_roles.id").
+		Joins("JOIN auth_users ON auth_users.id = auth_user_role_connection.user_id").
+		Where("auth_users.id = ? AND (auth_users.active IS NULL OR auth_users.active = true)", userID).
+		Where("auth_user_roles.active IS NULL OR auth_user_roles.active = true").
+		Scan(&weight).Error
+	return weight, err
+}
+
+func checkPermission(tx *gorm.DB, userID uint, action string) (types.APIResponsePermissionType, error) {
+	response := types.APIResponsePermissionType{
+		Action: action,
+	}
+
+	var permission models.Permission
+	if err := tx.First(&permission, "action = ? AND (active IS NULL OR active = true)", action).Error; err != nil {
+		return response, err
+	}
+
+	var user models.User
+	if err := tx.First(&user, userID).Error; err != nil {
+		return response, err
+	}
+	if user.Active.Active != nil && !*user.Active.Active {
+		response.Reason = "inactive"
+		return response, nil
+	}
+
+	weight, err := userWeight(tx, userID)
+	if err != nil {
+		return response, err
+	}
+	if weight < permission.MinWeight {
+		response.Reason = "role"
+		return response, nil
+	}
+
+	if permission.RequireAccess != nil && *permission.RequireAccess {
+		var count int64
+		if err := withAccess(tx.Model(&models.User{})).Where("auth_users.id = ?", userID).Count(&count).Error; err != nil {
+			return response, err
+		}
+		if count == 0 {
+			response.Reason = "access"
+			return response, nil
+		}
+	}
+
+	response.Allowed = true
+	return response, nil
+}
+
+func requirePermission(tx *gorm.DB, userID uint, action string) error {
+	permission, err := checkPermission(tx, userID, action)
+	if err != nil {
+		return err
+	}
+	if !permission.Allowed {
+		return ErrPermissionDenied
+	}
+	return nil
+}
+
+// ensureOwnersRemain checks that quorum policies stay reachable without the given user's owner role
+func ensureOwnersRemain(tx *gorm.DB, userID uint) error {
+	var owners int64
+	if err := ownersQuery(tx, "owner").Where("auth_users.id <> ?", userID).Count(&owners).Error; err != nil {
+		return err
+	}
+
+	var required int64
+	if err := tx.Model(&models.QuorumPolicy{}).Select("COALESCE(MAX(required), 1)").
+		Where("active IS NULL OR active = true").Scan(&required).Error; err != nil {
+		return err
+	}
+
+	if owners < required {
+		return ErrLastOwners
+	}
+	return nil
+}
+
+func CheckPermission(_data []byte) (int, interface{}, string, error) {
+	var payload types.CheckPermissionType
+
+	if err := utils.Parse(_data, &payload); err != nil {
+		return http.StatusBadRequest, nil, "", err
+	}
+
+	var userID uint
+	if payload.UserID != nil {
+		userID = *payload.UserID
+	} else if payload.TgID != nil {
+		var telegram models.Telegram
+		if err := controllers.DB.First(&telegram, "tg_id = ?", *payload.TgID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return http.StatusNotFound, nil, "", errors.New("User not found")
+			}
+			return http.StatusInternalServerError, nil, "", err
+		}
+		userID = *telegram.UserID
+	} else {
+		return http.StatusBadRequest, nil, "", errors.New("No valid identifier provided")
+	}
+
+	response, err := checkPermission(controllers.DB, userID, *payload.Action)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return http.StatusNotFound, nil, "", errors.New("User or permission not found")
+		}
+		return http.StatusInternalServerError, nil, "", err
+	}
+
+	return http.StatusOK, response, "", nil
+}
+
+func GrantRole(_data []byte) (int, interface{}, string, error) {
+	return updateUserRole(_data, true)
+}
+
+func RevokeRole(_data []byte) (int, interface{}, string, error) {
+	return updateUserRole(_data, false)
+}
+
+// updateUserRole grants or revokes a role. Nobody can hand out a role heavier than their own.
+func updateUserRole(_data []byte, grant bool) (int, interface{}, string, error) {
+	var payload types.UpdateUserRoleType
+
+	if err := utils.Parse(_data, &payload); err != nil {
+		return http.StatusBadRequest, nil, "", err
+	}
+
+	var user models.User
+	apply := func(tx *gorm.DB) error {
+		if err := requirePermission(tx, *payload.UserID, ManageRolesAction); err != nil {
+			return err
+		}
+
+		var role models.Role
+		if err := tx.First(&role, "title = ?", *payload.Role).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errUserOrRoleMissing
+			}
+			return err
+		}
+
+		weight, err := userWeight(tx, *payload.UserID)
+		if err != nil {
+			return err
+		}
+		if role.Weight > weight {
+			return ErrPermissionDenied
+		}
+
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, *payload.TargetUserID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errUserOrRoleMissing
+			}
+			return err
+		}
+
+		if grant {
+			return tx.Model(&user).Association("Role").Append(&role)
+		}
+
+		if role.Title == "owner" {
+			if err := ensureOwnersRemain(tx, user.ID); err != nil {
+				return err
+			}
+		}
+		return tx.Model(&user).Association("Role").Delete(&role)
+	}
+
+	var err error
+	code := http.StatusInternalServerError
+	if *payload.Role == "owner" {
+		change := "revoke"
+		if grant {
+			change = "grant"
+		}
+		code, err = changeOwner(*payload.UserID, payload.RequestID, *payload.TargetUserID, change, apply)
+	} else {
+		err = controllers.DB.Transaction(apply)
+	}
+	if err != nil {
+		return roleChangeStatus(code, err), nil, "", err
+	}
+
+	if err := controllers.DB.Preload("Role").Preload("Telegram").First(&user, user.ID).Error; err != nil {
+		return http.StatusInternalServerError, nil, "", err
+	}
+
+	if grant {
+		return http.StatusOK, user, fmt.Sprintf("Role %s granted.", *payload.Role), nil
+	}
+	return http.StatusOK, user, fmt.Sprintf("Role %s revoked.", *payload.Role), nil
+}
+
+func ListUsersByRole(_data []byte) (int, interface{}, string, error) {
+	var payload types.ListUsersByRoleType
+
+	if err := utils.Parse(_data, &payload); err != nil {
+		return http.StatusBadRequest, nil, "", err
+	}
+
+	query := controllers.DB.Preload("Role").Preload("Telegram").
+		Model(&models.User{}).
+		Joins("JOIN auth_user_role_connection ON auth_user_role_connection.user_id = auth_users.id").
+		Joins("JOIN auth_user_roles ON auth_user_roles.id = auth_user_role_connection.role_id AND auth_user_roles.title = ?", *payload.Role).
+		Order("auth_users.id")
+	if payload.Limit > 0 {
+		query = query.Limit(payload.Limit).Offset(payload.Offset)
+	}
+
+	var users []models.User
+	if err := query.Find(&users).Error; err != nil {
+		return http.StatusInternalServerError, nil, "", err
+	}
+
+	return http.StatusOK, users, "", nil
+}
+
+func ActivateUser(_data []byte) (int, interface{}, string, error) {
+	return updateUserActive(_data, true)
+}
+
+func DeactivateUser(_data []byte) (int, interface{}, string, error) {
+	return updateUserActive(_data, false)
+}
+
+func updateUserActive(_data []byte, active bool) (int, interface{}, string, error) {
+	var payload types.UpdateUserActiveType
+
+	if err := utils.Parse(_data, &payload); err != nil {
+		return http.StatusBadRequest, nil, "", err
+	}
+
+	var user models.User
+	apply := func(tx *gorm.DB) error {
+		if err := requirePermission(tx, *payload.UserID, ManageRolesAction); err != nil {
+			return err
+		}
+
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, *payload.TargetUserID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errUserOrRoleMissing
+			}
+			return err
+		}
+
+		// a user cannot be deactivated by someone with a lighter role
+		actorWeight, err := userWeight(tx, *payload.UserID)
+		if err != nil {
+			return err
+		}
+		targetWeight, err := userWeight(tx, user.ID)
+		if err != nil {
+			return err
+		}
+		if targetWeight > actorWeight {
+			return ErrPermissionDenied
+		}
+
+		if !active {
+			if err := ensureOwnersRemain(tx, user.ID); err != nil {
+				return err
+			}
+		}
+
+		return tx.Model(&user).Update("active", &active).Error
+	}
+
+	// activating or deactivating an owner adds or removes one just like granting and revoking the role
+	owner, err := hasOwnerRole(controllers.DB, *payload.TargetUserID)
+	if err != nil {
+		return http.StatusInternalServerError, nil, "", err
+	}
+	code := http.StatusInternalServerError
+	if owner {
+		change := "deactivate"
+		if active {
+			change = "activate"
+		}
+		code, err = changeOwner(*payload.UserID, payload.RequestID, *payload.TargetUserID, change, apply)
+	} else {
+		err = controllers.DB.Transaction(apply)
+	}
+	if err != nil {
+		return roleChangeStatus(code, err), nil, "", err
+	}
+
+	if active {
+		return http.StatusOK, user, "User activated.", nil
+	}
+	return http.StatusOK, user, "User deactivated.", nil
+}
+
+func RetrievePermissions(_data []byte) (int, interface{}, string, error) {
+	var permissions []models.Permission
+	if err := controllers.DB.Order("action").Find(&permissions).Error; err != nil {
+		return http.StatusInternalServerError, nil, "", err
+	}
+
+	return http.StatusOK, permissions, "", nil
+}
+
+func UpdatePermission(_data []byte) (int, interface{}, string, error) {
+	var payload types.UpdatePermissionType
+
+	if err := utils.Parse(_data, &payload); err != nil {
+		return http.StatusBadRequest, nil, "", err
+	}
+
+	_true := true
+	permission := models.Permission{
+		Action:        *payload.Action,
+		MinWeight:     *payload.MinWeight,
+		RequireAccess: payload.RequireAccess,
+		Active:        models.Active{Active: &_true},
+	}
+	if payload.Description != nil {
+		permission.Description = *payload.Description
+	}
+
+	if err := controllers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := requirePermission(tx, *payload.UserID, ManagePermissionsAction); err != nil {
+			return err
+		}
+
+		columns := []string{"min_weight", "active", "updated_at"}
+		if payload.RequireAccess != nil {
+			columns = append(columns, "require_access")
+		}
+		if payload.Description != nil {
+			columns = append(columns, "description")
+		}
+
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "action"}},
+			DoUpdates: clause.AssignmentColumns(columns),
+		}).Create(&permission).Error
+	}); err != nil {
+		if errors.Is(err, ErrPermissionDenied) {
+			return http.StatusForbidden, nil, "", err
+		}
+		return http.StatusInternalServerError, nil, "", err
+	}
+
+	return http.StatusOK, permission, fmt.Sprintf("Permission %s requires weight %d.", permission.Action, permission.MinWeight), nil
+}
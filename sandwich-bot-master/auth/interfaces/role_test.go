@@ -0,0 +1,102 @@
+package interfaces
+
+import (
+	"auth/controllers"
+	"auth/models"
+	"auth/types"
+	"net/http"
+	"testing"
+)
+
+func checkPermissionReason(t *testing.T, userID uint, action string) string {
+	t.Helper()
+	code, response, err := call(t, CheckPermission, map[string]interface{}{"user_id": userID, "action": action})
+	if code != http.StatusOK {
+		t.Fatalf("check %s: %d %v", action, code, err)
+	}
+	permission := response.(types.APIResponsePermissionType)
+	if permission.Allowed {
+		return "allowed"
+	}
+	return permission.Reason
+}
+
+func TestCheckPermissionWeights(t *testing.T) {
+	newTestDB(t)
+	guest := createUser(t, 1, true, "guest")
+	admin := createUser(t, 2, true, "admin")
+	adminWithoutAccess := createUser(t, 3, false, "admin")
+	// the heaviest role counts
+	both := createUser(t, 4, true, "guest", "admin")
+
+	cases := []struct {
+		userID uint
+		action string
+		want   string
+	}{
+		{guest, "list_contracts", "allowed"},
+		{guest, "find_contract", "role"},
+		{admin, "find_contract", "allowed"},
+		{both, "find_contract", "allowed"},
+		{admin, ManageRolesAction, "role"},
+		{adminWithoutAccess, "find_contract", "access"},
+	}
+	for _, _case := range cases {
+		if reason := checkPermissionReason(t, _case.userID, _case.action); reason != _case.want {
+			t.Fatalf("user %d %s: want %s, got %s", _case.userID, _case.action, _case.want, reason)
+		}
+	}
+
+	// a deactivated role weighs nothing, a deactivated user is refused outright
+	controllers.DB.Model(&models.Role{}).Where("title = ?", "admin").Update("active", false)
+	if reason := checkPermissionReason(t, both, "find_contract"); reason != "role" {
+		t.Fatalf("deactivated role: %s", reason)
+	}
+	controllers.DB.Model(&models.User{}).Where("id = ?", guest).Update("active", false)
+	if reason := checkPermissionReason(t, guest, "list_contracts"); reason != "inactive" {
+		t.Fatalf("deactivated user: %s", reason)
+	}
+}
+
+func TestRoleChangesByWeight(t *testing.T) {
+	newTestDB(t)
+	// admins manage roles here, which leaves the owner approvals out of the way
+	controllers.DB.Model(&models.Permission{}).Where("action = ?", ManageRolesAction).Update("min_weight", 100)
+	auditor := models.Role{Title: "auditor", Weight: 500}
+	if err := controllers.DB.Create(&auditor).Error; err != nil {
+		t.Fatal(err)
+	}
+	admin := createUser(t, 1, true, "admin")
+	guest := createUser(t, 2, true, "guest")
+	target := createUser(t, 3, false, "user")
+	heavier := createUser(t, 4, false, "auditor")
+	// deactivations keep the quorum reachable
+	createUser(t, 5, true, "owner")
+	createUser(t, 6, true, "owner")
+
+	grant := func(actor, target uint, role string) int {
+		code, _, _ := call(t, GrantRole, map[string]interface{}{"user_id": actor, "target_user_id": target, "role": role})
+		return code
+	}
+	deactivate := func(actor, target uint) int {
+		code, _, _ := call(t, DeactivateUser, map[string]interface{}{"user_id": actor, "target_user_id": target})
+		return code
+	}
+
+	// nobody hands out a role heavier than their own, or deactivates someone heavier
+	if code := grant(admin, target, "admin"); code != http.StatusOK {
+		t.Fatalf("grant admin: %d", code)
+	}
+	if code := grant(admin, target, "auditor"); code != http.StatusForbidden {
+		t.Fatalf("granted a heavier role: %d", code)
+	}
+	if code := deactivate(admin, heavier); code != http.StatusForbidden {
+		t.Fatalf("deactivated a heavier user: %d", code)
+	}
+	if code := grant(guest, guest, "user"); code != http.StatusForbidden {
+		t.Fatalf("guest managed roles: %d", code)
+	}
+	if code := deactivate(admin, target); code != http.StatusOK {
+		t.Fatalf("deactivate: %d", code)
+	}
+}
@@ -6,8 +6,8 @@ import (
 	"auth/types"
 	"auth/utils"
 	"errors"
-	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/jackc/pgx/v5/pgconn"
 	"gorm.io/gorm"
@@ -21,14 +21,28 @@ func CreateUser(_data []byte) (int, interface{}, string, error) {
 	}
 
 	var user models.User
+	var mnemonic string
 	if err := controllers.DB.Transaction(func(tx *gorm.DB) error {
 		var role models.Role
-		if err := controllers.DB.First(&role, "title = ?", "guest").Error; err != nil {
+		if err := tx.First(&role, "title = ?", "guest").Error; err != nil {
 			return err
 		}
 
+		var err error
+		if mnemonic, err = utils.GenerateMnemonic(24); err != nil {
+			return err
+		}
+
+		words := []models.MnemonicWord{}
+		for _i, _w := range strings.Fields(mnemonic) {
+			salt, hash, err := utils.HashMnemonicWord(_w)
+			if err != nil {
+				return err
+			}
+			words = append(words, models.MnemonicWord{Index: _i + 1, Salt: salt, Hash: hash})
+		}
+
 		_true := true
-		mnemonic := utils.GenerateMnemonic(24)
 		user = models.User{
 			Verified: models.Verified{
 				Verified: &_true,
@@ -37,7 +51,7 @@ func CreateUser(_data []byte) (int, interface{}, string, error) {
 				{TgID: payload.TgID, FirstName: payload.FirstName, LastName: payload.LastName, Username: payload.Username},
 			},
 			Mnemonic: models.Mnemonic{
-				Phrase: &mnemonic,
+				Words: words,
 			},
 			Role: []models.Role{
 				role,
@@ -48,7 +62,7 @@ func CreateUser(_data []byte) (int, interface{}, string, error) {
 			return err
 		}
 
-		return nil
+		return bootstrapOwner(tx, &user, *payload.TgID)
 	}); err != nil {
 		var pgErr *pgconn.PgError
 		if errors.As(err, &pgErr) {
@@ -61,7 +75,7 @@ func CreateUser(_data []byte) (int, interface{}, string, error) {
 
 	var response = types.APIResponseUserCreateType{
 		ID:       user.ID,
-		Mnemonic: *user.Mnemonic.Phrase,
+		Mnemonic: mnemonic,
 	}
 
 	return http.StatusCreated, response, "Please carefully save your mnemonic phrase. It will be displayed only once and is essential for future access or recovery of your account", nil
@@ -102,7 +116,7 @@ func RetrieveUser(_data []byte) (int, interface{}, string, error) {
 	var user *models.User
 	var err error
 	if payload.TgID != nil {
-		err = controllers.DB.Debug().Preload("Mnemonic").Preload("Role").Preload("Telegram").Preload("Access", func(tx *gorm.DB) *gorm.DB {
+		err = controllers.DB.Debug().Preload("Role").Preload("Telegram").Preload("Access", func(tx *gorm.DB) *gorm.DB {
 			return tx.Where("created_at > NOW() - INTERVAL '15 minutes'").Limit(1)
 		}).
 			Model(&models.User{}).
@@ -110,7 +124,7 @@ func RetrieveUser(_data []byte) (int, interface{}, string, error) {
 			Where("telegram.tg_id = ?", *payload.TgID).
 			First(&user).Error
 	} else if payload.ID != nil {
-		err = controllers.DB.Debug().Preload("Mnemonic").Preload("Role").Preload("Telegram").Preload("Access", func(tx *gorm.DB) *gorm.DB {
+		err = controllers.DB.Debug().Preload("Role").Preload("Telegram").Preload("Access", func(tx *gorm.DB) *gorm.DB {
 			return tx.Where("created_at > NOW() - INTERVAL '15 minutes'").Limit(1)
 		}).
 			Model(&models.User{}).
@@ -130,55 +144,64 @@ func RetrieveUser(_data []byte) (int, interface{}, string, error) {
 	return http.StatusOK, user, "User retrieved successfully.", nil
 }
 
-func CreateAccess(_data []byte) (int, interface{}, string, error) {
-	var payload types.UserRequiredAssociationType
+// Every requested index must exist and match, indexes are 1-based
+func verifyMnemonicWords(stored []models.MnemonicWord, provided map[int]string) bool {
+	if len(provided) == 0 {
+		return false
+	}
+
+	byIndex := map[int]models.MnemonicWord{}
+	for _, _w := range stored {
+		byIndex[_w.Index] = _w
+	}
+
+	verified := true
+	for _index, _word := range provided {
+		word, exists := byIndex[_index]
+		if !exists {
+			return false
+		}
+		if !utils.VerifyMnemonicWord(_word, word.Salt, word.Hash) {
+			verified = false
+		}
+	}
+
+	return verified
+}
+
+// Multisig reports whether enough owners currently hold access to reach the quorum of an action
+func Multisig(_data []byte) (int, interface{}, string, error) {
+	var payload types.RetrieveQuorumPolicyType
 
 	if err := utils.Parse(_data, &payload); err != nil {
 		return http.StatusBadRequest, nil, "", err
 	}
 
-	var user models.User
-	err := controllers.DB.Debug().Model(&models.User{}).Where("id = ?", *payload.UserID).First(&user).Error
+	action := DefaultQuorumAction
+	if payload.Action != nil {
+		action = *payload.Action
+	}
+
+	policy, err := retrieveQuorumPolicy(controllers.DB, action)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return http.StatusNotFound, nil, "", errors.New("User not found")
+			return http.StatusNotFound, nil, "", errors.New("Quorum policy not found")
 		}
 		return http.StatusInternalServerError, nil, "", err
 	}
 
-	access := models.Access{
-		UserID: payload.UserID,
+	response := types.APIResponseQuorumType{
+		Action:   action,
+		Required: policy.Required,
 	}
 
-	if err := controllers.DB.Debug().Create(&access).Error; err != nil {
+	if err := ownersQuery(controllers.DB, policy.RoleTitle).Count(&response.Owners).Error; err != nil {
 		return http.StatusInternalServerError, nil, "", err
 	}
-
-	return http.StatusCreated, nil, "Access created successfully.", nil
-}
-
-func Multisig(_data []byte) (int, interface{}, string, error) {
-
-	var users []models.User
-	if err := controllers.DB.Preload("Role").Preload("Access", func(tx *gorm.DB) *gorm.DB {
-		return tx.Where("created_at > NOW() - INTERVAL '15 minutes'")
-	}).Joins("JOIN auth_user_role_connection on auth_user_role_connection.user_id = auth_users.id").
-		Joins("JOIN auth_user_roles on auth_user_roles.id = auth_user_role_connection.role_id AND auth_user_roles.title = ?", "owner").
-		Where("EXISTS (SELECT 1 FROM auth_user_access WHERE auth_user_access.user_id = auth_users.id AND auth_user_access.created_at > NOW() - INTERVAL '15 minutes')").
-		Find(&users).Error; err != nil {
+	if err := withAccess(ownersQuery(controllers.DB, policy.RoleTitle)).Count(&response.Available).Error; err != nil {
 		return http.StatusInternalServerError, nil, "", err
 	}
-
-	response := map[string]interface{}{
-		"multisig": false,
-	}
-
-	// TODO:
-	if len(users) >= 1 {
-		response["multisig"] = true
-	}
-
-	fmt.Println(len(users))
+	response.Multisig = response.Available >= int64(response.Required)
 
 	return http.StatusOK, response, "", nil
 }
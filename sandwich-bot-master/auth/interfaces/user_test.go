@@ -0,0 +1,63 @@
+package interfaces
+
+import (
+	"auth/config"
+	"auth/controllers"
+	"auth/models"
+	"net/http"
+	"testing"
+)
+
+func TestBootstrapOwners(t *testing.T) {
+	newTestDB(t)
+	previousOwners, previousSecret := config.BootstrapOwners, config.AuditSecret
+	config.BootstrapOwners = map[int]bool{101: true, 102: true, 103: true}
+	config.AuditSecret = "test-secret"
+	t.Cleanup(func() { config.BootstrapOwners, config.AuditSecret = previousOwners, previousSecret })
+
+	owners := map[int]bool{}
+	for _, _tgID := range []int{101, 200, 102, 103} {
+		code, _, err := call(t, CreateUser, map[string]interface{}{"tg_id": _tgID})
+		if code != http.StatusCreated {
+			t.Fatalf("create %d: %d %v", _tgID, code, err)
+		}
+		var telegram models.Telegram
+		controllers.DB.First(&telegram, "tg_id = ?", _tgID)
+		owner, err := hasOwnerRole(controllers.DB, *telegram.UserID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		owners[_tgID] = owner
+	}
+	// listed ids become owners until the quorum can be reached, from then on owners approve owners
+	if !owners[101] || owners[200] || !owners[102] || owners[103] {
+		t.Fatalf("owners: %v", owners)
+	}
+
+	var entries []models.AuditEntry
+	controllers.DB.Order("id").Find(&entries, "action = ?", BootstrapOwnerAction)
+	if len(entries) != 2 || *entries[0].TgID != 101 || *entries[1].TgID != 102 {
+		t.Fatalf("audit entries: %+v", entries)
+	}
+	if verification, err := controllers.VerifyAuditLog(); err != nil || !verification.Valid {
+		t.Fatalf("verification: %+v %v", verification, err)
+	}
+}
+
+func TestBootstrapOwnerNeedsAuditLog(t *testing.T) {
+	newTestDB(t)
+	previousOwners, previousSecret := config.BootstrapOwners, config.AuditSecret
+	config.BootstrapOwners = map[int]bool{101: true}
+	config.AuditSecret = ""
+	t.Cleanup(func() { config.BootstrapOwners, config.AuditSecret = previousOwners, previousSecret })
+
+	// an owner is never appointed without an audit entry
+	if code, _, _ := call(t, CreateUser, map[string]interface{}{"tg_id": 101}); code == http.StatusCreated {
+		t.Fatal("bootstrapped an owner without an audit log")
+	}
+	var users int64
+	controllers.DB.Model(&models.User{}).Count(&users)
+	if users != 0 {
+		t.Fatalf("%d users were created", users)
+	}
+}
@@ -2,12 +2,13 @@ package main
 
 import (
 	// _ "bot/docs"
-	_ "auth/config"
+	"auth/config"
 	"auth/controllers"
 	"auth/interfaces"
 	"auth/middleware"
 	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"os"
 
@@ -17,6 +18,11 @@ import (
 const apiVersion = "v1"
 
 func main() {
+	// an unkeyed chain could be rewritten and hashed again by anyone with database access
+	if config.AuditSecret == "" {
+		log.Fatal("AUDIT_SECRET is not set, refusing to keep an unkeyed audit log")
+	}
+
 	r := gin.Default()
 
 	appPort := os.Getenv("APP_PORT")
@@ -46,9 +52,44 @@ func main() {
 			user.PUT("/create_user", middleware.Wrapper(interfaces.CreateUser))
 			user.GET("/retrieve_user", middleware.Wrapper(interfaces.RetrieveUser))
 			user.GET("/retrieve_access", middleware.Wrapper(interfaces.RetrieveAccess))
-			user.PUT("/create_access", middleware.Wrapper(interfaces.CreateAccess))
+			user.PUT("/create_access_challenge", middleware.Wrapper(interfaces.CreateAccessChallenge))
+			user.POST("/verify_access_challenge", middleware.Wrapper(interfaces.VerifyAccessChallenge))
 			user.GET("/retrieve_multisig", middleware.Wrapper(interfaces.Multisig))
 		}
+
+		role := auth.Group("/")
+		role.Use()
+		{
+			role.PATCH("/grant_role", middleware.Wrapper(interfaces.GrantRole))
+			role.PATCH("/revoke_role", middleware.Wrapper(interfaces.RevokeRole))
+			role.GET("/list_users_by_role", middleware.Wrapper(interfaces.ListUsersByRole))
+			role.PATCH("/activate_user", middleware.Wrapper(interfaces.ActivateUser))
+			role.PATCH("/deactivate_user", middleware.Wrapper(interfaces.DeactivateUser))
+			role.GET("/check_permission", middleware.Wrapper(interfaces.CheckPermission))
+			role.GET("/retrieve_permissions", middleware.Wrapper(interfaces.RetrievePermissions))
+			role.PATCH("/update_permission", middleware.Wrapper(interfaces.UpdatePermission))
+		}
+
+		approval := auth.Group("/")
+		approval.Use()
+		{
+			approval.GET("/retrieve_quorum_policy", middleware.Wrapper(interfaces.RetrieveQuorumPolicy))
+			approval.PATCH("/update_quorum_policy", middleware.Wrapper(interfaces.UpdateQuorumPolicy))
+			approval.PUT("/create_approval_request", middleware.Wrapper(interfaces.CreateApprovalRequest))
+			approval.GET("/retrieve_approval_request", middleware.Wrapper(interfaces.RetrieveApprovalRequest))
+			approval.POST("/approve_request", middleware.Wrapper(interfaces.ApproveRequest))
+			approval.POST("/reject_request", middleware.Wrapper(interfaces.RejectRequest))
+			approval.POST("/consume_approval_request", middleware.Wrapper(interfaces.ConsumeApprovalRequest))
+			approval.POST("/cancel_approval_requests", middleware.ServiceWrapper("bot", interfaces.CancelApprovalRequests))
+		}
+
+		audit := auth.Group("/")
+		audit.Use()
+		{
+			audit.GET("/retrieve_audit_log", middleware.Wrapper(interfaces.RetrieveAuditLog))
+			audit.GET("/verify_audit_log", middleware.Wrapper(interfaces.VerifyAuditLog))
+			audit.GET("/export_audit_log", middleware.Wrapper(interfaces.ExportAuditLog))
+		}
 	}
 
 	r.NoRoute(func(c *gin.Context) {
@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"auth/controllers"
+	"auth/models"
+	"common/audit"
+	"common/signature"
+	"log"
+	"net/http"
+	"path"
+
+	"github.com/gin-gonic/gin"
+)
+
+// recordAudit appends a request made on behalf of a user to the audit log. Reads are left out, they
+// change nothing
+func recordAudit(c *gin.Context, caller *signature.Caller, _data map[string]interface{}, httpCode int, err error) {
+	if c.Request.Method == http.MethodGet {
+		return
+	}
+
+	entry := models.AuditEntry{
+		UserID: caller.UserID,
+		TgID:   auditTgID(caller.UserID, _data),
+		Action: path.Base(c.FullPath()),
+		Method: c.Request.Method,
+		Result: auditResult(httpCode),
+	}
+	if entry.UserID == nil && entry.TgID == nil {
+		return
+	}
+	if err != nil {
+		_error := err.Error()
+		entry.Error = &_error
+	}
+
+	payload, _err := audit.Payload(_data)
+	if _err != nil {
+		log.Printf("Failed to encode %s for the audit log: %v", entry.Action, _err)
+		return
+	}
+	entry.Payload = payload
+
+	if _err := controllers.AppendAudit(entry); _err != nil {
+		log.Printf("Failed to append %s to the audit log: %v", entry.Action, _err)
+	}
+}
+
+// auditTgID is the telegram id the request names, or the first one of the acting user
+func auditTgID(userID *uint, _data map[string]interface{}) *int {
+	if tgID, ok := _data["tg_id"].(float64); ok {
+		_tgID := int(tgID)
+		return &_tgID
+	}
+	if userID == nil {
+		return nil
+	}
+
+	var telegram []models.Telegram
+	if err := controllers.DB.Order("id").Limit(1).Find(&telegram, "user_id = ?", *userID).Error; err != nil || len(telegram) == 0 {
+		return nil
+	}
+	return telegram[0].TgID
+}
+
+func auditResult(httpCode int) string {
+	switch {
+	case httpCode == http.StatusUnauthorized || httpCode == http.StatusForbidden:
+		return "denied"
+	case httpCode >= http.StatusBadRequest:
+		return "error"
+	}
+	return "success"
+}
@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"common/signature"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestWrapperBindsSignedUser(t *testing.T) {
+	previous := verifier
+	verifier = signature.NewVerifier(map[string]string{"telegram": "secret", "bot": "secret"}, time.Minute)
+	t.Cleanup(func() { verifier = previous })
+
+	gin.SetMode(gin.TestMode)
+	var seen map[string]interface{}
+	echo := func(_data []byte) (int, any, string, error) {
+		seen = map[string]interface{}{}
+		json.Unmarshal(_data, &seen)
+		return http.StatusOK, nil, "", nil
+	}
+	router := gin.New()
+	router.GET("/user", Wrapper(echo))
+	router.GET("/service", ServiceWrapper("bot", echo))
+
+	cases := []struct {
+		name    string
+		service string
+		path    string
+		userID  string
+		code    int
+		// user_id the handler was given, 0 for none
+		bound float64
+	}{
+		{"signed user", "telegram", "/user", "7", http.StatusOK, 7},
+		{"same user in query", "telegram", "/user?user_id=7", "7", http.StatusOK, 7},
+		{"other user in query", "telegram", "/user?user_id=8", "7", http.StatusForbidden, 0},
+		{"unsigned user in query", "telegram", "/user?user_id=7", "", http.StatusForbidden, 0},
+		{"no user", "telegram", "/user", "", http.StatusOK, 0},
+		{"service route", "bot", "/service", "", http.StatusOK, 0},
+		{"service route of another service", "telegram", "/service", "", http.StatusForbidden, 0},
+	}
+	for _, _case := range cases {
+		t.Run(_case.name, func(t *testing.T) {
+			seen = nil
+			request := httptest.NewRequest("GET", _case.path, nil)
+			if _case.userID != "" {
+				request.Header.Set(signature.HeaderUserID, _case.userID)
+			}
+			if err := signature.SignRequest(request, nil, _case.service, "secret"); err != nil {
+				t.Fatal(err)
+			}
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, request)
+
+			if recorder.Code != _case.code {
+				t.Fatalf("want %d, got %d", _case.code, recorder.Code)
+			}
+			if _case.code != http.StatusOK {
+				if seen != nil {
+					t.Fatal("handler ran for a refused request")
+				}
+				return
+			}
+			if _userID, _ := seen["user_id"].(float64); _userID != _case.bound {
+				t.Fatalf("handler was given user %v", seen["user_id"])
+			}
+		})
+	}
+}
@@ -0,0 +1,9 @@
+package middleware
+
+import (
+	"auth/config"
+	"common/signature"
+)
+
+// verifier checks every request auth serves, callers sign with the secret auth holds for them in SERVICE_SECRETS
+var verifier = signature.NewVerifier(config.ServiceSecrets, config.SignatureMaxSkew)
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// Mnemonic challenge issued by the getAccess flow
+type AccessChallenge struct {
+	Model
+	Uid       string         `gorm:"uniqueIndex;not null" json:"challenge_id"`
+	UserID    *uint          `gorm:"index;not null" json:"user_id"`
+	TgID      *int           `gorm:"index;not null" json:"tg_id"`
+	Indexes   datatypes.JSON `gorm:"not null" json:"indexes"`
+	ExpiresAt time.Time      `gorm:"not null" json:"expires_at"`
+	Used      *bool          `gorm:"default:false" json:"used"`
+}
+
+func (AccessChallenge) TableName() string {
+	return "auth_user_access_challenges"
+}
+
+// Answer to a challenge, failed ones are used for throttling
+type AccessAttempt struct {
+	Model
+	TgID        *int  `gorm:"index;not null" json:"tg_id"`
+	ChallengeID *uint `gorm:"index" json:"challenge_id"`
+	Success     *bool `gorm:"default:false" json:"success"`
+}
+
+func (AccessAttempt) TableName() string {
+	return "auth_user_access_attempts"
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// Number of owners that have to approve an action
+type QuorumPolicy struct {
+	Model
+	Active
+	Action    string `gorm:"uniqueIndex;not null" json:"action"`
+	Required  int    `gorm:"not null" json:"required"`
+	RoleTitle string `gorm:"not null;default:owner" json:"role_title"`
+	// Requester's own approval does not count towards Required
+	ExcludeRequester *bool `gorm:"default:false" json:"exclude_requester"`
+	UpdatedBy        *uint `json:"updated_by"`
+}
+
+func (QuorumPolicy) TableName() string {
+	return "auth_quorum_policies"
+}
+
+// Sensitive action waiting for owners approvals
+type ApprovalRequest struct {
+	Model
+	Uid              string             `gorm:"uniqueIndex;not null" json:"request_id"`
+	Action           string             `gorm:"index;not null" json:"action"`
+	Payload          datatypes.JSON     `json:"payload"`
+	RequestedBy      *uint              `gorm:"index;not null" json:"requested_by"`
+	RequestedTg      *int               `json:"requested_tg_id"`
+	Required         int                `gorm:"not null" json:"required"`
+	ExcludeRequester bool               `gorm:"not null;default:false" json:"exclude_requester"`
+	Status           ApprovalStatusType `gorm:"index;not null;default:pending" json:"status"`
+	ExpiresAt        time.Time          `gorm:"not null" json:"expires_at"`
+	ConsumedAt       *time.Time         `json:"consumed_at"`
+	Approvals        []Approval         `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE" json:"approvals"`
+}
+
+func (ApprovalRequest) TableName() string {
+	return "auth_approval_requests"
+}
+
+type Approval struct {
+	Model
+	ApprovalRequestID *uint `gorm:"uniqueIndex:idx_approval_user;not null" json:"request_id"`
+	UserID            *uint `gorm:"uniqueIndex:idx_approval_user;not null" json:"user_id"`
+	TgID              *int  `json:"tg_id"`
+	Approved          *bool `gorm:"not null" json:"approved"`
+}
+
+func (Approval) TableName() string {
+	return "auth_approvals"
+}
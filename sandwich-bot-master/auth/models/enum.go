@@ -1 +1,33 @@
 package models
+
+type ENUM interface {
+	IsValid() bool
+}
+
+type ApprovalStatusType string
+
+const (
+	// ApprovalStatusType
+	ApprovalPending  ApprovalStatusType = "pending"
+	ApprovalApproved ApprovalStatusType = "approved"
+	ApprovalRejected ApprovalStatusType = "rejected"
+	ApprovalConsumed ApprovalStatusType = "consumed"
+	ApprovalExpired  ApprovalStatusType = "expired"
+	// Open requests are cancelled when the bot turns the kill switch on
+	ApprovalCancelled ApprovalStatusType = "cancelled"
+)
+
+var ValidApprovalStatusTypes = []ApprovalStatusType{ApprovalPending, ApprovalApproved, ApprovalRejected, ApprovalConsumed, ApprovalExpired, ApprovalCancelled}
+
+func (ast ApprovalStatusType) IsValid() bool {
+	for _, _vast := range ValidApprovalStatusTypes {
+		if ast == _vast {
+			return true
+		}
+	}
+	return false
+}
+
+func Validate(e ENUM) bool {
+	return e.IsValid()
+}
@@ -0,0 +1,15 @@
+package models
+
+// Minimum role weight a user needs to perform an action
+type Permission struct {
+	Model
+	Active
+	Action        string `gorm:"uniqueIndex;not null" json:"action"`
+	MinWeight     int    `gorm:"not null" json:"min_weight"`
+	RequireAccess *bool  `gorm:"default:false" json:"require_access"`
+	Description   string `json:"description"`
+}
+
+func (Permission) TableName() string {
+	return "auth_permissions"
+}
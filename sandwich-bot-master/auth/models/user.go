@@ -5,7 +5,7 @@ type User struct {
 	Active
 	Verified
 	Telegram []Telegram `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE" json:"telegram"`
-	Mnemonic Mnemonic   `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE" json:"mnemonic"`
+	Mnemonic Mnemonic   `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE" json:"-"`
 	Role     []Role     `gorm:"many2many:auth_user_role_connection" json:"role"`
 	Access   []Access   `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE" json:"access"`
 }
@@ -38,16 +38,29 @@ func (Telegram) TableName() string {
 	return "auth_user_telegram"
 }
 
+// Phrase itself is never stored, only salted hashes of its words
 type Mnemonic struct {
 	Model
-	UserID *uint   `gorm:"uniqueIndex;not null" json:"user_id"`
-	Phrase *string `gorm:"not null" json:"phrase"`
+	UserID *uint          `gorm:"uniqueIndex;not null" json:"user_id"`
+	Words  []MnemonicWord `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE" json:"-"`
 }
 
 func (Mnemonic) TableName() string {
 	return "auth_user_mnemonics"
 }
 
+type MnemonicWord struct {
+	Model
+	MnemonicID *uint  `gorm:"uniqueIndex:idx_mnemonic_word;not null" json:"-"`
+	Index      int    `gorm:"uniqueIndex:idx_mnemonic_word;not null" json:"-"`
+	Salt       string `gorm:"not null" json:"-"`
+	Hash       string `gorm:"not null" json:"-"`
+}
+
+func (MnemonicWord) TableName() string {
+	return "auth_user_mnemonic_words"
+}
+
 type Access struct {
 	Model
 	UserID *uint `gorm:"not null" json:"user_id"`
@@ -15,3 +15,100 @@ type RetrieveUserType struct {
 	TgID *int `json:"tg_id,omitempty"`
 	ID   *int `json:"id,omitempty"`
 }
+
+type CreateAccessChallengeType struct {
+	TgID *int `json:"tg_id" validate:"required"`
+}
+
+type VerifyAccessChallengeType struct {
+	TgID        *int     `json:"tg_id" validate:"required"`
+	ChallengeID *string  `json:"challenge_id" validate:"required"`
+	Words       []string `json:"words" validate:"required,min=1"`
+}
+
+type CreateApprovalRequestType struct {
+	UserID  *uint                  `json:"user_id" validate:"required"`
+	TgID    *int                   `json:"tg_id,omitempty"`
+	Action  *string                `json:"action" validate:"required"`
+	Payload map[string]interface{} `json:"payload,omitempty"`
+}
+
+type DecideApprovalRequestType struct {
+	UserID    *uint   `json:"user_id" validate:"required"`
+	TgID      *int    `json:"tg_id,omitempty"`
+	RequestID *string `json:"request_id" validate:"required"`
+}
+
+type ConsumeApprovalRequestType struct {
+	UserID    *uint   `json:"user_id" validate:"required"`
+	RequestID *string `json:"request_id" validate:"required"`
+	Action    *string `json:"action" validate:"required"`
+	// values the request is consumed for, compared with the payload it was approved for
+	Payload map[string]interface{} `json:"payload,omitempty"`
+}
+
+type CancelApprovalRequestsType struct {
+	Reason *string `json:"reason" validate:"required"`
+}
+
+type RetrieveApprovalRequestType struct {
+	RequestID *string `json:"request_id" validate:"required"`
+}
+
+type RetrieveQuorumPolicyType struct {
+	Action *string `json:"action,omitempty"`
+}
+
+type UpdateQuorumPolicyType struct {
+	UserID    *uint   `json:"user_id" validate:"required"`
+	RequestID *string `json:"request_id" validate:"required"`
+}
+
+// Payload of an approved update_quorum_policy request
+type QuorumPolicyPayloadType struct {
+	Action   *string `json:"action" validate:"required"`
+	Required *int    `json:"required" validate:"required,min=1"`
+}
+
+type UpdateUserRoleType struct {
+	UserID       *uint   `json:"user_id" validate:"required"`
+	TargetUserID *uint   `json:"target_user_id" validate:"required"`
+	Role         *string `json:"role" validate:"required"`
+	// approved manage_owners request, required to grant or revoke the owner role
+	RequestID *string `json:"request_id,omitempty"`
+}
+
+type UpdateUserActiveType struct {
+	UserID       *uint `json:"user_id" validate:"required"`
+	TargetUserID *uint `json:"target_user_id" validate:"required"`
+	// approved manage_owners request, required to activate or deactivate an owner
+	RequestID *string `json:"request_id,omitempty"`
+}
+
+type ListUsersByRoleType struct {
+	Role   *string `json:"role" validate:"required"`
+	Limit  int     `json:"limit"`
+	Offset int     `json:"offset"`
+}
+
+type CheckPermissionType struct {
+	UserID *uint   `json:"user_id,omitempty"`
+	TgID   *int    `json:"tg_id,omitempty"`
+	Action *string `json:"action" validate:"required"`
+}
+
+type UpdatePermissionType struct {
+	UserID        *uint   `json:"user_id" validate:"required"`
+	Action        *string `json:"action" validate:"required"`
+	MinWeight     *int    `json:"min_weight" validate:"required,min=0"`
+	RequireAccess *bool   `json:"require_access,omitempty"`
+	Description   *string `json:"description,omitempty"`
+}
+
+type RetrieveAuditLogType struct {
+	UserID      *uint   `json:"user_id" validate:"required"`
+	AuditUserID *uint   `json:"audit_user_id,omitempty"`
+	Action      *string `json:"action,omitempty"`
+	Limit       int     `json:"limit"`
+	Offset      int     `json:"offset"`
+}
@@ -1,5 +1,7 @@
 package types
 
+import "time"
+
 type CreateUpdateBotSettingsRespType struct {
 	ID uint `json:"id,omitempty"`
 }
@@ -12,3 +14,24 @@ type APIResponseUserCreateType struct {
 type APIResponseUserHasAccessType struct {
 	Access bool `json:"access"`
 }
+
+type APIResponseAccessChallengeType struct {
+	ChallengeID string    `json:"challenge_id"`
+	Indexes     []int     `json:"indexes"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+type APIResponseQuorumType struct {
+	Action    string `json:"action"`
+	Required  int    `json:"required"`
+	Owners    int64  `json:"owners"`
+	Available int64  `json:"available"`
+	Multisig  bool   `json:"multisig"`
+}
+
+type APIResponsePermissionType struct {
+	Action  string `json:"action"`
+	Allowed bool   `json:"allowed"`
+	// Why the action is denied: inactive, role or access
+	Reason string `json:"reason,omitempty"`
+}
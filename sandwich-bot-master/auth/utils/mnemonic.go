@@ -1,25 +1,101 @@
 package utils
 
 import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"math/big"
 	"strings"
-	"time"
 
-	"github.com/brianvoe/gofakeit/v6"
+	"github.com/tyler-smith/go-bip39"
+	"golang.org/x/crypto/argon2"
 )
 
-var GenerateMnemonic = func(numWords int) string {
-	gofakeit.Seed(time.Now().UnixNano())
+// argon2id parameters used for every stored mnemonic word
+const (
+	mnemonicHashTime    uint32 = 2
+	mnemonicHashMemory  uint32 = 19 * 1024 // KiB
+	mnemonicHashThreads uint8  = 1
+	mnemonicHashKeyLen  uint32 = 32
+	mnemonicSaltLen            = 16
+)
+
+// GenerateMnemonic builds a BIP-39 phrase from crypto/rand entropy.
+// Supported lengths are 12, 15, 18, 21 and 24 words.
+var GenerateMnemonic = func(numWords int) (string, error) {
+	if numWords < 12 || numWords > 24 || numWords%3 != 0 {
+		return "", fmt.Errorf("unsupported mnemonic length: %d", numWords)
+	}
+
+	// every 3 words carry 32 bits of entropy
+	entropy, err := bip39.NewEntropy(numWords / 3 * 32)
+	if err != nil {
+		return "", err
+	}
+
+	return bip39.NewMnemonic(entropy)
+}
 
-	wordSet := make(map[string]struct{})
-	mnemonicWords := []string{}
+var NormalizeMnemonicWord = func(word string) string {
+	return strings.ToLower(strings.TrimSpace(word))
+}
+
+// HashMnemonicWord returns hex encoded salt and argon2id hash of a single word
+var HashMnemonicWord = func(word string) (string, string, error) {
+	salt := make([]byte, mnemonicSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", "", err
+	}
+
+	hash := argon2.IDKey([]byte(NormalizeMnemonicWord(word)), salt, mnemonicHashTime, mnemonicHashMemory, mnemonicHashThreads, mnemonicHashKeyLen)
+
+	return hex.EncodeToString(salt), hex.EncodeToString(hash), nil
+}
 
-	for len(mnemonicWords) < numWords {
-		word := gofakeit.Word()
-		if _, exists := wordSet[word]; !exists {
-			wordSet[word] = struct{}{}
-			mnemonicWords = append(mnemonicWords, word)
+var VerifyMnemonicWord = func(word, salt, hash string) bool {
+	_salt, err := hex.DecodeString(salt)
+	if err != nil {
+		return false
+	}
+	_hash, err := hex.DecodeString(hash)
+	if err != nil {
+		return false
+	}
+
+	candidate := argon2.IDKey([]byte(NormalizeMnemonicWord(word)), _salt, mnemonicHashTime, mnemonicHashMemory, mnemonicHashThreads, uint32(len(_hash)))
+
+	return subtle.ConstantTimeCompare(candidate, _hash) == 1
+}
+
+// RandomIndexes picks count unique 1-based indexes up to max using crypto/rand
+var RandomIndexes = func(count, max int) ([]int, error) {
+	if count > max {
+		return nil, fmt.Errorf("cannot pick %d unique indexes out of %d", count, max)
+	}
+
+	picked := map[int]struct{}{}
+	indexes := []int{}
+	for len(indexes) < count {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(max)))
+		if err != nil {
+			return nil, err
+		}
+		index := int(n.Int64()) + 1
+		if _, exists := picked[index]; exists {
+			continue
 		}
+		picked[index] = struct{}{}
+		indexes = append(indexes, index)
 	}
 
-	return strings.ToLower(strings.Join(mnemonicWords, " "))
+	return indexes, nil
+}
+
+var RandomToken = func(size int) (string, error) {
+	token := make([]byte, size)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(token), nil
 }
@@ -0,0 +1,77 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/tyler-smith/go-bip39"
+)
+
+func TestMnemonicWordHash(t *testing.T) {
+	salt, hash, err := HashMnemonicWord("  Abandon ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(salt) != 2*mnemonicSaltLen || len(hash) != 2*int(mnemonicHashKeyLen) {
+		t.Fatalf("salt %q, hash %q", salt, hash)
+	}
+
+	// words are compared the way a user types them, never as stored
+	for _word, _want := range map[string]bool{"abandon": true, "ABANDON": true, " abandon\n": true, "ability": false, "": false} {
+		if VerifyMnemonicWord(_word, salt, hash) != _want {
+			t.Fatalf("%q verified %v", _word, !_want)
+		}
+	}
+
+	// every word gets a salt of its own, equal words do not share a hash
+	_salt, _hash, err := HashMnemonicWord("abandon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _salt == salt || _hash == hash {
+		t.Fatal("equal words hashed alike")
+	}
+
+	if VerifyMnemonicWord("abandon", "not hex", hash) || VerifyMnemonicWord("abandon", salt, "not hex") {
+		t.Fatal("verified against a malformed salt or hash")
+	}
+	if VerifyMnemonicWord("abandon", _salt, hash) {
+		t.Fatal("verified with the salt of another word")
+	}
+}
+
+func TestGenerateMnemonic(t *testing.T) {
+	for _, _words := range []int{12, 15, 18, 21, 24} {
+		mnemonic, err := GenerateMnemonic(_words)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(strings.Fields(mnemonic)) != _words || !bip39.IsMnemonicValid(mnemonic) {
+			t.Fatalf("%d words: %q", _words, mnemonic)
+		}
+	}
+	for _, _words := range []int{0, 11, 13, 27} {
+		if _, err := GenerateMnemonic(_words); err == nil {
+			t.Fatalf("generated a %d word mnemonic", _words)
+		}
+	}
+}
+
+func TestRandomIndexes(t *testing.T) {
+	for _i := 0; _i < 50; _i++ {
+		indexes, err := RandomIndexes(3, 4)
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen := map[int]bool{}
+		for _, _index := range indexes {
+			if _index < 1 || _index > 4 || seen[_index] {
+				t.Fatalf("indexes: %v", indexes)
+			}
+			seen[_index] = true
+		}
+	}
+	if _, err := RandomIndexes(5, 4); err == nil {
+		t.Fatal("picked more unique indexes than there are")
+	}
+}
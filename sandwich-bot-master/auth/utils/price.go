@@ -0,0 +1,46 @@
+package utils
+
+import (
+	"auth/config"
+	"common/price"
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+const maticAsset = "matic-network"
+
+var maticPrice struct {
+	sync.Mutex
+	quote price.Quote
+}
+
+// GetMaticPrice returns the USD price of MATIC from the shared price oracle, cached for config.MaticPriceTTL
+var GetMaticPrice = func(ctx context.Context) (decimal.Decimal, error) {
+	maticPrice.Lock()
+	defer maticPrice.Unlock()
+
+	if !maticPrice.quote.At.IsZero() && time.Since(maticPrice.quote.At) <= config.MaticPriceTTL {
+		return maticPrice.quote.Price, nil
+	}
+
+	sources := []price.Oracle{price.CoinGecko{BaseURL: config.CoinGeckoURL, Client: &http.Client{Timeout: 10 * time.Second}}}
+	if config.PriceFixtures != "" {
+		fixtures, err := price.ParseFixtures(config.PriceFixtures)
+		if err != nil {
+			return decimal.Zero, err
+		}
+		sources = append(sources, price.Static{Quotes: fixtures})
+	}
+	oracle := price.Median{Sources: sources, MaxStaleness: config.MaticPriceTTL}
+
+	quotes, err := oracle.Prices(ctx, []string{maticAsset})
+	if err != nil {
+		return decimal.Zero, err
+	}
+	maticPrice.quote = quotes[maticAsset]
+	return maticPrice.quote.Price, nil
+}
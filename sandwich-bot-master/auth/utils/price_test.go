@@ -0,0 +1,65 @@
+package utils
+
+import (
+	"auth/config"
+	"common/price"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestGetMaticPrice(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		fmt.Fprint(w, `{"matic-network": {"usd": 0.7123}}`)
+	}))
+	t.Cleanup(server.Close)
+
+	previousURL, previousTTL := config.CoinGeckoURL, config.MaticPriceTTL
+	config.CoinGeckoURL, config.MaticPriceTTL = server.URL, time.Minute
+	t.Cleanup(func() {
+		config.CoinGeckoURL, config.MaticPriceTTL = previousURL, previousTTL
+		maticPrice.quote = price.Quote{}
+	})
+
+	for _i := 0; _i < 3; _i++ {
+		_price, err := GetMaticPrice(context.Background())
+		if err != nil || !_price.Equal(decimal.RequireFromString("0.7123")) {
+			t.Fatalf("price %s: %v", _price, err)
+		}
+	}
+	// the cached price is used until it is older than the ttl
+	if calls.Load() != 1 {
+		t.Fatalf("asked coingecko %d times", calls.Load())
+	}
+	maticPrice.quote.At = time.Now().Add(-2 * time.Minute)
+	if _, err := GetMaticPrice(context.Background()); err != nil || calls.Load() != 2 {
+		t.Fatalf("stale price was not read again: %d calls, %v", calls.Load(), err)
+	}
+}
+
+func TestGetMaticPriceUnavailable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "rate limited", http.StatusTooManyRequests)
+	}))
+	t.Cleanup(server.Close)
+
+	previousURL := config.CoinGeckoURL
+	config.CoinGeckoURL = server.URL
+	t.Cleanup(func() {
+		config.CoinGeckoURL = previousURL
+		maticPrice.quote = price.Quote{}
+	})
+
+	if _, err := GetMaticPrice(context.Background()); !errors.Is(err, price.ErrUnavailable) {
+		t.Fatalf("want ErrUnavailable, got %v", err)
+	}
+}
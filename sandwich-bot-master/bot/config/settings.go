@@ -4,7 +4,11 @@ import (
 	"bot/models"
 	"encoding/json"
 	"log"
+	"os"
+	"strings"
+	"time"
 
+	"github.com/shopspring/decimal"
 	"gorm.io/datatypes"
 )
 
@@ -33,3 +37,129 @@ func init() {
 		Settings: datatypes.JSON(settingsJSON),
 	}
 }
+
+var (
+	// Accepted clock skew of signed internal requests, nonces are remembered twice as long
+	SignatureMaxSkew = 60 * time.Second
+	// HMAC secret per calling service, SERVICE_SECRETS="telegram=<secret>,auth=<secret>"
+	ServiceSecrets = ParseServiceSecrets(os.Getenv("SERVICE_SECRETS"))
+	// Identity and HMAC secret of the bot's own requests, auth lists them in its SERVICE_SECRETS
+	ServiceName   = getenvDefault("SERVICE_NAME", "bot")
+	ServiceSecret = os.Getenv("SERVICE_SECRET")
+	AuthURL       = getenvDefault("AUTH_URL", "http://auth:30084/auth/api/v1")
+	// HMAC key of the audit log hash chain, entries can not be rewritten and hashed again without it
+	AuditSecret = os.Getenv("AUDIT_SECRET")
+	// How often main wallets are checked against withdrawal_threshold
+	SweepCheckInterval = time.Minute
+	// Unanswered sweep proposals and requests are dropped and proposed again with fresh balances
+	SweepRequestTTL = 30 * time.Minute
+	// How often on-chain allowances of system wallets are re-checked
+	AllowanceCheckInterval = 10 * time.Minute
+	// First scan of a wallet looks this many blocks back for Approval events
+	AllowanceLogLookback = uint64(500000)
+	// Blocks per eth_getLogs call, public nodes reject wide ranges
+	AllowanceLogChunk = uint64(5000)
+	// How long an activated kill switch waits for in-flight attacks before reporting
+	KillSwitchDrainTimeout = 2 * time.Minute
+	// Restart delay of a failed background service, doubled on every failure up to the maximum
+	SupervisorMinBackoff = time.Second
+	SupervisorMaxBackoff = time.Minute
+	// How long a SIGTERM waits for requests, services and in-flight attacks before exiting
+	ShutdownTimeout = 30 * time.Second
+	// How often token prices and the gas oracle are polled
+	PricePollInterval = 5 * time.Second
+	GasPollInterval   = 5 * time.Second
+	// Consumers refuse gas estimates older than this instead of guessing fees
+	GasMaxStaleness = 30 * time.Second
+	// eth_feeHistory window and the reward percentiles of the safe, standard and fast tips
+	GasFeeHistoryBlocks = uint64(20)
+	GasTipPercentiles   = [3]float64{25, 50, 90}
+	PolygonscanURL      = getenvDefault("POLYGONSCAN_URL", "https://api.polygonscan.com/api")
+	PolygonscanAPIKey   = os.Getenv("POLYGONSCAN_API_KEY")
+	// GAS_FIXTURE="base_fee=30,safe_tip=30,standard_tip=35,fast_tip=40" replaces the gas sources for development
+	GasFixture = os.Getenv("GAS_FIXTURE")
+	// Assets priced by the oracle, named by their CoinGecko id
+	PriceAssets = []string{"matic-network", "ethereum"}
+	// Quotes older than this are used neither by the median nor by callers
+	PriceMaxStaleness = 2 * time.Minute
+	// A source further off the median than this fraction raises an alarm
+	PriceMaxDeviation = decimal.NewFromFloat(0.02)
+	CoinGeckoURL      = getenvDefault("COINGECKO_URL", "https://api.coingecko.com/api/v3")
+	// PRICE_FIXTURES="matic-network=0.7,ethereum=3000" adds a static price source for development
+	PriceFixtures = os.Getenv("PRICE_FIXTURES")
+	// The on-chain source averages the reserves of each asset against a stable coin over a window
+	PriceTWAPDEX       = "quickswap"
+	PriceTWAPQuoteCoin = "usdt"
+	PriceTWAPWindow    = 5 * time.Minute
+	PriceTWAPTokens    = map[string]PriceToken{
+		"matic-network": {Address: "0x0d500b1d8e8ef31e21c99d1db9a6444d3adf1270", Decimals: 18, Symbol: "wmatic"},
+		"ethereum":      {Address: "0x7ceb23fd6bc0add59e62ac25578270cff1b9f619", Decimals: 18, Symbol: "weth"},
+	}
+	// Node pool probes, a node is ejected while it fails, lags or answers slowly and restored once it recovers
+	NodeProbeInterval = 10 * time.Second
+	NodeProbeTimeout  = 5 * time.Second
+	NodeProbeWindow   = 10
+	NodeMaxErrorRate  = 0.3
+	NodeMaxLag        = uint64(5)
+	NodeMaxLatency    = 2 * time.Second
+	// Outbound transactions are polled for receipts and settle once this many blocks deep
+	ReceiptPollInterval  = 3 * time.Second
+	ReceiptConfirmations = uint64(16)
+	// A pending transaction the nodes no longer know is dropped after this long
+	ReceiptDropAfter = 10 * time.Minute
+	// An order nothing was sent for fails after OrderSendTimeout, one still unsettled after OrderStuckAfter is reported
+	OrderSendTimeout = time.Minute
+	OrderStuckAfter  = 2 * time.Minute
+	// How often reserved nonces are compared with the chain, a reservation not sent for NonceGapAfter is filled
+	NonceCheckInterval = 15 * time.Second
+	NonceGapAfter      = time.Minute
+	// Claimed events are leased to telegram, failed deliveries back off up to EventMaxBackoff and are given up after EventMaxAttempts
+	EventLease       = time.Minute
+	EventMinBackoff  = 30 * time.Second
+	EventMaxBackoff  = time.Hour
+	EventMaxAttempts = 10
+	// A condition that persists, e.g. a low balance, is reported again after this long
+	EventRepeatAfter = time.Hour
+	// Main wallets holding less MATIC than this cannot pay for gas
+	WalletMinGasBalance = decimal.NewFromInt(1)
+	// Balances of every wallet are valued and stored this often, snapshots older than PortfolioRetention are dropped
+	PortfolioSnapshotInterval = 15 * time.Minute
+	PortfolioRetention        = 90 * 24 * time.Hour
+	// Size of the portfolio chart in pixels
+	PortfolioChartWidth  = 800
+	PortfolioChartHeight = 400
+	// Coins the portfolio and the balancer value 1:1 in USD, by address. Other coins are valued at
+	// the oracle median or not at all
+	StableCoins = map[string]bool{
+		"0xc2132d05d31c914a87c6611c10748aeb04b58e8f": true, // USDT
+		"0x2791bca1f2de4661ed88a30c99a7a9449aa84174": true, // USDC.e
+		"0x3c499c542cef5e3811e1192ce70d8cc03d5c3359": true, // USDC
+		"0x8f3cf7ad23cd3cadbd9735aff958023239c6a063": true, // DAI
+	}
+)
+
+type PriceToken struct {
+	Address  string
+	Decimals int32
+	// how the wallet portfolio names the token
+	Symbol string
+}
+
+func getenvDefault(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func ParseServiceSecrets(raw string) map[string]string {
+	secrets := map[string]string{}
+	for _, _pair := range strings.Split(raw, ",") {
+		name, secret, found := strings.Cut(strings.TrimSpace(_pair), "=")
+		if !found || name == "" || secret == "" {
+			continue
+		}
+		secrets[name] = secret
+	}
+	return secrets
+}
@@ -0,0 +1,118 @@
+package config
+
+import (
+	"bot/models"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+type SettingField struct {
+	Key         string                  `json:"key"`
+	Title       string                  `json:"title"`
+	Type        models.SettingFieldType `json:"type"`
+	Unit        string                  `json:"unit"`
+	Min         *decimal.Decimal        `json:"min"`
+	Max         *decimal.Decimal        `json:"max"`
+	Default     decimal.Decimal         `json:"default"`
+	Description string                  `json:"description"`
+}
+
+func bound(value string) *decimal.Decimal {
+	_value := decimal.RequireFromString(value)
+	return &_value
+}
+
+// SettingsSchema describes every trading setting, updates are validated against it and
+// the telegram settings menu is built from it
+var SettingsSchema = []SettingField{
+	{Key: "gas_fee_max", Title: "Gas Fee Max", Type: models.DecimalSetting, Unit: "gwei", Min: bound("1"), Max: bound("10000"), Default: decimal.NewFromInt(500), Description: "Max gas fee we are comfortable paying"},
+	{Key: "gas_limit", Title: "Gas Limit", Type: models.IntegerSetting, Unit: "units", Min: bound("21000"), Max: bound("30000000"), Default: decimal.NewFromInt(300000), Description: "Gas limit of bot transactions"},
+	{Key: "gas_priority", Title: "Gas Priority", Type: models.DecimalSetting, Unit: "gwei", Min: bound("0"), Max: bound("10000"), Default: decimal.NewFromInt(30), Description: "Priority fee"},
+	{Key: "ttx_max_latency", Title: "TTX Max Latency", Type: models.IntegerSetting, Unit: "ms", Min: bound("1"), Max: bound("60000"), Default: decimal.NewFromInt(275), Description: "Oldest target transaction still worth attacking"},
+	{Key: "exit_gas", Title: "Exit Gas", Type: models.DecimalSetting, Unit: "%", Min: bound("0"), Max: bound("1000"), Default: decimal.NewFromInt(100), Description: "Gas of the exit transaction relative to the entry"},
+	{Key: "slippage", Title: "Slippage", Type: models.FloatSetting, Unit: "%", Min: bound("0"), Max: bound("100"), Default: decimal.NewFromInt(25), Description: "Slippage allowed on tokens the bot buys"},
+	{Key: "target_value_min", Title: "Target Value Min", Type: models.DecimalSetting, Unit: "USD", Min: bound("0"), Default: decimal.NewFromInt(40), Description: "Smallest target transaction value"},
+	{Key: "target_value_max", Title: "Target Value Max", Type: models.DecimalSetting, Unit: "USD", Min: bound("0"), Default: decimal.NewFromInt(1000), Description: "Largest target transaction value"},
+	{Key: "target_gas_markup_allowed", Title: "Target Gas Markup Allowed", Type: models.DecimalSetting, Unit: "%", Min: bound("0"), Max: bound("1000"), Default: decimal.NewFromInt(70), Description: "Target gas price allowed over the network fast gas price"},
+	{Key: "usd_per_trade", Title: "USD Per Trade", Type: models.DecimalSetting, Unit: "%", Min: bound("0"), Max: bound("100"), Default: decimal.NewFromInt(10), Description: "Trade size as a share of the target amount in"},
+	{Key: "deadline", Title: "Deadline", Type: models.IntegerSetting, Unit: "minutes", Min: bound("1"), Max: bound("60"), Default: decimal.NewFromInt(5), Description: "Swap deadline"},
+	{Key: "draw_down", Title: "Draw Down", Type: models.FloatSetting, Unit: "%", Min: bound("0"), Max: bound("1000"), Default: decimal.NewFromInt(200), Description: "Pre-approved draw down"},
+	{Key: "gas_tolerance", Title: "Gas Tolerance", Type: models.FloatSetting, Unit: "%", Min: bound("0"), Max: bound("1000"), Default: decimal.NewFromInt(20), Description: "Gas price over the target transaction gas price"},
+	{Key: "withdrawal_threshold", Title: "Withdrawal Threshold", Type: models.DecimalSetting, Unit: "USD", Min: bound("0"), Default: decimal.NewFromInt(500), Description: "Main wallet value above which profit is swept"},
+}
+
+func SettingFieldByKey(key string) (SettingField, bool) {
+	for _, _field := range SettingsSchema {
+		if _field.Key == key {
+			return _field, true
+		}
+	}
+	return SettingField{}, false
+}
+
+// settingValue returns a value as stored in settings JSON
+func (field SettingField) settingValue(value decimal.Decimal) interface{} {
+	switch field.Type {
+	case models.IntegerSetting:
+		return value.IntPart()
+	case models.FloatSetting:
+		return value.InexactFloat64()
+	}
+	return value
+}
+
+// ParseSetting validates a raw value of a settings field, numbers and numeric strings are accepted
+func ParseSetting(key string, raw json.RawMessage) (interface{}, error) {
+	field, ok := SettingFieldByKey(key)
+	if !ok {
+		return nil, fmt.Errorf("Unknown setting %s", key)
+	}
+
+	value, err := decimal.NewFromString(strings.Trim(strings.TrimSpace(string(raw)), `"`))
+	if err != nil {
+		return nil, fmt.Errorf("%s should be a number", field.Title)
+	}
+	if field.Type == models.IntegerSetting && !value.IsInteger() {
+		return nil, fmt.Errorf("%s should be an integer", field.Title)
+	}
+	if field.Min != nil && value.LessThan(*field.Min) {
+		return nil, fmt.Errorf("%s should be at least %s %s", field.Title, field.Min, field.Unit)
+	}
+	if field.Max != nil && value.GreaterThan(*field.Max) {
+		return nil, fmt.Errorf("%s should be at most %s %s", field.Title, field.Max, field.Unit)
+	}
+
+	return field.settingValue(value), nil
+}
+
+// SettingsDefaults builds a complete settings document from schema defaults
+func SettingsDefaults() map[string]interface{} {
+	settings := map[string]interface{}{}
+	for _, _field := range SettingsSchema {
+		settings[_field.Key] = _field.settingValue(_field.Default)
+	}
+	return settings
+}
+
+// ValidateSettings checks rules spanning several fields of a complete settings document
+func ValidateSettings(settings map[string]interface{}) error {
+	valueOf := func(key string) (decimal.Decimal, error) {
+		return decimal.NewFromString(strings.Trim(fmt.Sprint(settings[key]), `"`))
+	}
+
+	targetValueMin, err := valueOf("target_value_min")
+	if err != nil {
+		return err
+	}
+	targetValueMax, err := valueOf("target_value_max")
+	if err != nil {
+		return err
+	}
+	if targetValueMin.GreaterThan(targetValueMax) {
+		return fmt.Errorf("Target Value Min %s is above Target Value Max %s", targetValueMin, targetValueMax)
+	}
+	return nil
+}
@@ -12,6 +12,29 @@ import (
 
 var DB *gorm.DB
 
+// Models are migrated on every start
+var Models = []interface{}{
+	&models.Blockchain{},
+	&models.Order{},
+	&models.Reject{},
+	&models.Transaction{},
+	&models.Settings{},
+	&models.Wallet{},
+	&models.KillSwitch{},
+	&models.Contract{},
+	&models.DEX{},
+	&models.Coin{},
+	&models.WalletRotation{},
+	&models.Sweep{},
+	&models.Allowance{},
+	&models.AllowanceCursor{},
+	&models.NonceReservation{},
+	&models.Event{},
+	&models.AuditEntry{},
+	&models.PortfolioSnapshot{},
+	&models.PortfolioHolding{},
+}
+
 func ConnectDatabase() {
 	var err error
 
@@ -32,16 +55,17 @@ func ConnectDatabase() {
 		panic("Failed to connect to database!")
 	}
 
-	DB.AutoMigrate(
-		&models.Blockchain{},
-		&models.Order{},
-		&models.Reject{},
-		&models.Transaction{},
-		&models.Settings{},
-		&models.Wallet{},
-		&models.KillSwitch{},
-		&models.Contract{},
-		&models.DEX{},
-		&models.Coin{},
-	)
+	DB.AutoMigrate(Models...)
+}
+
+// CloseDatabase closes the connection pool once nothing queries the database anymore
+func CloseDatabase() {
+	sqlDB, err := DB.DB()
+	if err != nil {
+		log.Printf("Failed to access database pool: %v", err)
+		return
+	}
+	if err := sqlDB.Close(); err != nil {
+		log.Printf("Failed to close database: %v", err)
+	}
 }
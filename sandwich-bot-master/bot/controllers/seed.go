@@ -1,14 +1,12 @@
 package controllers
 
 import (
+	"bot/config"
 	"bot/models"
 	"bot/utils"
 	"encoding/json"
-	"log"
 	"time"
 
-	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/rpc"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 )
@@ -42,23 +40,9 @@ func Seed() {
 		DoUpdates: clause.AssignmentColumns([]string{"name", "chain_id", "currency"}),
 	}).Create(&blockchain)
 
-	_settings, _ := json.Marshal(map[string]interface{}{
-		"gas_fee_max":               500,    // GWEI -- Max Gas Fee we are comfortable paying
-		"gas_limit":                 300000, // Units
-		"gas_priority":              getDynamicGasPrice(),     // GWEI dynamically fetched
-		"ttx_max_latency":           275,    // ms
-		"dex_fee":                   300,
-		"exit_gas":                  100,   // percentage
-		"slippage":                  25,    // percentage of token bot's buying
-		"target_value_min":          40,    // USD
-		"target_value_max":          1000,  // USD
-		"target_gas_markup_allowed": 70,    // percentage of target tx GasPrice compared to network fast gas price
-		"usd_per_trade":             10.0,  // percentage of target tx amountIn
-		"deadline":                  5,     // minutes
-		"draw_down":                 200,   // percentage preapproved
-		"gas_tolerance":             20,    // how much higher over target tx gas price
-		"withdrawal_threshold":      500.0, // USD
-	})
+	// defaults come from the settings schema, network fees come from the gas oracle at runtime
+	defaultSettings := config.SettingsDefaults()
+	_settings, _ := json.Marshal(defaultSettings)
 
 	settings := []models.Settings{
 		{
@@ -197,21 +181,3 @@ func Seed() {
 		DoUpdates: clause.AssignmentColumns([]string{"blacklist", "address", "name"}),
 	}).Create(&_contractsListings)
 }
-
-// Helper function to get dynamic gas price
-func getDynamicGasPrice() int {
-	client, err := rpc.Dial("https://polygon-rpc.com")
-	if err != nil {
-		log.Fatalf("Failed to connect to Polygon RPC: %v", err)
-	}
-	defer client.Close()
-
-	var result string
-	err = client.Call(&result, "eth_gasPrice")
-	if err != nil {
-		log.Fatalf("Failed to get gas price: %v", err)
-	}
-
-	gasPrice := utils.HexToInt(result) / 1e9 // Convert from Wei to GWEI
-	return gasPrice
-}
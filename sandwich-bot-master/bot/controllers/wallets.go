@@ -0,0 +1,41 @@
+package controllers
+
+import (
+	"bot/models"
+	"bot/utils"
+	"fmt"
+)
+
+// EncryptWalletKeys seals legacy plaintext wallet keys and clears the plaintext column
+func EncryptWalletKeys() (int, error) {
+	var wallets []models.Wallet
+	if err := DB.Unscoped().Find(&wallets, "private_key IS NOT NULL AND private_key <> ''").Error; err != nil {
+		return 0, err
+	}
+
+	encrypted := 0
+	for _, _wallet := range wallets {
+		sealedKey, wrappedKey, kekID, err := utils.SealPrivateKey(*_wallet.PrivateKey)
+		if err != nil {
+			return encrypted, err
+		}
+
+		// make sure the key can be opened before the plaintext is dropped
+		plain, err := utils.OpenPrivateKey(sealedKey, wrappedKey, kekID)
+		if err != nil || string(plain) != *_wallet.PrivateKey {
+			return encrypted, fmt.Errorf("failed to verify sealed key of wallet %d: %v", _wallet.ID, err)
+		}
+
+		if err := DB.Unscoped().Model(&models.Wallet{}).Where("id = ?", _wallet.ID).Updates(map[string]interface{}{
+			"sealed_key":  sealedKey,
+			"wrapped_key": wrappedKey,
+			"kek_id":      kekID,
+			"private_key": nil,
+		}).Error; err != nil {
+			return encrypted, err
+		}
+		encrypted++
+	}
+
+	return encrypted, nil
+}
@@ -0,0 +1,304 @@
+package handlers
+
+import (
+	"bot/config"
+	"bot/controllers"
+	"bot/models"
+	"bot/utils"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// keccak256("Approval(address,address,uint256)"), shared by ERC-20 and ERC-721
+var approvalEventID = crypto.Keccak256Hash([]byte("Approval(address,address,uint256)"))
+
+var ErrAllowanceRevoked = errors.New("allowance is already revoked")
+
+func RunAllowanceMonitor(ctx context.Context) error {
+	return utils.Every(ctx, config.AllowanceCheckInterval, func() {
+		if err := CheckAllowances(); err != nil {
+			log.Printf("Allowance monitor: %v", err)
+		}
+	})
+}
+
+// allowanceSpenders tells current DEX routers apart from routers deleted from bot_dexs
+func allowanceSpenders() (map[string]bool, map[string]bool, error) {
+	var dexs []models.DEX
+	if err := controllers.DB.Unscoped().Find(&dexs).Error; err != nil {
+		return nil, nil, err
+	}
+
+	current, removed := map[string]bool{}, map[string]bool{}
+	for _, _dex := range dexs {
+		address := strings.ToLower(*_dex.Address)
+		if _dex.DeletedAt.Valid {
+			removed[address] = true
+		} else {
+			current[address] = true
+		}
+	}
+	// a router can be deleted and connected again
+	for _address := range current {
+		delete(removed, _address)
+	}
+	return current, removed, nil
+}
+
+// CheckAllowances refreshes allowances of every active wallet from on-chain state
+func CheckAllowances() error {
+	var wallets []models.Wallet
+	if err := controllers.DB.Find(&wallets, "active = true").Error; err != nil {
+		return err
+	}
+
+	current, removed, err := allowanceSpenders()
+	if err != nil {
+		return err
+	}
+
+	client, err := supportClient()
+	if err != nil {
+		return err
+	}
+
+	erc20ABI, err := loadERC20ABI()
+	if err != nil {
+		return err
+	}
+
+	for _, _wallet := range wallets {
+		if err := checkWalletAllowances(client, erc20ABI, _wallet, current, removed); err != nil {
+			log.Printf("Allowance monitor: wallet %s: %v", *_wallet.Address, err)
+		}
+	}
+	return nil
+}
+
+// approvalSpenders collects token and spender pairs of Approval events emitted for owner since the last scan
+func approvalSpenders(client *ethclient.Client, wallet models.Wallet) (map[[2]string]struct{}, uint64, error) {
+	latest, err := client.BlockNumber(context.Background())
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var cursor models.AllowanceCursor
+	from := uint64(0)
+	if err := controllers.DB.First(&cursor, "wallet_id = ?", wallet.ID).Error; err == nil {
+		from = cursor.Block + 1
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, 0, err
+	} else if latest > config.AllowanceLogLookback {
+		from = latest - config.AllowanceLogLookback
+	}
+
+	owner := common.BytesToHash(common.HexToAddress(*wallet.Address).Bytes())
+	pairs := map[[2]string]struct{}{}
+	for start := from; start <= latest; start += config.AllowanceLogChunk {
+		end := start + config.AllowanceLogChunk - 1
+		if end > latest {
+			end = latest
+		}
+
+		logs, err := client.FilterLogs(context.Background(), ethereum.FilterQuery{
+			FromBlock: new(big.Int).SetUint64(start),
+			ToBlock:   new(big.Int).SetUint64(end),
+			Topics:    [][]common.Hash{{approvalEventID}, {owner}},
+		})
+		if err != nil {
+			return nil, 0, err
+		}
+		for _, _log := range logs {
+			// ERC-721 approvals index the token id as a fourth topic
+			if len(_log.Topics) != 3 {
+				continue
+			}
+			spender := common.BytesToAddress(_log.Topics[2].Bytes())
+			pairs[[2]string{strings.ToLower(_log.Address.Hex()), strings.ToLower(spender.Hex())}] = struct{}{}
+		}
+	}
+
+	return pairs, latest, nil
+}
+
+func checkWalletAllowances(client *ethclient.Client, erc20ABI abi.ABI, wallet models.Wallet, current, removed map[string]bool) error {
+	pairs, latest, err := approvalSpenders(client, wallet)
+	if err != nil {
+		return err
+	}
+
+	// routers the bot approves itself and every pair seen before are always re-read
+	for _, _token := range knownTokens() {
+		for _dexAddress := range current {
+			pairs[[2]string{strings.ToLower(_token.Hex()), _dexAddress}] = struct{}{}
+		}
+	}
+	var known []models.Allowance
+	if err := controllers.DB.Find(&known, "wallet_id = ?", wallet.ID).Error; err != nil {
+		return err
+	}
+	knownAmounts := map[[2]string]string{}
+	for _, _allowance := range known {
+		pair := [2]string{*_allowance.Token, *_allowance.Spender}
+		pairs[pair] = struct{}{}
+		knownAmounts[pair] = *_allowance.Amount
+	}
+
+	owner := common.HexToAddress(*wallet.Address)
+	now := time.Now()
+	for _pair := range pairs {
+		amount, err := NewERC20Token(common.HexToAddress(_pair[0]), client, erc20ABI, nil).Allowance(owner, common.HexToAddress(_pair[1]))
+		if err != nil {
+			log.Printf("Failed to read allowance of %s on %s for %s: %v", _pair[1], _pair[0], *wallet.Address, err)
+			continue
+		}
+
+		knownAmount, seen := knownAmounts[_pair]
+		if !seen && amount.Sign() == 0 {
+			continue
+		}
+
+		spenderType := models.UnknownSpender
+		if current[_pair[1]] {
+			spenderType = models.DEXSpender
+		} else if removed[_pair[1]] {
+			spenderType = models.RemovedDEXSpender
+		}
+
+		token, spender, _amount := _pair[0], _pair[1], amount.String()
+		allowance := models.Allowance{
+			BlockchainID: wallet.BlockchainID,
+			WalletID:     &wallet.ID,
+			Token:        &token,
+			Spender:      &spender,
+			Amount:       &_amount,
+			SpenderType:  spenderType,
+			Stale:        spenderType != models.DEXSpender && amount.Sign() > 0,
+			CheckedAt:    &now,
+		}
+
+		columns := []string{"amount", "spender_type", "stale", "checked_at", "updated_at"}
+		if err := controllers.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "wallet_id"}, {Name: "token"}, {Name: "spender"}},
+				DoUpdates: clause.AssignmentColumns(columns),
+			}).Create(&allowance).Error; err != nil {
+				return err
+			}
+			if !seen {
+				knownAmount = "0"
+			}
+			// swaps keep consuming allowances of current routers, only their revocation is reported
+			if knownAmount == _amount || (spenderType == models.DEXSpender && amount.Sign() > 0) {
+				return nil
+			}
+			return publishAllowanceChanged(tx, wallet, allowance, knownAmount, latest)
+		}); err != nil {
+			return err
+		}
+
+		if !seen && spenderType == models.UnknownSpender {
+			log.Printf("Unexpected spender %s holds %s allowance of %s for %s", spender, _amount, token, *wallet.Address)
+		}
+	}
+
+	return controllers.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "wallet_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"block", "updated_at"}),
+	}).Create(&models.AllowanceCursor{WalletID: &wallet.ID, Block: latest}).Error
+}
+
+// RevokeAllowance sets the allowance to zero through ERC20Token.Revoke and records the transaction
+func RevokeAllowance(allowanceID uint) error {
+	if KillSwitchOn() {
+		return ErrKillSwitchOn
+	}
+	var allowance models.Allowance
+	if err := controllers.DB.Preload("Wallet").First(&allowance, allowanceID).Error; err != nil {
+		return err
+	}
+	if *allowance.Amount == "0" {
+		return ErrAllowanceRevoked
+	}
+
+	client, err := supportClient()
+	if err != nil {
+		return err
+	}
+
+	erc20ABI, err := loadERC20ABI()
+	if err != nil {
+		return err
+	}
+
+	auth, err := WalletTransactor(*allowance.Wallet, CHAIN_ID)
+	if err != nil {
+		return err
+	}
+	if err := withOracleGas(auth); err != nil {
+		return err
+	}
+	erc20Token := NewERC20Token(common.HexToAddress(*allowance.Token), client, erc20ABI, nil)
+	spender := common.HexToAddress(*allowance.Spender)
+
+	nonces, err := ReserveNonces(*allowance.Wallet.Address, 1, "revoke")
+	if err != nil {
+		return err
+	}
+	auth.Nonce = new(big.Int).SetUint64(nonces[0])
+	tx, err := erc20Token.Revoke(spender, auth)
+	if err != nil {
+		ReleaseNonce(*allowance.Wallet.Address, nonces[0])
+		return err
+	}
+	revokeHash := tx.Hash().Hex()
+	MarkNonceSent(*allowance.Wallet.Address, nonces[0], revokeHash)
+	TrackOutbound(tx, *allowance.Wallet.Address, "revoke")
+	if err := controllers.DB.Model(&allowance).Update("revoke_hash", revokeHash).Error; err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), RecordedTxTimeout)
+	defer cancel()
+	receipt, err := bind.WaitMined(ctx, client, tx)
+	if err != nil {
+		return err
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		return fmt.Errorf("revoke %s reverted", revokeHash)
+	}
+
+	amount, err := erc20Token.Allowance(common.HexToAddress(*allowance.Wallet.Address), spender)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if err := controllers.DB.Model(&allowance).Updates(map[string]interface{}{
+		"amount":     amount.String(),
+		"stale":      false,
+		"checked_at": &now,
+	}).Error; err != nil {
+		return err
+	}
+
+	// keep the attack path from relying on an allowance that is gone
+	WalletAllowance.Delete(allowanceKey{strings.ToLower(*allowance.Wallet.Address), *allowance.Token, *allowance.Spender})
+
+	log.Printf("Allowance of %s on %s for %s revoked in %s", *allowance.Spender, *allowance.Token, *allowance.Wallet.Address, revokeHash)
+	return nil
+}
@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	"bot/config"
+	"bot/controllers"
+	"bot/models"
+	"common/audit"
+)
+
+// auditLog is the hash chain of bot_audit_log, keyed with AUDIT_SECRET
+func auditLog() audit.Chain {
+	return audit.Chain{Table: models.AuditEntry{}.TableName(), Key: []byte(config.AuditSecret)}
+}
+
+// AppendAudit links entry to the last one of the audit log and writes it
+func AppendAudit(entry models.AuditEntry) error {
+	return auditLog().Append(controllers.DB, audit.Entry(entry))
+}
+
+// VerifyAuditLog walks the audit log from its first entry and reports the first one that does not
+// link to its predecessor or whose content does not match its hash
+func VerifyAuditLog() (audit.Verification, error) {
+	return auditLog().Verify(controllers.DB)
+}
@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"bot/config"
+	"bytes"
+	"common/signature"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+var authClient = &http.Client{Timeout: 10 * time.Second}
+
+type authResponse struct {
+	Status  string          `json:"status"`
+	Data    json.RawMessage `json:"data"`
+	Message string          `json:"message"`
+}
+
+// AuthError is a request auth refused, Message is what auth answered
+type AuthError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *AuthError) Error() string {
+	return e.Message
+}
+
+// authRequest sends a signed request to auth and decodes the data of its response into result
+func authRequest(ctx context.Context, method, path string, payload, result interface{}) error {
+	return authRequestAs(ctx, nil, method, path, payload, result)
+}
+
+// authRequestAs signs userID into the request, auth takes it as the user the request is made for.
+// A nil payload sends no body, query parameters go into path.
+func authRequestAs(ctx context.Context, userID *uint, method, path string, payload, result interface{}) error {
+	if config.ServiceSecret == "" {
+		return errors.New("SERVICE_SECRET is not set, auth rejects unsigned requests")
+	}
+
+	var body []byte
+	if payload != nil {
+		var err error
+		if body, err = json.Marshal(payload); err != nil {
+			return err
+		}
+	}
+	request, err := http.NewRequestWithContext(ctx, method, fmt.Sprintf("%s/%s", config.AuthURL, path), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if userID != nil {
+		request.Header.Set(signature.HeaderUserID, strconv.FormatUint(uint64(*userID), 10))
+	}
+	if err := signature.SignRequest(request, body, config.ServiceName, config.ServiceSecret); err != nil {
+		return err
+	}
+
+	response, err := authClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	var _response authResponse
+	if err := json.NewDecoder(response.Body).Decode(&_response); err != nil {
+		return fmt.Errorf("auth %s answered %s: %v", path, response.Status, err)
+	}
+	if response.StatusCode >= http.StatusBadRequest {
+		return &AuthError{StatusCode: response.StatusCode, Message: _response.Message}
+	}
+	if result == nil || len(_response.Data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(_response.Data, result)
+}
+
+// cancelApprovalRequests cancels approval requests nobody consumed yet, an approval given before
+// the kill switch must not be used after it
+func cancelApprovalRequests(ctx context.Context, reason string) (int, error) {
+	var result struct {
+		Cancelled int `json:"cancelled"`
+	}
+	if err := authRequest(ctx, "POST", "cancel_approval_requests", map[string]interface{}{"reason": reason}, &result); err != nil {
+		return 0, err
+	}
+	return result.Cancelled, nil
+}
+
+var (
+	ErrSweepApproval       = errors.New("Approval request does not belong to this sweep")
+	ErrSweepApprover       = errors.New("Sweep has to be approved by an owner other than the requester")
+	ErrSweepApprovalClosed = errors.New("Approval request of this sweep is no longer open")
+)
+
+type approvalRequest struct {
+	Action      string `json:"action"`
+	Status      string `json:"status"`
+	RequestedBy uint   `json:"requested_by"`
+	Payload     struct {
+		SweepID string `json:"sweep_id"`
+	} `json:"payload"`
+	Approvals []struct {
+		UserID   uint `json:"user_id"`
+		Approved bool `json:"approved"`
+	} `json:"approvals"`
+}
+
+// CheckSweepApproval makes sure requestID is an open sweep_profit request userID made for sweepID
+func CheckSweepApproval(ctx context.Context, userID uint, requestID, sweepID string) error {
+	var request approvalRequest
+	if err := authRequestAs(ctx, &userID, "GET", "retrieve_approval_request?request_id="+url.QueryEscape(requestID), nil, &request); err != nil {
+		return err
+	}
+	if request.Action != "sweep_profit" || request.RequestedBy != userID || request.Payload.SweepID != sweepID {
+		return ErrSweepApproval
+	}
+	if request.Status != "pending" && request.Status != "approved" {
+		return ErrSweepApprovalClosed
+	}
+	return nil
+}
+
+// ConsumeSweepApproval uses up the approval of a sweep and returns the owner who confirmed it,
+// auth refuses to consume a request that was not approved for this sweep
+func ConsumeSweepApproval(ctx context.Context, userID uint, requestID, sweepID string) (uint, error) {
+	var request approvalRequest
+	if err := authRequestAs(ctx, &userID, "POST", "consume_approval_request", map[string]interface{}{
+		"request_id": requestID,
+		"action":     "sweep_profit",
+		"payload":    map[string]interface{}{"sweep_id": sweepID},
+	}, &request); err != nil {
+		return 0, err
+	}
+
+	// the requester's own approval does not count
+	for _, _approval := range request.Approvals {
+		if _approval.Approved && _approval.UserID != userID {
+			return _approval.UserID, nil
+		}
+	}
+	return 0, ErrSweepApprover
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"bot/config"
+	"common/signature"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// fakeAuth answers every request with response and records the signed user and body it was sent
+func fakeAuth(t *testing.T, code int, response interface{}) (userIDs *[]string, bodies *[]map[string]interface{}) {
+	t.Helper()
+	userIDs, bodies = &[]string{}, &[]map[string]interface{}{}
+	verifier := signature.NewVerifier(map[string]string{"bot": "secret"}, time.Minute)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := verifier.Verify(r); err != nil {
+			t.Errorf("request to %s: %v", r.URL, err)
+		}
+		body, _ := io.ReadAll(r.Body)
+		*userIDs = append(*userIDs, r.Header.Get(signature.HeaderUserID))
+		_body := map[string]interface{}{}
+		json.Unmarshal(body, &_body)
+		*bodies = append(*bodies, _body)
+
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": "success", "data": response, "message": "answered"})
+	}))
+	t.Cleanup(server.Close)
+
+	previousURL, previousName, previousSecret := config.AuthURL, config.ServiceName, config.ServiceSecret
+	config.AuthURL, config.ServiceName, config.ServiceSecret = server.URL, "bot", "secret"
+	t.Cleanup(func() {
+		config.AuthURL, config.ServiceName, config.ServiceSecret = previousURL, previousName, previousSecret
+	})
+	return userIDs, bodies
+}
+
+func sweepApprovalResponse(status, sweepID string, approvers ...uint) map[string]interface{} {
+	approvals := []map[string]interface{}{}
+	for _, _approver := range approvers {
+		approvals = append(approvals, map[string]interface{}{"user_id": _approver, "approved": true})
+	}
+	return map[string]interface{}{
+		"action":       "sweep_profit",
+		"status":       status,
+		"requested_by": 1,
+		"payload":      map[string]interface{}{"sweep_id": sweepID},
+		"approvals":    approvals,
+	}
+}
+
+func TestCheckSweepApproval(t *testing.T) {
+	cases := []struct {
+		name     string
+		response map[string]interface{}
+		userID   uint
+		want     error
+	}{
+		{"pending", sweepApprovalResponse("pending", "swp-1"), 1, nil},
+		{"other sweep", sweepApprovalResponse("pending", "swp-2"), 1, ErrSweepApproval},
+		{"other requester", sweepApprovalResponse("pending", "swp-1"), 2, ErrSweepApproval},
+		{"consumed", sweepApprovalResponse("consumed", "swp-1"), 1, ErrSweepApprovalClosed},
+	}
+	for _, _case := range cases {
+		t.Run(_case.name, func(t *testing.T) {
+			userIDs, _ := fakeAuth(t, http.StatusOK, _case.response)
+			if err := CheckSweepApproval(context.Background(), _case.userID, "req-1", "swp-1"); !errors.Is(err, _case.want) {
+				t.Fatalf("want %v, got %v", _case.want, err)
+			}
+			// auth checks the request against the signed user, not one the bot was handed in a body
+			if len(*userIDs) != 1 || (*userIDs)[0] == "" {
+				t.Fatalf("signed users: %v", *userIDs)
+			}
+		})
+	}
+}
+
+func TestConsumeSweepApproval(t *testing.T) {
+	userIDs, bodies := fakeAuth(t, http.StatusOK, sweepApprovalResponse("consumed", "swp-1", 1, 2))
+	approvedBy, err := ConsumeSweepApproval(context.Background(), 1, "req-1", "swp-1")
+	if err != nil || approvedBy != 2 {
+		t.Fatalf("approved by %d: %v", approvedBy, err)
+	}
+	// the approval is consumed for this sweep only
+	payload, _ := (*bodies)[0]["payload"].(map[string]interface{})
+	if (*userIDs)[0] != "1" || (*bodies)[0]["action"] != "sweep_profit" || payload["sweep_id"] != "swp-1" {
+		t.Fatalf("consumed as %v with %v", *userIDs, *bodies)
+	}
+
+	// the requester's own approval does not count
+	fakeAuth(t, http.StatusOK, sweepApprovalResponse("consumed", "swp-1", 1))
+	if _, err := ConsumeSweepApproval(context.Background(), 1, "req-1", "swp-1"); !errors.Is(err, ErrSweepApprover) {
+		t.Fatalf("want ErrSweepApprover, got %v", err)
+	}
+
+	// a refusal keeps the status auth answered with
+	fakeAuth(t, http.StatusConflict, nil)
+	var authErr *AuthError
+	if _, err := ConsumeSweepApproval(context.Background(), 1, "req-1", "swp-2"); !errors.As(err, &authErr) || authErr.StatusCode != http.StatusConflict {
+		t.Fatalf("want a 409 from auth, got %v", err)
+	}
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+const RecordedTxTimeout = 5 * time.Minute
+
+// EncodeRawTx serializes a signed transaction so it can be stored before broadcasting
+func EncodeRawTx(tx *types.Transaction) (string, error) {
+	raw, err := tx.MarshalBinary()
+	if err != nil {
+		return "", err
+	}
+	return hexutil.Encode(raw), nil
+}
+
+// AwaitRecordedTx waits for a stored transaction to be mined. It is broadcast again when the
+// node does not know it, e.g. the process stopped between recording and sending it.
+func AwaitRecordedTx(client *ethclient.Client, rawTx string) (*types.Receipt, error) {
+	raw, err := hexutil.Decode(rawTx)
+	if err != nil {
+		return nil, err
+	}
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(raw); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), RecordedTxTimeout)
+	defer cancel()
+
+	if _, _, err := client.TransactionByHash(ctx, tx.Hash()); errors.Is(err, ethereum.NotFound) {
+		if err := client.SendTransaction(ctx, tx); err != nil {
+			return nil, fmt.Errorf("failed to broadcast %s: %w", tx.Hash().Hex(), err)
+		}
+	}
+
+	receipt, err := bind.WaitMined(ctx, client, tx)
+	if err != nil {
+		return nil, fmt.Errorf("failed waiting for %s: %w", tx.Hash().Hex(), err)
+	}
+	return receipt, nil
+}
@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// ethClients are shared per node url and stay open until CloseClients on shutdown
+var ethClients = newStateStore[string, *ethclient.Client]()
+
+func dialClient(ctx context.Context, url string) (*ethclient.Client, error) {
+	if client, ok := ethClients.Load(url); ok {
+		return client, nil
+	}
+
+	client, err := ethclient.DialContext(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	// another goroutine dialed the same node meanwhile, its client wins
+	if !ethClients.StoreIfAbsent(url, client) {
+		client.Close()
+		if client, ok := ethClients.Load(url); ok {
+			return client, nil
+		}
+		return nil, errors.New("node client was closed")
+	}
+	return client, nil
+}
+
+// CloseClients closes every shared node connection, it is the last step of a shutdown
+func CloseClients() {
+	for _, _url := range ethClients.Keys() {
+		if client, ok := ethClients.Load(_url); ok {
+			client.Close()
+		}
+		ethClients.Delete(_url)
+	}
+}
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"bot/controllers"
+	"fmt"
+	"strings"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestDB points controllers.DB at a migrated in-memory database for the duration of the test
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := fmt.Sprintf("file:%s?mode=memory&cache=shared", strings.ReplaceAll(t.Name(), "/", "_"))
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// one connection keeps the shared in-memory database alive and serializes writers
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(controllers.Models...); err != nil {
+		t.Fatal(err)
+	}
+
+	previous := controllers.DB
+	controllers.DB = db
+	t.Cleanup(func() {
+		controllers.DB = previous
+		sqlDB.Close()
+	})
+	return db
+}
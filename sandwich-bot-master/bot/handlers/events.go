@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"bot/config"
+	"bot/controllers"
+	"bot/models"
+	"bot/types"
+	"common/price"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// PublishEvent writes an event to the outbox through tx, pass the transaction of the change the event
+// reports so both are committed together. An event with a key published before is dropped
+func PublishEvent(tx *gorm.DB, category models.EventCategoryType, dedupKey string, payload interface{}) error {
+	rawPayload, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	return tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "dedup_key"}},
+		DoNothing: true,
+	}).Create(&models.Event{
+		Category:      category,
+		DedupKey:      fmt.Sprintf("%s:%s", category, dedupKey),
+		Payload:       rawPayload,
+		Status:        models.EventPending,
+		NextAttemptAt: time.Now(),
+	}).Error
+}
+
+// publishEvent is PublishEvent for changes that were not written in a transaction, failures are only logged
+func publishEvent(category models.EventCategoryType, dedupKey string, payload interface{}) {
+	if err := PublishEvent(controllers.DB, category, dedupKey, payload); err != nil {
+		log.Printf("Failed to publish %s event %s: %v", category, dedupKey, err)
+	}
+}
+
+// PublishSettingsChanged reports a new settings version with the fields it changed against the previous one
+func PublishSettingsChanged(tx *gorm.DB, previous, current models.Settings) error {
+	changes, err := DiffSettings(previous.Settings, current.Settings)
+	if err != nil {
+		return err
+	}
+
+	return PublishEvent(tx, models.SettingsChangedEvent, fmt.Sprint(current.ID), types.SettingsChangedEventType{
+		Version:    current.ID,
+		UserID:     current.CreatedBy,
+		RollbackOf: current.RollbackOf,
+		Changes:    changes,
+	})
+}
+
+func publishOrderStuck(tx *gorm.DB, order models.Order) error {
+	return PublishEvent(tx, models.OrderStuckEvent, fmt.Sprint(order.ID), types.OrderStuckEventType{
+		OrderID: order.ID,
+		Status:  string(order.Status.Status),
+		Hash:    *order.Hash,
+		Since:   order.CreatedAt.Format(time.RFC3339),
+	})
+}
+
+// publishAllowanceChanged reports an allowance that differs from the last scan, block tells scans apart
+func publishAllowanceChanged(tx *gorm.DB, wallet models.Wallet, allowance models.Allowance, from string, block uint64) error {
+	return PublishEvent(tx, models.AllowanceChangedEvent, fmt.Sprintf("%d:%s:%s:%d", wallet.ID, *allowance.Token, *allowance.Spender, block), types.AllowanceChangedEventType{
+		Wallet:      *wallet.Address,
+		Token:       *allowance.Token,
+		Spender:     *allowance.Spender,
+		SpenderType: string(allowance.SpenderType),
+		From:        from,
+		To:          *allowance.Amount,
+		AllowanceID: allowance.ID,
+	})
+}
+
+// publishSweepProposed offers a sweep to the owners, the message carries a button to request it
+func publishSweepProposed(tx *gorm.DB, sweep models.Sweep, from, to string) error {
+	return PublishEvent(tx, models.SweepProposedEvent, sweep.Uid, types.SweepProposedEventType{
+		SweepID:        sweep.Uid,
+		Wallet:         from,
+		ToWallet:       to,
+		TokenName:      sweep.TokenName,
+		Amount:         *sweep.Amount,
+		UsdValue:       sweep.UsdValue.String(),
+		WalletUsdValue: sweep.WalletUsdValue.String(),
+	})
+}
+
+// publishKillSwitchSummary reports what happened to in-flight work once the kill switch settled
+func publishKillSwitchSummary(tx *gorm.DB, killSwitchID uint, summary KillSwitchSummary) error {
+	summaryJSON, err := json.Marshal(summary)
+	if err != nil {
+		return err
+	}
+	return PublishEvent(tx, models.KillSwitchEvent, fmt.Sprintf("%d:summary", killSwitchID), types.KillSwitchEventType{
+		KillSwitchID: killSwitchID,
+		IsOn:         summary.On,
+		Summary:      summaryJSON,
+	})
+}
+
+// publishPriceDeviation reports a source that started deviating from the median, at tells the
+// episodes of the same source apart
+func publishPriceDeviation(deviation price.Deviation, at time.Time) {
+	publishEvent(models.PriceDeviationEvent, fmt.Sprintf("%s:%s:%d", deviation.Asset, deviation.Source, at.UnixNano()), types.PriceDeviationEventType{
+		Asset:     deviation.Asset,
+		Source:    deviation.Source,
+		Price:     deviation.Price.String(),
+		Median:    deviation.Median.String(),
+		Deviation: deviation.Deviation.String(),
+	})
+}
+
+func publishWalletBalanceLow(address string, balance decimal.Decimal) {
+	publishEvent(models.WalletBalanceLowEvent, fmt.Sprintf("%s:%s", strings.ToLower(address), eventWindow(time.Now())), types.WalletBalanceLowEventType{
+		Address: address,
+		Balance: balance.String(),
+		Minimum: config.WalletMinGasBalance.String(),
+	})
+}
+
+// eventWindow names the EventRepeatAfter window of t, a dedup key holding it repeats a persisting
+// condition once per window
+func eventWindow(t time.Time) string {
+	return fmt.Sprint(t.Truncate(config.EventRepeatAfter).Unix())
+}
+
+// ClaimEvents leases up to limit pending events for delivery, oldest first. An event not acknowledged
+// within EventLease is claimed again
+func ClaimEvents(limit int) ([]models.Event, error) {
+	var events []models.Event
+	err := controllers.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Order("id").Limit(limit).
+			Find(&events, "status = ? AND next_attempt_at <= ?", models.EventPending, now).Error; err != nil {
+			return err
+		}
+		if len(events) == 0 {
+			return nil
+		}
+
+		ids := make([]uint, len(events))
+		for _i := range events {
+			ids[_i] = events[_i].ID
+			events[_i].Attempts++
+		}
+		return tx.Model(&models.Event{}).Where("id IN ?", ids).Updates(map[string]interface{}{
+			"attempts":        gorm.Expr("attempts + 1"),
+			"next_attempt_at": now.Add(config.EventLease),
+		}).Error
+	})
+	return events, err
+}
+
+// AckEvents settles claimed events, failed ones are retried with backoff until EventMaxAttempts
+func AckEvents(delivered []uint, failed map[uint]string) error {
+	return controllers.DB.Transaction(func(tx *gorm.DB) error {
+		if len(delivered) > 0 {
+			if err := tx.Model(&models.Event{}).
+				Where("id IN ? AND status = ?", delivered, models.EventPending).
+				Updates(map[string]interface{}{
+					"status":       models.EventDelivered,
+					"delivered_at": time.Now(),
+				}).Error; err != nil {
+				return err
+			}
+		}
+
+		for _id, _error := range failed {
+			var event models.Event
+			if err := tx.First(&event, "id = ? AND status = ?", _id, models.EventPending).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					continue
+				}
+				return err
+			}
+
+			fields := map[string]interface{}{
+				"last_error":      _error,
+				"next_attempt_at": time.Now().Add(eventBackoff(event.Attempts)),
+			}
+			if event.Attempts >= config.EventMaxAttempts {
+				fields["status"] = models.EventFailed
+				log.Printf("Event %d (%s) failed after %d attempts: %s", event.ID, event.Category, event.Attempts, _error)
+			}
+			if err := tx.Model(&event).Updates(fields).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// eventBackoff doubles EventMinBackoff with every attempt up to EventMaxBackoff
+func eventBackoff(attempts int) time.Duration {
+	backoff := config.EventMinBackoff
+	for _i := 1; _i < attempts && backoff < config.EventMaxBackoff; _i++ {
+		backoff *= 2
+	}
+	if backoff > config.EventMaxBackoff {
+		backoff = config.EventMaxBackoff
+	}
+	return backoff
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"bot/config"
+	"bot/utils"
+	"context"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/shopspring/decimal"
+)
+
+var gasFeed struct {
+	mu       sync.RWMutex
+	estimate *utils.GasEstimate
+}
+
+func newGasOracle() (utils.GasOracle, error) {
+	if config.GasFixture != "" {
+		fixed, err := utils.ParseGasFixture(config.GasFixture)
+		if err != nil {
+			return nil, err
+		}
+		return utils.FixedGasOracle{Fixed: fixed}, nil
+	}
+
+	return utils.FallbackGasOracle{Sources: []utils.GasOracle{
+		utils.FeeHistoryGasOracle{
+			Client: func() (utils.FeeHistoryReader, error) {
+				return supportClient()
+			},
+			Blocks:      config.GasFeeHistoryBlocks,
+			Percentiles: config.GasTipPercentiles,
+		},
+		utils.PolygonscanGasOracle{
+			BaseURL: config.PolygonscanURL,
+			APIKey:  config.PolygonscanAPIKey,
+			Client:  &http.Client{Timeout: 10 * time.Second},
+		},
+	}}, nil
+}
+
+// RunGasOracle refreshes the gas estimate until ctx is cancelled
+func RunGasOracle(ctx context.Context) error {
+	oracle, err := newGasOracle()
+	if err != nil {
+		return err
+	}
+
+	return utils.Every(ctx, config.GasPollInterval, func() {
+		estimate, err := oracle.Estimate(ctx)
+		if err != nil {
+			log.Printf("Gas oracle: %v", err)
+			return
+		}
+
+		gasFeed.mu.Lock()
+		gasFeed.estimate = &estimate
+		gasFeed.mu.Unlock()
+	})
+}
+
+// CurrentGas returns the latest gas estimate, it refuses estimates older than config.GasMaxStaleness
+func CurrentGas() (utils.GasEstimate, error) {
+	gasFeed.mu.RLock()
+	estimate := gasFeed.estimate
+	gasFeed.mu.RUnlock()
+
+	if estimate == nil {
+		return utils.GasEstimate{}, utils.ErrGasUnavailable
+	}
+	if age := time.Since(estimate.At); age > config.GasMaxStaleness {
+		return utils.GasEstimate{}, fmt.Errorf("%w: %s old", utils.ErrGasStale, age.Round(time.Second))
+	}
+	return *estimate, nil
+}
+
+// LastGas returns the latest gas estimate regardless of its age
+func LastGas() (utils.GasEstimate, bool) {
+	gasFeed.mu.RLock()
+	defer gasFeed.mu.RUnlock()
+
+	if gasFeed.estimate == nil {
+		return utils.GasEstimate{}, false
+	}
+	return *gasFeed.estimate, true
+}
+
+// OracleFees prices transactions outside the attack path: the fast tip and room for the base fee
+// to double. There is no fallback to node suggestions, without a fresh estimate nothing is sent
+func OracleFees() (tip, feeCap *big.Int, err error) {
+	gas, err := CurrentGas()
+	if err != nil {
+		return nil, nil, err
+	}
+	return GweiToWei(gas.FastTip), GweiToWei(gas.BaseFee.Mul(decimal.NewFromInt(2)).Add(gas.FastTip)), nil
+}
+
+// withOracleGas sets the fees of auth from OracleFees so bind does not ask the node for them
+func withOracleGas(auth *bind.TransactOpts) error {
+	tip, feeCap, err := OracleFees()
+	if err != nil {
+		return err
+	}
+	auth.GasPrice, auth.GasTipCap, auth.GasFeeCap = nil, tip, feeCap
+	return nil
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"bot/config"
+	"bot/utils"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/shopspring/decimal"
+)
+
+func setGasEstimate(t *testing.T, estimate *utils.GasEstimate) {
+	t.Helper()
+	gasFeed.mu.Lock()
+	previous := gasFeed.estimate
+	gasFeed.estimate = estimate
+	gasFeed.mu.Unlock()
+	t.Cleanup(func() {
+		gasFeed.mu.Lock()
+		gasFeed.estimate = previous
+		gasFeed.mu.Unlock()
+	})
+}
+
+func TestWithOracleGasFailsClosed(t *testing.T) {
+	auth := &bind.TransactOpts{}
+
+	setGasEstimate(t, nil)
+	if err := withOracleGas(auth); !errors.Is(err, utils.ErrGasUnavailable) {
+		t.Fatalf("without an estimate: got %v", err)
+	}
+
+	setGasEstimate(t, &utils.GasEstimate{BaseFee: decimal.NewFromInt(100), FastTip: decimal.NewFromInt(30), At: time.Now().Add(-2 * config.GasMaxStaleness)})
+	if err := withOracleGas(auth); !errors.Is(err, utils.ErrGasStale) {
+		t.Fatalf("with a stale estimate: got %v", err)
+	}
+	if auth.GasTipCap != nil || auth.GasFeeCap != nil {
+		t.Fatalf("fees were set from a refused estimate")
+	}
+
+	setGasEstimate(t, &utils.GasEstimate{BaseFee: decimal.NewFromInt(100), FastTip: decimal.NewFromInt(30), At: time.Now()})
+	if err := withOracleGas(auth); err != nil {
+		t.Fatal(err)
+	}
+	if auth.GasTipCap.Cmp(GweiToWei(decimal.NewFromInt(30))) != 0 || auth.GasFeeCap.Cmp(GweiToWei(decimal.NewFromInt(230))) != 0 {
+		t.Fatalf("tip %s, fee cap %s, want 30 and 230 gwei", auth.GasTipCap, auth.GasFeeCap)
+	}
+}
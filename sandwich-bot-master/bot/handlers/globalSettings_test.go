@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"bot/models"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+func seedGlobalSettings(t *testing.T, db *gorm.DB) {
+	t.Helper()
+	user, blockchainID, off := uint(1), uint(1), false
+	rows := []interface{}{
+		&models.KillSwitch{ModelExtended: models.ModelExtended{CreatedBy: &user, UpdatedBy: &user}, IsOn: &off},
+		&models.Settings{
+			ModelExtended: models.ModelExtended{CreatedBy: &user, UpdatedBy: &user},
+			BlockchainID:  &blockchainID,
+			Settings:      datatypes.JSON(`{"gas_limit": 300000, "deadline": 300000}`),
+		},
+	}
+	for _, _row := range rows {
+		if err := db.Create(_row).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// readers must always see one whole snapshot while reloads publish new ones
+func TestUpdateGlobalSettingsConcurrent(t *testing.T) {
+	db := newTestDB(t)
+	seedGlobalSettings(t, db)
+	if err := UpdateGlobalSettings(1); err != nil {
+		t.Fatal(err)
+	}
+
+	const writers, readers, rounds = 4, 8, 25
+	var wg sync.WaitGroup
+	var done atomic.Bool
+	for _writer := 0; _writer < writers; _writer++ {
+		wg.Add(1)
+		go func(writer int) {
+			defer wg.Done()
+			for _round := 0; _round < rounds; _round++ {
+				value := 21000 + writer*rounds + _round
+				if err := db.Model(&models.Settings{}).Where("active = true").
+					Update("settings", datatypes.JSON(fmt.Sprintf(`{"gas_limit": %d, "deadline": %d}`, value, value))).Error; err != nil {
+					t.Error(err)
+					return
+				}
+				if err := UpdateGlobalSettings(1); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(_writer)
+	}
+
+	var readersWG sync.WaitGroup
+	for _reader := 0; _reader < readers; _reader++ {
+		readersWG.Add(1)
+		go func() {
+			defer readersWG.Done()
+			for !done.Load() {
+				settings := GlobalSettings().Polygon.Settings
+				if settings.GasLimit != uint64(settings.Deadline) {
+					t.Errorf("torn snapshot: gas_limit %d, deadline %d", settings.GasLimit, settings.Deadline)
+					return
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	done.Store(true)
+	readersWG.Wait()
+}
+
+// pre-approval authenticates all main wallets at once
+func TestAuthenticatorConcurrent(t *testing.T) {
+	WalletAuth.Reset()
+	t.Cleanup(WalletAuth.Reset)
+
+	remote := models.RemoteSigner
+	var wallets []models.Wallet
+	for _i := 0; _i < 32; _i++ {
+		_, address := newTestKey(t)
+		_address, uri := address.Hex(), "http://127.0.0.1:1"
+		wallets = append(wallets, models.Wallet{Address: &_address, SignerType: &remote, SignerURI: &uri})
+	}
+
+	p := Polygon{}
+	var wg sync.WaitGroup
+	for _, _wallet := range wallets {
+		wg.Add(1)
+		go func(wallet models.Wallet) {
+			defer wg.Done()
+			if err := p.Authenticator(wallet, CHAIN_ID); err != nil {
+				t.Error(err)
+			}
+			WalletAuth.Load(*wallet.Address)
+		}(_wallet)
+	}
+	wg.Wait()
+
+	for _, _wallet := range wallets {
+		auth, ok := WalletAuth.Load(*_wallet.Address)
+		if !ok || auth.From != common.HexToAddress(*_wallet.Address) {
+			t.Fatalf("no transactor stored for %s", *_wallet.Address)
+		}
+	}
+}
@@ -1,8 +1,9 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
 
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethclient"
@@ -11,9 +12,9 @@ import (
 type BlockchainClient interface {
 	// GetNode()
 	GetState() interface{}
-	GetClient(interface{}) *ethclient.Client
+	GetClient(interface{}) (*ethclient.Client, error)
 	ScanMempool(string, *ethclient.Client, ...interface{})
-	ScanMempoolV2(...interface{})
+	ScanMempoolV2(context.Context, ...interface{}) error
 	// BuyToken(walletToBuyWithAddress, dexContractAddress, tokenToBuyAddress string, amountIn, amountOutMin *big.Int, privateKey *ecdsa.PrivateKey, chainId *big.Int) *types.Transaction
 	// SellToken(walletAddress, dexContractAddress, tokenToSellAddress, tokenToReceiveAddress string, amountIn, amountOutMin *big.Int, privateKey *ecdsa.PrivateKey, chainId *big.Int) *types.Transaction
 }
@@ -27,13 +28,14 @@ func NewBlockchainClient(clientType string) BlockchainClient {
 	}
 }
 
-func Run(clientType string, args ...interface{}) {
+// Run scans the mempool of a blockchain until ctx is cancelled
+func Run(ctx context.Context, clientType string, args ...interface{}) error {
 	bc := NewBlockchainClient(clientType)
 	if bc == nil {
-		log.Fatal("Client not found. Please try another client type.")
+		return errors.New("Client not found. Please try another client type.")
 	}
 
-	bc.ScanMempoolV2(ScenarioEvent)
+	return bc.ScanMempoolV2(ctx, ScenarioEvent)
 }
 
 func ScenarioEvent(tx *types.Transaction, client interface{}, args ...interface{}) func() {
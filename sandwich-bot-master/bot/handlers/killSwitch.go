@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"bot/config"
+	"bot/controllers"
+	"bot/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var ErrKillSwitchOn = errors.New("KillSwitch is on")
+
+type KillSwitchEvent struct {
+	On bool      `json:"on"`
+	At time.Time `json:"at"`
+}
+
+type KillSwitchSummary struct {
+	On bool `json:"on"`
+	// Attacks running when the switch was turned on, and wallets still busy once draining ended
+	InFlight           int      `json:"in_flight"`
+	Undrained          []string `json:"undrained"`
+	ExpiredSweeps      int64    `json:"expired_sweeps"`
+	CancelledApprovals int      `json:"cancelled_approvals"`
+	DrainSeconds       float64  `json:"drain_seconds"`
+}
+
+var (
+	killSwitchOn          atomic.Bool
+	killSwitchMutex       sync.Mutex
+	killSwitchSubscribers []chan KillSwitchEvent
+)
+
+// KillSwitchOn is the instant view of the kill switch, hot paths check it before taking new work
+func KillSwitchOn() bool {
+	return killSwitchOn.Load()
+}
+
+// SubscribeKillSwitch returns a channel receiving every kill switch change. Only the latest
+// event is kept for a slow subscriber, it always ends up with the current state
+func SubscribeKillSwitch() <-chan KillSwitchEvent {
+	killSwitchMutex.Lock()
+	defer killSwitchMutex.Unlock()
+
+	events := make(chan KillSwitchEvent, 1)
+	killSwitchSubscribers = append(killSwitchSubscribers, events)
+	return events
+}
+
+// publishKillSwitch flips the switch and notifies subscribers, it reports false when the state did not change
+func publishKillSwitch(on bool) bool {
+	killSwitchMutex.Lock()
+	defer killSwitchMutex.Unlock()
+
+	if killSwitchOn.Swap(on) == on {
+		return false
+	}
+
+	event := KillSwitchEvent{On: on, At: time.Now()}
+	for _, _events := range killSwitchSubscribers {
+		select {
+		case <-_events:
+		default:
+		}
+		_events <- event
+	}
+	log.Printf("KillSwitch changed, on: %v", on)
+	return true
+}
+
+// SetKillSwitch applies a kill switch row. Turning it on drains in-flight work in the background
+// and records a summary on the row, turning it off lets subscribers restart right away
+func SetKillSwitch(killSwitch models.KillSwitch) {
+	on := killSwitch.IsOn != nil && *killSwitch.IsOn
+	if !publishKillSwitch(on) {
+		return
+	}
+	if killSwitch.State != nil {
+		// a drain cut short by a restart is finished now, other rows loaded on start were handled already
+		if *killSwitch.State == models.KillSwitchDraining {
+			log.Printf("Resuming the drain of kill switch %d", killSwitch.ID)
+			go drainKillSwitch(killSwitch.ID)
+		}
+		return
+	}
+
+	if !on {
+		// a drain still running is over, its final write finds its switch no longer draining
+		if err := controllers.DB.Model(&models.KillSwitch{}).Where("id < ? AND state = ?", killSwitch.ID, models.KillSwitchDraining).
+			Update("state", models.KillSwitchRunning).Error; err != nil {
+			log.Printf("Failed to end the drain before kill switch %d: %v", killSwitch.ID, err)
+		}
+		finishKillSwitch(killSwitch.ID, "", models.KillSwitchRunning, KillSwitchSummary{On: false})
+		return
+	}
+
+	state := models.KillSwitchDraining
+	if err := controllers.DB.Model(&models.KillSwitch{}).Where("id = ?", killSwitch.ID).Update("state", state).Error; err != nil {
+		log.Printf("Failed to mark kill switch %d as draining: %v", killSwitch.ID, err)
+	}
+	go drainKillSwitch(killSwitch.ID)
+}
+
+// UnsubscribeKillSwitch stops delivering events to a channel of SubscribeKillSwitch
+func UnsubscribeKillSwitch(events <-chan KillSwitchEvent) {
+	killSwitchMutex.Lock()
+	defer killSwitchMutex.Unlock()
+
+	for _i, _events := range killSwitchSubscribers {
+		if (<-chan KillSwitchEvent)(_events) == events {
+			killSwitchSubscribers = append(killSwitchSubscribers[:_i], killSwitchSubscribers[_i+1:]...)
+			return
+		}
+	}
+}
+
+// WaitKillSwitch blocks until the kill switch is in the wanted state or ctx is cancelled
+func WaitKillSwitch(ctx context.Context, events <-chan KillSwitchEvent, on bool) error {
+	for KillSwitchOn() != on {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-events:
+		}
+	}
+	return nil
+}
+
+// WaitInFlight blocks until every attack released its wallet or ctx is done
+func WaitInFlight(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for WalletTTX.Len() > 0 {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func drainKillSwitch(killSwitchID uint) {
+	started := time.Now()
+	summary := KillSwitchSummary{On: true, InFlight: WalletTTX.Len()}
+
+	// queued sweeps are dropped, they are proposed again with fresh balances once trading resumes
+	result := controllers.DB.Model(&models.Sweep{}).
+		Where("status IN ?", []models.SweepStatusType{models.SweepProposed, models.SweepRequested}).
+		Update("status", models.SweepExpired)
+	if result.Error != nil {
+		log.Printf("Failed to expire queued sweeps: %v", result.Error)
+	}
+	summary.ExpiredSweeps = result.RowsAffected
+
+	// approvals of wallet changes, sweeps and the like are requested again once trading resumes
+	cancelCtx, cancelRequest := context.WithTimeout(context.Background(), config.KillSwitchDrainTimeout)
+	cancelled, err := cancelApprovalRequests(cancelCtx, fmt.Sprintf("kill switch %d", killSwitchID))
+	cancelRequest()
+	if err != nil {
+		log.Printf("Failed to cancel approval requests: %v", err)
+	}
+	summary.CancelledApprovals = cancelled
+
+	// attacks release their wallet once both legs are mined or failed
+	ctx, cancel := context.WithTimeout(context.Background(), config.KillSwitchDrainTimeout)
+	defer cancel()
+	WaitInFlight(ctx)
+
+	summary.Undrained = WalletTTX.Keys()
+	sort.Strings(summary.Undrained)
+	summary.DrainSeconds = time.Since(started).Seconds()
+	finishKillSwitch(killSwitchID, models.KillSwitchDraining, models.KillSwitchStopped, summary)
+}
+
+// finishKillSwitch moves a kill switch row from one state to the next and publishes its summary. The
+// row has to still be in from, an empty from being a row not switched yet, so a switch turned off
+// while draining is not reported stopped afterwards
+func finishKillSwitch(killSwitchID uint, from, to models.KillSwitchStateType, summary KillSwitchSummary) {
+	summaryJSON, _ := json.Marshal(summary)
+	if err := controllers.DB.Transaction(func(tx *gorm.DB) error {
+		query := tx.Model(&models.KillSwitch{}).Where("id = ?", killSwitchID)
+		if from == "" {
+			query = query.Where("state IS NULL")
+		} else {
+			query = query.Where("state = ?", from)
+		}
+		result := query.Updates(map[string]interface{}{
+			"state":   to,
+			"summary": summaryJSON,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			log.Printf("Kill switch %d is no longer %q, it is not marked %s", killSwitchID, from, to)
+			return nil
+		}
+		return publishKillSwitchSummary(tx, killSwitchID, summary)
+	}); err != nil {
+		log.Printf("Failed to record kill switch %d summary: %v", killSwitchID, err)
+	}
+}
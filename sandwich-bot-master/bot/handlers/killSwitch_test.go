@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"bot/controllers"
+	"bot/models"
+	"bot/types"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// createKillSwitch stores a kill switch row, an empty state is a row not switched yet
+func createKillSwitch(t *testing.T, on bool, state models.KillSwitchStateType) models.KillSwitch {
+	t.Helper()
+	userID := uint(1)
+	killSwitch := models.KillSwitch{ModelExtended: models.ModelExtended{CreatedBy: &userID, UpdatedBy: &userID}, IsOn: &on}
+	if state != "" {
+		killSwitch.State = &state
+	}
+	if err := controllers.DB.Create(&killSwitch).Error; err != nil {
+		t.Fatal(err)
+	}
+	return killSwitch
+}
+
+// keepKillSwitch puts the in-memory switch back once the test is done
+func keepKillSwitch(t *testing.T) {
+	previous := KillSwitchOn()
+	t.Cleanup(func() { publishKillSwitch(previous) })
+}
+
+func killSwitchState(t *testing.T, killSwitchID uint) models.KillSwitchStateType {
+	t.Helper()
+	var killSwitch models.KillSwitch
+	if err := controllers.DB.First(&killSwitch, killSwitchID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if killSwitch.State == nil {
+		return ""
+	}
+	return *killSwitch.State
+}
+
+func TestFinishKillSwitchPublishesSummary(t *testing.T) {
+	newTestDB(t)
+	killSwitch := createKillSwitch(t, true, models.KillSwitchDraining)
+
+	summary := KillSwitchSummary{On: true, InFlight: 2, Undrained: []string{"0xabc"}, ExpiredSweeps: 1, CancelledApprovals: 3}
+	finishKillSwitch(killSwitch.ID, models.KillSwitchDraining, models.KillSwitchStopped, summary)
+	// a summary is published once per switch
+	finishKillSwitch(killSwitch.ID, models.KillSwitchDraining, models.KillSwitchStopped, summary)
+
+	var events []models.Event
+	if err := controllers.DB.Find(&events, "category = ?", models.KillSwitchEvent).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("published %d kill switch events", len(events))
+	}
+	var payload types.KillSwitchEventType
+	if err := json.Unmarshal(events[0].Payload, &payload); err != nil {
+		t.Fatal(err)
+	}
+	var published KillSwitchSummary
+	if err := json.Unmarshal(payload.Summary, &published); err != nil {
+		t.Fatal(err)
+	}
+	if payload.KillSwitchID != killSwitch.ID || !payload.IsOn || published.InFlight != 2 || published.CancelledApprovals != 3 {
+		t.Fatalf("kill switch event: %+v, summary %+v", payload, published)
+	}
+
+	if err := controllers.DB.First(&killSwitch, killSwitch.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if *killSwitch.State != models.KillSwitchStopped {
+		t.Fatalf("kill switch state: %s", *killSwitch.State)
+	}
+}
+
+func TestKillSwitchOffDuringDrain(t *testing.T) {
+	newTestDB(t)
+	keepKillSwitch(t)
+	publishKillSwitch(true)
+	draining := createKillSwitch(t, true, models.KillSwitchDraining)
+
+	SetKillSwitch(createKillSwitch(t, false, ""))
+	if KillSwitchOn() {
+		t.Fatal("kill switch is still on")
+	}
+	// the drain ends after the switch was turned off, it must not report the bot stopped
+	finishKillSwitch(draining.ID, models.KillSwitchDraining, models.KillSwitchStopped, KillSwitchSummary{On: true})
+	if state := killSwitchState(t, draining.ID); state != models.KillSwitchRunning {
+		t.Fatalf("drained kill switch state: %s", state)
+	}
+
+	var events []models.Event
+	if err := controllers.DB.Find(&events, "category = ?", models.KillSwitchEvent).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, _event := range events {
+		var payload types.KillSwitchEventType
+		if err := json.Unmarshal(_event.Payload, &payload); err != nil {
+			t.Fatal(err)
+		}
+		if payload.IsOn {
+			t.Fatalf("published a stopped summary after the switch was turned off: %+v", payload)
+		}
+	}
+	if len(events) != 1 {
+		t.Fatalf("published %d kill switch events", len(events))
+	}
+}
+
+func TestKillSwitchResumesDrain(t *testing.T) {
+	newTestDB(t)
+	keepKillSwitch(t)
+	publishKillSwitch(false)
+	killSwitch := createKillSwitch(t, true, models.KillSwitchDraining)
+	id := uint(1)
+	sweep := models.Sweep{BlockchainID: models.BlockchainID{BlockchainID: &id}, Uid: "swp-1", WalletID: &id, ToWalletID: &id,
+		Token: new(string), Amount: new(string), Status: models.SweepRequested}
+	if err := controllers.DB.Create(&sweep).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// the bot restarted halfway through draining, loading the row finishes the drain
+	SetKillSwitch(killSwitch)
+	if !KillSwitchOn() {
+		t.Fatal("kill switch is off")
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for killSwitchState(t, killSwitch.ID) != models.KillSwitchStopped {
+		if time.Now().After(deadline) {
+			t.Fatal("drain was not resumed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := controllers.DB.First(&sweep, sweep.ID).Error; err != nil || sweep.Status != models.SweepExpired {
+		t.Fatalf("sweep %s: %v", sweep.Status, err)
+	}
+
+	// rows already finished are left alone
+	stopped := createKillSwitch(t, true, models.KillSwitchStopped)
+	publishKillSwitch(false)
+	SetKillSwitch(stopped)
+	time.Sleep(50 * time.Millisecond)
+	if state := killSwitchState(t, stopped.ID); state != models.KillSwitchStopped {
+		t.Fatalf("finished kill switch state: %s", state)
+	}
+}
@@ -0,0 +1,295 @@
+package handlers
+
+import (
+	"bot/config"
+	"bot/models"
+	"bot/types"
+	"bot/utils"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+const (
+	mainNode    = "main"
+	supportNode = "support"
+)
+
+var ErrNoHealthyNode = errors.New("no healthy node available")
+
+type poolNode struct {
+	url  string
+	role string
+
+	blockNumber uint64
+	latency     time.Duration
+	// outcomes of the last probes, oldest first, true for a failed probe
+	failures  []bool
+	lastError string
+	checkedAt *time.Time
+
+	healthy bool
+	reason  string
+}
+
+func (n *poolNode) errorRate() float64 {
+	if len(n.failures) == 0 {
+		return 0
+	}
+	failed := 0
+	for _, _failed := range n.failures {
+		if _failed {
+			failed++
+		}
+	}
+	return float64(failed) / float64(len(n.failures))
+}
+
+// nodePool keeps the nodes of nodes.json with their health. Nodes are read once, probed by
+// RunNodePool and share one connection each through dialClient
+type nodePool struct {
+	mu     sync.RWMutex
+	nodes  []*poolNode
+	loaded bool
+}
+
+var rpcNodes = &nodePool{}
+
+func (np *nodePool) load() error {
+	np.mu.Lock()
+	defer np.mu.Unlock()
+	if np.loaded {
+		return nil
+	}
+
+	nodes, err := ReadJson("nodes.json")
+	if err != nil {
+		return err
+	}
+
+	var rpcUrls []string
+	if os.Getenv("GIN_MODE") == "release" {
+		if len(nodes.Polygon) == 0 {
+			return errors.New("No Polygon RPC Url found for production")
+		}
+		rpcUrls = nodes.Polygon
+	} else {
+		if len(nodes.PolygonTest) == 0 {
+			return errors.New("No Polygon RPC Url found for testing")
+		}
+		rpcUrls = nodes.PolygonTest
+	}
+
+	supportUrls := nodes.PolygonSupport
+	if len(supportUrls) == 0 {
+		for _, _url := range rpcUrls {
+			if strings.HasPrefix(_url, "wss://") {
+				supportUrls = append(supportUrls, strings.Replace(_url, "wss://", "https://", 1))
+			}
+		}
+	}
+
+	for _, _url := range rpcUrls {
+		np.nodes = append(np.nodes, &poolNode{url: _url, role: mainNode, healthy: true})
+	}
+	for _, _url := range supportUrls {
+		np.nodes = append(np.nodes, &poolNode{url: _url, role: supportNode, healthy: true})
+	}
+	np.loaded = true
+	return nil
+}
+
+// healthy lists the healthy nodes of a role, fastest first
+func (np *nodePool) healthy(role string) []string {
+	np.mu.RLock()
+	defer np.mu.RUnlock()
+
+	var nodes []*poolNode
+	for _, _node := range np.nodes {
+		if _node.role == role && _node.healthy {
+			nodes = append(nodes, _node)
+		}
+	}
+	sort.SliceStable(nodes, func(i, j int) bool {
+		return nodes[i].latency < nodes[j].latency
+	})
+
+	urls := make([]string, len(nodes))
+	for _i, _node := range nodes {
+		urls[_i] = _node.url
+	}
+	return urls
+}
+
+type probeResult struct {
+	blockNumber uint64
+	latency     time.Duration
+	err         error
+}
+
+func probeNode(ctx context.Context, url string) probeResult {
+	ctx, cancel := context.WithTimeout(ctx, config.NodeProbeTimeout)
+	defer cancel()
+
+	client, err := dialClient(ctx, url)
+	if err != nil {
+		return probeResult{err: err}
+	}
+	started := time.Now()
+	blockNumber, err := client.BlockNumber(ctx)
+	return probeResult{blockNumber: blockNumber, latency: time.Since(started), err: err}
+}
+
+// probe checks every node at once and ejects nodes that fail, lag behind the best block or answer slowly
+func (np *nodePool) probe(ctx context.Context) {
+	np.mu.RLock()
+	nodes := append([]*poolNode{}, np.nodes...)
+	np.mu.RUnlock()
+
+	results := make([]probeResult, len(nodes))
+	var wg sync.WaitGroup
+	for _i, _node := range nodes {
+		wg.Add(1)
+		go func(i int, url string) {
+			defer wg.Done()
+			results[i] = probeNode(ctx, url)
+		}(_i, _node.url)
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		return
+	}
+
+	var head uint64
+	for _, _result := range results {
+		if _result.err == nil && _result.blockNumber > head {
+			head = _result.blockNumber
+		}
+	}
+
+	now := time.Now()
+	events := map[string]*types.RPCPoolDegradedEventType{}
+	np.mu.Lock()
+	for _i, _node := range nodes {
+		result := results[_i]
+		_node.checkedAt = &now
+		_node.failures = append(_node.failures, result.err != nil)
+		if len(_node.failures) > config.NodeProbeWindow {
+			_node.failures = _node.failures[len(_node.failures)-config.NodeProbeWindow:]
+		}
+
+		reason := ""
+		if result.err != nil {
+			_node.lastError = result.err.Error()
+			reason = "probe failed"
+		} else {
+			_node.blockNumber = result.blockNumber
+			_node.latency = result.latency
+			switch {
+			case _node.errorRate() > config.NodeMaxErrorRate:
+				reason = fmt.Sprintf("error rate %.0f%%", _node.errorRate()*100)
+			case head-_node.blockNumber > config.NodeMaxLag:
+				reason = fmt.Sprintf("%d blocks behind", head-_node.blockNumber)
+			case _node.latency > config.NodeMaxLatency:
+				reason = fmt.Sprintf("latency %s", _node.latency.Round(time.Millisecond))
+			}
+		}
+
+		healthy := reason == ""
+		if healthy != _node.healthy {
+			event, ok := events[_node.role]
+			if !ok {
+				event = &types.RPCPoolDegradedEventType{Role: _node.role, Ejected: map[string]string{}}
+				events[_node.role] = event
+			}
+			if healthy {
+				log.Printf("Node %s is healthy again", _node.url)
+				event.Restored = append(event.Restored, _node.url)
+			} else {
+				log.Printf("Node %s ejected: %s", _node.url, reason)
+				event.Ejected[_node.url] = reason
+			}
+		}
+		_node.healthy = healthy
+		_node.reason = reason
+	}
+	for _, _node := range np.nodes {
+		if event, ok := events[_node.role]; ok {
+			event.Total++
+			if _node.healthy {
+				event.Healthy++
+			}
+		}
+	}
+	np.mu.Unlock()
+
+	for _, _event := range events {
+		publishEvent(models.RPCPoolDegradedEvent, fmt.Sprintf("%s:%d", _event.Role, now.UnixNano()), _event)
+	}
+}
+
+// RunNodePool probes the nodes of nodes.json until ctx is cancelled
+func RunNodePool(ctx context.Context) error {
+	if err := rpcNodes.load(); err != nil {
+		return err
+	}
+	return utils.Every(ctx, config.NodeProbeInterval, func() {
+		rpcNodes.probe(ctx)
+	})
+}
+
+// NodePoolStatus reports the health of every node, main nodes first
+func NodePoolStatus() ([]types.NodeStatusRespType, error) {
+	if err := rpcNodes.load(); err != nil {
+		return nil, err
+	}
+
+	rpcNodes.mu.RLock()
+	defer rpcNodes.mu.RUnlock()
+
+	var head uint64
+	for _, _node := range rpcNodes.nodes {
+		if _node.blockNumber > head {
+			head = _node.blockNumber
+		}
+	}
+
+	status := make([]types.NodeStatusRespType, len(rpcNodes.nodes))
+	for _i, _node := range rpcNodes.nodes {
+		status[_i] = types.NodeStatusRespType{
+			URL:         _node.url,
+			Role:        _node.role,
+			Healthy:     _node.healthy,
+			Reason:      _node.reason,
+			BlockNumber: _node.blockNumber,
+			Lag:         head - _node.blockNumber,
+			LatencyMs:   _node.latency.Milliseconds(),
+			ErrorRate:   _node.errorRate(),
+			LastError:   _node.lastError,
+			CheckedAt:   _node.checkedAt,
+		}
+	}
+	return status, nil
+}
+
+// supportClient returns the shared client of a random healthy support node
+func supportClient() (*ethclient.Client, error) {
+	if err := rpcNodes.load(); err != nil {
+		return nil, err
+	}
+
+	nodes := rpcNodes.healthy(supportNode)
+	if len(nodes) == 0 {
+		return nil, ErrNoHealthyNode
+	}
+	return dialClient(context.Background(), nodes[rand.Intn(len(nodes))])
+}
@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"bot/config"
+	"bot/controllers"
+	"bot/models"
+	"bot/types"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// fakeNode answers eth_blockNumber with a block, a delay and an error the test changes between probes
+type fakeNode struct {
+	mu     sync.Mutex
+	block  uint64
+	delay  time.Duration
+	failed bool
+}
+
+func (fn *fakeNode) set(block uint64, delay time.Duration, failed bool) {
+	fn.mu.Lock()
+	defer fn.mu.Unlock()
+	fn.block, fn.delay, fn.failed = block, delay, failed
+}
+
+func (fn *fakeNode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ID     int    `json:"id"`
+		Method string `json:"method"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	fn.mu.Lock()
+	block, delay, failed := fn.block, fn.delay, fn.failed
+	fn.mu.Unlock()
+	time.Sleep(delay)
+
+	resp := jsonRPCResponse{JSONRPC: "2.0", ID: req.ID}
+	switch {
+	case failed:
+		resp.Error = &jsonRPCError{Code: -32000, Message: "node is down"}
+	case req.Method == "eth_blockNumber":
+		resp.Result, _ = json.Marshal(hexutil.Uint64(block))
+	default:
+		resp.Error = &jsonRPCError{Code: -32601, Message: "method not found"}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// newTestPool swaps rpcNodes for a pool of fake nodes, main nodes first
+func newTestPool(t *testing.T, main, support int) ([]*fakeNode, []string) {
+	t.Helper()
+	newTestDB(t)
+
+	pool := &nodePool{loaded: true}
+	var nodes []*fakeNode
+	var urls []string
+	for _i := 0; _i < main+support; _i++ {
+		node := &fakeNode{block: 100}
+		server := httptest.NewServer(node)
+		t.Cleanup(server.Close)
+
+		role := mainNode
+		if _i >= main {
+			role = supportNode
+		}
+		pool.nodes = append(pool.nodes, &poolNode{url: server.URL, role: role, healthy: true})
+		nodes = append(nodes, node)
+		urls = append(urls, server.URL)
+	}
+
+	previous := rpcNodes
+	rpcNodes = pool
+	t.Cleanup(func() {
+		rpcNodes = previous
+		CloseClients()
+	})
+	return nodes, urls
+}
+
+func nodeStatus(t *testing.T, url string) types.NodeStatusRespType {
+	t.Helper()
+	status, err := NodePoolStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, _status := range status {
+		if _status.URL == url {
+			return _status
+		}
+	}
+	t.Fatalf("node %s is not in the pool", url)
+	return types.NodeStatusRespType{}
+}
+
+func degradedEvents(t *testing.T) []types.RPCPoolDegradedEventType {
+	t.Helper()
+	var events []models.Event
+	if err := controllers.DB.Order("id").Find(&events, "category = ?", models.RPCPoolDegradedEvent).Error; err != nil {
+		t.Fatal(err)
+	}
+	payloads := make([]types.RPCPoolDegradedEventType, len(events))
+	for _i, _event := range events {
+		if err := json.Unmarshal(_event.Payload, &payloads[_i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return payloads
+}
+
+func TestNodePoolEjectsLaggingNode(t *testing.T) {
+	nodes, urls := newTestPool(t, 3, 0)
+	nodes[2].set(100-config.NodeMaxLag-1, 0, false)
+
+	rpcNodes.probe(context.Background())
+
+	if status := nodeStatus(t, urls[2]); status.Healthy || status.Reason != "6 blocks behind" || status.Lag != 6 {
+		t.Fatalf("lagging node: %+v", status)
+	}
+	if healthy := rpcNodes.healthy(mainNode); len(healthy) != 2 {
+		t.Fatalf("healthy main nodes: %v", healthy)
+	}
+	events := degradedEvents(t)
+	if len(events) != 1 || events[0].Role != mainNode || events[0].Healthy != 2 || events[0].Total != 3 || events[0].Ejected[urls[2]] == "" {
+		t.Fatalf("degraded events: %+v", events)
+	}
+
+	// a node within NodeMaxLag stays in
+	nodes[2].set(100-config.NodeMaxLag, 0, false)
+	rpcNodes.probe(context.Background())
+	if status := nodeStatus(t, urls[2]); !status.Healthy {
+		t.Fatalf("node within lag: %+v", status)
+	}
+}
+
+func TestNodePoolEjectsSlowNode(t *testing.T) {
+	previous := config.NodeMaxLatency
+	config.NodeMaxLatency = 50 * time.Millisecond
+	t.Cleanup(func() { config.NodeMaxLatency = previous })
+
+	nodes, urls := newTestPool(t, 2, 0)
+	nodes[0].set(100, 150*time.Millisecond, false)
+
+	rpcNodes.probe(context.Background())
+
+	if status := nodeStatus(t, urls[0]); status.Healthy || !strings.HasPrefix(status.Reason, "latency") {
+		t.Fatalf("slow node: %+v", status)
+	}
+	if healthy := rpcNodes.healthy(mainNode); len(healthy) != 1 || healthy[0] != urls[1] {
+		t.Fatalf("healthy main nodes: %v", healthy)
+	}
+}
+
+func TestNodePoolErrorRateAndRestore(t *testing.T) {
+	nodes, urls := newTestPool(t, 1, 0)
+
+	nodes[0].set(100, 0, true)
+	rpcNodes.probe(context.Background())
+	if status := nodeStatus(t, urls[0]); status.Healthy || status.Reason != "probe failed" || status.LastError == "" {
+		t.Fatalf("failing node: %+v", status)
+	}
+
+	// answering again is not enough while the failed probe weighs more than NodeMaxErrorRate
+	nodes[0].set(100, 0, false)
+	for _, _want := range []string{"error rate 50%", "error rate 33%"} {
+		rpcNodes.probe(context.Background())
+		if status := nodeStatus(t, urls[0]); status.Healthy || status.Reason != _want {
+			t.Fatalf("want %q, got %+v", _want, status)
+		}
+	}
+
+	rpcNodes.probe(context.Background())
+	if status := nodeStatus(t, urls[0]); !status.Healthy || status.ErrorRate != 0.25 {
+		t.Fatalf("recovered node: %+v", status)
+	}
+
+	events := degradedEvents(t)
+	if len(events) != 2 || events[0].Ejected[urls[0]] != "probe failed" || len(events[1].Restored) != 1 || events[1].Restored[0] != urls[0] {
+		t.Fatalf("degraded events: %+v", events)
+	}
+}
+
+func TestSupportClientFailover(t *testing.T) {
+	nodes, _ := newTestPool(t, 1, 2)
+	nodes[1].set(100, 0, true)
+	rpcNodes.probe(context.Background())
+
+	for _i := 0; _i < 20; _i++ {
+		client, err := supportClient()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := client.BlockNumber(context.Background()); err != nil {
+			t.Fatalf("support client picked an ejected node: %v", err)
+		}
+	}
+
+	nodes[2].set(100, 0, true)
+	rpcNodes.probe(context.Background())
+	if _, err := supportClient(); !errors.Is(err, ErrNoHealthyNode) {
+		t.Fatalf("want ErrNoHealthyNode, got %v", err)
+	}
+
+	// a failed probe keeps the node out until its error rate is back under NodeMaxErrorRate
+	nodes[1].set(100, 0, false)
+	for _i := 0; _i < 5; _i++ {
+		rpcNodes.probe(context.Background())
+	}
+	client, err := supportClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.BlockNumber(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
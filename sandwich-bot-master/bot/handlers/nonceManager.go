@@ -0,0 +1,322 @@
+package handlers
+
+import (
+	"bot/config"
+	"bot/controllers"
+	"bot/models"
+	"bot/utils"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const nonceSyncTimeout = 5 * time.Second
+
+// nonceBackend is what the nonce manager needs from a node, *ethclient.Client provides it
+type nonceBackend interface {
+	NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error)
+	PendingNonceAt(ctx context.Context, account common.Address) (uint64, error)
+	SendTransaction(ctx context.Context, tx *types.Transaction) error
+}
+
+var nonceClient = func() (nonceBackend, error) {
+	client, err := supportClient()
+	if err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// walletNonces is the next nonce of a wallet, reservations of the wallet happen under its lock
+type walletNonces struct {
+	mu     sync.Mutex
+	synced bool
+	next   uint64
+}
+
+func walletNoncesOf(address string) *walletNonces {
+	nonces := &walletNonces{}
+	WalletNonces.Update(address, func(existing *walletNonces, ok bool) (*walletNonces, bool) {
+		if ok {
+			nonces = existing
+			return existing, false
+		}
+		return nonces, true
+	})
+	return nonces
+}
+
+// sync moves next past the pending nonce of the node and past every persisted reservation,
+// so a restart never hands out a nonce twice
+func (w *walletNonces) sync(ctx context.Context, client nonceBackend, address string) error {
+	pending, err := client.PendingNonceAt(ctx, common.HexToAddress(address))
+	if err != nil {
+		return fmt.Errorf("failed to get pending nonce: %w", err)
+	}
+
+	next := pending
+	var last models.NonceReservation
+	if err := controllers.DB.Order("nonce DESC").First(&last, "wallet = ?", address).Error; err == nil {
+		if last.Nonce+1 > next {
+			next = last.Nonce + 1
+		}
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	if w.synced && w.next > next {
+		next = w.next
+	}
+
+	w.next, w.synced = next, true
+	return nil
+}
+
+// ReserveNonces hands out count consecutive nonces of a wallet. They are persisted before they are
+// returned, each one has to end in MarkNonceSent or ReleaseNonce
+func ReserveNonces(address string, count int, purpose string) ([]uint64, error) {
+	address = strings.ToLower(address)
+	nonces := walletNoncesOf(address)
+	nonces.mu.Lock()
+	defer nonces.mu.Unlock()
+
+	if !nonces.synced {
+		client, err := nonceClient()
+		if err != nil {
+			return nil, err
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), nonceSyncTimeout)
+		defer cancel()
+		if err := nonces.sync(ctx, client, address); err != nil {
+			return nil, err
+		}
+	}
+
+	reserved := make([]uint64, count)
+	reservations := make([]models.NonceReservation, count)
+	for _i := range reservations {
+		reserved[_i] = nonces.next + uint64(_i)
+		reservations[_i] = models.NonceReservation{
+			Wallet:  address,
+			Nonce:   reserved[_i],
+			Purpose: purpose,
+			Status:  models.NonceReserved,
+		}
+	}
+	if err := controllers.DB.Create(&reservations).Error; err != nil {
+		// e.g. a reservation written by another process, the next sync moves past it
+		nonces.synced = false
+		return nil, err
+	}
+
+	nonces.next += uint64(count)
+	return reserved, nil
+}
+
+// MarkNonceSent records the transaction a reserved nonce was used for
+func MarkNonceSent(address string, nonce uint64, hash string) {
+	if err := controllers.DB.Model(&models.NonceReservation{}).
+		Where("wallet = ? AND nonce = ? AND status = ?", strings.ToLower(address), nonce, models.NonceReserved).
+		Updates(map[string]interface{}{
+			"status":  models.NonceSent,
+			"hash":    hash,
+			"sent_at": time.Now(),
+		}).Error; err != nil {
+		log.Printf("Failed to mark nonce %d of %s as sent: %v", nonce, address, err)
+	}
+}
+
+// ReleaseNonce hands back a reserved nonce nothing was sent with. The latest nonce of a wallet is
+// reused, any other one leaves a gap that RunNonceManager fills
+func ReleaseNonce(address string, nonce uint64) {
+	address = strings.ToLower(address)
+	nonces := walletNoncesOf(address)
+	nonces.mu.Lock()
+	defer nonces.mu.Unlock()
+
+	if nonces.synced && nonce+1 == nonces.next {
+		// released nonces right below it are reused as well
+		for status := models.NonceReserved; nonces.next > 0; status = models.NonceReleased {
+			result := controllers.DB.Unscoped().
+				Where("wallet = ? AND nonce = ? AND status = ?", address, nonces.next-1, status).
+				Delete(&models.NonceReservation{})
+			if result.Error != nil {
+				log.Printf("Failed to release nonce %d of %s: %v", nonces.next-1, address, result.Error)
+				return
+			}
+			if result.RowsAffected == 0 {
+				return
+			}
+			nonces.next--
+		}
+		return
+	}
+
+	if err := controllers.DB.Model(&models.NonceReservation{}).
+		Where("wallet = ? AND nonce = ? AND status = ?", address, nonce, models.NonceReserved).
+		Update("status", models.NonceReleased).Error; err != nil {
+		log.Printf("Failed to release nonce %d of %s: %v", nonce, address, err)
+	}
+}
+
+// RunNonceManager settles mined reservations and fills nonce gaps of wallets with open reservations
+func RunNonceManager(ctx context.Context) error {
+	return utils.Every(ctx, config.NonceCheckInterval, func() {
+		if err := checkNonces(ctx); err != nil {
+			log.Printf("Nonce manager: %v", err)
+		}
+	})
+}
+
+func checkNonces(ctx context.Context) error {
+	var wallets []string
+	if err := controllers.DB.Model(&models.NonceReservation{}).
+		Where("status <> ?", models.NonceMined).
+		Distinct().Pluck("wallet", &wallets).Error; err != nil {
+		return err
+	}
+	if len(wallets) == 0 {
+		return nil
+	}
+
+	client, err := nonceClient()
+	if err != nil {
+		return err
+	}
+	for _, _wallet := range wallets {
+		if err := reconcileNonces(ctx, client, _wallet); err != nil {
+			log.Printf("Failed to check nonces of %s: %v", _wallet, err)
+		}
+	}
+	return nil
+}
+
+// reconcileNonces marks reservations below the mined count as mined and fills the gaps between
+// the pending count of the node and the next nonce
+func reconcileNonces(ctx context.Context, client nonceBackend, address string) error {
+	nonces := walletNoncesOf(address)
+	nonces.mu.Lock()
+	defer nonces.mu.Unlock()
+
+	if err := nonces.sync(ctx, client, address); err != nil {
+		return err
+	}
+
+	account := common.HexToAddress(address)
+	mined, err := client.NonceAt(ctx, account, nil)
+	if err != nil {
+		return fmt.Errorf("failed to get nonce: %w", err)
+	}
+	if err := controllers.DB.Model(&models.NonceReservation{}).
+		Where("wallet = ? AND nonce < ? AND status <> ?", address, mined, models.NonceMined).
+		Update("status", models.NonceMined).Error; err != nil {
+		return err
+	}
+
+	pending, err := client.PendingNonceAt(ctx, account)
+	if err != nil {
+		return fmt.Errorf("failed to get pending nonce: %w", err)
+	}
+	// gap fills are sent transactions too, they wait for the kill switch to be turned off
+	if pending >= nonces.next || KillSwitchOn() {
+		return nil
+	}
+
+	var reservations []models.NonceReservation
+	if err := controllers.DB.Find(&reservations, "wallet = ? AND nonce >= ? AND nonce < ?", address, pending, nonces.next).Error; err != nil {
+		return err
+	}
+	byNonce := map[uint64]models.NonceReservation{}
+	for _, _reservation := range reservations {
+		byNonce[_reservation.Nonce] = _reservation
+	}
+
+	for nonce := pending; nonce < nonces.next; nonce++ {
+		if reservation, ok := byNonce[nonce]; ok && !isNonceGap(reservation, nonce == pending) {
+			continue
+		}
+		if err := fillNonceGap(ctx, client, address, nonce); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isNonceGap tells whether a reservation at or above the pending count holds up later nonces.
+// A sent transaction is only given up at the head, above it it may just wait behind a gap
+func isNonceGap(reservation models.NonceReservation, head bool) bool {
+	switch reservation.Status {
+	case models.NonceReleased:
+		return true
+	case models.NonceReserved:
+		return time.Since(reservation.CreatedAt) > config.NonceGapAfter
+	case models.NonceSent, models.NonceFilled:
+		return head && time.Since(reservation.UpdatedAt) > config.NonceGapAfter
+	}
+	return false
+}
+
+// fillNonceGap sends a zero value self-transfer with nonce so the transactions after it get mined
+func fillNonceGap(ctx context.Context, client nonceBackend, address string, nonce uint64) error {
+	var wallet models.Wallet
+	if err := controllers.DB.First(&wallet, "address = ?", address).Error; err != nil {
+		return err
+	}
+
+	tip, feeCap, err := OracleFees()
+	if err != nil {
+		return err
+	}
+
+	to := common.HexToAddress(address)
+	tx, err := SignWalletTx(wallet, types.NewTx(&types.DynamicFeeTx{
+		ChainID:   CHAIN_ID,
+		Nonce:     nonce,
+		GasTipCap: tip,
+		GasFeeCap: feeCap,
+		Gas:       params.TxGas,
+		To:        &to,
+		Value:     ZERO_BIG_INT,
+	}), CHAIN_ID)
+	if err != nil {
+		return err
+	}
+	if err := client.SendTransaction(ctx, tx); err != nil {
+		return fmt.Errorf("failed to fill nonce %d: %w", nonce, err)
+	}
+	TrackOutbound(tx, address, "gap_fill")
+
+	hash := tx.Hash().Hex()
+	now := time.Now()
+	if err := controllers.DB.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "wallet"}, {Name: "nonce"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"status":     models.NonceFilled,
+			"hash":       hash,
+			"sent_at":    now,
+			"updated_at": now,
+		}),
+	}).Create(&models.NonceReservation{
+		Wallet:  address,
+		Nonce:   nonce,
+		Purpose: "gap_fill",
+		Status:  models.NonceFilled,
+		Hash:    &hash,
+		SentAt:  &now,
+	}).Error; err != nil {
+		return err
+	}
+
+	log.Printf("Filled nonce gap %d of %s with %s", nonce, address, hash)
+	return nil
+}
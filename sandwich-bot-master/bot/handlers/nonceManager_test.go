@@ -0,0 +1,278 @@
+package handlers
+
+import (
+	"bot/models"
+	"bot/utils"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// nonceTestNode keeps the transactions a node has seen. Commit mines the pending ones that follow the
+// mined nonce of their sender without a gap
+type nonceTestNode struct {
+	mu      sync.Mutex
+	chainID *big.Int
+	mined   map[common.Address]uint64
+	pool    map[common.Address]map[uint64]*types.Transaction
+}
+
+func newNonceTestNode(chainID *big.Int) *nonceTestNode {
+	return &nonceTestNode{chainID: chainID, mined: map[common.Address]uint64{}, pool: map[common.Address]map[uint64]*types.Transaction{}}
+}
+
+func (n *nonceTestNode) NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.mined[account], nil
+}
+
+func (n *nonceTestNode) PendingNonceAt(ctx context.Context, account common.Address) (uint64, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	pending := n.mined[account]
+	for n.pool[account][pending] != nil {
+		pending++
+	}
+	return pending, nil
+}
+
+func (n *nonceTestNode) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	sender, err := types.Sender(types.LatestSignerForChainID(n.chainID), tx)
+	if err != nil {
+		return err
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if tx.Nonce() < n.mined[sender] {
+		return fmt.Errorf("nonce too low: next nonce %d, tx nonce %d", n.mined[sender], tx.Nonce())
+	}
+	if n.pool[sender] == nil {
+		n.pool[sender] = map[uint64]*types.Transaction{}
+	}
+	n.pool[sender][tx.Nonce()] = tx
+	return nil
+}
+
+func (n *nonceTestNode) Commit() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _sender, _pool := range n.pool {
+		for _pool[n.mined[_sender]] != nil {
+			delete(_pool, n.mined[_sender])
+			n.mined[_sender]++
+		}
+	}
+}
+
+type nonceTestChain struct {
+	node    *nonceTestNode
+	db      *gorm.DB
+	wallet  models.Wallet
+	address string
+}
+
+// newNonceTestChain funds a wallet on a simulated chain and routes the nonce manager to it
+func newNonceTestChain(t *testing.T) *nonceTestChain {
+	t.Helper()
+	key, account := newTestKey(t)
+	node := newNonceTestNode(big.NewInt(1337))
+
+	previousChainID, previousClient := CHAIN_ID, nonceClient
+	CHAIN_ID = node.chainID
+	nonceClient = func() (nonceBackend, error) { return node, nil }
+	WalletNonces.Reset()
+	t.Cleanup(func() {
+		CHAIN_ID, nonceClient = previousChainID, previousClient
+		WalletNonces.Reset()
+	})
+	setGasEstimate(t, &utils.GasEstimate{BaseFee: decimal.NewFromInt(10), FastTip: decimal.NewFromInt(1), At: time.Now()})
+
+	db := newTestDB(t)
+	user, blockchainID, walletType := uint(1), uint(1), models.Main
+	address, privateKey := strings.ToLower(account.Hex()), hex.EncodeToString(crypto.FromECDSA(key))
+	wallet := models.Wallet{
+		ModelExtended: models.ModelExtended{CreatedBy: &user, UpdatedBy: &user},
+		BlockchainID:  models.BlockchainID{BlockchainID: &blockchainID},
+		Address:       &address,
+		Type:          &walletType,
+		PrivateKey:    &privateKey,
+	}
+	if err := db.Create(&wallet).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	return &nonceTestChain{node: node, db: db, wallet: wallet, address: address}
+}
+
+// send signs a self-transfer with nonce, outside the nonce manager unless it reserved nonce
+func (c *nonceTestChain) send(t *testing.T, nonce uint64) *types.Transaction {
+	t.Helper()
+	tip, feeCap, err := OracleFees()
+	if err != nil {
+		t.Fatal(err)
+	}
+	to := common.HexToAddress(c.address)
+	tx, err := SignWalletTx(c.wallet, types.NewTx(&types.DynamicFeeTx{
+		ChainID:   CHAIN_ID,
+		Nonce:     nonce,
+		GasTipCap: tip,
+		GasFeeCap: feeCap,
+		Gas:       params.TxGas,
+		To:        &to,
+		Value:     ZERO_BIG_INT,
+	}), CHAIN_ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.node.SendTransaction(context.Background(), tx); err != nil {
+		t.Fatal(err)
+	}
+	return tx
+}
+
+func (c *nonceTestChain) status(t *testing.T, nonce uint64) models.NonceStatusType {
+	t.Helper()
+	var reservation models.NonceReservation
+	if err := c.db.First(&reservation, "wallet = ? AND nonce = ?", c.address, nonce).Error; err != nil {
+		t.Fatalf("reservation %d: %v", nonce, err)
+	}
+	return reservation.Status
+}
+
+func TestReserveNonces(t *testing.T) {
+	chain := newNonceTestChain(t)
+	// sent before the manager knew the wallet, reservations start after it
+	chain.send(t, 0)
+	chain.node.Commit()
+
+	const workers = 20
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var reserved []uint64
+	for _i := 0; _i < workers; _i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			nonces, err := ReserveNonces(chain.address, 1, "test")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			mu.Lock()
+			reserved = append(reserved, nonces...)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	sort.Slice(reserved, func(i, j int) bool { return reserved[i] < reserved[j] })
+	for _i, _nonce := range reserved {
+		if _nonce != uint64(_i+1) {
+			t.Fatalf("reserved %v, want 1 to %d once each", reserved, workers)
+		}
+	}
+
+	// the latest nonce is handed out again once released
+	ReleaseNonce(chain.address, workers)
+	nonces, err := ReserveNonces(chain.address, 1, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nonces[0] != workers {
+		t.Fatalf("reserved %d after releasing the latest nonce, want %d", nonces[0], workers)
+	}
+}
+
+// persisted reservations survive a restart, so nonces handed out before it are not reused
+func TestReserveNoncesAfterRestart(t *testing.T) {
+	chain := newNonceTestChain(t)
+	if _, err := ReserveNonces(chain.address, 3, "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	WalletNonces.Reset()
+	nonces, err := ReserveNonces(chain.address, 1, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nonces[0] != 3 {
+		t.Fatalf("reserved %d after a restart, want 3", nonces[0])
+	}
+
+	// the node is ahead once other transactions of the wallet are mined
+	WalletNonces.Reset()
+	for _nonce := uint64(0); _nonce < 6; _nonce++ {
+		chain.send(t, _nonce)
+	}
+	chain.node.Commit()
+	if nonces, err = ReserveNonces(chain.address, 1, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if nonces[0] != 6 {
+		t.Fatalf("reserved %d behind the node, want 6", nonces[0])
+	}
+}
+
+func TestReconcileNoncesFillsGaps(t *testing.T) {
+	chain := newNonceTestChain(t)
+	ctx := context.Background()
+
+	nonces, err := ReserveNonces(chain.address, 3, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, _nonce := range []uint64{nonces[0], nonces[2]} {
+		tx := chain.send(t, _nonce)
+		MarkNonceSent(chain.address, _nonce, tx.Hash().Hex())
+	}
+	// nothing is sent with the middle nonce, the last one waits behind it
+	ReleaseNonce(chain.address, nonces[1])
+	chain.node.Commit()
+
+	if err := reconcileNonces(ctx, chain.node, chain.address); err != nil {
+		t.Fatal(err)
+	}
+	if status := chain.status(t, 0); status != models.NonceMined {
+		t.Fatalf("nonce 0 is %s, want mined", status)
+	}
+	if status := chain.status(t, 1); status != models.NonceFilled {
+		t.Fatalf("nonce 1 is %s, want filled", status)
+	}
+	var filled models.Transaction
+	if err := chain.db.First(&filled, "purpose = ? AND nonce = ?", "gap_fill", 1).Error; err != nil {
+		t.Fatalf("gap fill is not tracked: %v", err)
+	}
+
+	chain.node.Commit()
+	mined, err := chain.node.NonceAt(ctx, common.HexToAddress(chain.address), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mined != 3 {
+		t.Fatalf("%d transactions mined, want the gap and the one waiting behind it", mined)
+	}
+
+	if err := reconcileNonces(ctx, chain.node, chain.address); err != nil {
+		t.Fatal(err)
+	}
+	for _nonce := uint64(0); _nonce < 3; _nonce++ {
+		if status := chain.status(t, _nonce); status != models.NonceMined {
+			t.Fatalf("nonce %d is %s, want mined", _nonce, status)
+		}
+	}
+}
@@ -5,7 +5,6 @@ import (
 	"bot/models"
 	"bot/utils"
 	"context"
-	"crypto/ecdsa"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
@@ -13,11 +12,11 @@ import (
 	"log"
 	"math"
 	"math/big"
-	"math/rand"
 	"os"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ethereum/go-ethereum"
@@ -86,18 +85,10 @@ func (t *ERC20Token) BalanceOf(owner common.Address) ([]interface{}, error) {
 func GetTokenDecimals(client *ethclient.Client, tokenAddress common.Address) (*int32, error) {
 	// Define the contract ABI for the decimals function
 	if client == nil {
-		p := Polygon{}
-		p.GetNode(true)
-
-		nodeSupportPool, ok := p.NodeSupportPool.([]string)
-		if !ok {
-			log.Fatal("Failed to assert NodeSupportPool as []string")
-			return nil, errors.New("Failed to assert NodeSupportPool as []string")
+		var err error
+		if client, err = supportClient(); err != nil {
+			return nil, err
 		}
-
-		node := nodeSupportPool[rand.Intn(len(nodeSupportPool))]
-		client = p.GetClient(node)
-		defer client.Close()
 	}
 
 	const decimalsABI = `[{"constant":true,"inputs":[],"name":"decimals","outputs":[{"name":"","type":"uint8"}],"payable":false,"stateMutability":"view","type":"function"}]`
@@ -141,17 +132,47 @@ func GetTokenDecimals(client *ethclient.Client, tokenAddress common.Address) (*i
 // Approve spendings
 func (t *ERC20Token) Approve(spender common.Address, signer *bind.TransactOpts, value *big.Int, nonce *uint64) (*types.Transaction, error) {
 	if nonce != nil {
-		signer.Nonce = big.NewInt(int64(*nonce))
+		// signers are shared per wallet, the nonce only applies to this call
+		_signer := *signer
+		_signer.Nonce = new(big.Int).SetUint64(*nonce)
+		signer = &_signer
 		// signer.GasTipCap = big.NewInt(150)
 	}
 	return t.contract.Transact(signer, "approve", spender, value)
 }
 
+// ManagedApprove is Approve with a nonce reserved from the nonce manager
+func (t *ERC20Token) ManagedApprove(spender common.Address, signer *bind.TransactOpts, value *big.Int) (*types.Transaction, error) {
+	// signers are shared per wallet, fees only apply to this call
+	_signer := *signer
+	signer = &_signer
+	if err := withOracleGas(signer); err != nil {
+		return nil, err
+	}
+	nonces, err := ReserveNonces(signer.From.Hex(), 1, "approve")
+	if err != nil {
+		return nil, err
+	}
+	tx, err := t.Approve(spender, signer, value, &nonces[0])
+	if err != nil {
+		ReleaseNonce(signer.From.Hex(), nonces[0])
+		return nil, err
+	}
+	MarkNonceSent(signer.From.Hex(), nonces[0], tx.Hash().Hex())
+	TrackOutbound(tx, signer.From.Hex(), "approve")
+	return tx, nil
+}
+
 // Wrapper to revoke approvement
 func (t *ERC20Token) Revoke(spender common.Address, signer *bind.TransactOpts) (*types.Transaction, error) {
 	return t.contract.Transact(signer, "approve", spender, ZERO_BIG_INT)
 }
 
+// Transfer tokens out of the signer's wallet
+func (t *ERC20Token) Transfer(to common.Address, amount *big.Int, signer *bind.TransactOpts) (*types.Transaction, error) {
+	return t.contract.Transact(signer, "transfer", to, amount)
+}
+
 func (t *ERC20Token) Allowance(owner, spender common.Address) (allowance *big.Int, err error) {
 	var result []interface{}
 	if err = t.contract.Call(nil, &result, "allowance", owner, spender); err != nil {
@@ -195,40 +216,36 @@ func RetrieveERC20Balance(p Polygon, client *ethclient.Client, walletAddress, ad
 	}
 }
 
-func (p Polygon) PreApproveERC20TokensForDexs(client *ethclient.Client, _walletAddress string) {
+func (p Polygon) PreApproveERC20TokensForDexs(client *ethclient.Client, _walletAddress string) error {
 	if client == nil {
-		nodeSupportPool, ok := p.NodeSupportPool.([]string)
-		if !ok {
-			log.Fatal("Failed to assert NodeSupportPool as []string")
-		} else {
-			node := nodeSupportPool[rand.Intn(len(nodeSupportPool))]
-			client = p.GetClient(node)
+		var err error
+		if client, err = supportClient(); err != nil {
+			return fmt.Errorf("pre-approving tokens of %s: %v", _walletAddress, err)
 		}
 	}
 
-	for _coinName, _coinData := range GlobalSettings.Polygon.Coins {
-		for _dexType, _dexAddress := range GlobalSettings.Polygon.DEXs {
+	for _coinName, _coinData := range GlobalSettings().Polygon.Coins {
+		for _dexType, _dexAddress := range GlobalSettings().Polygon.DEXs {
 			fmt.Println(_coinName, ": preapproving coin for", _dexType)
 			decimalsInt32 := _coinData[1].(int32)
 			// decimalsInt32 := int32(decimals.Coefficient().Int64())
 
 			// go func(_coinData []interface{}, _dexAddress string, decimalsInt32 int32) {
-			PreApproveERC20Token(p, client, _walletAddress, _coinData[0].(string), _dexAddress, decimalsInt32, nil, nil)
+			if err := PreApproveERC20Token(p, client, _walletAddress, _coinData[0].(string), _dexAddress, decimalsInt32, nil); err != nil {
+				return err
+			}
 			// }(_coinData, _dexAddress, decimalsInt32)
 		}
 	}
+	return nil
 }
 
-func (p Polygon) PreApproveERC20ContractsForDexs(client *ethclient.Client, _walletAddress string, amount *int64) {
+func (p Polygon) PreApproveERC20ContractsForDexs(client *ethclient.Client, _walletAddress string, amount *int64) error {
 	if client == nil {
-		nodeSupportPool, ok := p.NodeSupportPool.([]string)
-		if !ok {
-			log.Fatal("Failed to assert NodeSupportPool as []string")
-
+		var err error
+		if client, err = supportClient(); err != nil {
+			return fmt.Errorf("pre-approving contracts of %s: %v", _walletAddress, err)
 		}
-
-		node := nodeSupportPool[rand.Intn(len(nodeSupportPool))]
-		client = p.GetClient(node)
 	}
 
 	// _nonce, err := client.NonceAt(context.Background(), common.HexToAddress(_walletAddress), nil)
@@ -237,7 +254,7 @@ func (p Polygon) PreApproveERC20ContractsForDexs(client *ethclient.Client, _wall
 	// 	return
 	// }
 
-	for _contractAddress, _contractData := range GlobalSettings.Polygon.Contracts.Whitelist {
+	for _contractAddress, _contractData := range GlobalSettings().Polygon.Contracts.Whitelist {
 		// _decimals, err := GetTokenDecimals(client, common.HexToAddress(_contractAddress))
 		// if err != nil {
 		// 	log.Printf("Failed to get decimals for contract: %v", err)
@@ -246,7 +263,7 @@ func (p Polygon) PreApproveERC20ContractsForDexs(client *ethclient.Client, _wall
 
 		decimalsInt32 := _contractData.Decimals
 
-		for _dexType, _dexAddress := range GlobalSettings.Polygon.DEXs {
+		for _dexType, _dexAddress := range GlobalSettings().Polygon.DEXs {
 			fmt.Println(_contractAddress, ": preapproving contract for", _dexType)
 
 			// decimals := decimal.NewFromInt32(*_decimals)
@@ -255,21 +272,24 @@ func (p Polygon) PreApproveERC20ContractsForDexs(client *ethclient.Client, _wall
 
 			// go func(_contractAddress, _dexAddress string) {
 
-			PreApproveERC20Token(p, client, _walletAddress, _contractAddress, _dexAddress, *decimalsInt32, amount, nil)
+			if err := PreApproveERC20Token(p, client, _walletAddress, _contractAddress, _dexAddress, *decimalsInt32, amount); err != nil {
+				return err
+			}
 
 			// }(_contractAddress, _dexAddress)
 		}
 	}
+	return nil
 }
 
-var balanceSimpleLock = false
-var balanceMutex sync.Mutex
+// set while a balance refresh runs, TokenBalance starts at most one at a time
+var balanceSimpleLock atomic.Bool
 
 func WalletKnownBalances(p Polygon, client *ethclient.Client) {
 	var wg sync.WaitGroup
-	balanceSimpleLock = true
+	balanceSimpleLock.Store(true)
 
-	for _, _walletAddress := range GlobalSettings.Polygon.Wallets.Main {
+	for _, _walletAddress := range GlobalSettings().Polygon.Wallets.Main {
 		wg.Add(1)
 		go func(_walletAddress models.Wallet) {
 			defer wg.Done()
@@ -279,23 +299,13 @@ func WalletKnownBalances(p Polygon, client *ethclient.Client) {
 				log.Printf("Failed to retrieve Matic balance: %v", err)
 				return
 			}
-			if GlobalSettings.Polygon.WalletBalance == nil {
-				GlobalSettings.Polygon.WalletBalance = map[string]map[string]Balance{}
-			}
-
-			if GlobalSettings.Polygon.WalletBalance[*_walletAddress.Address] == nil {
-				GlobalSettings.Polygon.WalletBalance[*_walletAddress.Address] = map[string]Balance{}
-			}
-
-			balanceMutex.Lock()
-			GlobalSettings.Polygon.WalletBalance[*_walletAddress.Address]["matic"] = Balance{
+			WalletBalance.Store(balanceKey{*_walletAddress.Address, "matic"}, Balance{
 				Decimal:    maticBalance,
 				BigInt:     maticBalanceBigInt,
 				ERC20Token: nil,
-			}
-			balanceMutex.Unlock()
+			})
 
-			for _, _coinData := range GlobalSettings.Polygon.Coins {
+			for _, _coinData := range GlobalSettings().Polygon.Coins {
 				wg.Add(1)
 				go func(_coinData []interface{}) {
 					defer wg.Done()
@@ -305,29 +315,25 @@ func WalletKnownBalances(p Polygon, client *ethclient.Client) {
 
 					erc20Balance, erc20BalanceBigInt, erc20Token := RetrieveERC20Balance(p, client, *_walletAddress.Address, _coinAddress, decimalsInt32)
 
-					balanceMutex.Lock()
-					GlobalSettings.Polygon.WalletBalance[*_walletAddress.Address][_coinAddress] = Balance{
+					WalletBalance.Store(balanceKey{*_walletAddress.Address, _coinAddress}, Balance{
 						Decimal:    erc20Balance,
 						BigInt:     erc20BalanceBigInt,
 						ERC20Token: erc20Token,
-					}
-					balanceMutex.Unlock()
+					})
 				}(_coinData)
 			}
-			for _, _wContracts := range GlobalSettings.Polygon.Contracts.Whitelist {
+			for _, _wContracts := range GlobalSettings().Polygon.Contracts.Whitelist {
 				wg.Add(1)
 				go func(_wContracts Contract) {
 					defer wg.Done()
 
 					erc20Balance, erc20BalanceBigInt, erc20Token := RetrieveERC20Balance(p, client, *_walletAddress.Address, *_wContracts.Address, *_wContracts.Decimals)
 
-					balanceMutex.Lock()
-					GlobalSettings.Polygon.WalletBalance[*_walletAddress.Address][*_wContracts.Address] = Balance{
+					WalletBalance.Store(balanceKey{*_walletAddress.Address, *_wContracts.Address}, Balance{
 						Decimal:    erc20Balance,
 						BigInt:     erc20BalanceBigInt,
 						ERC20Token: erc20Token,
-					}
-					balanceMutex.Unlock()
+					})
 				}(_wContracts)
 
 			}
@@ -336,17 +342,15 @@ func WalletKnownBalances(p Polygon, client *ethclient.Client) {
 
 	go func() {
 		wg.Wait()
-		balanceSimpleLock = false
+		balanceSimpleLock.Store(false)
 	}()
 }
 
-var allowanceMutex sync.Mutex
-
 func WalletKnownAllowances(p Polygon, client *ethclient.Client) {
 	var wg sync.WaitGroup
-	balanceSimpleLock = true
+	balanceSimpleLock.Store(true)
 
-	for _, _walletAddress := range GlobalSettings.Polygon.Wallets.Main {
+	for _, _walletAddress := range GlobalSettings().Polygon.Wallets.Main {
 		wg.Add(1)
 		go func(_walletAddress models.Wallet) {
 			defer wg.Done()
@@ -356,23 +360,13 @@ func WalletKnownAllowances(p Polygon, client *ethclient.Client) {
 				log.Printf("Failed to retrieve Matic balance: %v", err)
 				return
 			}
-			if GlobalSettings.Polygon.WalletBalance == nil {
-				GlobalSettings.Polygon.WalletBalance = map[string]map[string]Balance{}
-			}
-
-			if GlobalSettings.Polygon.WalletBalance[*_walletAddress.Address] == nil {
-				GlobalSettings.Polygon.WalletBalance[*_walletAddress.Address] = map[string]Balance{}
-			}
-
-			allowanceMutex.Lock()
-			GlobalSettings.Polygon.WalletBalance[*_walletAddress.Address]["matic"] = Balance{
+			WalletBalance.Store(balanceKey{*_walletAddress.Address, "matic"}, Balance{
 				Decimal:    maticBalance,
 				BigInt:     maticBalanceBigInt,
 				ERC20Token: nil,
-			}
-			allowanceMutex.Unlock()
+			})
 
-			for _, _coinData := range GlobalSettings.Polygon.Coins {
+			for _, _coinData := range GlobalSettings().Polygon.Coins {
 				wg.Add(1)
 				go func(_coinData []interface{}) {
 					defer wg.Done()
@@ -382,13 +376,11 @@ func WalletKnownAllowances(p Polygon, client *ethclient.Client) {
 
 					erc20Balance, erc20BalanceBigInt, erc20Token := RetrieveERC20Balance(p, client, *_walletAddress.Address, _coinAddress, decimalsInt32)
 
-					allowanceMutex.Lock()
-					GlobalSettings.Polygon.WalletBalance[*_walletAddress.Address][_coinAddress] = Balance{
+					WalletBalance.Store(balanceKey{*_walletAddress.Address, _coinAddress}, Balance{
 						Decimal:    erc20Balance,
 						BigInt:     erc20BalanceBigInt,
 						ERC20Token: erc20Token,
-					}
-					allowanceMutex.Unlock()
+					})
 				}(_coinData)
 			}
 		}(_walletAddress)
@@ -396,29 +388,37 @@ func WalletKnownAllowances(p Polygon, client *ethclient.Client) {
 
 	go func() {
 		wg.Wait()
-		balanceSimpleLock = false
+		balanceSimpleLock.Store(false)
 	}()
 }
 
 func TokenBalance(p Polygon, client *ethclient.Client, walletAddress, tokenAddress string, decimals int32) (tokenBalance *Balance) {
 	// fmt.Println("TOKEN BALANCE", walletAddress, tokenAddress)
-	var _tokenBalance = GlobalSettings.Polygon.WalletBalance[walletAddress][tokenAddress]
+	_tokenBalance, _ := WalletBalance.Load(balanceKey{walletAddress, tokenAddress})
 	// fmt.Println("TOKEN BALANCE", _tokenBalance)
 
 	tokenBalance = &_tokenBalance
 	go func() {
-		if balanceSimpleLock {
+		if !balanceSimpleLock.CompareAndSwap(false, true) {
 			return
 		}
-		balanceSimpleLock = true
 		WalletKnownBalances(p, client)
 	}()
 
 	return tokenBalance
 }
 
-func PreApproveERC20Token(p Polygon, client *ethclient.Client, walletAddress, tokenAddress, dexRouter string, decimals int32, amount *int64, _nonce *uint64) {
+// PreApproveERC20Token tops up the allowance of dexRouter over tokenAddress, up to the draw down
+// of the balance or to amount when given
+func PreApproveERC20Token(p Polygon, client *ethclient.Client, walletAddress, tokenAddress, dexRouter string, decimals int32, amount *int64) error {
 	erc20Balance, _, erc20Token := RetrieveERC20Balance(p, client, walletAddress, tokenAddress, decimals)
+	if erc20Token == nil {
+		return fmt.Errorf("reading the %s balance of %s failed", tokenAddress, walletAddress)
+	}
+	auth, ok := WalletAuth.Load(walletAddress)
+	if !ok {
+		return fmt.Errorf("no transactor for %s", walletAddress)
+	}
 
 	// fmt.Println("ERC20 BALANCE", erc20Balance)
 	botMainWalletAddress := common.HexToAddress(walletAddress)
@@ -426,32 +426,22 @@ func PreApproveERC20Token(p Polygon, client *ethclient.Client, walletAddress, to
 
 	// walletAddress, tokenAddress, dexRouter = strings.ToLower(walletAddress), strings.ToLower(tokenAddress), strings.ToLower(dexRouter)
 
-	if GlobalSettings.Polygon.WalletAllowance == nil {
-		GlobalSettings.Polygon.WalletAllowance = map[string]map[string]map[string]Allowance{}
-	}
-	if GlobalSettings.Polygon.WalletAllowance[walletAddress] == nil {
-		GlobalSettings.Polygon.WalletAllowance[walletAddress] = map[string]map[string]Allowance{}
-	}
-	if GlobalSettings.Polygon.WalletAllowance[walletAddress][tokenAddress] == nil {
-		GlobalSettings.Polygon.WalletAllowance[walletAddress][tokenAddress] = map[string]Allowance{}
-	}
-
-	// if _pendingNonce, err = client.PendingNonceAt(context.Background(), common.HexToAddress(*GlobalSettings.Polygon.Wallets.Main.Address)); err != nil {
+	// if _pendingNonce, err = client.PendingNonceAt(context.Background(), common.HexToAddress(*GlobalSettings().Polygon.Wallets.Main.Address)); err != nil {
 	// 	log.Printf("Failed to get pending nonce: %v", err)
 	// 	return
 	// }
 
 	if amount == nil {
-		drawDown := GlobalSettings.Polygon.Settings.DrawDown
+		drawDown := GlobalSettings().Polygon.Settings.DrawDown
 
 		if erc20Balance.Equals(decimal.Zero) {
 			log.Println("balance is zero")
-			return
+			return nil
 		}
 
 		erc20Allowance, err := erc20Token.Allowance(botMainWalletAddress, dexRouterAddress)
 		if err != nil {
-			log.Fatalf("Failed to get allowance: %v, %s", err, botMainWalletAddress)
+			return fmt.Errorf("reading the %s allowance of %s: %v", tokenAddress, walletAddress, err)
 		}
 
 		// fmt.Println("ERC20 ALLOWANCE", erc20Allowance)
@@ -469,21 +459,18 @@ func PreApproveERC20Token(p Polygon, client *ethclient.Client, walletAddress, to
 			drawdownAmountBigInt := drawDownPseudoBigInt.BigInt()
 
 			// Approve the drawdown amount
-			fmt.Println(walletAddress)
-			fmt.Println(p.Auth[walletAddress])
-			tx, err := erc20Token.Approve(dexRouterAddress, p.Auth[walletAddress], drawdownAmountBigInt, nil)
+			tx, err := erc20Token.ManagedApprove(dexRouterAddress, auth, drawdownAmountBigInt)
 			if err != nil {
-				log.Fatalf("Failed to approve ERC20 token: %v", err)
+				return fmt.Errorf("approving %s for %s: %v", tokenAddress, dexRouter, err)
 			}
 
 			// Wait for the approval transaction to be confirmed
 			// ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
 			// defer cancel()
 
-			reciept, err := bind.WaitMined(context.Background(), client, tx)
-
-			fmt.Println(err)
-			fmt.Println(reciept)
+			if err := waitApproval(client, tx); err != nil {
+				return err
+			}
 
 			erc20Allowance = drawdownAmountBigInt
 			allowance = decimal.NewFromBigInt(erc20Allowance, -decimals)
@@ -492,18 +479,15 @@ func PreApproveERC20Token(p Polygon, client *ethclient.Client, walletAddress, to
 			log.Printf("Allowance percentage %s%% meets or exceeds the drawdown limit %s%%. No pre-approval required.", allowancePercentage, drawDownDecimal)
 		}
 
-		allowanceMutex.Lock()
-		GlobalSettings.Polygon.WalletAllowance[walletAddress][tokenAddress][dexRouter] = Allowance{
+		WalletAllowance.Store(allowanceKey{walletAddress, tokenAddress, dexRouter}, Allowance{
 			Decimal: allowance,
 			BigInt:  erc20Allowance,
 			// DEX:     dexRouter,
-		}
-
-		allowanceMutex.Unlock()
+		})
 	} else {
 		erc20Allowance, err := erc20Token.Allowance(botMainWalletAddress, dexRouterAddress)
 		if err != nil {
-			log.Fatalf("Failed to get allowance: %v, %s", err, botMainWalletAddress)
+			return fmt.Errorf("reading the %s allowance of %s: %v", tokenAddress, walletAddress, err)
 		}
 
 		// fmt.Println(erc20Allowance)
@@ -517,32 +501,42 @@ func PreApproveERC20Token(p Polygon, client *ethclient.Client, walletAddress, to
 		// log.Println("HALF AMOUNT TO APPROVE", halfAmountToApprove, erc20Allowance)
 
 		if erc20Allowance.Cmp(halfAmountToApprove) < 0 {
-			// fmt.Println("NONCE", *_nonce)
-
-			tx, err := erc20Token.Approve(dexRouterAddress, p.Auth[walletAddress], amountToApprove, _nonce)
+			tx, err := erc20Token.ManagedApprove(dexRouterAddress, auth, amountToApprove)
 			if err != nil {
-				log.Fatalf("Failed to approve ERC20 token: %v", err)
+				return fmt.Errorf("approving %s for %s: %v", tokenAddress, dexRouter, err)
 			}
 
 			// Wait for the approval transaction to be confirmed
 			// ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
 			// defer cancel()
-			bind.WaitMined(context.Background(), client, tx)
+			if err := waitApproval(client, tx); err != nil {
+				return err
+			}
 			log.Printf("Approval transaction hash: %s", tx.Hash().Hex())
 		}
 
-		allowanceMutex.Lock()
-		GlobalSettings.Polygon.WalletAllowance[walletAddress][tokenAddress][dexRouter] = Allowance{
+		WalletAllowance.Store(allowanceKey{walletAddress, tokenAddress, dexRouter}, Allowance{
 			Decimal: _amountToApproveDecimal,
 			BigInt:  amountToApprove,
 			// DEX:     dexRouter,
-		}
-		allowanceMutex.Unlock()
+		})
 	}
+	return nil
+}
+
+func waitApproval(client *ethclient.Client, tx *types.Transaction) error {
+	receipt, err := bind.WaitMined(context.Background(), client, tx)
+	if err != nil {
+		return fmt.Errorf("waiting for approval %s: %v", tx.Hash().Hex(), err)
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		return fmt.Errorf("approval %s reverted", tx.Hash().Hex())
+	}
+	return nil
 }
 
 func RetrieveBalance(client *ethclient.Client, walletAddress string) (decimal.Decimal, *big.Int, error) {
-	balance, err := client.BalanceAt(context.Background(), common.HexToAddress(*GlobalSettings.Polygon.Wallets.Main[0].Address), nil)
+	balance, err := client.BalanceAt(context.Background(), common.HexToAddress(*GlobalSettings().Polygon.Wallets.Main[0].Address), nil)
 	if err != nil {
 		log.Printf("Failed to get balance: %v", err)
 		return decimal.NewFromInt(0), nil, err
@@ -552,12 +546,11 @@ func RetrieveBalance(client *ethclient.Client, walletAddress string) (decimal.De
 }
 
 type Polygon struct {
-	Node            interface{}                   `json:"node"`
-	NodePool        interface{}                   `json:"node_pool"`
-	NodeSupportPool interface{}                   `json:"node_support_pool"`
-	Client          []*ethclient.Client           `json:"client"`
-	Auth            map[string]*bind.TransactOpts `json:"auth"`
-	Nonce           *uint64                       `json:"nonce"`
+	Node            interface{}         `json:"node"`
+	NodePool        interface{}         `json:"node_pool"`
+	NodeSupportPool interface{}         `json:"node_support_pool"`
+	Client          []*ethclient.Client `json:"client"`
+	Nonce           *uint64             `json:"nonce"`
 }
 
 type Nodes struct {
@@ -587,42 +580,6 @@ type txAmount struct {
 	amountMax *big.Int
 }
 
-func WalletNonceSync(p Polygon, client *ethclient.Client, walletAddress string) (err error) {
-	if client == nil {
-		nodeSupportPool, ok := p.NodeSupportPool.([]string)
-		if !ok {
-			log.Fatal("Failed to assert NodeSupportPool as []string")
-		} else {
-			node := nodeSupportPool[rand.Intn(len(nodeSupportPool))]
-			client = p.GetClient(node)
-		}
-	}
-
-	walletAddress = strings.ToLower(walletAddress)
-
-	var _pendingNonce, _nonce uint64
-
-	if _pendingNonce, err = client.PendingNonceAt(context.Background(), common.HexToAddress(walletAddress)); err != nil {
-		return fmt.Errorf("Failed to get pending nonce: %v", err)
-	}
-
-	if _nonce, err = client.NonceAt(context.Background(), common.HexToAddress(walletAddress), nil); err != nil {
-		return fmt.Errorf("Failed to get nonce: %v", err)
-	}
-
-	if GlobalSettings.Polygon.WalletNonce == nil {
-		GlobalSettings.Polygon.WalletNonce = map[string]Nonce{
-			walletAddress: {
-				Nonce:        &_nonce,
-				PendingNonce: &_pendingNonce,
-			},
-		}
-	}
-	fmt.Println("Wallet: ", walletAddress, "\n", "Nonce: ", _nonce, "\n", "Pending nonce: ", _pendingNonce)
-
-	return nil
-}
-
 func (p *Polygon) AnalyzeTx(tx *types.Transaction, client *ethclient.Client, args ...interface{}) {
 	// mutex2.Lock()
 	// if _, exists := duplicateTxHashes[tx.Hash().Hex()]; exists {
@@ -634,6 +591,9 @@ func (p *Polygon) AnalyzeTx(tx *types.Transaction, client *ethclient.Client, arg
 	// fmt.Println(time.Now().Format("2006-01-02T15:04:05.999Z07:00"), tx.Hash().Hex())
 	// loger
 
+	// one snapshot for the whole analysis, a reload in between must not mix settings
+	settings := GlobalSettings()
+
 	if tx.To() == nil {
 		// log.Println("===========================================================")
 		// log.Println("Contract Creation: skipping")
@@ -641,7 +601,7 @@ func (p *Polygon) AnalyzeTx(tx *types.Transaction, client *ethclient.Client, arg
 		return
 	}
 
-	dex, _dexRouter, contains := utils.MapContains(GlobalSettings.Polygon.DEXs, tx.To().String())
+	dex, _dexRouter, contains := utils.MapContains(settings.Polygon.DEXs, tx.To().String())
 	if !contains {
 		// log.Printf("Tx routing swap through unknown dex %s", tx.To().String())
 		// log.Println("===========================================================")
@@ -666,8 +626,8 @@ func (p *Polygon) AnalyzeTx(tx *types.Transaction, client *ethclient.Client, arg
 	// walletToAttackWith := args[1].(*common.Address)
 	// privateKey := args[2].(*ecdsa.PrivateKey)
 
-	// fmt.Println("Allowance", GlobalSettings.Polygon.WalletAllowance)
-	// fmt.Println("Balance", GlobalSettings.Polygon.WalletBalance)
+	// fmt.Println("Allowance", settings.Polygon.WalletAllowance)
+	// fmt.Println("Balance", settings.Polygon.WalletBalance)
 
 	// preapprovement check
 	// p.PreApproveERC20TokensForDexs(nil)
@@ -686,7 +646,7 @@ func (p *Polygon) AnalyzeTx(tx *types.Transaction, client *ethclient.Client, arg
 	// 	return
 	// }
 
-	var parsedABI = GlobalSettings.Polygon.ABI[*dex]
+	var parsedABI = settings.Polygon.ABI[*dex]
 
 	if len(tx.Data()) < 4 {
 		return
@@ -764,7 +724,7 @@ func (p *Polygon) AnalyzeTx(tx *types.Transaction, client *ethclient.Client, arg
 						// if true {
 						if false {
 							fmt.Println("This target tx using matic for swap", tx.Value())
-							Logger(tx, method, &GlobalSettings, fmt.Sprintf("Failed to assert amountIn from params.\nTxHash: %s\nInputs: %v\n", tx.Hash().Hex(), inputs), true)
+							Logger(tx, method, settings, fmt.Sprintf("Failed to assert amountIn from params.\nTxHash: %s\nInputs: %v\n", tx.Hash().Hex(), inputs), true)
 							return
 						}
 					}
@@ -784,7 +744,7 @@ func (p *Polygon) AnalyzeTx(tx *types.Transaction, client *ethclient.Client, arg
 						amountOut.amountMin = params.AmountOutMinimum
 						amountOut.amountMax = params.AmountOutMaximum
 					} else {
-						Logger(tx, method, &GlobalSettings, fmt.Sprintf("Failed to assert amountOut from params.\nTxHash: %s\nInputs: %v\n", tx.Hash().Hex(), inputs), true)
+						Logger(tx, method, settings, fmt.Sprintf("Failed to assert amountOut from params.\nTxHash: %s\nInputs: %v\n", tx.Hash().Hex(), inputs), true)
 						return
 
 					}
@@ -810,7 +770,7 @@ func (p *Polygon) AnalyzeTx(tx *types.Transaction, client *ethclient.Client, arg
 							feeTierHex := hexString[i : i+feeTierLength]
 							feeTierDec, err := strconv.ParseInt(feeTierHex, 16, 32)
 							if err != nil {
-								Logger(tx, method, &GlobalSettings, fmt.Sprintf("Error parsing fee tier: %v", err), true)
+								Logger(tx, method, settings, fmt.Sprintf("Error parsing fee tier: %v", err), true)
 								return
 							}
 							feeTiers = append(feeTiers, fmt.Sprintf("%d", feeTierDec))
@@ -821,7 +781,7 @@ func (p *Polygon) AnalyzeTx(tx *types.Transaction, client *ethclient.Client, arg
 					path = []common.Address{params.TokenIn, params.TokenOut}
 				}
 			} else {
-				Logger(tx, method, &GlobalSettings, "Failed to assert path as []common.Address", true)
+				Logger(tx, method, settings, "Failed to assert path as []common.Address", true)
 				return
 			}
 		}
@@ -849,20 +809,20 @@ func (p *Polygon) AnalyzeTx(tx *types.Transaction, client *ethclient.Client, arg
 			// Contract target tx is trying to buy
 			contract := strings.ToLower(path[len(path)-1].Hex())
 
-			if _, exists := GlobalSettings.Polygon.Contracts.BlackList[contract]; exists {
-				Logger(tx, method, &GlobalSettings, fmt.Sprintf("Tx Contract %s is in the blacklist. Skipping transaction.", contract), true)
+			if _, exists := settings.Polygon.Contracts.BlackList[contract]; exists {
+				Logger(tx, method, settings, fmt.Sprintf("Tx Contract %s is in the blacklist. Skipping transaction.", contract), true)
 				return
 			}
 
-			whitelistedContract, exists := GlobalSettings.Polygon.Contracts.Whitelist[contract]
+			whitelistedContract, exists := settings.Polygon.Contracts.Whitelist[contract]
 			if !exists {
-				Logger(tx, method, &GlobalSettings, fmt.Sprintf("Tx Contract %s is not in the whitelist. Skipping transaction.", contract), true)
+				Logger(tx, method, settings, fmt.Sprintf("Tx Contract %s is not in the whitelist. Skipping transaction.", contract), true)
 				return
 			}
 
-			coin, coinAddress, coinDecimals, allowed := utils.MapContainsV2(GlobalSettings.Polygon.Coins, path[0].String())
+			coin, coinAddress, coinDecimals, allowed := utils.MapContainsV2(settings.Polygon.Coins, path[0].String())
 			if !allowed {
-				Logger(tx, method, &GlobalSettings, fmt.Sprintf("Tx trading coin that is not supported yet. Please add wallet with that coin to metamask and log this wallet data to database. Coin: %s", path[0].String()), true)
+				Logger(tx, method, settings, fmt.Sprintf("Tx trading coin that is not supported yet. Please add wallet with that coin to metamask and log this wallet data to database. Coin: %s", path[0].String()), true)
 				return
 			}
 
@@ -878,13 +838,13 @@ func (p *Polygon) AnalyzeTx(tx *types.Transaction, client *ethclient.Client, arg
 
 			// erc20ContractABIString, err := p.LoadABI("erc20")
 			// if err != nil {
-			// 	Logger(tx, method, &GlobalSettings, fmt.Sprintf("Failed to read erc-20 ABI file: %v", err), true)
+			// 	Logger(tx, method, settings, fmt.Sprintf("Failed to read erc-20 ABI file: %v", err), true)
 			// 	return
 			// }
 
 			// erc20ABI, err := abi.JSON(strings.NewReader(erc20ContractABIString))
 			// if err != nil {
-			// 	Logger(tx, method, &GlobalSettings, fmt.Sprintf("Failed to parse ERC-20 contract ABI: %vv", err), true)
+			// 	Logger(tx, method, settings, fmt.Sprintf("Failed to parse ERC-20 contract ABI: %vv", err), true)
 			// 	return
 			// }
 
@@ -897,7 +857,7 @@ func (p *Polygon) AnalyzeTx(tx *types.Transaction, client *ethclient.Client, arg
 			// contractDecimals = &_int18
 			// contractDecimals, err = GetTokenDecimals(client, common.HexToAddress(contract))
 			// if err != nil || contractDecimals == nil {
-			// 	Logger(tx, method, &GlobalSettings, fmt.Sprintf("Failed to retrieve decimals for contract: %s", contract), true)
+			// 	Logger(tx, method, settings, fmt.Sprintf("Failed to retrieve decimals for contract: %s", contract), true)
 			// 	return
 			// }
 			// erc20ContractTokenBalance = decimal.NewFromInt(0)
@@ -909,9 +869,9 @@ func (p *Polygon) AnalyzeTx(tx *types.Transaction, client *ethclient.Client, arg
 			// go func() {
 			// 	defer wg.Done() // Ensure we signal that this goroutine is done
 
-			// 	// maticBalance, maticBalanceBigInt, err = RetrieveBalance(client, *GlobalSettings.Polygon.Wallets.Main.Address)
+			// 	// maticBalance, maticBalanceBigInt, err = RetrieveBalance(client, *settings.Polygon.Wallets.Main.Address)
 			// 	// if err != nil {
-			// 	// 	Logger(tx, method, &GlobalSettings, fmt.Sprint("Failed to retrieve Matic balance"), true)
+			// 	// 	Logger(tx, method, settings, fmt.Sprint("Failed to retrieve Matic balance"), true)
 			// 	// 	return
 			// 	// }
 
@@ -919,7 +879,7 @@ func (p *Polygon) AnalyzeTx(tx *types.Transaction, client *ethclient.Client, arg
 			// 	maticBalanceBigInt = big.NewInt(6386825403753865241)
 
 			// 	if maticBalance.Equal(decimal.NewFromInt(0)) {
-			// 		Logger(tx, method, &GlobalSettings, fmt.Sprintf("Not enough MATIC to cover txs: %v", maticBalance), true)
+			// 		Logger(tx, method, settings, fmt.Sprintf("Not enough MATIC to cover txs: %v", maticBalance), true)
 			// 		return
 			// 	}
 			// }()
@@ -928,10 +888,10 @@ func (p *Polygon) AnalyzeTx(tx *types.Transaction, client *ethclient.Client, arg
 			// 	erc20CoinBalance = decimal.NewFromFloat(6.64273)
 			// 	erc20CoinBalanceBigInt = big.NewInt(6642730)
 			// 	erc20Coin = NewERC20Token(common.HexToAddress(*address), client, erc20ABI)
-			// 	// erc20CoinBalance, erc20CoinBalanceBigInt, erc20Coin = RetrieveERC20Balance(*p, client, *GlobalSettings.Polygon.Wallets.Main.Address, *address, *decimals)
+			// 	// erc20CoinBalance, erc20CoinBalanceBigInt, erc20Coin = RetrieveERC20Balance(*p, client, *settings.Polygon.Wallets.Main.Address, *address, *decimals)
 
 			// 	if erc20Coin == nil {
-			// 		Logger(tx, method, &GlobalSettings, fmt.Sprintf("Failed to retrieve ERC20 balance for coin: %s", contract), true)
+			// 		Logger(tx, method, settings, fmt.Sprintf("Failed to retrieve ERC20 balance for coin: %s", contract), true)
 			// 		return
 			// 	}
 			// }()
@@ -940,7 +900,7 @@ func (p *Polygon) AnalyzeTx(tx *types.Transaction, client *ethclient.Client, arg
 
 			// 	// contractDecimals, err = GetTokenDecimals(client, common.HexToAddress(contract))
 			// 	// if err != nil || contractDecimals == nil {
-			// 	// 	Logger(tx, method, &GlobalSettings, fmt.Sprintf("Failed to retrieve decimals for contract: %s", contract), true)
+			// 	// 	Logger(tx, method, settings, fmt.Sprintf("Failed to retrieve decimals for contract: %s", contract), true)
 			// 	// 	return
 			// 	// }
 
@@ -948,16 +908,16 @@ func (p *Polygon) AnalyzeTx(tx *types.Transaction, client *ethclient.Client, arg
 			// 	contractDecimals = &_int18
 			// 	// contractDecimals, err = GetTokenDecimals(client, common.HexToAddress(contract))
 			// 	// if err != nil || contractDecimals == nil {
-			// 	// 	Logger(tx, method, &GlobalSettings, fmt.Sprintf("Failed to retrieve decimals for contract: %s", contract), true)
+			// 	// 	Logger(tx, method, settings, fmt.Sprintf("Failed to retrieve decimals for contract: %s", contract), true)
 			// 	// 	return
 			// 	// }
 			// 	erc20ContractTokenBalance = decimal.NewFromInt(0)
 			// 	erc20ContractTokenBalanceBigInt = big.NewInt(0)
 			// 	erc20ContractToken = NewERC20Token(common.HexToAddress(contract), client, erc20ABI)
 
-			// 	// erc20ContractTokenBalance, erc20ContractTokenBalanceBigInt, erc20ContractToken = RetrieveERC20Balance(*p, client, *GlobalSettings.Polygon.Wallets.Main.Address, contract, *contractDecimals)
+			// 	// erc20ContractTokenBalance, erc20ContractTokenBalanceBigInt, erc20ContractToken = RetrieveERC20Balance(*p, client, *settings.Polygon.Wallets.Main.Address, contract, *contractDecimals)
 			// 	if erc20ContractToken == nil {
-			// 		Logger(tx, method, &GlobalSettings, fmt.Sprintf("Failed to retrieve ERC20 balance for contract: %s", contract), true)
+			// 		Logger(tx, method, settings, fmt.Sprintf("Failed to retrieve ERC20 balance for contract: %s", contract), true)
 			// 		return
 			// 	}
 			// }()
@@ -995,12 +955,12 @@ func (p *Polygon) AnalyzeTx(tx *types.Transaction, client *ethclient.Client, arg
 			// log.Printf("Amount in %s: %v\nAmount in USD: %v", *coin, amountInDecimal, amountInUSD)
 
 			// Retrieving Matic Balance to check if we can cover gas fee
-			// maticBalance = RetrieveBalance(client, *GlobalSettings.Polygon.Wallets.Main.Address)
+			// maticBalance = RetrieveBalance(client, *settings.Polygon.Wallets.Main.Address)
 			// Calculating wallet balance for the erc20 token we aiming to swap
 
 			// block, err := client.BlockByNumber(context.Background(), nil)
 			// if err != nil {
-			// 	Logger(tx, method, &GlobalSettings, fmt.Sprintf("Failed to retrieve the latest block: %v", err), true)
+			// 	Logger(tx, method, settings, fmt.Sprintf("Failed to retrieve the latest block: %v", err), true)
 			// 	return
 			// }
 			// baseNetworkGasFee := block.BaseFee()
@@ -1021,15 +981,15 @@ func (p *Polygon) AnalyzeTx(tx *types.Transaction, client *ethclient.Client, arg
 			// logger
 
 			// global settings Gas Fee Max
-			fmt.Println("FAST GAS PRICE", utils.GasPriceData.Result.Result.FastGasPrice)
-			networkFastGasPrice, err := decimal.NewFromString(utils.GasPriceData.Result.Result.FastGasPrice)
+			gas, err := CurrentGas()
 			if err != nil {
-				Logger(tx, method, &GlobalSettings, fmt.Sprintf("Failed to convert fast gas price to decimal: %v", err), true)
+				Logger(tx, method, settings, fmt.Sprintf("No usable gas estimate: %v", err), true)
 				return
 			}
+			networkFastGasPrice := gas.FastGasPrice()
 
 			// logger
-			log.Printf("Gas fee max GWEI: %v Fast gas price GWEI decimal: %v", GlobalSettings.Polygon.Settings.GasFeeMax, networkFastGasPrice)
+			log.Printf("Gas fee max GWEI: %v Fast gas price GWEI decimal: %v", settings.Polygon.Settings.GasFeeMax, networkFastGasPrice)
 			// logger
 
 			// tx GasPrice GWEI compared to network networkFastGasPrice %
@@ -1044,12 +1004,12 @@ func (p *Polygon) AnalyzeTx(tx *types.Transaction, client *ethclient.Client, arg
 			// logger
 
 			// compare txNetworkGasPriceDifferencePercentge to the TargetGasMrkupAllowed for targeted tx, to not try to attack tx, that's running with huge GasPrice
-			if txNetworkGasPriceDifferencePercentage.GreaterThan(GlobalSettings.Polygon.Settings.TargetGasMarkupAllowed) {
-				Logger(tx, method, &GlobalSettings, fmt.Sprintf("Gas price difference percentage %v%% is greater than the target gas markup allowed %v%%", txNetworkGasPriceDifferencePercentage, GlobalSettings.Polygon.Settings.TargetGasMarkupAllowed), true)
+			if txNetworkGasPriceDifferencePercentage.GreaterThan(settings.Polygon.Settings.TargetGasMarkupAllowed) {
+				Logger(tx, method, settings, fmt.Sprintf("Gas price difference percentage %v%% is greater than the target gas markup allowed %v%%", txNetworkGasPriceDifferencePercentage, settings.Polygon.Settings.TargetGasMarkupAllowed), true)
 				return
 			} else {
 				// logger
-				log.Printf("Gas price difference percentage %v%% is less than or equal to the target gas markup allowed %v%%", txNetworkGasPriceDifferencePercentage, GlobalSettings.Polygon.Settings.TargetGasMarkupAllowed)
+				log.Printf("Gas price difference percentage %v%% is less than or equal to the target gas markup allowed %v%%", txNetworkGasPriceDifferencePercentage, settings.Polygon.Settings.TargetGasMarkupAllowed)
 				// logger
 			}
 
@@ -1074,39 +1034,39 @@ func (p *Polygon) AnalyzeTx(tx *types.Transaction, client *ethclient.Client, arg
 			}
 
 			if amountInDecimal.IsZero() && amountOutDecimal.IsZero() {
-				Logger(tx, method, &GlobalSettings, fmt.Sprintf("Malformed tx"), true)
+				Logger(tx, method, settings, fmt.Sprintf("Malformed tx"), true)
 				return
 			}
 			if amountOutDecimal.IsZero() {
-				Logger(tx, method, &GlobalSettings, fmt.Sprintf("Error: cannot build local txs due to some parameters missing from the TTX"), true)
+				Logger(tx, method, settings, fmt.Sprintf("Error: cannot build local txs due to some parameters missing from the TTX"), true)
 				return
 			}
 
-			// slippage := decimal.NewFromFloat(GlobalSettings.Polygon.Settings.Slippage)
+			// slippage := decimal.NewFromFloat(settings.Polygon.Settings.Slippage)
 			var newTxAmountInDecimal, newTxAmountOutDecimal decimal.Decimal
 			var newTxAmountInBigInt, newTxAmountOutBigInt *big.Int
 
 			if !amountInDecimal.IsZero() {
-				newTxAmountInDecimal = amountInDecimal.Mul(GlobalSettings.Polygon.Settings.UsdPerTrade).Div(decimal.NewFromInt(100))
+				newTxAmountInDecimal = amountInDecimal.Mul(settings.Polygon.Settings.UsdPerTrade).Div(decimal.NewFromInt(100))
 				newTxAmountInBigInt = newTxAmountInDecimal.Mul(decimal.NewFromInt(10).Pow(decimal.NewFromInt(int64(*coinDecimals)))).BigInt()
 			} else {
 				newTxAmountInDecimal = decimal.NewFromInt(0)
 				newTxAmountInBigInt = big.NewInt(0)
 			}
 
-			amountOutTolerance := GlobalSettings.Polygon.Settings.UsdPerTrade.Mul(decimal.NewFromFloat(0.10))
-			newTxAmountOutDecimal = amountOutDecimal.Mul(GlobalSettings.Polygon.Settings.UsdPerTrade.Sub(amountOutTolerance)).Div(decimal.NewFromInt(100))
+			amountOutTolerance := settings.Polygon.Settings.UsdPerTrade.Mul(decimal.NewFromFloat(0.10))
+			newTxAmountOutDecimal = amountOutDecimal.Mul(settings.Polygon.Settings.UsdPerTrade.Sub(amountOutTolerance)).Div(decimal.NewFromInt(100))
 			log.Println("AMOUNT OUT DECIMAL", amountOutDecimal, newTxAmountOutDecimal)
 			newTxAmountOutBigInt = newTxAmountOutDecimal.Mul(decimal.NewFromInt(10).Pow(decimal.NewFromInt(int64(*whitelistedContract.Decimals)))).BigInt()
 
-			if amountInDecimal.GreaterThan(GlobalSettings.Polygon.Settings.TargetValueMax) || amountInDecimal.LessThan(GlobalSettings.Polygon.Settings.TargetValueMin) {
-				Logger(tx, method, &GlobalSettings, fmt.Sprintf("tx amountIn %v is gt target tx value MAX %v or lt target tx value MIN %v", amountInDecimal, GlobalSettings.Polygon.Settings.TargetValueMax, GlobalSettings.Polygon.Settings.TargetValueMin), true)
+			if amountInDecimal.GreaterThan(settings.Polygon.Settings.TargetValueMax) || amountInDecimal.LessThan(settings.Polygon.Settings.TargetValueMin) {
+				Logger(tx, method, settings, fmt.Sprintf("tx amountIn %v is gt target tx value MAX %v or lt target tx value MIN %v", amountInDecimal, settings.Polygon.Settings.TargetValueMax, settings.Polygon.Settings.TargetValueMin), true)
 				return
 			}
 
 			// Building values for the upcoming swapExactTokensToTokens
 			// Gas fee of target transaction + % of gas tolerance <= gasfee
-			globalSettingsGasTolerance := decimal.NewFromFloat(GlobalSettings.Polygon.Settings.GasTolerance)
+			globalSettingsGasTolerance := decimal.NewFromFloat(settings.Polygon.Settings.GasTolerance)
 			log.Println("GLOBAL SETTIGNS GAS TOLERANCE", globalSettingsGasTolerance)
 			toleranceAmount := txGasPriceGweiDecimal.Mul(globalSettingsGasTolerance).Div(decimal.NewFromInt(100))
 			log.Println("TOLERANCE AMOUNT", toleranceAmount)
@@ -1117,24 +1077,26 @@ func (p *Polygon) AnalyzeTx(tx *types.Transaction, client *ethclient.Client, arg
 			log.Printf("Calculated newTxGasFee to attack is %v\n. TTX Gas Price: %v. Tolerance: %v", newTxGasFee, txGasPriceGweiDecimal, globalSettingsGasTolerance)
 			// logger
 
-			if newTxGasFee.GreaterThan(GlobalSettings.Polygon.Settings.GasFeeMax) {
+			if newTxGasFee.GreaterThan(settings.Polygon.Settings.GasFeeMax) {
 				// logger
-				log.Printf("NewTxGasFee %v to attack is greater than globalSettings.GasFeeMax %v\n", newTxGasFee, GlobalSettings.Polygon.Settings.GasFeeMax)
+				log.Printf("NewTxGasFee %v to attack is greater than globalSettings.GasFeeMax %v\n", newTxGasFee, settings.Polygon.Settings.GasFeeMax)
 				// logger
-				newTxGasFee = GlobalSettings.Polygon.Settings.GasFeeMax
+				newTxGasFee = settings.Polygon.Settings.GasFeeMax
 			}
 
 			var walletToAttackWith *common.Address
-			var privateKey *ecdsa.PrivateKey
+			var attackWallet models.Wallet
 
-			for _, _wttx := range GlobalSettings.Polygon.Wallets.Main {
-				if _, exists := GlobalSettings.Polygon.WalletTTX[*_wttx.Address]; !exists {
+			if KillSwitchOn() {
+				Logger(tx, method, settings, fmt.Sprintf("KillSwitch is on, skipping tx. TxHash: %s", tx.Hash().Hex()), true)
+				return
+			}
 
-					privateKey, err = utils.HexToECDSAV2(*_wttx.PrivateKey)
-					if err != nil {
-						// Logger(tx, method, &GlobalSettings, fmt.Sprintf("failed to pack PK to ecdsa. %s", err), true)
-						return
-					}
+			// the wallet is locked for this target right away, it is released again unless the attack starts
+			for _, _wttx := range settings.Polygon.Wallets.Main {
+				if !IsWalletRotating(*_wttx.Address) && WalletTTX.StoreIfAbsent(strings.ToLower(*_wttx.Address), tx.Hash().Hex()) {
+
+					attackWallet = _wttx
 
 					_walletToAttackWith := common.HexToAddress(*_wttx.Address)
 					walletToAttackWith = &_walletToAttackWith
@@ -1144,38 +1106,36 @@ func (p *Polygon) AnalyzeTx(tx *types.Transaction, client *ethclient.Client, arg
 			}
 
 			if walletToAttackWith == nil {
-				Logger(tx, method, &GlobalSettings, fmt.Sprintf("Lock on the wallet engaged, skipping tx. TxHash: %s", tx.Hash().Hex()), true)
+				Logger(tx, method, settings, fmt.Sprintf("Lock on the wallet engaged, skipping tx. TxHash: %s", tx.Hash().Hex()), true)
 				return
 			}
+			attacking := false
+			defer func() {
+				if !attacking {
+					WalletTTX.Delete(strings.ToLower(walletToAttackWith.Hex()))
+				}
+			}()
 
 			// Allowance check
 			log.Println("WALLET TO ATTACK WITH", walletToAttackWith.Hex(), walletToAttackWith.String(), strings.ToLower(walletToAttackWith.Hex()))
-			walletAllowances, ok := GlobalSettings.Polygon.WalletAllowance[strings.ToLower(walletToAttackWith.Hex())]
-			if !ok {
-				Logger(tx, method, &GlobalSettings, fmt.Sprintf("No wallet allowances found for wallet: %s", walletToAttackWith.Hex()), true)
-				if !IsPreApprovementInProgress() {
-					PreApprovement(*p)
-				}
-				return
-			}
+			coinDexAllowance, ok := WalletAllowance.Load(allowanceKey{strings.ToLower(walletToAttackWith.Hex()), *coinAddress, strings.ToLower(dexRouter.Hex())})
 
-			fmt.Println("ALLOWANCE INSIDE", walletAllowances[*coinAddress][strings.ToLower(dexRouter.Hex())])
+			fmt.Println("ALLOWANCE INSIDE", coinDexAllowance)
 			fmt.Println("CONTRACT INSIDE", coinAddress)
 			fmt.Println("DEX INSIDE", dexRouter.Hex())
 
-			coinDexAllowance, ok := walletAllowances[*coinAddress][strings.ToLower(dexRouter.Hex())]
 			if !ok {
-				Logger(tx, method, &GlobalSettings, fmt.Sprintf("No token allowance found for coin: %s and dex: %s", *coinAddress, *dex), true)
+				Logger(tx, method, settings, fmt.Sprintf("No token allowance found for coin: %s and dex: %s", *coinAddress, *dex), true)
 				if !IsPreApprovementInProgress() {
-					PreApprovement(*p)
+					RequestPreApprovement()
 				}
 				return
 			}
 
 			if coinDexAllowance.BigInt.Cmp(newTxAmountInBigInt) < 0 {
-				Logger(tx, method, &GlobalSettings, fmt.Sprintf("Not enough allowance to execute an attack. Allowance: %v. AmountOut: %v. TxHash: %s", coinDexAllowance, newTxAmountOutBigInt, tx.Hash().Hex()), true)
+				Logger(tx, method, settings, fmt.Sprintf("Not enough allowance to execute an attack. Allowance: %v. AmountOut: %v. TxHash: %s", coinDexAllowance, newTxAmountOutBigInt, tx.Hash().Hex()), true)
 				if !IsPreApprovementInProgress() {
-					PreApprovement(*p)
+					RequestPreApprovement()
 				}
 				return
 			}
@@ -1186,12 +1146,12 @@ func (p *Polygon) AnalyzeTx(tx *types.Transaction, client *ethclient.Client, arg
 			erc20Coin := TokenBalance(*p, client, strings.ToLower(walletToAttackWith.Hex()), *coinAddress, *coinDecimals)
 			erc20Contract := TokenBalance(*p, client, strings.ToLower(walletToAttackWith.Hex()), *whitelistedContract.Address, *whitelistedContract.Decimals)
 
-			// erc20Balance, _ := RetrieveERC20Balance(p, client, *GlobalSettings.Polygon.Wallets.Main.Address, *address, *decimals)
+			// erc20Balance, _ := RetrieveERC20Balance(p, client, *settings.Polygon.Wallets.Main.Address, *address, *decimals)
 			log.Println("MATIC BALANCE:", maticBalance.Decimal, "MATIC BALANCE GWEI:", maticBalance.BigInt, "ERC20 COIN BALANCE", erc20Coin.Decimal, "TARGET TOKEN BALACE", erc20Contract.Decimal)
 
-			// log.Printf("Checking MATIC balance before exec. MATIC Balance: %v, NewTxGasFee: %v, GasPriority: %v, GasLimit: %v\n", maticBalance.BigInt, newTxGasFee, GlobalSettings.Polygon.Settings.GasPriority, GlobalSettings.Polygon.Settings.GasLimit)
-			// if maticBalance.Decimal.LessThan(newTxGasFee.Add(GlobalSettings.Polygon.Settings.GasPriority).Add(decimal.NewFromInt(int64(GlobalSettings.Polygon.Settings.GasLimit)))) {
-			// 	Logger(tx, method, &GlobalSettings, fmt.Sprintf("Not enough MATIC in the wallet to cover newTx gas fee. Current MATIC balance: %v.NewTxGasFee: %v. Gas Priority: %v. Gas Limit: %v", maticBalance.Decimal, newTxGasFee, GlobalSettings.Polygon.Settings.GasPriority, GlobalSettings.Polygon.Settings.GasLimit), true)
+			// log.Printf("Checking MATIC balance before exec. MATIC Balance: %v, NewTxGasFee: %v, GasPriority: %v, GasLimit: %v\n", maticBalance.BigInt, newTxGasFee, settings.Polygon.Settings.GasPriority, settings.Polygon.Settings.GasLimit)
+			// if maticBalance.Decimal.LessThan(newTxGasFee.Add(settings.Polygon.Settings.GasPriority).Add(decimal.NewFromInt(int64(settings.Polygon.Settings.GasLimit)))) {
+			// 	Logger(tx, method, settings, fmt.Sprintf("Not enough MATIC in the wallet to cover newTx gas fee. Current MATIC balance: %v.NewTxGasFee: %v. Gas Priority: %v. Gas Limit: %v", maticBalance.Decimal, newTxGasFee, settings.Polygon.Settings.GasPriority, settings.Polygon.Settings.GasLimit), true)
 			// 	return
 			// }
 
@@ -1199,7 +1159,7 @@ func (p *Polygon) AnalyzeTx(tx *types.Transaction, client *ethclient.Client, arg
 			if !amountInDecimal.IsZero() {
 				log.Printf("Checking if erc20Balance %v is less than required newTxAmountInDecimal %v\n", erc20Coin.BigInt, newTxAmountInDecimal)
 				if erc20Coin.Decimal.LessThan(newTxAmountInDecimal) {
-					Logger(tx, method, &GlobalSettings, fmt.Sprintf("Insufficient ERC20 balance for the transaction. Balance: %v, Required: %v", erc20Coin.Decimal, newTxAmountInDecimal), true)
+					Logger(tx, method, settings, fmt.Sprintf("Insufficient ERC20 balance for the transaction. Balance: %v, Required: %v", erc20Coin.Decimal, newTxAmountInDecimal), true)
 					return
 				}
 			}
@@ -1210,30 +1170,24 @@ func (p *Polygon) AnalyzeTx(tx *types.Transaction, client *ethclient.Client, arg
 
 			log.Println("===========================================================")
 			// if strings.Contains(*dex, "v3") {
-			// 	Logger(tx, method, &GlobalSettings, "Temp return", true)
+			// 	Logger(tx, method, settings, "Temp return", true)
 			// 	return
 			// }
 			// return
 
+			attacking = true
 			go func() {
 				_txHash := tx.Hash().Hex()
 
-				if GlobalSettings.Polygon.WalletTTX == nil {
-					GlobalSettings.Polygon.WalletTTX = make(map[string]string)
-				}
-
-				GlobalSettings.Polygon.WalletTTX[strings.ToLower(walletToAttackWith.Hex())] = _txHash
-
-				nonces, ok := GlobalSettings.Polygon.WalletNonce[strings.ToLower(walletToAttackWith.Hex())]
-				if !ok {
-					WalletNonceSync(*p, nil, walletToAttackWith.Hex())
+				// frontrun and backrun nonces are reserved together so parallel attacks never share one
+				nonces, err := ReserveNonces(walletToAttackWith.Hex(), 2, "sandwich")
+				if err != nil {
+					WalletTTX.Delete(strings.ToLower(walletToAttackWith.Hex()))
+					Logger(tx, method, settings, fmt.Sprintf("Failed to reserve nonces: %v", err), true)
 					return
 				}
+				_nonce := &nonces[0]
 
-				_nonce := nonces.Nonce
-				_pendingNonce := nonces.PendingNonce
-
-				log.Printf("Pending nonce: %v", *_pendingNonce)
 				log.Printf("Nonce: %v", *_nonce)
 				log.Printf("Forced Nonce: %v", *_nonce+1)
 
@@ -1244,14 +1198,14 @@ func (p *Polygon) AnalyzeTx(tx *types.Transaction, client *ethclient.Client, arg
 						newTxMethodName = "exactOutputSingle"
 					}
 
-					p.Swap(&_nonce, newTxMethodName, *walletToAttackWith, dexRouter, erc20Contract.ERC20Token.address, client, erc20Coin.ERC20Token, parsedABI, newTxAmountInBigInt, newTxAmountOutBigInt, newTxGasFee, GlobalSettings.Polygon.Settings.GasPriority, GlobalSettings.Polygon.Settings.GasFeeMax, GlobalSettings.Polygon.Settings.GasLimit, privateKey, CHAIN_ID, &_txHash, false, false)
+					p.Swap(&_nonce, newTxMethodName, *walletToAttackWith, dexRouter, erc20Contract.ERC20Token.address, client, erc20Coin.ERC20Token, parsedABI, newTxAmountInBigInt, newTxAmountOutBigInt, newTxGasFee, settings.Polygon.Settings.GasPriority, settings.Polygon.Settings.GasFeeMax, settings.Polygon.Settings.GasLimit, attackWallet, CHAIN_ID, &_txHash, false, false)
 				}(*_nonce)
 				*_nonce++
 
 				go func(_nonce uint64) {
 					fmt.Println("NONCE BACKRUN", _nonce)
 					// fmt.Println("FAST GAS PRICE", utils.GasPriceData.Result.Result.FastGasPrice)
-					// brTxExitGas, err := decimal.NewFromString(GlobalSettings.Polygon.Settings.ExitGas.String())
+					// brTxExitGas, err := decimal.NewFromString(settings.Polygon.Settings.ExitGas.String())
 					if err != nil {
 						log.Fatalf("Failed to parse fast gas price: %v", err)
 						return
@@ -1259,11 +1213,11 @@ func (p *Polygon) AnalyzeTx(tx *types.Transaction, client *ethclient.Client, arg
 
 					// brTxExitGas = brTxExitGas.Mul(decimal.NewFromFloat(1.6))
 					// brTxExitGas := txGasPriceGweiDecimal.Mul(decimal.NewFromFloat(1))
-					exitGasPercentage := GlobalSettings.Polygon.Settings.ExitGas.Div(decimal.NewFromInt(100))
+					exitGasPercentage := settings.Polygon.Settings.ExitGas.Div(decimal.NewFromInt(100))
 					// brTxExitGas, _ := decimal.NewFromString(utils.GasPriceData.Result.Result.FastGasPrice)
 					// brTxExitGas = brTxExitGas.Mul(exitGasPercentage)
 					brTxExitGas := txGasPriceGweiDecimal.Mul(exitGasPercentage)
-					// brTxExitGas := txGasPriceGweiDecimal.Mul(GlobalSettings.Polygon.Settings.ExitGas.Div(decimal.NewFromInt(100)))
+					// brTxExitGas := txGasPriceGweiDecimal.Mul(settings.Polygon.Settings.ExitGas.Div(decimal.NewFromInt(100)))
 
 					fmt.Println(txGasPriceGweiDecimal)
 					// fmt.Println(tx.GasPrice())
@@ -1276,19 +1230,14 @@ func (p *Polygon) AnalyzeTx(tx *types.Transaction, client *ethclient.Client, arg
 						newTxMethodName = "exactInputSingle"
 					}
 
-					p.Swap(&_nonce, newTxMethodName, *walletToAttackWith, dexRouter, erc20Coin.ERC20Token.address, client, erc20Contract.ERC20Token, parsedABI, newTxAmountOutBigInt, ZERO_BIG_INT, decimal.NewFromInt(0), brTxExitGas, GlobalSettings.Polygon.Settings.GasFeeMax, GlobalSettings.Polygon.Settings.GasLimit, privateKey, CHAIN_ID, &_txHash, false, false)
-					nextNonce := _nonce + 1
-					GlobalSettings.Polygon.WalletNonce[strings.ToLower(walletToAttackWith.Hex())] = Nonce{
-						Nonce:        &nextNonce,
-						PendingNonce: &_nonce,
-					}
+					p.Swap(&_nonce, newTxMethodName, *walletToAttackWith, dexRouter, erc20Coin.ERC20Token.address, client, erc20Contract.ERC20Token, parsedABI, newTxAmountOutBigInt, ZERO_BIG_INT, decimal.NewFromInt(0), brTxExitGas, settings.Polygon.Settings.GasFeeMax, settings.Polygon.Settings.GasLimit, attackWallet, CHAIN_ID, &_txHash, false, false)
 				}(*_nonce)
 
 				go func() {
-					Logger(tx, method, &GlobalSettings, fmt.Sprintf("Attacking tx. TxHash: %s", _txHash), false)
+					Logger(tx, method, settings, fmt.Sprintf("Attacking tx. TxHash: %s", _txHash), false)
 					txReceipt := TxReceipt(tx.Hash(), client)
 					if err != nil {
-						Logger(tx, method, &GlobalSettings, fmt.Sprintf("Failed to get transaction receipt for TxHash: %s, Error: %s", _txHash, err), true)
+						Logger(tx, method, settings, fmt.Sprintf("Failed to get transaction receipt for TxHash: %s, Error: %s", _txHash, err), true)
 						return
 					}
 
@@ -1307,7 +1256,7 @@ func (p *Polygon) AnalyzeTx(tx *types.Transaction, client *ethclient.Client, arg
 			}()
 		}
 	} else {
-		Logger(tx, method, &GlobalSettings, fmt.Sprintf("Unknown method.\nTxHash: %s\nFunction: %s\nInputs: %v", tx.Hash().Hex(), method.Name, inputs), true)
+		Logger(tx, method, settings, fmt.Sprintf("Unknown method.\nTxHash: %s\nFunction: %s\nInputs: %v", tx.Hash().Hex(), method.Name, inputs), true)
 	}
 }
 
@@ -1316,23 +1265,19 @@ func GweiToWei(gwei decimal.Decimal) *big.Int {
 	return wei
 }
 
-func (p *Polygon) Authenticator(walletAddress string, privateKey *ecdsa.PrivateKey, chainID *big.Int) {
-	var err error
+func (p *Polygon) Authenticator(wallet models.Wallet, chainID *big.Int) error {
+	walletAddress := *wallet.Address
 
-	auth, err := bind.NewKeyedTransactorWithChainID(privateKey, chainID)
+	auth, err := WalletTransactor(wallet, chainID)
 	if err != nil {
-		log.Fatalf("Failed to create authorized transactor: %v", err)
+		return fmt.Errorf("creating the transactor of %s: %v", walletAddress, err)
 	}
 
 	// walletAddress1 := crypto.PubkeyToAddress(privateKey.PublicKey).Hex()
 	// fmt.Println("AUTHENTICATOR", auth.Nonce, auth.From, auth, "Wallet Address:", walletAddress1)
 
-	if p.Auth == nil {
-		p.Auth = make(map[string]*bind.TransactOpts)
-	}
-
-	fmt.Println("WALLET ADDRESS", walletAddress)
-	p.Auth[walletAddress] = auth
+	WalletAuth.Store(walletAddress, auth)
+	return nil
 }
 
 func buildPath(addresses []string, feeTiers []int) []byte {
@@ -1355,7 +1300,7 @@ func buildPath(addresses []string, feeTiers []int) []byte {
 }
 
 // Flags []bool{legacy, dryRun}
-func (p Polygon) Swap(nonce *uint64, method string, ownerWallet, dexRouter, tokenContract common.Address, client *ethclient.Client, erc20Token *ERC20Token, dexAbi abi.ABI, amountIn, amountOut *big.Int, gasPrice, gasPriority, gasFeeMax decimal.Decimal, gasLimit uint64, privateKey *ecdsa.PrivateKey, chainID *big.Int, targetTxHash *string, flags ...bool) {
+func (p Polygon) Swap(nonce *uint64, method string, ownerWallet, dexRouter, tokenContract common.Address, client *ethclient.Client, erc20Token *ERC20Token, dexAbi abi.ABI, amountIn, amountOut *big.Int, gasPrice, gasPriority, gasFeeMax decimal.Decimal, gasLimit uint64, wallet models.Wallet, chainID *big.Int, targetTxHash *string, flags ...bool) {
 
 	// if i > 1 {
 	// 	return
@@ -1371,8 +1316,16 @@ func (p Polygon) Swap(nonce *uint64, method string, ownerWallet, dexRouter, toke
 		}
 	}
 
-	// Signer -> move to sepparate struct function
-	auth, err := bind.NewKeyedTransactorWithChainID(privateKey, chainID)
+	// the nonce is handed back unless the transaction left the process
+	sent := false
+	defer func() {
+		if !sent {
+			ReleaseNonce(ownerWallet.Hex(), *nonce)
+		}
+	}()
+
+	// key stays sealed until the transaction is signed
+	auth, err := WalletTransactor(wallet, chainID)
 	if err != nil {
 		log.Fatalf("Failed to create authorized transactor: %v", err)
 	}
@@ -1382,7 +1335,7 @@ func (p Polygon) Swap(nonce *uint64, method string, ownerWallet, dexRouter, toke
 	// path := []common.Address{erc20Token.address, tokenContract}
 	path := []common.Address{erc20Token.address, tokenContract} //common.HexToAddress("0x3c499c542cEF5E3811e1192ce70d8cC03d5c3359"), erc20Token.address}
 
-	deadline := big.NewInt(time.Now().Add(time.Minute * time.Duration(GlobalSettings.Polygon.Settings.Deadline)).Unix()) // Transaction must be mined within 10 minutes
+	deadline := big.NewInt(time.Now().Add(time.Minute * time.Duration(GlobalSettings().Polygon.Settings.Deadline)).Unix()) // Transaction must be mined within 10 minutes
 
 	// Nonce
 	// Get the account's nonce for the next transaction
@@ -1422,7 +1375,7 @@ func (p Polygon) Swap(nonce *uint64, method string, ownerWallet, dexRouter, toke
 
 	if strings.Contains(method, "exact") {
 		// path := []common.Address{erc20Token.address, tokenContract}
-		dex, _, contains := utils.MapContains(GlobalSettings.Polygon.DEXs, strings.ToLower(dexRouter.Hex()))
+		dex, _, contains := utils.MapContains(GlobalSettings().Polygon.DEXs, strings.ToLower(dexRouter.Hex()))
 		if !contains {
 			log.Printf("Tx routing swap through unknown dex %s", dexRouter)
 			return
@@ -1522,8 +1475,8 @@ func (p Polygon) Swap(nonce *uint64, method string, ownerWallet, dexRouter, toke
 	//
 
 	// Legacy on/off
+	// signers pick EIP-155 or London signing from the transaction type
 	var tx *types.Transaction
-	var signer types.Signer
 	if legacy {
 		tx = types.NewTransaction(
 			*nonce,
@@ -1533,7 +1486,6 @@ func (p Polygon) Swap(nonce *uint64, method string, ownerWallet, dexRouter, toke
 			auth.GasPrice,
 			data,
 		)
-		signer = types.NewEIP155Signer(chainID)
 	} else {
 		tx = types.NewTx(&types.DynamicFeeTx{
 			ChainID:   CHAIN_ID,
@@ -1545,11 +1497,10 @@ func (p Polygon) Swap(nonce *uint64, method string, ownerWallet, dexRouter, toke
 			Value:     ZERO_BIG_INT,
 			Data:      data,
 		})
-		signer = types.LatestSignerForChainID(chainID)
 	}
 
 	var signedTx *types.Transaction
-	if signedTx, err = types.SignTx(tx, signer, privateKey); err != nil {
+	if signedTx, err = SignWalletTx(wallet, tx, chainID); err != nil {
 		log.Printf("Failed to sign transaction: %v", err)
 		return
 	}
@@ -1575,7 +1526,10 @@ func (p Polygon) Swap(nonce *uint64, method string, ownerWallet, dexRouter, toke
 		return
 	}
 
+	sent = true
+	sentAt := time.Now()
 	signedTxHash := signedTx.Hash().Hex()
+	MarkNonceSent(ownerWallet.Hex(), *nonce, signedTxHash)
 	log.Printf("Transaction hash: %v", signedTx.Hash().Hex())
 
 	go func(method string) {
@@ -1604,13 +1558,17 @@ func (p Polygon) Swap(nonce *uint64, method string, ownerWallet, dexRouter, toke
 		txDataJSON, err := json.Marshal(signedTx.Data())
 		if err != nil {
 
-			delete(GlobalSettings.Polygon.WalletTTX, strings.ToLower(ownerWallet.Hex()))
+			WalletTTX.Delete(strings.ToLower(ownerWallet.Hex()))
 			log.Printf("Error marshalling transaction data to JSON: %v", err)
 			return
 		}
 
 		contract := path[1].Hex()
+		from := strings.ToLower(auth.From.Hex())
+		txNonce := signedTx.Nonce()
+		purpose := "swap"
 
+		// the receipt tracker settles it from here
 		_tx := models.Transaction{
 			Status: models.Status{
 				Status: _status,
@@ -1620,6 +1578,10 @@ func (p Polygon) Swap(nonce *uint64, method string, ownerWallet, dexRouter, toke
 			Contract: &contract,
 			OrderID:  &orderID,
 			RawData:  datatypes.JSON(txDataJSON),
+			Purpose:  &purpose,
+			From:     &from,
+			Nonce:    &txNonce,
+			SentAt:   &sentAt,
 		}
 
 		if err := controllers.DB.Debug().Create(&_tx).Error; err != nil {
@@ -1629,30 +1591,18 @@ func (p Polygon) Swap(nonce *uint64, method string, ownerWallet, dexRouter, toke
 
 		receipt := TxReceipt(signedTx.Hash(), client)
 		if receipt != nil {
-			receiptJSON, err := json.Marshal(receipt)
-
-			if err != nil {
-				log.Printf("Error marshalling receipt to JSON: %v", err)
-				return
-			}
-
-			if err := controllers.DB.Debug().Model(&_tx).Update("receipt", datatypes.JSON(receiptJSON)).Error; err != nil {
-				log.Printf("Error updating transaction receipt in db. Hash: %s. err: %v", *targetTxHash, err)
-				return
-			}
-
-			allowanceMutex.Lock()
-			var allowance = GlobalSettings.Polygon.WalletAllowance[strings.ToLower(ownerWallet.Hex())][strings.ToLower(erc20Token.address.Hex())][strings.ToLower(dexRouter.Hex())]
-			allowance = Allowance{
-				BigInt:  new(big.Int).Sub(allowance.BigInt, amountIn),
-				Decimal: allowance.Decimal.Sub(decimal.NewFromBigInt(amountIn, -*erc20Token.decimals)),
-			}
-			GlobalSettings.Polygon.WalletAllowance[strings.ToLower(ownerWallet.Hex())][strings.ToLower(erc20Token.address.Hex())][strings.ToLower(dexRouter.Hex())] = allowance
-			allowanceMutex.Unlock()
+			WalletAllowance.Update(allowanceKey{strings.ToLower(ownerWallet.Hex()), strings.ToLower(erc20Token.address.Hex()), strings.ToLower(dexRouter.Hex())}, func(allowance Allowance, ok bool) (Allowance, bool) {
+				if !ok {
+					return allowance, false
+				}
+				return Allowance{
+					BigInt:  new(big.Int).Sub(allowance.BigInt, amountIn),
+					Decimal: allowance.Decimal.Sub(decimal.NewFromBigInt(amountIn, -*erc20Token.decimals)),
+				}, true
+			})
 		}
 
-		// WalletNonceSync(p, nil, ownerWallet.Hex())
-		delete(GlobalSettings.Polygon.WalletTTX, strings.ToLower(ownerWallet.Hex()))
+		WalletTTX.Delete(strings.ToLower(ownerWallet.Hex()))
 
 	}(method)
 }
@@ -1709,28 +1659,35 @@ func Queue(pool bool, args ...interface{}) (interface{}, error) {
 // 	return nil, fmt.Errorf("no arguments provided")
 // }
 
-func (p Polygon) ClientPool(nodes interface{}) (clients []*ethclient.Client) {
+func (p Polygon) ClientPool(nodes interface{}) ([]*ethclient.Client, error) {
 	// fmt.Println(p.NodePool)
 	nodePool, ok := p.NodePool.([]string)
 	if !ok {
-		log.Fatalf("Failed to assert NodePool as []string")
+		return nil, errors.New("Failed to assert NodePool as []string")
 	}
 
+	var clients []*ethclient.Client
 	for _, _node := range nodePool {
-		clients = append(clients, p.GetClient(_node))
+		client, err := p.GetClient(_node)
+		if err != nil {
+			return nil, err
+		}
+		clients = append(clients, client)
 	}
 
-	return clients
+	return clients, nil
 }
 
 var uniqueTxHashes = make(map[string]struct{})
 var duplicateTxHashes = make(map[string]struct{})
 var mutex = &sync.Mutex{}
 var mutex2 = &sync.Mutex{}
-var globalLock = &sync.Mutex{}
-var preApprovementInProgress = false
+var preApprovementInProgress atomic.Bool
+var preApprovementRequests = make(chan struct{}, 1)
 
-func PreApprovement(p Polygon) {
+// PreApprovement approves coins and contracts of all main wallets at once, a wallet that failed
+// does not stop the others
+func PreApprovement(p Polygon) error {
 	// globalLock.Lock()
 	// preApprovementInProgress = true
 	// globalLock.Unlock()
@@ -1741,57 +1698,134 @@ func PreApprovement(p Polygon) {
 	// 	globalLock.Unlock()
 	// }()
 
+	// approvals are queued again when trading restarts
+	if KillSwitchOn() {
+		log.Print("KillSwitch is on, skipping pre-approvement")
+		return nil
+	}
+
+	wallets := GlobalSettings().Polygon.Wallets.Main
+	errs := make([]error, len(wallets))
 	var wg sync.WaitGroup
-	for _, _wallet := range GlobalSettings.Polygon.Wallets.Main {
+	for _i, _wallet := range wallets {
 		wg.Add(1)
 		// fmt.Println("WALLETS", _wallet)
-		go func(_wallet models.Wallet) {
+		go func(i int, _wallet models.Wallet) {
 			defer wg.Done()
-			if _wallet.Address != nil && _wallet.PrivateKey != nil {
-				privateKey, err := utils.HexToECDSAV2(*_wallet.PrivateKey)
-				if err != nil {
-					log.Printf("failed to pack PK to ecdsa. %s", err)
-					return
-				}
-				p.Authenticator(*_wallet.Address, privateKey, CHAIN_ID)
-				// // // preapprovement check
-				p.PreApproveERC20TokensForDexs(nil, *_wallet.Address)
-				amount := int64(500000000)
-				p.PreApproveERC20ContractsForDexs(nil, *_wallet.Address, &amount)
-
-				WalletNonceSync(p, nil, *_wallet.Address)
+			if _wallet.Address != nil {
+				errs[i] = preApproveWallet(p, _wallet)
 			}
-		}(_wallet)
+		}(_i, _wallet)
 	}
 	wg.Wait()
+	return errors.Join(errs...)
+}
+
+func preApproveWallet(p Polygon, wallet models.Wallet) error {
+	if err := p.Authenticator(wallet, CHAIN_ID); err != nil {
+		return err
+	}
+	// // // preapprovement check
+	if err := p.PreApproveERC20TokensForDexs(nil, *wallet.Address); err != nil {
+		return err
+	}
+	amount := int64(500000000)
+	return p.PreApproveERC20ContractsForDexs(nil, *wallet.Address, &amount)
 }
 
 func IsPreApprovementInProgress() bool {
-	globalLock.Lock()
-	defer globalLock.Unlock()
-	return preApprovementInProgress
+	return preApprovementInProgress.Load()
 }
 
-func (p Polygon) ScanMempoolV2(callbacks ...interface{}) {
-	if GlobalSettings.KillSwitch.IsOn != nil && *GlobalSettings.KillSwitch.IsOn {
-		log.Print("KillSwitch is on")
-		return
+// RequestPreApprovement queues a pre-approval run, targets are skipped until it finished.
+// Requests made while one is queued are merged into it
+func RequestPreApprovement() {
+	preApprovementInProgress.Store(true)
+	select {
+	case preApprovementRequests <- struct{}{}:
+	default:
+	}
+}
+
+// RunPreApprovement approves coins and contracts of the main wallets whenever it is requested
+func RunPreApprovement(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-preApprovementRequests:
+		}
+
+		p := Polygon{}
+		if err := p.GetNode(false); err != nil {
+			// the request is kept for the restarted service
+			RequestPreApprovement()
+			return err
+		}
+		if err := PreApprovement(p); err != nil {
+			// approvals are retried by the restarted service
+			RequestPreApprovement()
+			return fmt.Errorf("pre-approvement: %v", err)
+		}
+
+		if len(preApprovementRequests) == 0 {
+			preApprovementInProgress.Store(false)
+		}
 	}
+}
 
-	p.GetNode(true)
-	clientPool := p.ClientPool(p.NodePool)
+// ScanMempoolV2 runs the scanners until ctx is cancelled. The kill switch stops them,
+// turning it off again starts a fresh scan in the same process
+func (p Polygon) ScanMempoolV2(ctx context.Context, callbacks ...interface{}) error {
+	events := SubscribeKillSwitch()
+	defer UnsubscribeKillSwitch(events)
 
-	if len(GlobalSettings.Polygon.Wallets.Main) == 0 {
-		log.Printf("Error: Main wallets are not setup")
-		return
+	for {
+		if KillSwitchOn() {
+			log.Print("KillSwitch is on")
+			if err := WaitKillSwitch(ctx, events, false); err != nil {
+				return err
+			}
+		}
+
+		scanCtx, cancel := context.WithCancel(ctx)
+		go func() {
+			WaitKillSwitch(scanCtx, events, true)
+			cancel()
+		}()
+		err := p.scanNodes(scanCtx, callbacks...)
+		cancel()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// scanNodes scans the mempool of every node of the pool and returns once all scanners stopped
+func (p Polygon) scanNodes(ctx context.Context, callbacks ...interface{}) error {
+	settings := GlobalSettings()
+
+	if err := p.GetNode(true); err != nil {
+		return err
+	}
+	clientPool, err := p.ClientPool(p.NodePool)
+	if err != nil {
+		return err
 	}
 
-	GlobalSettings.Polygon.WalletTTX = make(map[string]string)
-	GlobalSettings.Polygon.WalletBalance = make(map[string]map[string]Balance)
-	GlobalSettings.Polygon.WalletAllowance = make(map[string]map[string]map[string]Allowance)
+	if len(settings.Polygon.Wallets.Main) == 0 {
+		return errors.New("Main wallets are not setup")
+	}
+
+	WalletTTX.Reset()
+	WalletBalance.Reset()
+	WalletAllowance.Reset()
 
 	// var wg sync.WaitGroup
-	// for _, _wallet := range GlobalSettings.Polygon.Wallets.Main {
+	// for _, _wallet := range settings.Polygon.Wallets.Main {
 	// 	wg.Add(1)
 	// 	go func(_wallet models.Wallet) {
 	// 		defer wg.Done()
@@ -1815,30 +1849,28 @@ func (p Polygon) ScanMempoolV2(callbacks ...interface{}) {
 	// }
 	// wg.Wait()
 
-	PreApprovement(p)
+	RequestPreApprovement()
 
 	log.Printf("\nScanning mempool:\n --nodes:\n %v", p.NodePool)
 
 	initialTime := time.Now()
 	fmt.Printf("Initial time: %s\n", initialTime.Format(time.RFC3339))
 
+	nodePool := p.NodePool.([]string)
+	var wg sync.WaitGroup
 	for _i, _client := range clientPool {
-		nodePool, ok := p.NodePool.([]string)
-		if !ok {
-			log.Fatalf("Failed to assert NodePool as []string")
-		}
-		__node := nodePool[_i]
+		wg.Add(1)
 		go func(_node string, _c *ethclient.Client) {
-			p.ScanMempool(_node, _c, callbacks...)
-		}(__node, _client)
+			defer wg.Done()
+			p.scanMempool(ctx, _node, _c, callbacks...)
+		}(nodePool[_i], _client)
 	}
-
-	time.Sleep(time.Minute)
-	fmt.Printf("Unique transactions after 1 minute: %v\nDuplicate transactions after 1 minute: %v\n", len(uniqueTxHashes), len(duplicateTxHashes))
-	fmt.Printf("Ended at: %s\n", time.Now().Format(time.RFC3339))
+	wg.Wait()
+	return nil
 }
 
 func MockAttack(p Polygon, client *ethclient.Client) {
+	settings := GlobalSettings()
 	log.Println("httpsSTART")
 
 	var newTxAmountIn = big.NewInt(493100) // USDT
@@ -1846,17 +1878,13 @@ func MockAttack(p Polygon, client *ethclient.Client) {
 	// var newTxAmountOutMin = big.NewInt(100000000000000000) // DAI
 	// var newTxAmountOutMin = big.NewInt(409440656214998200) // DAI
 
-	privateKey, err := utils.HexToECDSAV2(*GlobalSettings.Polygon.Wallets.Main[0].PrivateKey) // Replace with the actual private key
-	if err != nil {
-		log.Fatalf("Failed to parse private key: %v", err)
-		return
-	}
+	mockWallet := settings.Polygon.Wallets.Main[0]
 
-	// _, _, erc20Token := RetrieveERC20Balance(p, client, *GlobalSettings.Polygon.Wallets.Main.Address, "0x8328e6fceC9477C28298c9f02d740Dd87a1683e5", 18)
-	_, _, erc20Token := RetrieveERC20Balance(p, client, *GlobalSettings.Polygon.Wallets.Main[0].Address, "0xc2132D05D31c914a87C6611C10748AEb04B58e8F", 6)
+	// _, _, erc20Token := RetrieveERC20Balance(p, client, *settings.Polygon.Wallets.Main.Address, "0x8328e6fceC9477C28298c9f02d740Dd87a1683e5", 18)
+	_, _, erc20Token := RetrieveERC20Balance(p, client, *settings.Polygon.Wallets.Main[0].Address, "0xc2132D05D31c914a87C6611C10748AEb04B58e8F", 6)
 	newTxGasFee := decimal.NewFromInt(100)
 
-	botWallet := common.HexToAddress(*GlobalSettings.Polygon.Wallets.Main[0].Address)
+	botWallet := common.HexToAddress(*settings.Polygon.Wallets.Main[0].Address)
 	router := common.HexToAddress("0xa5E0829CaCEd8fFDD4De3c43696c57F7D7A678ff")
 	tokenContract := common.HexToAddress("0xE06Bd4F5aAc8D0aA337D13eC88dB6defC6eAEefE")
 	router = common.HexToAddress("0xe592427a0aece92de3edee1f18e0157c05861564")
@@ -1921,13 +1949,13 @@ func MockAttack(p Polygon, client *ethclient.Client) {
 
 	var _pendingNonce, _nonce uint64
 
-	if _pendingNonce, err = client.PendingNonceAt(context.Background(), common.HexToAddress(*GlobalSettings.Polygon.Wallets.Main[0].Address)); err != nil {
+	if _pendingNonce, err = client.PendingNonceAt(context.Background(), common.HexToAddress(*settings.Polygon.Wallets.Main[0].Address)); err != nil {
 		log.Printf("Failed to get pending nonce: %v", err)
 		return
 	}
 
 	log.Println("CONTINUE")
-	if _nonce, err = client.NonceAt(context.Background(), common.HexToAddress(*GlobalSettings.Polygon.Wallets.Main[0].Address), nil); err != nil {
+	if _nonce, err = client.NonceAt(context.Background(), common.HexToAddress(*settings.Polygon.Wallets.Main[0].Address), nil); err != nil {
 		log.Printf("Failed to get nonce: %v", err)
 		return
 	}
@@ -1950,7 +1978,7 @@ func MockAttack(p Polygon, client *ethclient.Client) {
 		legacy = true
 		// dryRun = true
 		mockTxHash := "asfjghalsdkjalsdkfhaldjfhaslkdjlaskdfhlajklaskjdk"
-		p.Swap(&_nonce, "exactOutputSingle", botWallet, router, tokenContract, client, erc20Token, parsedABI, newTxAmountIn, newTxAmountOut, newTxGasFee, GlobalSettings.Polygon.Settings.GasPriority, GlobalSettings.Polygon.Settings.GasFeeMax, GlobalSettings.Polygon.Settings.GasLimit, privateKey, CHAIN_ID, &mockTxHash, legacy, dryRun)
+		p.Swap(&_nonce, "exactOutputSingle", botWallet, router, tokenContract, client, erc20Token, parsedABI, newTxAmountIn, newTxAmountOut, newTxGasFee, settings.Polygon.Settings.GasPriority, settings.Polygon.Settings.GasFeeMax, settings.Polygon.Settings.GasLimit, mockWallet, CHAIN_ID, &mockTxHash, legacy, dryRun)
 	}(_nonce)
 	_nonce++
 
@@ -1960,68 +1988,83 @@ func MockAttack(p Polygon, client *ethclient.Client) {
 		dryRun := false
 		// legacy = true
 		// dryRun = true
-		networkFastGasPrice, err := decimal.NewFromString(utils.GasPriceData.Result.Result.FastGasPrice)
-		networkFastGasPrice = networkFastGasPrice.Mul(decimal.NewFromFloat(1.5))
+		gas, err := CurrentGas()
 		if err != nil {
-			log.Printf("Failed to convert fast gas price to decimal: %v", err)
+			log.Printf("No usable gas estimate: %v", err)
 			return
 		}
+		networkFastGasPrice := gas.FastGasPrice().Mul(decimal.NewFromFloat(1.5))
 
 		mockTxHash := "asfjghalsdkjalsdkfhaldjfhaslkdjlaskdfhlajklaskjdk"
-		p.Swap(&__nonce, "exactInputSingle", botWallet, router, erc20Token.address, client, erc20TokenToSell, parsedABI, newTxAmountOut, ZERO_BIG_INT, newTxGasFee, networkFastGasPrice, GlobalSettings.Polygon.Settings.GasFeeMax, GlobalSettings.Polygon.Settings.GasLimit, privateKey, CHAIN_ID, &mockTxHash, legacy, dryRun)
+		p.Swap(&__nonce, "exactInputSingle", botWallet, router, erc20Token.address, client, erc20TokenToSell, parsedABI, newTxAmountOut, ZERO_BIG_INT, newTxGasFee, networkFastGasPrice, settings.Polygon.Settings.GasFeeMax, settings.Polygon.Settings.GasLimit, mockWallet, CHAIN_ID, &mockTxHash, legacy, dryRun)
 	}()
 }
 
 func (p Polygon) ScanMempool(node string, client *ethclient.Client, callbacks ...interface{}) {
-	if client == nil {
-		p.GetNode(false)
-
-		client = p.GetClient(p.Node)
+	p.scanMempool(context.Background(), node, client, callbacks...)
+}
 
-		defer client.Close()
+// scanMempool subscribes to pending transactions of one node until ctx is cancelled
+func (p Polygon) scanMempool(ctx context.Context, node string, client *ethclient.Client, callbacks ...interface{}) {
+	if client == nil {
+		var err error
+		if client, err = p.GetClient(nil); err != nil {
+			log.Printf("Error: failed to scan mempool: %v", err)
+			return
+		}
+		node, _ = p.Node.(string)
 	}
 
 	// _client := gethclient.New(client.Client())
 	WalletKnownBalances(p, client)
-	for balanceSimpleLock {
+	for balanceSimpleLock.Load() {
 		time.Sleep(100 * time.Millisecond)
 	}
 
 	txs := make(chan common.Hash)
-	var sub ethereum.Subscription
-	var err error
-
-	for {
-		sub, err = client.Client().EthSubscribe(context.Background(), txs, "newPendingTransactions")
-		if err != nil {
+	// subscribe retries until it succeeds, it returns nil once ctx is cancelled
+	subscribe := func() ethereum.Subscription {
+		for {
+			sub, err := client.Client().EthSubscribe(ctx, txs, "newPendingTransactions")
+			if err == nil {
+				log.Println("Successfully subscribed to new pending transactions")
+				return sub
+			}
 			log.Printf("Error: subscription to new pending transactions failed: %v. Retrying...", err)
-			time.Sleep(2 * time.Second)
-			continue
+			if utils.SleepContext(ctx, 2*time.Second) != nil {
+				return nil
+			}
 		}
-		log.Println("Successfully subscribed to new pending transactions")
-		break
 	}
 
+	sub := subscribe()
+	if sub == nil {
+		return
+	}
+	defer func() {
+		if sub != nil {
+			sub.Unsubscribe()
+		}
+		log.Printf("Stopped scanning mempool of %s", node)
+	}()
+
 	for {
 		select {
+		case <-ctx.Done():
+			return
 		case err := <-sub.Err():
 			log.Printf("Error: failed to connect to rpc node: %v. Trying to reconnect...", err)
 			sub.Unsubscribe()
-			time.Sleep(2 * time.Second)
-			sub, err = client.Client().EthSubscribe(context.Background(), txs, "newPendingTransactions")
-			if err != nil {
-				log.Printf("Error: subscription to new pending transactions failed: %v. Retrying...", err)
+			if sub = subscribe(); sub == nil {
+				return
 			}
-			log.Fatalf("Error: failed to connect to rpc node: %v. Trying to reconnect...", err)
 		case txHash := <-txs:
 			// log.Printf("Received new pending transaction hash: %s", txHash.Hex())
-			if GlobalSettings.KillSwitch.IsOn != nil && *GlobalSettings.KillSwitch.IsOn {
-				log.Print("KillSwitch is on")
-				return
+			if KillSwitchOn() {
+				continue
 			}
 			if IsPreApprovementInProgress() {
-				log.Print("PreApprovement is in progress")
-				return
+				continue
 			}
 
 			go func(p Polygon, txH common.Hash) {
@@ -2055,21 +2098,17 @@ func (p Polygon) ScanMempool(node string, client *ethclient.Client, callbacks ..
 
 func (p Polygon) GetTransactionByHash(client *ethclient.Client, txHash common.Hash) (*types.Transaction, bool, error) {
 	if client == nil {
-		nodeSupportPool, ok := p.NodeSupportPool.([]string)
-		if !ok {
-			log.Fatal("Failed to assert NodeSupportPool as []string")
-
+		var err error
+		if client, err = supportClient(); err != nil {
+			return nil, false, err
 		}
-
-		node := nodeSupportPool[rand.Intn(len(nodeSupportPool))]
-		client = p.GetClient(node)
 	}
 
 	// startTime := time.Now()
 	var ctx context.Context
 	var cancel context.CancelFunc
-	if GlobalSettings.Polygon.Settings.TTXMaxLatency != 0 {
-		ctx, cancel = context.WithTimeout(context.Background(), time.Duration(GlobalSettings.Polygon.Settings.TTXMaxLatency)*time.Millisecond)
+	if ttxMaxLatency := GlobalSettings().Polygon.Settings.TTXMaxLatency; ttxMaxLatency != 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), time.Duration(ttxMaxLatency)*time.Millisecond)
 	} else {
 		ctx, cancel = context.WithTimeout(context.Background(), 280*time.Millisecond)
 	}
@@ -2084,78 +2123,56 @@ func (p Polygon) GetTransactionByHash(client *ethclient.Client, txHash common.Ha
 	return tx, isPending, nil
 }
 
-func (p *Polygon) GetNode(pooling bool) {
-	var nodes Nodes
-
-	_nodes, err := ReadJson("nodes.json")
-	if err != nil {
-		log.Fatal(err.Error())
+// GetNode points p at the healthy nodes of the pool, fastest first
+func (p *Polygon) GetNode(pooling bool) error {
+	if err := rpcNodes.load(); err != nil {
+		return err
 	}
 
-	nodes = _nodes
-
-	var rpcUrls []string
-	if os.Getenv("GIN_MODE") == "release" {
-		if len(nodes.Polygon) > 0 {
-			rpcUrls = nodes.Polygon
-		} else {
-			log.Fatal("No Polygon RPC Url found for production")
-		}
-	} else {
-		if len(nodes.PolygonTest) > 0 {
-			rpcUrls = nodes.PolygonTest
-		} else {
-			log.Fatal("No Polygon RPC Url found for testing")
-		}
-	}
-	if len(nodes.PolygonSupport) > 0 {
-		p.NodeSupportPool = nodes.PolygonSupport
-	} else {
-		if p.NodeSupportPool == nil {
-			p.NodeSupportPool = []string{}
-		}
-		for _, url := range rpcUrls {
-			if strings.HasPrefix(url, "wss://") {
-				p.NodeSupportPool = append(p.NodeSupportPool.([]string), strings.Replace(url, "wss://", "https://", 1))
-			}
-		}
+	rpcUrls := rpcNodes.healthy(mainNode)
+	if len(rpcUrls) == 0 {
+		return ErrNoHealthyNode
 	}
+	p.NodeSupportPool = rpcNodes.healthy(supportNode)
 
+	var err error
 	p.Node, err = Queue(pooling, rpcUrls)
 	if err != nil {
-		log.Fatalf("Error accessing node queue: %v", err)
+		return fmt.Errorf("Error accessing node queue: %v", err)
 	}
 
 	p.NodePool, err = Queue(pooling, rpcUrls)
 	if err != nil {
-		log.Fatalf("Error accessing nodepool queue: %v", err)
+		return fmt.Errorf("Error accessing nodepool queue: %v", err)
 	}
+	return nil
 }
 
 func (p Polygon) GetState() interface{} {
 	return p
 }
 
+// GetClient returns the shared client of a node, the connection is closed on shutdown only
 // TODO: Extend to accept http
-func (p *Polygon) GetClient(nodeUrl interface{}) (client *ethclient.Client) {
+func (p *Polygon) GetClient(nodeUrl interface{}) (*ethclient.Client, error) {
 	if nodeUrl == nil {
-		p.GetNode(false)
+		if err := p.GetNode(false); err != nil {
+			return nil, err
+		}
 		nodeUrl = p.Node
 	}
 
 	nodeStr, ok := nodeUrl.(string)
 	if !ok {
-		log.Fatalf("Failed to assert node as string")
+		return nil, errors.New("Failed to assert node as string")
 	}
 
-	var err error
-
-	client, err = ethclient.Dial(nodeStr)
+	client, err := dialClient(context.Background(), nodeStr)
 	if err != nil {
-		log.Fatalf("Failed to connect to the Polygon network via WebSocket: %v", err)
+		return nil, fmt.Errorf("Failed to connect to the Polygon network via WebSocket: %v", err)
 	}
 
-	return client
+	return client, nil
 }
 
 // Cache it
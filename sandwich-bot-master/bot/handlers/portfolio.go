@@ -0,0 +1,333 @@
+package handlers
+
+import (
+	"bot/config"
+	"bot/controllers"
+	"bot/models"
+	"bot/types"
+	"bot/utils"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/shopspring/decimal"
+)
+
+var ErrPortfolioHistory = errors.New("Not enough portfolio history for a chart yet")
+
+// portfolioAsset is a balance the portfolio tracks, priceAsset names its oracle asset and is empty
+// for stable coins and for coins the oracle does not price
+type portfolioAsset struct {
+	name       string
+	token      *string
+	decimals   int32
+	stable     bool
+	priceAsset string
+	// USD price of the round, nil without a fresh one
+	price *decimal.Decimal
+}
+
+// RunPortfolio snapshots every active wallet each PortfolioSnapshotInterval. Stable coins are valued
+// 1:1 in USD like the balancer does, other coins at the oracle median or not at all
+func RunPortfolio(ctx context.Context) error {
+	return utils.Every(ctx, config.PortfolioSnapshotInterval, func() {
+		now := time.Now()
+		if err := SnapshotPortfolio(now); err != nil {
+			log.Printf("Portfolio: %v", err)
+		}
+		if err := prunePortfolio(now); err != nil {
+			log.Printf("Portfolio: %v", err)
+		}
+	})
+}
+
+// portfolioAssets lists native MATIC, the coins and the oracle tokens, each token once
+func portfolioAssets() []portfolioAsset {
+	assets := []portfolioAsset{{name: "matic", decimals: 18, priceAsset: "matic-network"}}
+	seen := map[string]bool{}
+	// oracle assets by token address
+	oracleAssets := map[string]string{}
+	for _, _asset := range config.PriceAssets {
+		if token, ok := config.PriceTWAPTokens[_asset]; ok {
+			oracleAssets[strings.ToLower(token.Address)] = _asset
+		}
+	}
+
+	coins := GlobalSettings().Polygon.Coins
+	names := make([]string, 0, len(coins))
+	for _name := range coins {
+		names = append(names, _name)
+	}
+	sort.Strings(names)
+	for _, _name := range names {
+		address := strings.ToLower(coins[_name][0].(string))
+		seen[address] = true
+		asset := portfolioAsset{name: _name, token: &address, decimals: coins[_name][1].(int32), stable: isStableCoin(address)}
+		if !asset.stable {
+			asset.priceAsset = oracleAssets[address]
+		}
+		assets = append(assets, asset)
+	}
+
+	for _, _asset := range config.PriceAssets {
+		token, ok := config.PriceTWAPTokens[_asset]
+		if !ok {
+			continue
+		}
+		address := strings.ToLower(token.Address)
+		if seen[address] {
+			continue
+		}
+		seen[address] = true
+		assets = append(assets, portfolioAsset{name: token.Symbol, token: &address, decimals: token.Decimals, priceAsset: _asset})
+	}
+	return assets
+}
+
+// isStableCoin tells whether the coin at address is valued 1:1 in USD
+func isStableCoin(address string) bool {
+	return config.StableCoins[strings.ToLower(address)]
+}
+
+// pricePortfolioAssets sets the price of every asset for a round, each oracle asset is looked up once
+func pricePortfolioAssets(assets []portfolioAsset) {
+	one := decimal.NewFromInt(1)
+	prices := map[string]*decimal.Decimal{}
+	for _i := range assets {
+		asset := &assets[_i]
+		switch {
+		case asset.stable:
+			asset.price = &one
+			continue
+		case asset.priceAsset == "":
+			log.Printf("Portfolio: %s is not valued: it is not a stable coin and the oracle does not price it", asset.name)
+			continue
+		}
+
+		price, ok := prices[asset.priceAsset]
+		if !ok {
+			if _price, err := PriceUSD(asset.priceAsset); err != nil {
+				log.Printf("Portfolio: %s is not valued: %v", asset.name, err)
+			} else {
+				price = &_price
+			}
+			prices[asset.priceAsset] = price
+		}
+		asset.price = price
+	}
+}
+
+// SnapshotPortfolio stores the holdings of every active wallet as one round taken at takenAt. A round
+// is stored whole or not at all, so the totals of rounds stay comparable
+func SnapshotPortfolio(takenAt time.Time) error {
+	var wallets []models.Wallet
+	if err := controllers.DB.Order("id").Find(&wallets, "active IS NULL OR active = ?", true).Error; err != nil {
+		return err
+	}
+	if len(wallets) == 0 {
+		return nil
+	}
+
+	client, err := supportClient()
+	if err != nil {
+		return err
+	}
+	erc20ABI, err := loadERC20ABI()
+	if err != nil {
+		return err
+	}
+
+	assets := portfolioAssets()
+	pricePortfolioAssets(assets)
+
+	snapshots := make([]models.PortfolioSnapshot, 0, len(wallets))
+	for _, _wallet := range wallets {
+		snapshot, err := snapshotWallet(client, erc20ABI, _wallet, assets)
+		if err != nil {
+			return fmt.Errorf("wallet %s: %w", *_wallet.Address, err)
+		}
+		snapshot.TakenAt = takenAt
+		snapshots = append(snapshots, snapshot)
+	}
+
+	return controllers.DB.Create(&snapshots).Error
+}
+
+func snapshotWallet(client *ethclient.Client, erc20ABI abi.ABI, wallet models.Wallet, assets []portfolioAsset) (models.PortfolioSnapshot, error) {
+	walletID := wallet.ID
+	snapshot := models.PortfolioSnapshot{WalletID: &walletID, Priced: true}
+	owner := common.HexToAddress(*wallet.Address)
+
+	for _, _asset := range assets {
+		var raw *big.Int
+		if _asset.token == nil {
+			balance, err := client.BalanceAt(context.Background(), owner, nil)
+			if err != nil {
+				return snapshot, fmt.Errorf("failed to get %s balance: %w", _asset.name, err)
+			}
+			raw = balance
+		} else {
+			decimals := _asset.decimals
+			balance, err := NewERC20Token(common.HexToAddress(*_asset.token), client, erc20ABI, &decimals).BalanceOf(owner)
+			if err != nil {
+				return snapshot, fmt.Errorf("failed to get %s balance: %w", _asset.name, err)
+			}
+			if len(balance) == 0 {
+				continue
+			}
+			raw = balance[0].(*big.Int)
+		}
+		if raw.Sign() == 0 {
+			continue
+		}
+
+		holding := models.PortfolioHolding{
+			Asset:    _asset.name,
+			Token:    _asset.token,
+			Balance:  decimal.NewFromBigInt(raw, -_asset.decimals),
+			PriceUsd: _asset.price,
+		}
+		if holding.PriceUsd == nil {
+			snapshot.Priced = false
+		} else {
+			holding.UsdValue = holding.Balance.Mul(*holding.PriceUsd)
+			snapshot.UsdValue = snapshot.UsdValue.Add(holding.UsdValue)
+		}
+		snapshot.Holdings = append(snapshot.Holdings, holding)
+	}
+	return snapshot, nil
+}
+
+// prunePortfolio drops snapshots older than PortfolioRetention with their holdings
+func prunePortfolio(now time.Time) error {
+	cutoff := now.Add(-config.PortfolioRetention)
+	expired := controllers.DB.Model(&models.PortfolioSnapshot{}).Select("id").Where("taken_at < ?", cutoff)
+	if err := controllers.DB.Unscoped().Where("snapshot_id IN (?)", expired).Delete(&models.PortfolioHolding{}).Error; err != nil {
+		return err
+	}
+	return controllers.DB.Unscoped().Where("taken_at < ?", cutoff).Delete(&models.PortfolioSnapshot{}).Error
+}
+
+// PortfolioWallets are the ids of the wallets a portfolio request covers. Inactive wallets are kept,
+// the history of a rotated wallet still counts towards its type
+func PortfolioWallets(walletType *models.WalletType, walletID *uint) ([]uint, error) {
+	query := controllers.DB.Model(&models.Wallet{})
+	if walletType != nil {
+		query = query.Where("type = ?", *walletType)
+	}
+	if walletID != nil {
+		query = query.Where("id = ?", *walletID)
+	}
+
+	var ids []uint
+	err := query.Pluck("id", &ids).Error
+	return ids, err
+}
+
+// PortfolioHistory sums the snapshots of wallets per round since since, oldest first. A round with
+// a holding that had no price is flagged as not priced, its total is too low to compare against
+func PortfolioHistory(walletIDs []uint, since time.Time) ([]types.PortfolioPointRespType, error) {
+	points := []types.PortfolioPointRespType{}
+	if len(walletIDs) == 0 {
+		return points, nil
+	}
+
+	err := controllers.DB.Model(&models.PortfolioSnapshot{}).
+		Select("taken_at, SUM(usd_value) AS usd_value, MIN(CASE WHEN priced THEN 1 ELSE 0 END) AS priced").
+		Where("wallet_id IN ? AND taken_at >= ?", walletIDs, since).
+		Group("taken_at").Order("taken_at").
+		Scan(&points).Error
+	return points, err
+}
+
+// Portfolio is the latest round of wallets with their holdings and how their total changed over the
+// last day and week
+func Portfolio(walletIDs []uint, now time.Time) (types.RetrievePortfolioRespType, error) {
+	response := types.RetrievePortfolioRespType{Wallets: []models.PortfolioSnapshot{}}
+	if len(walletIDs) == 0 {
+		return response, nil
+	}
+
+	var latest []models.PortfolioSnapshot
+	if err := controllers.DB.Order("taken_at DESC").Limit(1).Find(&latest, "wallet_id IN ?", walletIDs).Error; err != nil {
+		return response, err
+	}
+	if len(latest) == 0 {
+		return response, nil
+	}
+	takenAt := latest[0].TakenAt
+	response.TakenAt = &takenAt
+
+	if err := controllers.DB.Preload("Wallet").Preload("Holdings").Order("wallet_id").
+		Find(&response.Wallets, "wallet_id IN ? AND taken_at = ?", walletIDs, takenAt).Error; err != nil {
+		return response, err
+	}
+	response.Priced = true
+	for _, _snapshot := range response.Wallets {
+		response.UsdValue = response.UsdValue.Add(_snapshot.UsdValue)
+		response.Priced = response.Priced && _snapshot.Priced
+	}
+
+	// the week plus a round, so a comparison point exactly a week back is found
+	points, err := PortfolioHistory(walletIDs, now.Add(-7*24*time.Hour-config.PortfolioSnapshotInterval))
+	if err != nil {
+		return response, err
+	}
+	response.Change24h = portfolioChange(points, response.UsdValue, now.Add(-24*time.Hour))
+	response.Change7d = portfolioChange(points, response.UsdValue, now.Add(-7*24*time.Hour))
+	return response, nil
+}
+
+// portfolioChange compares current with the last priced round taken at or before since, nil without one
+func portfolioChange(points []types.PortfolioPointRespType, current decimal.Decimal, since time.Time) *types.PortfolioChangeRespType {
+	var then *types.PortfolioPointRespType
+	for _i := range points {
+		if points[_i].TakenAt.After(since) {
+			break
+		}
+		if points[_i].Priced {
+			then = &points[_i]
+		}
+	}
+	if then == nil {
+		return nil
+	}
+
+	change := &types.PortfolioChangeRespType{
+		Since:    then.TakenAt,
+		UsdValue: then.UsdValue,
+		Change:   current.Sub(then.UsdValue),
+	}
+	if !then.UsdValue.IsZero() {
+		percent := change.Change.Div(then.UsdValue).Mul(decimal.NewFromInt(100)).Round(2)
+		change.Percent = &percent
+	}
+	return change
+}
+
+// PortfolioChart plots the total of wallets since since as PNG, rounds that were not priced are left out
+func PortfolioChart(walletIDs []uint, since time.Time) ([]byte, error) {
+	points, err := PortfolioHistory(walletIDs, since)
+	if err != nil {
+		return nil, err
+	}
+
+	chartPoints := make([]utils.ChartPoint, 0, len(points))
+	for _, _point := range points {
+		if _point.Priced {
+			chartPoints = append(chartPoints, utils.ChartPoint{At: _point.TakenAt, Value: _point.UsdValue.InexactFloat64()})
+		}
+	}
+	if len(chartPoints) < 2 {
+		return nil, ErrPortfolioHistory
+	}
+	return utils.LineChartPNG(chartPoints, config.PortfolioChartWidth, config.PortfolioChartHeight)
+}
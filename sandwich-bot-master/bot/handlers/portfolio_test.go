@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"bot/controllers"
+	"bot/models"
+	"common/price"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestPortfolioAssetsValuation(t *testing.T) {
+	settings := &GlobalSettingsStruct{}
+	settings.Polygon.Coins = map[string][]interface{}{
+		"usdt":  {"0xC2132D05D31c914a87C6611C10748AEb04B58e8F", int32(6)},
+		"wpol":  {"0x0d500b1d8e8ef31e21c99d1db9a6444d3adf1270", int32(18)},
+		"token": {"0x00000000000000000000000000000000000000aa", int32(18)},
+	}
+	previous := globalSettings.Load()
+	globalSettings.Store(settings)
+	t.Cleanup(func() { globalSettings.Store(previous) })
+	setPrices(t, price.Quote{Asset: "matic-network", Price: decimal.RequireFromString("0.7"), At: time.Now()})
+
+	assets := portfolioAssets()
+	pricePortfolioAssets(assets)
+
+	prices := map[string]string{}
+	for _, _asset := range assets {
+		prices[_asset.name] = "none"
+		if _asset.price != nil {
+			prices[_asset.name] = _asset.price.String()
+		}
+	}
+	// only listed stable coins go 1:1, a coin at an oracle token address takes its median and the oracle
+	// token is not tracked twice
+	want := map[string]string{"matic": "0.7", "usdt": "1", "wpol": "0.7", "token": "none", "weth": "none"}
+	if len(prices) != len(want) {
+		t.Fatalf("prices: %v", prices)
+	}
+	for _name, _price := range want {
+		if prices[_name] != _price {
+			t.Fatalf("prices: %v, want %v", prices, want)
+		}
+	}
+}
+
+// createRound stores one snapshot per value, a negative value is a snapshot that was not priced
+func createRound(t *testing.T, takenAt time.Time, values ...int64) {
+	t.Helper()
+	for _i, _value := range values {
+		walletID := uint(_i + 1)
+		snapshot := models.PortfolioSnapshot{WalletID: &walletID, TakenAt: takenAt, UsdValue: decimal.NewFromInt(_value), Priced: _value >= 0}
+		if _value < 0 {
+			snapshot.UsdValue = decimal.NewFromInt(-_value)
+		}
+		if err := controllers.DB.Create(&snapshot).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestPortfolioHistorySkipsUnpricedRounds(t *testing.T) {
+	newTestDB(t)
+	now := time.Now().UTC().Truncate(time.Second)
+	createRound(t, now.Add(-48*time.Hour), 100, 50)
+	createRound(t, now.Add(-25*time.Hour), 100, -10)
+	createRound(t, now, 120, 80)
+
+	points, err := PortfolioHistory([]uint{1, 2}, now.Add(-72*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != 3 || !points[0].Priced || points[1].Priced || !points[2].Priced || !points[1].UsdValue.Equal(decimal.NewFromInt(110)) {
+		t.Fatalf("points: %+v", points)
+	}
+
+	// the round a day back lacks a price, the change compares against the last priced one before it
+	change := portfolioChange(points, decimal.NewFromInt(200), now.Add(-24*time.Hour))
+	if change == nil || !change.Since.Equal(points[0].TakenAt) || !change.Change.Equal(decimal.NewFromInt(50)) {
+		t.Fatalf("change: %+v", change)
+	}
+	if change := portfolioChange(points[1:], decimal.NewFromInt(200), now.Add(-24*time.Hour)); change != nil {
+		t.Fatalf("compared against an unpriced round: %+v", change)
+	}
+
+	// a single priced round is no chart
+	if _, err := PortfolioChart([]uint{1, 2}, now.Add(-30*time.Hour)); !errors.Is(err, ErrPortfolioHistory) {
+		t.Fatalf("want ErrPortfolioHistory, got %v", err)
+	}
+}
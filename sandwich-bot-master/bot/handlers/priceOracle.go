@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"bot/config"
+	"bot/utils"
+	"common/price"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/shopspring/decimal"
+)
+
+// router, factory and pair methods of UniswapV2 style DEXs, the names do not overlap
+const uniswapV2PriceABI = `[
+	{"constant":true,"inputs":[],"name":"factory","outputs":[{"name":"","type":"address"}],"stateMutability":"view","type":"function"},
+	{"constant":true,"inputs":[{"name":"","type":"address"},{"name":"","type":"address"}],"name":"getPair","outputs":[{"name":"","type":"address"}],"stateMutability":"view","type":"function"},
+	{"constant":true,"inputs":[],"name":"token0","outputs":[{"name":"","type":"address"}],"stateMutability":"view","type":"function"},
+	{"constant":true,"inputs":[],"name":"getReserves","outputs":[{"name":"reserve0","type":"uint112"},{"name":"reserve1","type":"uint112"},{"name":"blockTimestampLast","type":"uint32"}],"stateMutability":"view","type":"function"}
+]`
+
+// dexSpots reads the reserves of each asset against a stable coin, price.TWAP averages them
+// over config.PriceTWAPWindow
+type dexSpots struct {
+	mu    sync.Mutex
+	pairs map[string]common.Address
+}
+
+func newDEXTWAPOracle() *price.TWAP {
+	spots := &dexSpots{pairs: map[string]common.Address{}}
+	return price.NewTWAP("dex_twap", config.PriceTWAPWindow, spots.prices)
+}
+
+func (o *dexSpots) prices(ctx context.Context, assets []string) (map[string]decimal.Decimal, error) {
+	settings := GlobalSettings()
+	router, ok := settings.Polygon.DEXs[config.PriceTWAPDEX]
+	if !ok {
+		return nil, fmt.Errorf("dex %s is not connected", config.PriceTWAPDEX)
+	}
+	stable, ok := settings.Polygon.Coins[config.PriceTWAPQuoteCoin]
+	if !ok {
+		return nil, fmt.Errorf("coin %s is not connected", config.PriceTWAPQuoteCoin)
+	}
+	stableToken := config.PriceToken{Address: stable[0].(string), Decimals: stable[1].(int32)}
+
+	client, err := supportClient()
+	if err != nil {
+		return nil, err
+	}
+	parsedABI, err := abi.JSON(strings.NewReader(uniswapV2PriceABI))
+	if err != nil {
+		return nil, err
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	spots := map[string]decimal.Decimal{}
+	var errs []error
+	for _, _asset := range assets {
+		token, ok := config.PriceTWAPTokens[_asset]
+		if !ok {
+			continue
+		}
+		spot, err := o.spotPrice(ctx, client, parsedABI, common.HexToAddress(router), token, stableToken)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", _asset, err))
+			continue
+		}
+		spots[_asset] = spot
+	}
+	return spots, errors.Join(errs...)
+}
+
+func (o *dexSpots) spotPrice(ctx context.Context, client *ethclient.Client, parsedABI abi.ABI, router common.Address, token, stable config.PriceToken) (decimal.Decimal, error) {
+	opts := &bind.CallOpts{Context: ctx}
+	call := func(address common.Address, method string, args ...interface{}) ([]interface{}, error) {
+		var out []interface{}
+		err := bind.NewBoundContract(address, parsedABI, client, nil, nil).Call(opts, &out, method, args...)
+		return out, err
+	}
+
+	pair, ok := o.pairs[token.Address]
+	if !ok {
+		out, err := call(router, "factory")
+		if err != nil {
+			return decimal.Zero, err
+		}
+		if out, err = call(out[0].(common.Address), "getPair", common.HexToAddress(token.Address), common.HexToAddress(stable.Address)); err != nil {
+			return decimal.Zero, err
+		}
+		if pair = out[0].(common.Address); pair == (common.Address{}) {
+			return decimal.Zero, errors.New("no pair against the stable coin")
+		}
+		o.pairs[token.Address] = pair
+	}
+
+	out, err := call(pair, "token0")
+	if err != nil {
+		return decimal.Zero, err
+	}
+	token0 := out[0].(common.Address)
+	if out, err = call(pair, "getReserves"); err != nil {
+		return decimal.Zero, err
+	}
+
+	tokenReserve, stableReserve := out[0].(*big.Int), out[1].(*big.Int)
+	if token0 != common.HexToAddress(token.Address) {
+		tokenReserve, stableReserve = stableReserve, tokenReserve
+	}
+	if tokenReserve.Sign() == 0 {
+		return decimal.Zero, errors.New("pair has no liquidity")
+	}
+	return decimal.NewFromBigInt(stableReserve, -stable.Decimals).Div(decimal.NewFromBigInt(tokenReserve, -token.Decimals)), nil
+}
+
+// priceFeed holds the latest median quotes and the sources deviating from them
+type priceFeed struct {
+	mu        sync.RWMutex
+	quotes    map[string]price.Quote
+	deviating map[string]bool
+}
+
+var prices = &priceFeed{quotes: map[string]price.Quote{}, deviating: map[string]bool{}}
+
+// recordDeviations publishes a price_deviation event when a source starts deviating, not on every
+// poll it keeps deviating
+func (f *priceFeed) recordDeviations(deviations []price.Deviation) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := time.Now()
+	deviating := map[string]bool{}
+	for _, _deviation := range deviations {
+		key := _deviation.Asset + "|" + _deviation.Source
+		deviating[key] = true
+		if f.deviating[key] {
+			continue
+		}
+		log.Printf("Price of %s from %s deviates %s%% from the median %s", _deviation.Asset, _deviation.Source,
+			_deviation.Deviation.Mul(decimal.NewFromInt(100)).StringFixed(2), _deviation.Median)
+		publishPriceDeviation(_deviation, now)
+	}
+	f.deviating = deviating
+}
+
+func newPriceOracle() (price.Oracle, error) {
+	sources := []price.Oracle{
+		price.CoinGecko{BaseURL: config.CoinGeckoURL, Client: &http.Client{Timeout: 10 * time.Second}},
+		newDEXTWAPOracle(),
+	}
+	if config.PriceFixtures != "" {
+		fixtures, err := price.ParseFixtures(config.PriceFixtures)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, price.Static{Quotes: fixtures})
+	}
+
+	return price.Median{
+		Sources:      sources,
+		MaxStaleness: config.PriceMaxStaleness,
+		MaxDeviation: config.PriceMaxDeviation,
+		OnDeviation:  prices.recordDeviations,
+	}, nil
+}
+
+// RunPriceOracle polls the price sources until ctx is cancelled
+func RunPriceOracle(ctx context.Context) error {
+	oracle, err := newPriceOracle()
+	if err != nil {
+		return err
+	}
+
+	return utils.Every(ctx, config.PricePollInterval, func() {
+		quotes, err := oracle.Prices(ctx, config.PriceAssets)
+		if err != nil {
+			log.Printf("Price oracle: %v", err)
+			return
+		}
+
+		prices.mu.Lock()
+		for _asset, _quote := range quotes {
+			prices.quotes[_asset] = _quote
+		}
+		prices.mu.Unlock()
+	})
+}
+
+// PriceUSD returns the median USD price of asset, it refuses prices older than config.PriceMaxStaleness
+func PriceUSD(asset string) (decimal.Decimal, error) {
+	prices.mu.RLock()
+	quote, ok := prices.quotes[asset]
+	prices.mu.RUnlock()
+
+	if !ok {
+		return decimal.Zero, fmt.Errorf("%w: %s", price.ErrUnavailable, asset)
+	}
+	if age := time.Since(quote.At); age > config.PriceMaxStaleness {
+		return decimal.Zero, fmt.Errorf("%w: %s is %s old", price.ErrStale, asset, age.Round(time.Second))
+	}
+	return quote.Price, nil
+}
+
+// PriceQuotes lists the latest median quotes by asset
+func PriceQuotes() []price.Quote {
+	prices.mu.RLock()
+	defer prices.mu.RUnlock()
+
+	quotes := make([]price.Quote, 0, len(prices.quotes))
+	for _, _quote := range prices.quotes {
+		quotes = append(quotes, _quote)
+	}
+	sort.Slice(quotes, func(i, j int) bool {
+		return quotes[i].Asset < quotes[j].Asset
+	})
+	return quotes
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"bot/config"
+	"bot/controllers"
+	"bot/models"
+	"bot/types"
+	"common/price"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// setPrices swaps the price feed for one holding quotes
+func setPrices(t *testing.T, quotes ...price.Quote) {
+	t.Helper()
+	feed := &priceFeed{quotes: map[string]price.Quote{}, deviating: map[string]bool{}}
+	for _, _quote := range quotes {
+		feed.quotes[_quote.Asset] = _quote
+	}
+	previous := prices
+	prices = feed
+	t.Cleanup(func() { prices = previous })
+}
+
+func TestPriceUSDStaleness(t *testing.T) {
+	setPrices(t,
+		price.Quote{Asset: "ethereum", Price: decimal.NewFromInt(3000), At: time.Now()},
+		price.Quote{Asset: "matic-network", Price: decimal.RequireFromString("0.7"), At: time.Now().Add(-config.PriceMaxStaleness - time.Second)},
+	)
+
+	if price, err := PriceUSD("ethereum"); err != nil || !price.Equal(decimal.NewFromInt(3000)) {
+		t.Fatalf("fresh price: %s, %v", price, err)
+	}
+	if _, err := PriceUSD("matic-network"); !errors.Is(err, price.ErrStale) {
+		t.Fatalf("want ErrPriceStale, got %v", err)
+	}
+	if _, err := PriceUSD("bitcoin"); !errors.Is(err, price.ErrUnavailable) {
+		t.Fatalf("want ErrPriceUnavailable, got %v", err)
+	}
+}
+
+// deviationEvents lists the sources of published price_deviation events in order
+func deviationEvents(t *testing.T) []string {
+	t.Helper()
+	var events []models.Event
+	if err := controllers.DB.Order("id").Find(&events, "category = ?", models.PriceDeviationEvent).Error; err != nil {
+		t.Fatal(err)
+	}
+	sources := make([]string, len(events))
+	for _i, _event := range events {
+		var payload types.PriceDeviationEventType
+		if err := json.Unmarshal(_event.Payload, &payload); err != nil {
+			t.Fatal(err)
+		}
+		sources[_i] = payload.Source
+	}
+	return sources
+}
+
+func TestPriceDeviationEvents(t *testing.T) {
+	newTestDB(t)
+	setPrices(t)
+	static := price.Deviation{Asset: "ethereum", Source: "static", Price: decimal.NewFromInt(3400), Median: decimal.NewFromInt(3010)}
+	twap := price.Deviation{Asset: "ethereum", Source: "dex_twap", Price: decimal.NewFromInt(2800), Median: decimal.NewFromInt(3010)}
+
+	// a source is published when it starts deviating, not on every poll it keeps deviating
+	prices.recordDeviations([]price.Deviation{static})
+	prices.recordDeviations([]price.Deviation{static, twap})
+	if sources := deviationEvents(t); len(sources) != 2 || sources[0] != "static" || sources[1] != "dex_twap" {
+		t.Fatalf("deviation events: %v", sources)
+	}
+
+	// back within MaxDeviation and deviating again is a new event
+	prices.recordDeviations(nil)
+	prices.recordDeviations([]price.Deviation{static})
+	if sources := deviationEvents(t); len(sources) != 3 || sources[2] != "static" {
+		t.Fatalf("deviation events: %v", sources)
+	}
+}
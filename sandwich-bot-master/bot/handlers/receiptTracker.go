@@ -0,0 +1,320 @@
+package handlers
+
+import (
+	"bot/config"
+	"bot/controllers"
+	"bot/models"
+	"bot/utils"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+var ErrStatusChanged = errors.New("status was changed concurrently")
+
+// TrackOutbound hands a transaction sent outside of an order to the receipt tracker, purpose is the
+// one its nonce was reserved for
+func TrackOutbound(tx *types.Transaction, from, purpose string) {
+	rawData, err := json.Marshal(tx.Data())
+	if err != nil {
+		log.Printf("Failed to track %s transaction %s: %v", purpose, tx.Hash().Hex(), err)
+		return
+	}
+
+	hash := tx.Hash().Hex()
+	contract := strings.ToLower(tx.To().Hex())
+	from = strings.ToLower(from)
+	nonce := tx.Nonce()
+	sentAt := time.Now()
+	if err := controllers.DB.Create(&models.Transaction{
+		Status:   models.Status{Status: models.Pending},
+		Type:     models.Outbound,
+		Hash:     &hash,
+		Contract: &contract,
+		RawData:  datatypes.JSON(rawData),
+		Purpose:  &purpose,
+		From:     &from,
+		Nonce:    &nonce,
+		SentAt:   &sentAt,
+	}).Error; err != nil {
+		log.Printf("Failed to track %s transaction %s: %v", purpose, hash, err)
+	}
+}
+
+// RunReceiptTracker reconciles outbound transactions with the chain and settles their orders
+func RunReceiptTracker(ctx context.Context) error {
+	return utils.Every(ctx, config.ReceiptPollInterval, func() {
+		if err := trackReceipts(ctx); err != nil {
+			log.Printf("Receipt tracker: %v", err)
+		}
+		if err := settleOrders(); err != nil {
+			log.Printf("Receipt tracker: %v", err)
+		}
+	})
+}
+
+func trackReceipts(ctx context.Context) error {
+	var transactions []models.Transaction
+	if err := controllers.DB.Order("id").Find(&transactions, "type = ? AND status IN ?",
+		models.Outbound, []models.StatusType{models.Pending, models.Indexing}).Error; err != nil {
+		return err
+	}
+	if len(transactions) == 0 {
+		return nil
+	}
+
+	client, err := supportClient()
+	if err != nil {
+		return err
+	}
+	head, err := client.BlockNumber(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, _transaction := range transactions {
+		if err := trackTransaction(ctx, client, head, &_transaction); err != nil && !errors.Is(err, ErrStatusChanged) {
+			log.Printf("Failed to track transaction %s: %v", *_transaction.Hash, err)
+		}
+	}
+	return nil
+}
+
+func trackTransaction(ctx context.Context, client *ethclient.Client, head uint64, transaction *models.Transaction) error {
+	hash := common.HexToHash(*transaction.Hash)
+
+	receipt, err := client.TransactionReceipt(ctx, hash)
+	if err != nil && !errors.Is(err, ethereum.NotFound) {
+		return err
+	}
+	if receipt != nil {
+		// a node in the middle of a reorg can still serve receipts of the abandoned branch
+		header, err := client.HeaderByNumber(ctx, receipt.BlockNumber)
+		if err != nil {
+			return err
+		}
+		if header.Hash() != receipt.BlockHash {
+			return nil
+		}
+		return trackMined(head, transaction, receipt)
+	}
+
+	switch transaction.Status.Status {
+	case models.Indexing:
+		log.Printf("Transaction %s was reorged out of block %s", *transaction.Hash, *transaction.BlockHash)
+		return transitionTransaction(transaction, models.Pending, map[string]interface{}{
+			"receipt":      nil,
+			"block_number": nil,
+			"block_hash":   nil,
+			"mined_at":     nil,
+		})
+	case models.Pending:
+		return trackUnmined(ctx, client, hash, transaction)
+	}
+	return nil
+}
+
+func trackMined(head uint64, transaction *models.Transaction, receipt *types.Receipt) error {
+	blockNumber := receipt.BlockNumber.Uint64()
+	blockHash := receipt.BlockHash.Hex()
+
+	if transaction.BlockHash == nil || *transaction.BlockHash != blockHash {
+		receiptJSON, err := json.Marshal(receipt)
+		if err != nil {
+			return err
+		}
+		fields := map[string]interface{}{
+			"receipt":      datatypes.JSON(receiptJSON),
+			"block_number": blockNumber,
+			"block_hash":   blockHash,
+			"mined_at":     time.Now(),
+		}
+		if transaction.Status.Status == models.Indexing {
+			// mined again in another block of the new branch
+			if err := controllers.DB.Model(transaction).Updates(fields).Error; err != nil {
+				return err
+			}
+		} else if err := transitionTransaction(transaction, models.Indexing, fields); err != nil {
+			return err
+		}
+		transaction.BlockHash = &blockHash
+	}
+
+	if head < blockNumber || head-blockNumber+1 < config.ReceiptConfirmations {
+		return nil
+	}
+
+	status := models.Confirmed
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		status = models.Reverted
+	}
+	return transitionTransaction(transaction, status, map[string]interface{}{
+		"verified":     true,
+		"finalized_at": time.Now(),
+	})
+}
+
+func trackUnmined(ctx context.Context, client *ethclient.Client, hash common.Hash, transaction *models.Transaction) error {
+	if transaction.From != nil && transaction.Nonce != nil {
+		nonce, err := client.NonceAt(ctx, common.HexToAddress(*transaction.From), nil)
+		if err != nil {
+			return err
+		}
+		if nonce > *transaction.Nonce {
+			// the receipt may have been indexed between both calls
+			if _, err := client.TransactionReceipt(ctx, hash); !errors.Is(err, ethereum.NotFound) {
+				return err
+			}
+			log.Printf("Transaction %s was replaced, nonce %d of %s is used by another transaction", *transaction.Hash, *transaction.Nonce, *transaction.From)
+			return transitionTransaction(transaction, models.Replaced, map[string]interface{}{
+				"finalized_at": time.Now(),
+			})
+		}
+	}
+
+	sentAt := transaction.CreatedAt
+	if transaction.SentAt != nil {
+		sentAt = *transaction.SentAt
+	}
+	if time.Since(sentAt) < config.ReceiptDropAfter {
+		return nil
+	}
+	if _, _, err := client.TransactionByHash(ctx, hash); !errors.Is(err, ethereum.NotFound) {
+		// still waiting in the mempool, the order is reported as stuck meanwhile
+		return err
+	}
+	log.Printf("Transaction %s was dropped after %s", *transaction.Hash, time.Since(sentAt).Round(time.Second))
+	return transitionTransaction(transaction, models.Dropped, map[string]interface{}{
+		"finalized_at": time.Now(),
+	})
+}
+
+// transitionTransaction moves a transaction along models.StatusTransitions, it fails when another
+// writer changed the status since the transaction was read
+func transitionTransaction(transaction *models.Transaction, to models.StatusType, fields map[string]interface{}) error {
+	from := transaction.Status.Status
+	if !from.CanTransition(to) {
+		return fmt.Errorf("transaction %s cannot go from %s to %s", *transaction.Hash, from, to)
+	}
+
+	fields["status"] = to
+	result := controllers.DB.Model(&models.Transaction{}).Where("id = ? AND status = ?", transaction.ID, from).Updates(fields)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrStatusChanged
+	}
+
+	transaction.Status.Status = to
+	log.Printf("Transaction %s: %s -> %s", *transaction.Hash, from, to)
+	return nil
+}
+
+// settleOrders derives the status of unsettled orders from their outbound transactions and marks
+// the ones taking too long as stuck
+func settleOrders() error {
+	var orders []models.Order
+	if err := controllers.DB.Preload("Transaction", "type = ?", models.Outbound).
+		Find(&orders, "status IN ?", []models.StatusType{models.Pending, models.Indexing}).Error; err != nil {
+		return err
+	}
+
+	for _, _order := range orders {
+		status, reason := orderStatus(&_order)
+		if status != _order.Status.Status {
+			if err := transitionOrder(&_order, status, reason); err != nil {
+				if !errors.Is(err, ErrStatusChanged) {
+					log.Printf("Failed to settle order %d: %v", _order.ID, err)
+				}
+				continue
+			}
+		}
+
+		if !_order.Status.Status.IsFinal() && _order.StuckAt == nil && time.Since(_order.CreatedAt) > config.OrderStuckAfter {
+			if err := controllers.DB.Transaction(func(tx *gorm.DB) error {
+				if err := tx.Model(&_order).Update("stuck_at", time.Now()).Error; err != nil {
+					return err
+				}
+				return publishOrderStuck(tx, _order)
+			}); err != nil {
+				log.Printf("Failed to mark order %d as stuck: %v", _order.ID, err)
+				continue
+			}
+			log.Printf("Order %d is stuck in %s", _order.ID, _order.Status.Status)
+		}
+	}
+	return nil
+}
+
+// orderStatus is pending while any transaction waits to be mined, indexing while any awaits its
+// confirmations and confirmed only once all of them succeeded
+func orderStatus(order *models.Order) (models.StatusType, string) {
+	if len(order.Transaction) == 0 {
+		if time.Since(order.CreatedAt) > config.OrderSendTimeout {
+			return models.Fail, "no transaction was sent"
+		}
+		return order.Status.Status, ""
+	}
+
+	var indexing, reverted bool
+	var failed []string
+	for _, _transaction := range order.Transaction {
+		switch _transaction.Status.Status {
+		case models.Pending:
+			return models.Pending, ""
+		case models.Indexing:
+			indexing = true
+		case models.Reverted:
+			reverted = true
+		case models.Confirmed:
+		default:
+			failed = append(failed, fmt.Sprintf("%s %s", *_transaction.Hash, _transaction.Status.Status))
+		}
+	}
+
+	switch {
+	case indexing:
+		return models.Indexing, ""
+	case reverted:
+		return models.Reverted, "a transaction reverted"
+	case len(failed) > 0:
+		return models.Fail, strings.Join(failed, ", ")
+	}
+	return models.Confirmed, ""
+}
+
+func transitionOrder(order *models.Order, to models.StatusType, reason string) error {
+	from := order.Status.Status
+	if !from.CanTransition(to) {
+		return fmt.Errorf("order %d cannot go from %s to %s", order.ID, from, to)
+	}
+
+	fields := map[string]interface{}{"status": to}
+	if to.IsFinal() {
+		fields["finalized_at"] = time.Now()
+		fields["reason"] = reason
+	}
+	result := controllers.DB.Model(&models.Order{}).Where("id = ? AND status = ?", order.ID, from).Updates(fields)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrStatusChanged
+	}
+
+	order.Status.Status = to
+	log.Printf("Order %d: %s -> %s", order.ID, from, to)
+	return nil
+}
@@ -0,0 +1,450 @@
+package handlers
+
+import (
+	"bot/controllers"
+	"bot/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"gorm.io/gorm"
+)
+
+var ErrRotationRunning = errors.New("wallet rotation is already running")
+
+// rotations running in this process, by id and by old wallet address
+var (
+	runningRotations sync.Map
+	rotatingWallets  sync.Map
+)
+
+// IsWalletRotating tells whether funds are being moved out of address, such wallets must not trade
+func IsWalletRotating(address string) bool {
+	_, rotating := rotatingWallets.Load(strings.ToLower(address))
+	return rotating
+}
+
+type walletRotationJob struct {
+	rotation  *models.WalletRotation
+	transfers map[string]models.RotationTransfer
+	client    *ethclient.Client
+	erc20ABI  abi.ABI
+}
+
+// RunWalletRotation drives a rotation from its recorded step to completion. It is safe to call
+// again after a crash, recorded transactions are awaited or rebroadcast instead of being resent.
+func RunWalletRotation(rotationID uint) error {
+	if KillSwitchOn() {
+		return ErrKillSwitchOn
+	}
+	if _, running := runningRotations.LoadOrStore(rotationID, struct{}{}); running {
+		return ErrRotationRunning
+	}
+	defer runningRotations.Delete(rotationID)
+
+	var rotation models.WalletRotation
+	if err := controllers.DB.Preload("OldWallet").Preload("NewWallet").First(&rotation, rotationID).Error; err != nil {
+		return err
+	}
+	if rotation.Step == models.RotationCompleted {
+		return nil
+	}
+	if rotation.OldWallet == nil || rotation.NewWallet == nil {
+		return fmt.Errorf("rotation %s references a missing wallet", rotation.Uid)
+	}
+
+	oldAddress := strings.ToLower(*rotation.OldWallet.Address)
+	rotatingWallets.Store(oldAddress, struct{}{})
+	defer rotatingWallets.Delete(oldAddress)
+
+	job := &walletRotationJob{
+		rotation:  &rotation,
+		transfers: map[string]models.RotationTransfer{},
+	}
+	if len(rotation.Transfers) > 0 {
+		if err := json.Unmarshal(rotation.Transfers, &job.transfers); err != nil {
+			return err
+		}
+	}
+
+	err := job.run()
+
+	var errMessage *string
+	if err != nil {
+		_errMessage := err.Error()
+		errMessage = &_errMessage
+		log.Printf("Wallet rotation %s stopped at %s: %v", rotation.Uid, rotation.Step, err)
+	}
+	if dbErr := controllers.DB.Model(&models.WalletRotation{}).Where("id = ?", rotation.ID).Update("error", errMessage).Error; dbErr != nil {
+		log.Printf("Failed to record wallet rotation %s result: %v", rotation.Uid, dbErr)
+	}
+
+	return err
+}
+
+// RunWalletRotations resumes unfinished rotations on start and whenever the kill switch is turned off again
+func RunWalletRotations(ctx context.Context) error {
+	events := SubscribeKillSwitch()
+	defer UnsubscribeKillSwitch(events)
+
+	for {
+		if err := WaitKillSwitch(ctx, events, false); err != nil {
+			return nil
+		}
+		ResumeWalletRotations()
+		if err := WaitKillSwitch(ctx, events, true); err != nil {
+			return nil
+		}
+	}
+}
+
+// ResumeWalletRotations picks up rotations interrupted by a restart
+func ResumeWalletRotations() {
+	var rotations []models.WalletRotation
+	if err := controllers.DB.Find(&rotations, "step <> ?", models.RotationCompleted).Error; err != nil {
+		log.Printf("Failed to retrieve unfinished wallet rotations: %v", err)
+		return
+	}
+
+	for _, _rotation := range rotations {
+		log.Printf("Resuming wallet rotation %s at %s", _rotation.Uid, _rotation.Step)
+		if err := RunWalletRotation(_rotation.ID); err != nil && !errors.Is(err, ErrRotationRunning) {
+			log.Printf("Wallet rotation %s is still unfinished: %v", _rotation.Uid, err)
+		}
+	}
+}
+
+func (j *walletRotationJob) run() error {
+	client, err := supportClient()
+	if err != nil {
+		return err
+	}
+	j.client = client
+
+	p := Polygon{}
+	erc20ContractABIString, err := p.LoadABI("erc20")
+	if err != nil {
+		return err
+	}
+	if j.erc20ABI, err = abi.JSON(strings.NewReader(erc20ContractABIString)); err != nil {
+		return err
+	}
+
+	// old wallet keeps its native balance until the end, it pays for revokes and token transfers
+	steps := []struct {
+		step models.RotationStepType
+		run  func() error
+	}{
+		{models.RotationRevoking, j.revokeAllowances},
+		{models.RotationMoveERC20, j.moveERC20},
+		{models.RotationMoveNative, j.moveNative},
+		{models.RotationSwitching, j.switchWallets},
+	}
+
+	started := false
+	for _i, _s := range steps {
+		if _s.step == j.rotation.Step {
+			started = true
+		}
+		if !started {
+			continue
+		}
+		// the recorded step is picked up again once the kill switch is off
+		if KillSwitchOn() {
+			return ErrKillSwitchOn
+		}
+		if err := _s.run(); err != nil {
+			return err
+		}
+
+		if _i+1 < len(steps) {
+			if err := j.advance(steps[_i+1].step); err != nil {
+				return err
+			}
+		}
+	}
+
+	if !started {
+		return fmt.Errorf("unknown rotation step: %s", j.rotation.Step)
+	}
+	return nil
+}
+
+// knownTokens lists every token a system wallet may hold
+func knownTokens() []common.Address {
+	known := map[string]struct{}{}
+	for _, _coinData := range GlobalSettings().Polygon.Coins {
+		known[strings.ToLower(_coinData[0].(string))] = struct{}{}
+	}
+	for _contractAddress := range GlobalSettings().Polygon.Contracts.Whitelist {
+		known[strings.ToLower(_contractAddress)] = struct{}{}
+	}
+
+	tokens := []common.Address{}
+	for _address := range known {
+		tokens = append(tokens, common.HexToAddress(_address))
+	}
+	return tokens
+}
+
+func (j *walletRotationJob) oldAddress() common.Address {
+	return common.HexToAddress(*j.rotation.OldWallet.Address)
+}
+
+func (j *walletRotationJob) newAddress() common.Address {
+	return common.HexToAddress(*j.rotation.NewWallet.Address)
+}
+
+func (j *walletRotationJob) advance(step models.RotationStepType) error {
+	if err := controllers.DB.Model(&models.WalletRotation{}).Where("id = ?", j.rotation.ID).Update("step", step).Error; err != nil {
+		return err
+	}
+	j.rotation.Step = step
+	return nil
+}
+
+func (j *walletRotationJob) save() error {
+	transfers, err := json.Marshal(j.transfers)
+	if err != nil {
+		return err
+	}
+	return controllers.DB.Model(&models.WalletRotation{}).Where("id = ?", j.rotation.ID).Update("transfers", transfers).Error
+}
+
+// settle waits for the transaction recorded under key, rebroadcasting it if it never left the
+// process. Returns true when nothing more has to be sent for key.
+func (j *walletRotationJob) settle(key string) (bool, error) {
+	transfer, ok := j.transfers[key]
+	if !ok || transfer.Failed {
+		return false, nil
+	}
+	if transfer.Mined {
+		return true, nil
+	}
+
+	receipt, err := AwaitRecordedTx(j.client, transfer.RawTx)
+	if err != nil {
+		return false, err
+	}
+
+	transfer.Mined = true
+	transfer.Failed = receipt.Status != types.ReceiptStatusSuccessful
+	j.transfers[key] = transfer
+	if err := j.save(); err != nil {
+		return false, err
+	}
+
+	return !transfer.Failed, nil
+}
+
+// send signs the transaction built by sign with a nonce reserved for the old wallet and broadcasts it
+func (j *walletRotationJob) send(key string, transfer models.RotationTransfer, sign func(nonce uint64) (*types.Transaction, error)) error {
+	if KillSwitchOn() {
+		return ErrKillSwitchOn
+	}
+	from := j.oldAddress().Hex()
+	nonces, err := ReserveNonces(from, 1, "rotation")
+	if err != nil {
+		return err
+	}
+	tx, err := sign(nonces[0])
+	if err != nil {
+		ReleaseNonce(from, nonces[0])
+		return err
+	}
+	return j.broadcast(key, tx, transfer)
+}
+
+// broadcast records tx before sending it and waits until it is mined
+func (j *walletRotationJob) broadcast(key string, tx *types.Transaction, transfer models.RotationTransfer) error {
+	from := j.oldAddress().Hex()
+	rawTx, err := EncodeRawTx(tx)
+	if err != nil {
+		ReleaseNonce(from, tx.Nonce())
+		return err
+	}
+
+	transfer.Hash = tx.Hash().Hex()
+	transfer.RawTx = rawTx
+	j.transfers[key] = transfer
+	if err := j.save(); err != nil {
+		delete(j.transfers, key)
+		ReleaseNonce(from, tx.Nonce())
+		return err
+	}
+	MarkNonceSent(from, tx.Nonce(), transfer.Hash)
+	TrackOutbound(tx, from, "rotation")
+
+	if err := j.client.SendTransaction(context.Background(), tx); err != nil {
+		return fmt.Errorf("failed to send %s: %w", key, err)
+	}
+	log.Printf("Wallet rotation %s: %s sent in %s", j.rotation.Uid, key, transfer.Hash)
+
+	done, err := j.settle(key)
+	if err != nil {
+		return err
+	}
+	if !done {
+		return fmt.Errorf("%s transaction %s reverted", key, transfer.Hash)
+	}
+	return nil
+}
+
+func (j *walletRotationJob) transactor() (*bind.TransactOpts, error) {
+	auth, err := WalletTransactor(*j.rotation.OldWallet, CHAIN_ID)
+	if err != nil {
+		return nil, err
+	}
+	// signed only, broadcast goes through the job so it is recorded first
+	auth.NoSend = true
+	if err := withOracleGas(auth); err != nil {
+		return nil, err
+	}
+	return auth, nil
+}
+
+func (j *walletRotationJob) revokeAllowances() error {
+	for _, _token := range knownTokens() {
+		erc20Token := NewERC20Token(_token, j.client, j.erc20ABI, nil)
+
+		for _, _dexAddress := range GlobalSettings().Polygon.DEXs {
+			key := fmt.Sprintf("revoke:%s:%s", strings.ToLower(_token.Hex()), strings.ToLower(_dexAddress))
+			if done, err := j.settle(key); err != nil {
+				return err
+			} else if done {
+				continue
+			}
+
+			dexRouter := common.HexToAddress(_dexAddress)
+			allowance, err := erc20Token.Allowance(j.oldAddress(), dexRouter)
+			if err != nil {
+				return fmt.Errorf("failed to get allowance of %s for %s: %w", _token.Hex(), _dexAddress, err)
+			}
+			if allowance.Sign() == 0 {
+				continue
+			}
+
+			auth, err := j.transactor()
+			if err != nil {
+				return err
+			}
+			if err := j.send(key, models.RotationTransfer{Token: _token.Hex(), Spender: dexRouter.Hex()}, func(nonce uint64) (*types.Transaction, error) {
+				auth.Nonce = new(big.Int).SetUint64(nonce)
+				return erc20Token.Revoke(dexRouter, auth)
+			}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (j *walletRotationJob) moveERC20() error {
+	for _, _token := range knownTokens() {
+		key := fmt.Sprintf("erc20:%s", strings.ToLower(_token.Hex()))
+		if done, err := j.settle(key); err != nil {
+			return err
+		} else if done {
+			continue
+		}
+
+		erc20Token := NewERC20Token(_token, j.client, j.erc20ABI, nil)
+		balance, err := erc20Token.BalanceOf(j.oldAddress())
+		if err != nil {
+			return fmt.Errorf("failed to get balance of %s: %w", _token.Hex(), err)
+		}
+		if len(balance) == 0 || balance[0].(*big.Int).Sign() == 0 {
+			continue
+		}
+		amount := balance[0].(*big.Int)
+
+		auth, err := j.transactor()
+		if err != nil {
+			return err
+		}
+		if err := j.send(key, models.RotationTransfer{Token: _token.Hex(), Amount: amount.String()}, func(nonce uint64) (*types.Transaction, error) {
+			auth.Nonce = new(big.Int).SetUint64(nonce)
+			return erc20Token.Transfer(j.newAddress(), amount, auth)
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (j *walletRotationJob) moveNative() error {
+	const key = "native"
+	if done, err := j.settle(key); err != nil || done {
+		return err
+	}
+
+	ctx := context.Background()
+	balance, err := j.client.BalanceAt(ctx, j.oldAddress(), nil)
+	if err != nil {
+		return err
+	}
+	// legacy transfer pays exactly its gas price, so the wallet ends up empty
+	_, gasPrice, err := OracleFees()
+	if err != nil {
+		return err
+	}
+
+	const gasLimit = uint64(21000)
+	fee := new(big.Int).Mul(gasPrice, new(big.Int).SetUint64(gasLimit))
+	if balance.Cmp(fee) <= 0 {
+		log.Printf("Wallet rotation %s: native balance %s does not cover the transfer fee, leaving it", j.rotation.Uid, balance)
+		return nil
+	}
+	amount := new(big.Int).Sub(balance, fee)
+
+	to := j.newAddress()
+	return j.send(key, models.RotationTransfer{Amount: amount.String()}, func(nonce uint64) (*types.Transaction, error) {
+		return SignWalletTx(*j.rotation.OldWallet, types.NewTx(&types.LegacyTx{
+			Nonce:    nonce,
+			GasPrice: gasPrice,
+			Gas:      gasLimit,
+			To:       &to,
+			Value:    amount,
+		}), CHAIN_ID)
+	})
+}
+
+func (j *walletRotationJob) switchWallets() error {
+	now := time.Now()
+	if err := controllers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Wallet{}).Where("id = ?", j.rotation.OldWallet.ID).Update("active", false).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Wallet{}).Where("id = ?", j.rotation.NewWallet.ID).Update("active", true).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.WalletRotation{}).Where("id = ?", j.rotation.ID).Updates(map[string]interface{}{
+			"step":         models.RotationCompleted,
+			"completed_at": &now,
+		}).Error
+	}); err != nil {
+		return err
+	}
+	j.rotation.Step = models.RotationCompleted
+
+	UpdateGlobalSettings(int(*j.rotation.BlockchainID.BlockchainID))
+
+	// new main wallet needs its own allowances before it can trade
+	if *j.rotation.Type == models.Main {
+		RequestPreApprovement()
+	}
+
+	log.Printf("Wallet rotation %s completed, %s replaced %s", j.rotation.Uid, *j.rotation.NewWallet.Address, *j.rotation.OldWallet.Address)
+	return nil
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"bot/controllers"
+	"bot/models"
+	"bot/types"
+	"bytes"
+	"encoding/json"
+	"sort"
+
+	"gorm.io/datatypes"
+)
+
+func decodeSettings(settings datatypes.JSON) (map[string]interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(settings))
+	// keep numbers as written so large values compare exactly
+	decoder.UseNumber()
+
+	settingsMap := map[string]interface{}{}
+	if err := decoder.Decode(&settingsMap); err != nil {
+		return nil, err
+	}
+	delete(settingsMap, "user_id")
+	return settingsMap, nil
+}
+
+// DiffSettings lists fields that differ between two settings versions, sorted by field
+func DiffSettings(from, to datatypes.JSON) ([]types.SettingsChangeRespType, error) {
+	fromMap, err := decodeSettings(from)
+	if err != nil {
+		return nil, err
+	}
+	toMap, err := decodeSettings(to)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := map[string]struct{}{}
+	for _field := range fromMap {
+		fields[_field] = struct{}{}
+	}
+	for _field := range toMap {
+		fields[_field] = struct{}{}
+	}
+
+	changes := []types.SettingsChangeRespType{}
+	for _field := range fields {
+		fromValue, _ := json.Marshal(fromMap[_field])
+		toValue, _ := json.Marshal(toMap[_field])
+		if !bytes.Equal(fromValue, toValue) {
+			changes = append(changes, types.SettingsChangeRespType{Field: _field, From: fromMap[_field], To: toMap[_field]})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+
+	return changes, nil
+}
+
+// ReloadSettings publishes a copy of the current snapshot with the active settings version,
+// a version that does not decode leaves the running settings untouched
+func ReloadSettings(blockchainID int) error {
+	reloadMutex.Lock()
+	defer reloadMutex.Unlock()
+
+	var _settings models.Settings
+	if err := controllers.DB.First(&_settings, "active = true and blockchain_id = ?", blockchainID).Error; err != nil {
+		return err
+	}
+
+	var settings PolygonSettings
+	if err := json.Unmarshal(_settings.Settings, &settings); err != nil {
+		return err
+	}
+
+	snapshot := *GlobalSettings()
+	snapshot.Polygon.Settings = settings
+	globalSettings.Store(&snapshot)
+	return nil
+}
@@ -0,0 +1,334 @@
+package handlers
+
+import (
+	"bot/models"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Signer signs transactions for a single address. Implementations must not keep
+// decrypted key material between calls.
+type Signer interface {
+	Address() common.Address
+	SignTx(tx *types.Transaction, chainID *big.Int) (*types.Transaction, error)
+}
+
+// NewSigner picks the signer configured for wallet
+func NewSigner(wallet models.Wallet) (Signer, error) {
+	if wallet.Address == nil {
+		return nil, ErrWalletKeyMissing
+	}
+	address := common.HexToAddress(*wallet.Address)
+
+	signerType := models.LocalSigner
+	if wallet.SignerType != nil {
+		signerType = *wallet.SignerType
+	}
+
+	switch signerType {
+	case models.LocalSigner:
+		return &LocalSigner{Wallet: wallet}, nil
+	case models.KeystoreSigner:
+		if wallet.SignerURI == nil {
+			return nil, errors.New("keystore signer requires signer_uri with the keystore file path")
+		}
+		return &KeystoreSigner{From: address, Path: *wallet.SignerURI}, nil
+	case models.RemoteSigner:
+		if wallet.SignerURI == nil {
+			return nil, errors.New("remote signer requires signer_uri with the signer URL")
+		}
+		return NewRemoteSigner(address, *wallet.SignerURI), nil
+	}
+
+	return nil, fmt.Errorf("unsupported signer type: %s", signerType)
+}
+
+// LocalSigner opens the sealed key stored with the wallet row
+type LocalSigner struct {
+	Wallet models.Wallet
+}
+
+func (ls *LocalSigner) Address() common.Address {
+	return common.HexToAddress(*ls.Wallet.Address)
+}
+
+func (ls *LocalSigner) SignTx(tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	privateKey, err := walletPrivateKey(ls.Wallet)
+	if err != nil {
+		return nil, err
+	}
+	defer privateKey.D.SetInt64(0)
+
+	return types.SignTx(tx, types.LatestSignerForChainID(chainID), privateKey)
+}
+
+// KeystoreSigner decrypts a go-ethereum keystore JSON file on every signature.
+// Passphrase comes from KEYSTORE_PASSPHRASE_FILE or KEYSTORE_PASSPHRASE.
+type KeystoreSigner struct {
+	From common.Address
+	Path string
+}
+
+func keystorePassphrase() (string, error) {
+	if path := os.Getenv("KEYSTORE_PASSPHRASE_FILE"); path != "" {
+		passphrase, err := os.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(passphrase), "\r\n"), nil
+	}
+	return os.Getenv("KEYSTORE_PASSPHRASE"), nil
+}
+
+func (ks *KeystoreSigner) Address() common.Address {
+	return ks.From
+}
+
+func (ks *KeystoreSigner) SignTx(tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	keyJSON, err := os.ReadFile(ks.Path)
+	if err != nil {
+		return nil, err
+	}
+	passphrase, err := keystorePassphrase()
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := keystore.DecryptKey(keyJSON, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	defer key.PrivateKey.D.SetInt64(0)
+
+	if key.Address != ks.From {
+		return nil, fmt.Errorf("keystore %s holds %s, expected %s", ks.Path, key.Address.Hex(), ks.From.Hex())
+	}
+
+	return types.SignTx(tx, types.LatestSignerForChainID(chainID), key.PrivateKey)
+}
+
+// RemoteSigner asks a Web3Signer or Clef compatible JSON-RPC endpoint to sign.
+// Method is eth_signTransaction for Web3Signer and account_signTransaction for Clef.
+type RemoteSigner struct {
+	From     common.Address
+	Endpoint string
+	Method   string
+	Client   *http.Client
+}
+
+func NewRemoteSigner(from common.Address, endpoint string) *RemoteSigner {
+	return &RemoteSigner{
+		From:     from,
+		Endpoint: endpoint,
+		Method:   "eth_signTransaction",
+		Client:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+type jsonRPCRequest struct {
+	JSONRPC string        `json:"jsonrpc"`
+	ID      int           `json:"id"`
+	Method  string        `json:"method"`
+	Params  []interface{} `json:"params"`
+}
+
+type jsonRPCResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      int             `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *jsonRPCError   `json:"error,omitempty"`
+}
+
+type jsonRPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// SignTxArgs are eth_signTransaction parameters
+type SignTxArgs struct {
+	From                 common.Address  `json:"from"`
+	To                   *common.Address `json:"to,omitempty"`
+	Gas                  hexutil.Uint64  `json:"gas"`
+	GasPrice             *hexutil.Big    `json:"gasPrice,omitempty"`
+	MaxFeePerGas         *hexutil.Big    `json:"maxFeePerGas,omitempty"`
+	MaxPriorityFeePerGas *hexutil.Big    `json:"maxPriorityFeePerGas,omitempty"`
+	Value                *hexutil.Big    `json:"value"`
+	Nonce                hexutil.Uint64  `json:"nonce"`
+	Data                 hexutil.Bytes   `json:"data"`
+	ChainID              *hexutil.Big    `json:"chainId,omitempty"`
+}
+
+func NewSignTxArgs(from common.Address, tx *types.Transaction, chainID *big.Int) SignTxArgs {
+	args := SignTxArgs{
+		From:    from,
+		To:      tx.To(),
+		Gas:     hexutil.Uint64(tx.Gas()),
+		Value:   (*hexutil.Big)(tx.Value()),
+		Nonce:   hexutil.Uint64(tx.Nonce()),
+		Data:    tx.Data(),
+		ChainID: (*hexutil.Big)(chainID),
+	}
+	if tx.Type() == types.LegacyTxType {
+		args.GasPrice = (*hexutil.Big)(tx.GasPrice())
+	} else {
+		args.MaxFeePerGas = (*hexutil.Big)(tx.GasFeeCap())
+		args.MaxPriorityFeePerGas = (*hexutil.Big)(tx.GasTipCap())
+	}
+	return args
+}
+
+// ToTransaction rebuilds the unsigned transaction described by args
+func (args SignTxArgs) ToTransaction(chainID *big.Int) *types.Transaction {
+	value := new(big.Int)
+	if args.Value != nil {
+		value = args.Value.ToInt()
+	}
+
+	if args.MaxFeePerGas != nil {
+		tip := new(big.Int)
+		if args.MaxPriorityFeePerGas != nil {
+			tip = args.MaxPriorityFeePerGas.ToInt()
+		}
+		return types.NewTx(&types.DynamicFeeTx{
+			ChainID:   chainID,
+			Nonce:     uint64(args.Nonce),
+			GasTipCap: tip,
+			GasFeeCap: args.MaxFeePerGas.ToInt(),
+			Gas:       uint64(args.Gas),
+			To:        args.To,
+			Value:     value,
+			Data:      args.Data,
+		})
+	}
+
+	gasPrice := new(big.Int)
+	if args.GasPrice != nil {
+		gasPrice = args.GasPrice.ToInt()
+	}
+	return types.NewTx(&types.LegacyTx{
+		Nonce:    uint64(args.Nonce),
+		GasPrice: gasPrice,
+		Gas:      uint64(args.Gas),
+		To:       args.To,
+		Value:    value,
+		Data:     args.Data,
+	})
+}
+
+func (rs *RemoteSigner) call(method string, params []interface{}, result interface{}) error {
+	body, err := json.Marshal(jsonRPCRequest{JSONRPC: "2.0", ID: 1, Method: method, Params: params})
+	if err != nil {
+		return err
+	}
+
+	resp, err := rs.Client.Post(rs.Endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var rpcResp jsonRPCResponse
+	if err := json.NewDecoder(resp.Body).Decode(&rpcResp); err != nil {
+		return fmt.Errorf("malformed response from remote signer: %w", err)
+	}
+	if rpcResp.Error != nil {
+		return fmt.Errorf("remote signer error %d: %s", rpcResp.Error.Code, rpcResp.Error.Message)
+	}
+
+	return json.Unmarshal(rpcResp.Result, result)
+}
+
+func (rs *RemoteSigner) Address() common.Address {
+	return rs.From
+}
+
+// Accounts lists addresses the remote signer can sign for
+func (rs *RemoteSigner) Accounts() ([]common.Address, error) {
+	var accounts []common.Address
+	err := rs.call("eth_accounts", []interface{}{}, &accounts)
+	return accounts, err
+}
+
+func (rs *RemoteSigner) SignTx(tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	var result json.RawMessage
+	if err := rs.call(rs.Method, []interface{}{NewSignTxArgs(rs.From, tx, chainID)}, &result); err != nil {
+		return nil, err
+	}
+
+	// Web3Signer returns raw hex, Clef wraps it as {"raw": ..., "tx": ...}
+	var raw hexutil.Bytes
+	if err := json.Unmarshal(result, &raw); err != nil {
+		var clef struct {
+			Raw hexutil.Bytes `json:"raw"`
+		}
+		if err := json.Unmarshal(result, &clef); err != nil {
+			return nil, fmt.Errorf("malformed signature from remote signer: %w", err)
+		}
+		raw = clef.Raw
+	}
+
+	signedTx := new(types.Transaction)
+	if err := signedTx.UnmarshalBinary(raw); err != nil {
+		return nil, err
+	}
+
+	// never broadcast something other than what was asked for
+	signer := types.LatestSignerForChainID(chainID)
+	if signer.Hash(signedTx) != signer.Hash(tx) {
+		return nil, errors.New("remote signer returned a different transaction")
+	}
+	sender, err := types.Sender(signer, signedTx)
+	if err != nil {
+		return nil, err
+	}
+	if sender != rs.From {
+		return nil, fmt.Errorf("remote signer signed with %s, expected %s", sender.Hex(), rs.From.Hex())
+	}
+
+	return signedTx, nil
+}
+
+// VerifySigner checks that an external signer can sign for address before a wallet is stored
+func VerifySigner(signerType models.SignerType, uri string, address common.Address) error {
+	switch signerType {
+	case models.KeystoreSigner:
+		keyJSON, err := os.ReadFile(uri)
+		if err != nil {
+			return err
+		}
+		var keyFile struct {
+			Address string `json:"address"`
+		}
+		if err := json.Unmarshal(keyJSON, &keyFile); err != nil {
+			return fmt.Errorf("malformed keystore file: %w", err)
+		}
+		if common.HexToAddress(keyFile.Address) != address {
+			return fmt.Errorf("keystore %s does not hold %s", uri, address.Hex())
+		}
+		return nil
+	case models.RemoteSigner:
+		accounts, err := NewRemoteSigner(address, uri).Accounts()
+		if err != nil {
+			return err
+		}
+		for _, _account := range accounts {
+			if _account == address {
+				return nil
+			}
+		}
+		return fmt.Errorf("remote signer cannot sign for %s", address.Hex())
+	}
+	return fmt.Errorf("unsupported signer type: %s", signerType)
+}
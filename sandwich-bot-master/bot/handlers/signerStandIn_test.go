@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// SignerStandIn is a minimal local stand-in for a Web3Signer/Clef style remote signer for tests.
+// It answers eth_accounts, eth_signTransaction and account_signTransaction, keys live in its memory.
+type SignerStandIn struct {
+	ChainID *big.Int
+	keys    map[common.Address]*ecdsa.PrivateKey
+}
+
+func NewSignerStandIn(chainID *big.Int, keys ...*ecdsa.PrivateKey) *SignerStandIn {
+	ssi := &SignerStandIn{
+		ChainID: chainID,
+		keys:    map[common.Address]*ecdsa.PrivateKey{},
+	}
+	for _, _key := range keys {
+		ssi.keys[crypto.PubkeyToAddress(_key.PublicKey)] = _key
+	}
+	return ssi
+}
+
+func (ssi *SignerStandIn) respond(w http.ResponseWriter, id int, result interface{}, rpcErr *jsonRPCError) {
+	resp := jsonRPCResponse{JSONRPC: "2.0", ID: id, Error: rpcErr}
+	if rpcErr == nil {
+		resp.Result, _ = json.Marshal(result)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (ssi *SignerStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ID     int               `json:"id"`
+		Method string            `json:"method"`
+		Params []json.RawMessage `json:"params"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		ssi.respond(w, 0, nil, &jsonRPCError{Code: -32700, Message: "parse error"})
+		return
+	}
+
+	switch req.Method {
+	case "eth_accounts", "account_list":
+		accounts := []common.Address{}
+		for _address := range ssi.keys {
+			accounts = append(accounts, _address)
+		}
+		ssi.respond(w, req.ID, accounts, nil)
+	case "eth_signTransaction", "account_signTransaction":
+		if len(req.Params) == 0 {
+			ssi.respond(w, req.ID, nil, &jsonRPCError{Code: -32602, Message: "missing transaction"})
+			return
+		}
+		var args SignTxArgs
+		if err := json.Unmarshal(req.Params[0], &args); err != nil {
+			ssi.respond(w, req.ID, nil, &jsonRPCError{Code: -32602, Message: err.Error()})
+			return
+		}
+
+		key, ok := ssi.keys[args.From]
+		if !ok {
+			ssi.respond(w, req.ID, nil, &jsonRPCError{Code: -32000, Message: fmt.Sprintf("unknown account %s", args.From.Hex())})
+			return
+		}
+		chainID := ssi.ChainID
+		if args.ChainID != nil {
+			chainID = args.ChainID.ToInt()
+		}
+
+		signedTx, err := types.SignTx(args.ToTransaction(chainID), types.LatestSignerForChainID(chainID), key)
+		if err != nil {
+			ssi.respond(w, req.ID, nil, &jsonRPCError{Code: -32000, Message: err.Error()})
+			return
+		}
+		raw, err := signedTx.MarshalBinary()
+		if err != nil {
+			ssi.respond(w, req.ID, nil, &jsonRPCError{Code: -32000, Message: err.Error()})
+			return
+		}
+
+		if req.Method == "account_signTransaction" {
+			ssi.respond(w, req.ID, map[string]interface{}{"raw": hexutil.Bytes(raw), "tx": signedTx}, nil)
+			return
+		}
+		ssi.respond(w, req.ID, hexutil.Bytes(raw), nil)
+	default:
+		ssi.respond(w, req.ID, nil, &jsonRPCError{Code: -32601, Message: "method not found"})
+	}
+}
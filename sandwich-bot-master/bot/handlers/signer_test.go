@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"bot/models"
+	"crypto/ecdsa"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func newTestKey(t *testing.T) (*ecdsa.PrivateKey, common.Address) {
+	t.Helper()
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, crypto.PubkeyToAddress(key.PublicKey)
+}
+
+func newStandIn(t *testing.T, keys ...*ecdsa.PrivateKey) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(NewSignerStandIn(CHAIN_ID, keys...))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func testTransactions() map[string]*types.Transaction {
+	to := common.HexToAddress("0x000000000000000000000000000000000000dEaD")
+	return map[string]*types.Transaction{
+		"legacy": types.NewTx(&types.LegacyTx{
+			Nonce:    7,
+			GasPrice: big.NewInt(30e9),
+			Gas:      21000,
+			To:       &to,
+			Value:    big.NewInt(1e18),
+		}),
+		"dynamic fee": types.NewTx(&types.DynamicFeeTx{
+			ChainID:   CHAIN_ID,
+			Nonce:     8,
+			GasTipCap: big.NewInt(2e9),
+			GasFeeCap: big.NewInt(50e9),
+			Gas:       60000,
+			To:        &to,
+			Value:     big.NewInt(0),
+			Data:      []byte{0xa9, 0x05, 0x9c, 0xbb},
+		}),
+	}
+}
+
+func TestRemoteSignerSignTx(t *testing.T) {
+	key, address := newTestKey(t)
+	server := newStandIn(t, key)
+
+	for _, _method := range []string{"eth_signTransaction", "account_signTransaction"} {
+		for _name, _tx := range testTransactions() {
+			t.Run(_method+" "+_name, func(t *testing.T) {
+				signer := NewRemoteSigner(address, server.URL)
+				signer.Method = _method
+
+				signed, err := signer.SignTx(_tx, CHAIN_ID)
+				if err != nil {
+					t.Fatalf("SignTx: %v", err)
+				}
+				if signed.Nonce() != _tx.Nonce() || signed.Gas() != _tx.Gas() || signed.Value().Cmp(_tx.Value()) != 0 {
+					t.Fatalf("signed transaction differs from the requested one")
+				}
+				sender, err := types.Sender(types.LatestSignerForChainID(CHAIN_ID), signed)
+				if err != nil {
+					t.Fatalf("Sender: %v", err)
+				}
+				if sender != address {
+					t.Fatalf("signed by %s, want %s", sender.Hex(), address.Hex())
+				}
+			})
+		}
+	}
+}
+
+func TestRemoteSignerUnknownAccount(t *testing.T) {
+	key, _ := newTestKey(t)
+	_, other := newTestKey(t)
+	server := newStandIn(t, key)
+
+	_, err := NewRemoteSigner(other, server.URL).SignTx(testTransactions()["legacy"], CHAIN_ID)
+	if err == nil || !strings.Contains(err.Error(), "unknown account") {
+		t.Fatalf("SignTx for an unknown account: got %v", err)
+	}
+}
+
+// a signer that answers with a different transaction or key must never be trusted
+func TestRemoteSignerRejectsTampering(t *testing.T) {
+	key, address := newTestKey(t)
+	otherKey, _ := newTestKey(t)
+	tx := testTransactions()["legacy"]
+
+	cases := map[string]func(SignTxArgs) (*types.Transaction, error){
+		"other transaction": func(args SignTxArgs) (*types.Transaction, error) {
+			args.Value = (*hexutil.Big)(big.NewInt(2e18))
+			return types.SignTx(args.ToTransaction(CHAIN_ID), types.LatestSignerForChainID(CHAIN_ID), key)
+		},
+		"other key": func(args SignTxArgs) (*types.Transaction, error) {
+			return types.SignTx(args.ToTransaction(CHAIN_ID), types.LatestSignerForChainID(CHAIN_ID), otherKey)
+		},
+	}
+	for _name, _sign := range cases {
+		t.Run(_name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var req struct {
+					Params []SignTxArgs `json:"params"`
+				}
+				if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Params) == 0 {
+					t.Errorf("malformed request: %v", err)
+					return
+				}
+				signed, err := _sign(req.Params[0])
+				if err != nil {
+					t.Errorf("sign: %v", err)
+					return
+				}
+				raw, _ := signed.MarshalBinary()
+				result, _ := json.Marshal(hexutil.Bytes(raw))
+				json.NewEncoder(w).Encode(jsonRPCResponse{JSONRPC: "2.0", ID: 1, Result: result})
+			}))
+			defer server.Close()
+
+			if _, err := NewRemoteSigner(address, server.URL).SignTx(tx, CHAIN_ID); err == nil {
+				t.Fatalf("SignTx accepted a tampered signature")
+			}
+		})
+	}
+}
+
+func TestVerifyRemoteSigner(t *testing.T) {
+	key, address := newTestKey(t)
+	_, other := newTestKey(t)
+	server := newStandIn(t, key)
+
+	if err := VerifySigner(models.RemoteSigner, server.URL, address); err != nil {
+		t.Fatalf("VerifySigner for a served account: %v", err)
+	}
+	if err := VerifySigner(models.RemoteSigner, server.URL, other); err == nil {
+		t.Fatalf("VerifySigner accepted an account the signer does not hold")
+	}
+}
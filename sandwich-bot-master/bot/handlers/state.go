@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"sync"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+)
+
+// stateStore is a map guarded by a read-write lock. Runtime state changed by many goroutines
+// lives in stores like this, configuration is published as a GlobalSettings snapshot instead
+type stateStore[K comparable, V any] struct {
+	mu sync.RWMutex
+	m  map[K]V
+}
+
+func newStateStore[K comparable, V any]() *stateStore[K, V] {
+	return &stateStore[K, V]{m: map[K]V{}}
+}
+
+func (s *stateStore[K, V]) Load(key K) (V, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	value, ok := s.m[key]
+	return value, ok
+}
+
+func (s *stateStore[K, V]) Store(key K, value V) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.m[key] = value
+}
+
+// StoreIfAbsent stores value only when key is missing and reports whether it did
+func (s *stateStore[K, V]) StoreIfAbsent(key K, value V) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.m[key]; ok {
+		return false
+	}
+	s.m[key] = value
+	return true
+}
+
+// Update replaces the value of key with what fn returns, all under one lock.
+// Returning false from fn leaves the store as it was
+func (s *stateStore[K, V]) Update(key K, fn func(value V, ok bool) (V, bool)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	value, ok := s.m[key]
+	if value, store := fn(value, ok); store {
+		s.m[key] = value
+	}
+}
+
+func (s *stateStore[K, V]) Delete(key K) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.m, key)
+}
+
+func (s *stateStore[K, V]) Keys() []K {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	keys := make([]K, 0, len(s.m))
+	for _key := range s.m {
+		keys = append(keys, _key)
+	}
+	return keys
+}
+
+func (s *stateStore[K, V]) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.m)
+}
+
+func (s *stateStore[K, V]) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.m = map[K]V{}
+}
+
+type balanceKey struct {
+	Wallet, Token string
+}
+
+type allowanceKey struct {
+	Wallet, Token, Spender string
+}
+
+var (
+	// Target tx each main wallet is attacking, a wallet with an entry is busy
+	WalletTTX = newStateStore[string, string]()
+	// Nonce manager state per wallet, see nonceManager.go
+	WalletNonces    = newStateStore[string, *walletNonces]()
+	WalletBalance   = newStateStore[balanceKey, Balance]()
+	WalletAllowance = newStateStore[allowanceKey, Allowance]()
+	// Transactors of the main wallets, pre-approvals of all wallets run at once
+	WalletAuth = newStateStore[string, *bind.TransactOpts]()
+)
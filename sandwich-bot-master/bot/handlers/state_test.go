@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestStateStoreConcurrent(t *testing.T) {
+	store := newStateStore[string, int]()
+	const workers, rounds = 16, 500
+
+	var wg sync.WaitGroup
+	winners := make(chan int, workers)
+	for _worker := 0; _worker < workers; _worker++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			if store.StoreIfAbsent("busy", worker) {
+				winners <- worker
+			}
+			for _round := 0; _round < rounds; _round++ {
+				store.Update("counter", func(value int, _ bool) (int, bool) {
+					return value + 1, true
+				})
+				key := fmt.Sprintf("%d:%d", worker, _round%10)
+				store.Store(key, _round)
+				store.Load(key)
+				store.Keys()
+				store.Len()
+				store.Delete(key)
+			}
+		}(_worker)
+	}
+	wg.Wait()
+	close(winners)
+
+	if len(winners) != 1 {
+		t.Fatalf("%d workers stored the same key, want 1", len(winners))
+	}
+	if counter, _ := store.Load("counter"); counter != workers*rounds {
+		t.Fatalf("counter is %d, want %d", counter, workers*rounds)
+	}
+	if store.Len() != 2 {
+		t.Fatalf("store holds %v, want busy and counter only", store.Keys())
+	}
+
+	store.Reset()
+	if store.Len() != 0 {
+		t.Fatalf("Reset left %d keys", store.Len())
+	}
+}
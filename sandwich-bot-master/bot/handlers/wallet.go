@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"bot/models"
+	"bot/utils"
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"log"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+var ErrWalletKeyMissing = errors.New("wallet has no key material")
+
+// walletPrivateKey opens the wallet key. The result must only live for a single signature.
+func walletPrivateKey(wallet models.Wallet) (*ecdsa.PrivateKey, error) {
+	if wallet.SealedKey != nil && wallet.WrappedKey != nil && wallet.KekID != nil {
+		plain, err := utils.OpenPrivateKey(*wallet.SealedKey, *wallet.WrappedKey, *wallet.KekID)
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			for _i := range plain {
+				plain[_i] = 0
+			}
+		}()
+		return crypto.HexToECDSA(strings.TrimPrefix(string(plain), "0x"))
+	}
+
+	if wallet.PrivateKey != nil && *wallet.PrivateKey != "" {
+		log.Printf("Wallet %d still stores a plaintext key, run the encrypt-wallets command", wallet.ID)
+		return utils.HexToECDSAV2(*wallet.PrivateKey)
+	}
+
+	return nil, ErrWalletKeyMissing
+}
+
+// SignWalletTx signs tx with the signer configured for wallet
+func SignWalletTx(wallet models.Wallet, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	signer, err := NewSigner(wallet)
+	if err != nil {
+		return nil, err
+	}
+	return signer.SignTx(tx, chainID)
+}
+
+// WalletTransactor builds TransactOpts for contract bindings that sign through the wallet signer
+func WalletTransactor(wallet models.Wallet, chainID *big.Int) (*bind.TransactOpts, error) {
+	signer, err := NewSigner(wallet)
+	if err != nil {
+		return nil, err
+	}
+	from := signer.Address()
+
+	return &bind.TransactOpts{
+		From: from,
+		Signer: func(address common.Address, tx *types.Transaction) (*types.Transaction, error) {
+			if address != from {
+				return nil, bind.ErrNotAuthorized
+			}
+			return signer.SignTx(tx, chainID)
+		},
+		Context: context.Background(),
+	}, nil
+}
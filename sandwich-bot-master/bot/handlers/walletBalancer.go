@@ -1,8 +1,347 @@
 package handlers
 
+import (
+	"bot/config"
+	"bot/controllers"
+	"bot/models"
+	"bot/utils"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"time"
 
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/shopspring/decimal"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
 
+// Balancer keeps main wallets under withdrawal_threshold. Coins listed in config.StableCoins are
+// valued 1:1 in USD and are the only ones swept, MATIC is valued at the last known price.
 
+var ErrSweepBalance = errors.New("wallet balance no longer covers the sweep")
 
+func RunWalletBalancer(ctx context.Context) error {
+	return utils.Every(ctx, config.SweepCheckInterval, func() {
+		if err := CheckWalletBalances(); err != nil {
+			log.Printf("Wallet balancer: %v", err)
+		}
+		if KillSwitchOn() {
+			return
+		}
+		if err := ProposeSweeps(); err != nil {
+			log.Printf("Wallet balancer: %v", err)
+		}
+	})
+}
 
+func loadERC20ABI() (abi.ABI, error) {
+	p := Polygon{}
+	erc20ContractABIString, err := p.LoadABI("erc20")
+	if err != nil {
+		return abi.ABI{}, err
+	}
+	return abi.JSON(strings.NewReader(erc20ContractABIString))
+}
 
+// ProposeSweeps records a sweep proposal for every main wallet whose USD value exceeds
+// withdrawal_threshold. Only the excess is swept, from the largest coin balance.
+func ProposeSweeps() error {
+	settings := GlobalSettings()
+	threshold := settings.Polygon.Settings.WithdrawalThreshold
+	if threshold.LessThanOrEqual(decimal.Zero) {
+		return nil
+	}
+	if len(settings.Polygon.Wallets.Withdrawal) == 0 {
+		return errors.New("no withdrawal wallet is set up")
+	}
+	withdrawalWallet := settings.Polygon.Wallets.Withdrawal[0]
+
+	if err := controllers.DB.Model(&models.Sweep{}).
+		Where("status IN ? AND updated_at < ?", []models.SweepStatusType{models.SweepProposed, models.SweepRequested}, time.Now().Add(-config.SweepRequestTTL)).
+		Update("status", models.SweepExpired).Error; err != nil {
+		return err
+	}
+
+	client, err := supportClient()
+	if err != nil {
+		return err
+	}
+
+	erc20ABI, err := loadERC20ABI()
+	if err != nil {
+		return err
+	}
+
+	for _, _wallet := range settings.Polygon.Wallets.Main {
+		if IsWalletRotating(*_wallet.Address) {
+			continue
+		}
+
+		var open int64
+		if err := controllers.DB.Model(&models.Sweep{}).
+			Where("wallet_id = ? AND status IN ?", _wallet.ID, []models.SweepStatusType{models.SweepProposed, models.SweepRequested, models.SweepSending}).
+			Count(&open).Error; err != nil {
+			return err
+		}
+		if open > 0 {
+			continue
+		}
+
+		if err := proposeSweep(client, erc20ABI, _wallet, withdrawalWallet, threshold); err != nil {
+			log.Printf("Wallet balancer: wallet %s: %v", *_wallet.Address, err)
+		}
+	}
+	return nil
+}
+
+// CheckWalletBalances reports main wallets that hold too little MATIC to pay for gas, once per
+// EventRepeatAfter while it lasts
+func CheckWalletBalances() error {
+	client, err := supportClient()
+	if err != nil {
+		return err
+	}
+
+	for _, _wallet := range GlobalSettings().Polygon.Wallets.Main {
+		balance, err := client.BalanceAt(context.Background(), common.HexToAddress(*_wallet.Address), nil)
+		if err != nil {
+			return fmt.Errorf("failed to get balance of %s: %w", *_wallet.Address, err)
+		}
+		if matic := decimal.NewFromBigInt(balance, -18); matic.LessThan(config.WalletMinGasBalance) {
+			publishWalletBalanceLow(*_wallet.Address, matic)
+		}
+	}
+	return nil
+}
+
+func proposeSweep(client *ethclient.Client, erc20ABI abi.ABI, wallet, withdrawalWallet models.Wallet, threshold decimal.Decimal) error {
+	walletAddress := common.HexToAddress(*wallet.Address)
+
+	total := decimal.Zero
+	// without a fresh MATIC price only coins are counted
+	if maticPrice, err := PriceUSD("matic-network"); err != nil {
+		log.Printf("Wallet balancer: MATIC is not valued: %v", err)
+	} else {
+		balance, err := client.BalanceAt(context.Background(), walletAddress, nil)
+		if err != nil {
+			return err
+		}
+		total = total.Add(decimal.NewFromBigInt(balance, -18).Mul(maticPrice))
+	}
+
+	var largestName, largestAddress string
+	var largestDecimals int32
+	largest := decimal.Zero
+	for _coinName, _coinData := range GlobalSettings().Polygon.Coins {
+		_coinAddress := _coinData[0].(string)
+		_decimals := _coinData[1].(int32)
+		if !isStableCoin(_coinAddress) {
+			continue
+		}
+
+		balance, err := NewERC20Token(common.HexToAddress(_coinAddress), client, erc20ABI, &_decimals).BalanceOf(walletAddress)
+		if err != nil {
+			return fmt.Errorf("failed to get %s balance: %w", _coinName, err)
+		}
+		if len(balance) == 0 {
+			continue
+		}
+
+		coinValue := decimal.NewFromBigInt(balance[0].(*big.Int), -_decimals)
+		total = total.Add(coinValue)
+		if coinValue.GreaterThan(largest) {
+			largest, largestName, largestAddress, largestDecimals = coinValue, _coinName, _coinAddress, _decimals
+		}
+	}
+
+	if total.LessThanOrEqual(threshold) || largest.IsZero() {
+		return nil
+	}
+
+	usdValue := decimal.Min(total.Sub(threshold), largest)
+	amount := usdValue.Shift(largestDecimals).BigInt()
+	if amount.Sign() == 0 {
+		return nil
+	}
+
+	uid := make([]byte, 8)
+	if _, err := rand.Read(uid); err != nil {
+		return err
+	}
+	_amount := amount.String()
+	sweep := models.Sweep{
+		BlockchainID:   wallet.BlockchainID,
+		Uid:            "swp-" + hex.EncodeToString(uid),
+		WalletID:       &wallet.ID,
+		ToWalletID:     &withdrawalWallet.ID,
+		Token:          &largestAddress,
+		TokenName:      largestName,
+		Amount:         &_amount,
+		UsdValue:       usdValue,
+		WalletUsdValue: total,
+		Status:         models.SweepProposed,
+	}
+	if err := controllers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&sweep).Error; err != nil {
+			return err
+		}
+		return publishSweepProposed(tx, sweep, *wallet.Address, *withdrawalWallet.Address)
+	}); err != nil {
+		return err
+	}
+
+	log.Printf("Sweep %s proposed: %s %s from %s, wallet holds $%s", sweep.Uid, usdValue, largestName, *wallet.Address, total)
+	return nil
+}
+
+func failSweep(sweep *models.Sweep, err error) error {
+	errMessage := err.Error()
+	if dbErr := controllers.DB.Model(sweep).Updates(map[string]interface{}{
+		"status": models.SweepFailed,
+		"error":  errMessage,
+	}).Error; dbErr != nil {
+		log.Printf("Failed to record sweep %s failure: %v", sweep.Uid, dbErr)
+	}
+	return err
+}
+
+// SendSweep signs an approved sweep, records it and broadcasts it
+func SendSweep(sweepID uint) error {
+	var sweep models.Sweep
+	if err := controllers.DB.Preload("Wallet").Preload("ToWallet").First(&sweep, sweepID).Error; err != nil {
+		return err
+	}
+	if sweep.Status != models.SweepRequested || sweep.ApprovedBy == nil {
+		return fmt.Errorf("sweep %s is %s and cannot be sent", sweep.Uid, sweep.Status)
+	}
+
+	client, err := supportClient()
+	if err != nil {
+		return err
+	}
+
+	erc20ABI, err := loadERC20ABI()
+	if err != nil {
+		return failSweep(&sweep, err)
+	}
+
+	amount, ok := new(big.Int).SetString(*sweep.Amount, 10)
+	if !ok {
+		return failSweep(&sweep, fmt.Errorf("malformed sweep amount %s", *sweep.Amount))
+	}
+
+	erc20Token := NewERC20Token(common.HexToAddress(*sweep.Token), client, erc20ABI, nil)
+	balance, err := erc20Token.BalanceOf(common.HexToAddress(*sweep.Wallet.Address))
+	if err != nil {
+		return err
+	}
+	if len(balance) == 0 || balance[0].(*big.Int).Cmp(amount) < 0 {
+		return failSweep(&sweep, ErrSweepBalance)
+	}
+
+	auth, err := WalletTransactor(*sweep.Wallet, CHAIN_ID)
+	if err != nil {
+		return failSweep(&sweep, err)
+	}
+	auth.NoSend = true
+	// the sweep stays requested until a gas estimate is available
+	if err := withOracleGas(auth); err != nil {
+		return err
+	}
+	nonces, err := ReserveNonces(*sweep.Wallet.Address, 1, "sweep")
+	if err != nil {
+		return err
+	}
+	auth.Nonce = new(big.Int).SetUint64(nonces[0])
+	tx, err := erc20Token.Transfer(common.HexToAddress(*sweep.ToWallet.Address), amount, auth)
+	if err != nil {
+		ReleaseNonce(*sweep.Wallet.Address, nonces[0])
+		return failSweep(&sweep, err)
+	}
+
+	// recorded first, a restart waits for this exact transaction instead of sending another one
+	rawTx, err := EncodeRawTx(tx)
+	if err != nil {
+		ReleaseNonce(*sweep.Wallet.Address, nonces[0])
+		return failSweep(&sweep, err)
+	}
+	hash := tx.Hash().Hex()
+	if err := controllers.DB.Model(&sweep).Updates(map[string]interface{}{
+		"status": models.SweepSending,
+		"hash":   hash,
+		"raw_tx": rawTx,
+	}).Error; err != nil {
+		ReleaseNonce(*sweep.Wallet.Address, nonces[0])
+		return err
+	}
+	sweep.RawTx = &rawTx
+	MarkNonceSent(*sweep.Wallet.Address, nonces[0], hash)
+	TrackOutbound(tx, *sweep.Wallet.Address, "sweep")
+
+	if err := client.SendTransaction(context.Background(), tx); err != nil {
+		log.Printf("Failed to send sweep %s, it is retried while awaiting: %v", sweep.Uid, err)
+	}
+
+	return awaitSweep(client, &sweep)
+}
+
+func awaitSweep(client *ethclient.Client, sweep *models.Sweep) error {
+	receipt, err := AwaitRecordedTx(client, *sweep.RawTx)
+	if err != nil {
+		return err
+	}
+
+	receiptJSON, err := json.Marshal(receipt)
+	if err != nil {
+		return err
+	}
+	_receipt := datatypes.JSON(receiptJSON)
+
+	status := models.SweepConfirmed
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		status = models.SweepFailed
+	}
+	if err := controllers.DB.Model(sweep).Updates(map[string]interface{}{
+		"status":  status,
+		"receipt": &_receipt,
+	}).Error; err != nil {
+		return err
+	}
+
+	log.Printf("Sweep %s %s in %s", sweep.Uid, status, receipt.TxHash.Hex())
+	return nil
+}
+
+// ResumeSweeps waits for sweeps that were sent before a restart
+func ResumeSweeps() {
+	var sweeps []models.Sweep
+	if err := controllers.DB.Find(&sweeps, "status = ? AND raw_tx IS NOT NULL", models.SweepSending).Error; err != nil {
+		log.Printf("Failed to retrieve pending sweeps: %v", err)
+		return
+	}
+	if len(sweeps) == 0 {
+		return
+	}
+
+	client, err := supportClient()
+	if err != nil {
+		log.Printf("Failed to resume sweeps: %v", err)
+		return
+	}
+
+	for _, _sweep := range sweeps {
+		if err := awaitSweep(client, &_sweep); err != nil {
+			log.Printf("Sweep %s is still pending: %v", _sweep.Uid, err)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package interfaces
+
+import (
+	"bot/controllers"
+	"bot/handlers"
+	"bot/models"
+	"bot/types"
+	"bot/utils"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+func RetrieveAllowances(_data []byte) (int, interface{}, string, error) {
+	var payload types.RetrieveAllowancesReqType
+
+	if err := utils.Parse(_data, &payload); err != nil {
+		return http.StatusBadRequest, nil, "", err
+	}
+
+	query := controllers.DB.Preload("Wallet").Model(&models.Allowance{}).
+		Where("amount <> '0'").Order("stale DESC, id")
+	if payload.Stale != nil {
+		query = query.Where("stale = ?", *payload.Stale == 1)
+	}
+	if payload.Address != nil {
+		query = query.Joins("JOIN bot_wallets ON bot_wallets.id = bot_allowances.wallet_id").
+			Where("bot_wallets.address = ?", strings.ToLower(*payload.Address))
+	}
+	limit := payload.Limit
+	if limit <= 0 {
+		limit = 20
+	}
+
+	var allowances []models.Allowance
+	if err := query.Limit(limit).Offset(payload.Offset).Find(&allowances).Error; err != nil {
+		return http.StatusInternalServerError, nil, "", err
+	}
+
+	stale := 0
+	for _, _allowance := range allowances {
+		if _allowance.Stale {
+			stale++
+		}
+	}
+
+	return http.StatusOK, allowances, fmt.Sprintf("%d allowances, %d stale.", len(allowances), stale), nil
+}
+
+// CheckAllowances re-reads allowances from chain in the background
+func CheckAllowances(_data []byte) (int, interface{}, string, error) {
+	var payload types.UserRequiredType
+
+	if err := utils.Parse(_data, &payload); err != nil {
+		return http.StatusBadRequest, nil, "", err
+	}
+
+	go func() {
+		if err := handlers.CheckAllowances(); err != nil {
+			log.Printf("Allowance check failed: %v", err)
+		}
+	}()
+
+	return http.StatusAccepted, nil, "Allowance check started.", nil
+}
+
+// RevokeAllowances revokes the selected allowances, or every stale one
+func RevokeAllowances(_data []byte) (int, interface{}, string, error) {
+	var payload types.RevokeAllowancesReqType
+
+	if err := utils.Parse(_data, &payload); err != nil {
+		return http.StatusBadRequest, nil, "", err
+	}
+
+	if handlers.KillSwitchOn() {
+		return http.StatusConflict, nil, "", handlers.ErrKillSwitchOn
+	}
+
+	query := controllers.DB.Model(&models.Allowance{}).Where("amount <> '0'")
+	switch {
+	case payload.AllStale:
+		query = query.Where("stale = true")
+	case len(payload.AllowanceIDs) > 0:
+		query = query.Where("id IN ?", payload.AllowanceIDs)
+	default:
+		return http.StatusBadRequest, nil, "", errors.New("Select allowances to revoke or set all_stale")
+	}
+
+	var ids []uint
+	if err := query.Pluck("id", &ids).Error; err != nil {
+		return http.StatusInternalServerError, nil, "", err
+	}
+	if len(ids) == 0 {
+		return http.StatusNotFound, nil, "", errors.New("No allowances to revoke")
+	}
+
+	// revokes of one wallet share its nonce, they are sent one after another
+	go func() {
+		for _, _id := range ids {
+			if err := handlers.RevokeAllowance(_id); err != nil {
+				log.Printf("Failed to revoke allowance %d: %v", _id, err)
+			}
+		}
+	}()
+
+	return http.StatusAccepted, ids, fmt.Sprintf("Revoking %d allowances.", len(ids)), nil
+}
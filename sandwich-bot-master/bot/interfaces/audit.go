@@ -0,0 +1,82 @@
+package interfaces
+
+import (
+	"bot/controllers"
+	"bot/handlers"
+	"bot/models"
+	"bot/types"
+	"bot/utils"
+	"common/audit"
+	"fmt"
+	"net/http"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// rows of one CSV export, newest first
+const auditExportLimit = 10000
+
+func auditQuery(payload types.RetrieveAuditLogReqType) *gorm.DB {
+	query := controllers.DB.Model(&models.AuditEntry{})
+	if payload.AuditUserID != nil {
+		query = query.Where("user_id = ?", *payload.AuditUserID)
+	}
+	if payload.Action != nil && *payload.Action != "" {
+		query = query.Where("action = ?", *payload.Action)
+	}
+	return query
+}
+
+// RetrieveAuditLog lists audit entries newest first, filtered by audit_user_id and action
+func RetrieveAuditLog(_data []byte) (int, interface{}, string, error) {
+	var payload types.RetrieveAuditLogReqType
+
+	if err := utils.Parse(_data, &payload); err != nil {
+		return http.StatusBadRequest, nil, "", err
+	}
+
+	var entries []models.AuditEntry
+	if err := auditQuery(payload).Order("id DESC").Limit(payload.Limit).Offset(payload.Offset).Find(&entries).Error; err != nil {
+		return http.StatusInternalServerError, nil, "", err
+	}
+
+	return http.StatusOK, entries, "", nil
+}
+
+func VerifyAuditLog(_data []byte) (int, interface{}, string, error) {
+	verification, err := handlers.VerifyAuditLog()
+	if err != nil {
+		return http.StatusInternalServerError, nil, "", err
+	}
+
+	return http.StatusOK, verification, "", nil
+}
+
+// ExportAuditLog answers with the filtered audit entries as CSV, oldest first
+func ExportAuditLog(_data []byte) (int, interface{}, string, error) {
+	var payload types.RetrieveAuditLogReqType
+
+	if err := utils.Parse(_data, &payload); err != nil {
+		return http.StatusBadRequest, nil, "", err
+	}
+
+	var entries []audit.Entry
+	if err := auditQuery(payload).Order("id DESC").Limit(auditExportLimit).Find(&entries).Error; err != nil {
+		return http.StatusInternalServerError, nil, "", err
+	}
+	for _i, _j := 0, len(entries)-1; _i < _j; _i, _j = _i+1, _j-1 {
+		entries[_i], entries[_j] = entries[_j], entries[_i]
+	}
+
+	content, err := audit.CSV(entries)
+	if err != nil {
+		return http.StatusInternalServerError, nil, "", err
+	}
+
+	return http.StatusOK, &utils.File{
+		Name:        fmt.Sprintf("bot_audit_log_%s.csv", time.Now().UTC().Format("20060102T150405Z")),
+		ContentType: "text/csv",
+		Content:     content,
+	}, "", nil
+}
@@ -0,0 +1,42 @@
+package interfaces
+
+import (
+	"bot/handlers"
+	"bot/types"
+	"bot/utils"
+	"net/http"
+)
+
+// ClaimEvents leases pending outbox events to telegram, every claimed event has to be acknowledged
+func ClaimEvents(_data []byte) (int, interface{}, string, error) {
+	var payload types.ClaimEventsReqType
+
+	if err := utils.Parse(_data, &payload); err != nil {
+		return http.StatusBadRequest, nil, "", err
+	}
+
+	events, err := handlers.ClaimEvents(payload.Limit)
+	if err != nil {
+		return http.StatusInternalServerError, nil, "", err
+	}
+
+	return http.StatusOK, events, "", nil
+}
+
+func AckEvents(_data []byte) (int, interface{}, string, error) {
+	var payload types.AckEventsReqType
+
+	if err := utils.Parse(_data, &payload); err != nil {
+		return http.StatusBadRequest, nil, "", err
+	}
+
+	failed := map[uint]string{}
+	for _, _failure := range payload.Failed {
+		failed[_failure.ID] = _failure.Error
+	}
+	if err := handlers.AckEvents(payload.Delivered, failed); err != nil {
+		return http.StatusInternalServerError, nil, "", err
+	}
+
+	return http.StatusOK, nil, "", nil
+}
@@ -0,0 +1,33 @@
+package interfaces
+
+import (
+	"bot/config"
+	"bot/handlers"
+	"bot/types"
+	"bot/utils"
+	"net/http"
+	"time"
+)
+
+// RetrieveGas reports the latest base fee and tip tiers with their age
+func RetrieveGas(_data []byte) (int, interface{}, string, error) {
+	var payload types.UserRequiredType
+
+	if err := utils.Parse(_data, &payload); err != nil {
+		return http.StatusBadRequest, nil, "", err
+	}
+
+	estimate, ok := handlers.LastGas()
+	if !ok {
+		return http.StatusServiceUnavailable, nil, "", utils.ErrGasUnavailable
+	}
+
+	age := time.Since(estimate.At)
+	response := types.RetrieveGasRespType{
+		GasEstimate:  estimate,
+		FastGasPrice: estimate.FastGasPrice(),
+		AgeSeconds:   age.Seconds(),
+		Stale:        age > config.GasMaxStaleness,
+	}
+	return http.StatusOK, response, "", nil
+}
@@ -0,0 +1,24 @@
+package interfaces
+
+import (
+	"bot/handlers"
+	"bot/types"
+	"bot/utils"
+	"net/http"
+)
+
+// RetrieveNodePool reports block height, latency and error rate of every RPC node
+func RetrieveNodePool(_data []byte) (int, interface{}, string, error) {
+	var payload types.UserRequiredType
+
+	if err := utils.Parse(_data, &payload); err != nil {
+		return http.StatusBadRequest, nil, "", err
+	}
+
+	status, err := handlers.NodePoolStatus()
+	if err != nil {
+		return http.StatusInternalServerError, nil, "", err
+	}
+
+	return http.StatusOK, status, "", nil
+}
@@ -0,0 +1,99 @@
+package interfaces
+
+import (
+	"bot/handlers"
+	"bot/types"
+	"bot/utils"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// portfolioHistoryHours is the default window of the history and the chart, a week
+const portfolioHistoryHours = 7 * 24
+
+// RetrievePortfolio lists the latest holdings of the wallets, all of them or those of wallet_type or
+// wallet_id, with the change of their total over 24h and 7d
+func RetrievePortfolio(_data []byte) (int, interface{}, string, error) {
+	var payload types.RetrievePortfolioReqType
+
+	if err := utils.Parse(_data, &payload); err != nil {
+		return http.StatusBadRequest, nil, "", err
+	}
+	if payload.WalletType != nil && !payload.WalletType.IsValid() {
+		return http.StatusBadRequest, nil, "", fmt.Errorf("Unsupported wallet type: %v", *payload.WalletType)
+	}
+
+	walletIDs, err := handlers.PortfolioWallets(payload.WalletType, payload.WalletID)
+	if err != nil {
+		return http.StatusInternalServerError, nil, "", err
+	}
+
+	portfolio, err := handlers.Portfolio(walletIDs, time.Now())
+	if err != nil {
+		return http.StatusInternalServerError, nil, "", err
+	}
+	if portfolio.TakenAt == nil {
+		return http.StatusOK, portfolio, "No portfolio snapshot was taken yet", nil
+	}
+
+	return http.StatusOK, portfolio, "", nil
+}
+
+// RetrievePortfolioHistory lists the total USD value of the wallets per snapshot round, oldest first
+func RetrievePortfolioHistory(_data []byte) (int, interface{}, string, error) {
+	payload, walletIDs, code, err := parsePortfolioHistory(_data)
+	if err != nil {
+		return code, nil, "", err
+	}
+
+	points, err := handlers.PortfolioHistory(walletIDs, time.Now().Add(-time.Duration(payload.Hours)*time.Hour))
+	if err != nil {
+		return http.StatusInternalServerError, nil, "", err
+	}
+
+	return http.StatusOK, points, "", nil
+}
+
+// RetrievePortfolioChart answers with the history as PNG line chart
+func RetrievePortfolioChart(_data []byte) (int, interface{}, string, error) {
+	payload, walletIDs, code, err := parsePortfolioHistory(_data)
+	if err != nil {
+		return code, nil, "", err
+	}
+
+	chart, err := handlers.PortfolioChart(walletIDs, time.Now().Add(-time.Duration(payload.Hours)*time.Hour))
+	if err != nil {
+		if errors.Is(err, handlers.ErrPortfolioHistory) {
+			return http.StatusNotFound, nil, "", err
+		}
+		return http.StatusInternalServerError, nil, "", err
+	}
+
+	return http.StatusOK, &utils.File{
+		Name:        fmt.Sprintf("portfolio_%s.png", time.Now().UTC().Format("20060102T150405Z")),
+		ContentType: "image/png",
+		Content:     chart,
+	}, "", nil
+}
+
+func parsePortfolioHistory(_data []byte) (types.RetrievePortfolioHistoryReqType, []uint, int, error) {
+	var payload types.RetrievePortfolioHistoryReqType
+
+	if err := utils.Parse(_data, &payload); err != nil {
+		return payload, nil, http.StatusBadRequest, err
+	}
+	if payload.WalletType != nil && !payload.WalletType.IsValid() {
+		return payload, nil, http.StatusBadRequest, fmt.Errorf("Unsupported wallet type: %v", *payload.WalletType)
+	}
+	if payload.Hours == 0 {
+		payload.Hours = portfolioHistoryHours
+	}
+
+	walletIDs, err := handlers.PortfolioWallets(payload.WalletType, payload.WalletID)
+	if err != nil {
+		return payload, nil, http.StatusInternalServerError, err
+	}
+	return payload, walletIDs, http.StatusOK, nil
+}
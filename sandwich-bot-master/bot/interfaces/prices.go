@@ -0,0 +1,19 @@
+package interfaces
+
+import (
+	"bot/handlers"
+	"bot/types"
+	"bot/utils"
+	"net/http"
+)
+
+// RetrievePrices lists the latest median USD prices of the oracle
+func RetrievePrices(_data []byte) (int, interface{}, string, error) {
+	var payload types.UserRequiredType
+
+	if err := utils.Parse(_data, &payload); err != nil {
+		return http.StatusBadRequest, nil, "", err
+	}
+
+	return http.StatusOK, handlers.PriceQuotes(), "", nil
+}
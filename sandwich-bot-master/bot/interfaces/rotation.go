@@ -0,0 +1,215 @@
+package interfaces
+
+import (
+	"bot/controllers"
+	"bot/handlers"
+	"bot/models"
+	"bot/types"
+	"bot/utils"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"gorm.io/gorm"
+)
+
+var ErrRotationUnfinished = errors.New("Wallet already has an unfinished rotation")
+
+func runWalletRotation(rotation models.WalletRotation) {
+	go func() {
+		if err := handlers.RunWalletRotation(rotation.ID); err != nil {
+			log.Printf("Wallet rotation %s did not complete: %v", rotation.Uid, err)
+		}
+	}()
+}
+
+// RotateWallet registers a new wallet, inactive until every balance has been moved to it,
+// and starts a rotation job away from the currently active one
+func RotateWallet(_data []byte) (int, interface{}, string, error) {
+	var payload types.RotateWalletReqType
+
+	if err := utils.Parse(_data, &payload); err != nil {
+		return http.StatusBadRequest, nil, "", err
+	}
+
+	if handlers.KillSwitchOn() {
+		return http.StatusConflict, nil, "", handlers.ErrKillSwitchOn
+	}
+
+	if !payload.WalletType.IsValid() {
+		return http.StatusBadRequest, nil, "", fmt.Errorf("Unsupported wallet type: %v", *payload.WalletType)
+	}
+
+	signerType := models.LocalSigner
+	if payload.SignerType != nil {
+		signerType = *payload.SignerType
+	}
+	if signerType == models.LocalSigner {
+		if payload.PrivateKey == nil {
+			privateKey, err := crypto.GenerateKey()
+			if err != nil {
+				return http.StatusInternalServerError, nil, "", err
+			}
+			_privateKey := hex.EncodeToString(crypto.FromECDSA(privateKey))
+			payload.PrivateKey = &_privateKey
+		}
+
+		privateKey, err := utils.HexToECDSAV2(*payload.PrivateKey)
+		if err != nil {
+			return http.StatusBadRequest, nil, "Incorrect or malformed private key provided", err
+		}
+		keyAddress := crypto.PubkeyToAddress(privateKey.PublicKey).Hex()
+		if payload.Address != nil && !strings.EqualFold(*payload.Address, keyAddress) {
+			return http.StatusBadRequest, nil, "", errors.New("Private key does not belong to the given address")
+		}
+		payload.Address = &keyAddress
+	}
+	if payload.Address == nil {
+		return http.StatusBadRequest, nil, "", fmt.Errorf("address is required for a %s signer", signerType)
+	}
+
+	_address := strings.ToLower(*payload.Address)
+	_false := false
+	newWallet := models.Wallet{
+		ModelExtended: models.ModelExtended{
+			UpdatedBy: payload.UserID,
+			CreatedBy: payload.UserID,
+		},
+		BlockchainID: models.BlockchainID{
+			BlockchainID: utils.IntToUint(1),
+		},
+		Active: models.Active{
+			Active: &_false,
+		},
+		Type:       payload.WalletType,
+		Name:       payload.Name,
+		Address:    &_address,
+		SignerType: &signerType,
+		SignerURI:  payload.SignerURI,
+	}
+	if status, err := setWalletSigner(&newWallet, payload.PrivateKey); err != nil {
+		return status, nil, "", err
+	}
+
+	uid := make([]byte, 8)
+	if _, err := rand.Read(uid); err != nil {
+		return http.StatusInternalServerError, nil, "", err
+	}
+
+	var rotation models.WalletRotation
+	if err := controllers.DB.Transaction(func(tx *gorm.DB) error {
+		var oldWallet models.Wallet
+		query := tx.Where("active = ? AND type = ?", true, *payload.WalletType)
+		if payload.OldAddress != nil {
+			query = query.Where("address = ?", strings.ToLower(*payload.OldAddress))
+		} else {
+			var active int64
+			if err := tx.Model(&models.Wallet{}).Where("active = ? AND type = ?", true, *payload.WalletType).Count(&active).Error; err != nil {
+				return err
+			}
+			if active > 1 {
+				return fmt.Errorf("%d active %s wallets, old_address is required", active, *payload.WalletType)
+			}
+		}
+		if err := query.First(&oldWallet).Error; err != nil {
+			return err
+		}
+
+		var unfinished int64
+		if err := tx.Model(&models.WalletRotation{}).
+			Where("(old_wallet_id = ? OR new_wallet_id = ?) AND step <> ?", oldWallet.ID, oldWallet.ID, models.RotationCompleted).
+			Count(&unfinished).Error; err != nil {
+			return err
+		}
+		if unfinished > 0 {
+			return ErrRotationUnfinished
+		}
+
+		// key material is stored before any funds move towards it
+		if err := tx.Create(&newWallet).Error; err != nil {
+			return err
+		}
+
+		rotation = models.WalletRotation{
+			ModelExtended: models.ModelExtended{
+				UpdatedBy: payload.UserID,
+				CreatedBy: payload.UserID,
+			},
+			BlockchainID: oldWallet.BlockchainID,
+			Uid:          "rot-" + hex.EncodeToString(uid),
+			Type:         payload.WalletType,
+			OldWalletID:  &oldWallet.ID,
+			NewWalletID:  &newWallet.ID,
+			Step:         models.RotationRevoking,
+		}
+		return tx.Create(&rotation).Error
+	}); err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return http.StatusNotFound, nil, "", fmt.Errorf("No active %s wallet to rotate", *payload.WalletType)
+		case errors.Is(err, ErrRotationUnfinished):
+			return http.StatusConflict, nil, "", err
+		}
+		return http.StatusInternalServerError, nil, "", err
+	}
+
+	runWalletRotation(rotation)
+
+	return http.StatusAccepted, rotation, fmt.Sprintf("Rotation %s started, %s wallet moves to %s", rotation.Uid, *payload.WalletType, *newWallet.Address), nil
+}
+
+func RetrieveWalletRotation(_data []byte) (int, interface{}, string, error) {
+	var payload types.WalletRotationReqType
+
+	if err := utils.Parse(_data, &payload); err != nil {
+		return http.StatusBadRequest, nil, "", err
+	}
+
+	var rotation models.WalletRotation
+	if err := controllers.DB.Preload("OldWallet").Preload("NewWallet").First(&rotation, "uid = ?", *payload.RotationID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return http.StatusNotFound, nil, "", errors.New("Wallet rotation not found")
+		}
+		return http.StatusInternalServerError, nil, "", err
+	}
+
+	message := fmt.Sprintf("Rotation %s is at %s", rotation.Uid, rotation.Step)
+	if rotation.Error != nil {
+		message += fmt.Sprintf("\nLast error: %s", *rotation.Error)
+	}
+
+	return http.StatusOK, rotation, message, nil
+}
+
+// ResumeWalletRotation restarts a rotation that stopped on an error
+func ResumeWalletRotation(_data []byte) (int, interface{}, string, error) {
+	var payload types.WalletRotationReqType
+
+	if err := utils.Parse(_data, &payload); err != nil {
+		return http.StatusBadRequest, nil, "", err
+	}
+
+	if handlers.KillSwitchOn() {
+		return http.StatusConflict, nil, "", handlers.ErrKillSwitchOn
+	}
+
+	var rotation models.WalletRotation
+	if err := controllers.DB.First(&rotation, "uid = ?", *payload.RotationID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return http.StatusNotFound, nil, "", errors.New("Wallet rotation not found")
+		}
+		return http.StatusInternalServerError, nil, "", err
+	}
+	if rotation.Step == models.RotationCompleted {
+		return http.StatusConflict, nil, "", errors.New("Wallet rotation is already completed")
+	}
+
+	runWalletRotation(rotation)
+
+	return http.StatusAccepted, rotation, fmt.Sprintf("Rotation %s resumed at %s", rotation.Uid, rotation.Step), nil
+}
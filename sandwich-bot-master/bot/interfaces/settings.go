@@ -1,6 +1,7 @@
 package interfaces
 
 import (
+	"bot/config"
 	"bot/controllers"
 	"bot/handlers"
 	"bot/models"
@@ -10,9 +11,11 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
-	"reflect"
+	"sort"
 	"strings"
 
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 )
@@ -21,72 +24,61 @@ func UpdateSettings(_data []byte) (int, interface{}, string, error) {
 	var payload types.UpdateSettingsReqType
 
 	if err := utils.Parse(_data, &payload); err != nil {
-		return http.StatusBadGateway, nil, "", err
+		return http.StatusBadRequest, nil, "", err
+	}
+	if err := json.Unmarshal(_data, &payload.Settings); err != nil {
+		return http.StatusBadRequest, nil, "", err
+	}
+	delete(payload.Settings, "user_id")
+	if len(payload.Settings) == 0 {
+		return http.StatusBadRequest, nil, "", errors.New("No settings to update")
 	}
-	var err error
-
-	// Fetch the latest record from the database
 
-	message := ""
-	if err = controllers.DB.Transaction(func(tx *gorm.DB) error {
-		var settingsObj models.Settings
-		if err = tx.First(&settingsObj, "active = ?", true).Error; err != nil {
-			return err
+	updates := map[string]interface{}{}
+	var updatedFields []string
+	for _key, _raw := range payload.Settings {
+		value, err := config.ParseSetting(_key, _raw)
+		if err != nil {
+			return http.StatusBadRequest, nil, "", err
 		}
+		updates[_key] = value
+		field, _ := config.SettingFieldByKey(_key)
+		updatedFields = append(updatedFields, field.Title)
+	}
+	sort.Strings(updatedFields)
 
-		if err = controllers.DB.Model(&models.Settings{}).Where("active = ?", true).Update("active", false).Error; err != nil {
+	var blockchainID uint
+	if err := controllers.DB.Transaction(func(tx *gorm.DB) error {
+		var settingsObj models.Settings
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&settingsObj, "active = ?", true).Error; err != nil {
 			return err
 		}
 
 		settingsMap := map[string]interface{}{}
-		if err = json.Unmarshal(settingsObj.Settings, &settingsMap); err != nil {
+		if err := json.Unmarshal(settingsObj.Settings, &settingsMap); err != nil {
 			return err
 		}
 
-		// fmt.Println("FIRST", settingsMap)
-
-		delete(settingsMap, "user_id")
-
-		var updatedFieldSlice []string
-		// var updatedFieldNewValue interface{}
-		plType := reflect.TypeOf(payload)
-		plValue := reflect.ValueOf(payload)
-		for i := 0; i < plType.NumField(); i++ {
-			field := plType.Field(i)
-			jsonTag := field.Tag.Get("json")
-			jsonTag = strings.TrimSuffix(jsonTag, ",omitempty") // Remove 'omitempty' from the tag
-			fmt.Println(jsonTag)
-			if jsonTag != "user_id" {
-				fieldValue := plValue.FieldByName(field.Name)
-
-				// if jsonTag == "exit_gas" {
-
-				// 	log.Println(fieldValue.IsValid())
-				// 	log.Println(fieldValue.Kind())
-				// 	log.Println(fieldValue.Kind() == reflect.Ptr)
-				// 	log.Println(fieldValue.Kind() == reflect.Slice)
-				// 	log.Println(fieldValue.Kind() == reflect.Map)
-				// 	log.Println(fieldValue.Kind() == reflect.Interface)
-				// 	log.Println(fieldValue.Kind() == reflect.Chan)
-				// 	log.Println(fieldValue.Kind() == reflect.Func)
-				// 	log.Println(!fieldValue.IsNil())
-				// 	log.Println(jsonTag)
-				// 	log.Println("AAA", fieldValue)
-				// }
-
-				if fieldValue.IsValid() && ((fieldValue.Kind() == reflect.Ptr || fieldValue.Kind() == reflect.Slice || fieldValue.Kind() == reflect.Map || fieldValue.Kind() == reflect.Interface || fieldValue.Kind() == reflect.Chan || fieldValue.Kind() == reflect.Func) && !fieldValue.IsNil()) {
-					settingsMap[jsonTag] = fieldValue.Interface()
-					updatedFieldSlice = strings.Split(jsonTag, "_")
-					// updatedFieldNewValue = fieldValue.Interface()
-				}
-
+		// keys the schema does not know are dropped, missing ones fall back to defaults
+		merged := config.SettingsDefaults()
+		for _key := range merged {
+			if value, ok := settingsMap[_key]; ok {
+				merged[_key] = value
 			}
 		}
+		for _key, _value := range updates {
+			merged[_key] = _value
+		}
+		if err := config.ValidateSettings(merged); err != nil {
+			return err
+		}
 
-		message = fmt.Sprintf("%s has been updated.", strings.Title(strings.Join(updatedFieldSlice, " ")))
+		settingsByte, err := json.Marshal(&merged)
+		if err != nil {
+			return err
+		}
 
-		var settingsByte []byte
-		if settingsByte, err = json.Marshal(&settingsMap); err != nil {
+		if err := tx.Model(&models.Settings{}).Where("id = ?", settingsObj.ID).Update("active", false).Error; err != nil {
 			return err
 		}
 
@@ -100,24 +92,29 @@ func UpdateSettings(_data []byte) (int, interface{}, string, error) {
 			},
 			BlockchainID: settingsObj.BlockchainID,
 		}
+		blockchainID = *settingsObj.BlockchainID
 
-		// fmt.Println("SECOND", settingsMap)
-
-		if err = controllers.DB.Debug().Create(&newSettings).Error; err != nil {
+		if err := tx.Create(&newSettings).Error; err != nil {
 			return err
 		}
-
-		handlers.UpdateGlobalSettings(int(*settingsObj.BlockchainID))
-
-		return nil
+		return handlers.PublishSettingsChanged(tx, settingsObj, newSettings)
 	}); err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return http.StatusNotFound, nil, "", err
 		}
+		return http.StatusBadRequest, nil, "", err
+	}
+
+	if err := handlers.ReloadSettings(int(blockchainID)); err != nil {
 		return http.StatusInternalServerError, nil, "", err
 	}
 
-	return http.StatusCreated, nil, message, nil
+	return http.StatusCreated, nil, fmt.Sprintf("%s has been updated.", strings.Join(updatedFields, ", ")), nil
+}
+
+// RetrieveSettingsSchema publishes type, unit, bounds and default of every setting
+func RetrieveSettingsSchema(_data []byte) (int, interface{}, string, error) {
+	return http.StatusOK, config.SettingsSchema, "", nil
 }
 
 func RetrieveSettings(_data []byte) (int, interface{}, string, error) {
@@ -144,12 +141,6 @@ func CreateWallet(_data []byte) (int, interface{}, string, error) {
 		return http.StatusBadGateway, nil, "", fmt.Errorf("Unsupported wallet type: %v", *payload.WalletType)
 	}
 
-	if _, err := utils.HexToECDSAV2(*payload.PrivateKey); err != nil {
-		return http.StatusBadRequest, nil, "Incorrect or malformed private key provided", err
-	}
-	// else {
-	// 	fmt.Println(_privateKey)
-	// }
 	// non checksummed address to normalize it
 	_address := strings.ToLower(*payload.Address)
 	payload.Address = &_address
@@ -169,20 +160,23 @@ func CreateWallet(_data []byte) (int, interface{}, string, error) {
 		Type:       payload.WalletType,
 		Name:       payload.Name,
 		Address:    payload.Address,
-		PrivateKey: payload.PrivateKey,
+		SignerType: payload.SignerType,
+		SignerURI:  payload.SignerURI,
+	}
+	if status, err := setWalletSigner(&wallet, payload.PrivateKey); err != nil {
+		return status, nil, "", err
 	}
 
-	var err error
 	message := ""
-	if err = controllers.DB.Transaction(func(tx *gorm.DB) error {
-		if err = controllers.DB.Model(&models.Wallet{}).Where("type = ?", payload.WalletType).Update("active", false).Error; err != nil {
+	if err := controllers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := controllers.DB.Model(&models.Wallet{}).Where("type = ?", payload.WalletType).Update("active", false).Error; err != nil {
 			return err
 		}
 
 		if err := controllers.DB.Debug().Clauses(
 			clause.OnConflict{
 				Columns:   []clause.Column{{Name: "address"}},
-				DoUpdates: clause.AssignmentColumns([]string{"private_key", "name", "active"}),
+				DoUpdates: clause.AssignmentColumns([]string{"private_key", "sealed_key", "wrapped_key", "kek_id", "signer_type", "signer_uri", "name", "active"}),
 			}).Create(&wallet).Error; err != nil {
 			return err
 		}
@@ -198,6 +192,48 @@ func CreateWallet(_data []byte) (int, interface{}, string, error) {
 	return http.StatusCreated, nil, message, nil
 }
 
+// setWalletSigner validates how wallet is going to sign. Local keys are sealed onto the wallet,
+// plaintext never reaches the database.
+func setWalletSigner(wallet *models.Wallet, privateKey *string) (int, error) {
+	signerType := models.LocalSigner
+	if wallet.SignerType != nil {
+		signerType = *wallet.SignerType
+	}
+	if !signerType.IsValid() {
+		return http.StatusBadRequest, fmt.Errorf("Unsupported signer type: %v", signerType)
+	}
+	wallet.SignerType = &signerType
+
+	if signerType != models.LocalSigner {
+		if wallet.SignerURI == nil {
+			return http.StatusBadRequest, fmt.Errorf("signer_uri is required for a %s signer", signerType)
+		}
+		if err := handlers.VerifySigner(signerType, *wallet.SignerURI, common.HexToAddress(*wallet.Address)); err != nil {
+			return http.StatusBadRequest, err
+		}
+		return http.StatusOK, nil
+	}
+
+	if privateKey == nil {
+		return http.StatusBadRequest, errors.New("Private key is required for a local signer")
+	}
+	key, err := utils.HexToECDSAV2(*privateKey)
+	if err != nil {
+		return http.StatusBadRequest, fmt.Errorf("Incorrect or malformed private key provided: %w", err)
+	}
+	// owners approved the address, the key has to be the one of that address
+	if !strings.EqualFold(crypto.PubkeyToAddress(key.PublicKey).Hex(), *wallet.Address) {
+		return http.StatusBadRequest, errors.New("Private key does not belong to the given address")
+	}
+	sealedKey, wrappedKey, kekID, err := utils.SealPrivateKey(*privateKey)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	wallet.SealedKey, wallet.WrappedKey, wallet.KekID = &sealedKey, &wrappedKey, &kekID
+
+	return http.StatusOK, nil
+}
+
 func RetrieveWallet(_data []byte) (int, interface{}, string, error) {
 	var payload types.RetrieveWalletReqType
 
@@ -247,18 +283,26 @@ func ToggleKillSwitch(_data []byte) (int, interface{}, string, error) {
 		IsOn: payload.IsOn,
 	}
 
-	if err := controllers.DB.Create(&toggleKillSwitch).Error; err != nil {
+	if err := controllers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&toggleKillSwitch).Error; err != nil {
+			return err
+		}
+		return handlers.PublishEvent(tx, models.KillSwitchEvent, fmt.Sprint(toggleKillSwitch.ID), types.KillSwitchEventType{
+			KillSwitchID: toggleKillSwitch.ID,
+			IsOn:         *payload.IsOn,
+			UserID:       payload.UserID,
+		})
+	}); err != nil {
 		return http.StatusInternalServerError, nil, "", err
 	}
 
-	message := "KillSwitch is"
+	handlers.SetKillSwitch(toggleKillSwitch)
+	handlers.UpdateGlobalSettings(1)
+
+	message := "KillSwitch is off, trading restarts."
 	if *payload.IsOn {
-		message += " on"
-	} else {
-		message += " off"
+		message = "KillSwitch is on, new work is refused and in-flight attacks are draining. A summary follows."
 	}
-
-	handlers.UpdateGlobalSettings(1)
 	return http.StatusOK, nil, message, nil
 }
 
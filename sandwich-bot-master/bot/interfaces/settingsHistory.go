@@ -0,0 +1,204 @@
+package interfaces
+
+import (
+	"bot/config"
+	"bot/controllers"
+	"bot/handlers"
+	"bot/models"
+	"bot/types"
+	"bot/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RetrieveSettingsHistory lists settings versions, newest first, with the fields each one changed
+func RetrieveSettingsHistory(_data []byte) (int, interface{}, string, error) {
+	var payload types.RetrieveSettingsHistoryReqType
+
+	if err := utils.Parse(_data, &payload); err != nil {
+		return http.StatusBadRequest, nil, "", err
+	}
+
+	limit := payload.Limit
+	if limit <= 0 {
+		limit = 10
+	}
+
+	// one extra row to diff the oldest listed version against
+	var versions []models.Settings
+	if err := controllers.DB.Where("blockchain_id = ?", *payload.BlockchainID).
+		Order("id DESC").Limit(limit + 1).Offset(payload.Offset).Find(&versions).Error; err != nil {
+		return http.StatusInternalServerError, nil, "", err
+	}
+
+	history := []types.RetrieveSettingsVersionRespType{}
+	for _i, _version := range versions {
+		if _i == limit {
+			break
+		}
+
+		version := types.RetrieveSettingsVersionRespType{
+			ID:         _version.ID,
+			Active:     _version.Active,
+			RollbackOf: _version.RollbackOf,
+			CreatedAt:  _version.CreatedAt,
+			CreatedBy:  _version.CreatedBy,
+		}
+		if _i+1 < len(versions) {
+			changes, err := handlers.DiffSettings(versions[_i+1].Settings, _version.Settings)
+			if err != nil {
+				return http.StatusInternalServerError, nil, "", err
+			}
+			version.Changes = changes
+		}
+		history = append(history, version)
+	}
+
+	return http.StatusOK, history, "", nil
+}
+
+// DiffSettings compares two settings versions field by field
+func DiffSettings(_data []byte) (int, interface{}, string, error) {
+	var payload types.DiffSettingsReqType
+
+	if err := utils.Parse(_data, &payload); err != nil {
+		return http.StatusBadRequest, nil, "", err
+	}
+
+	var from, to models.Settings
+	if err := controllers.DB.First(&from, payload.FromVersion).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return http.StatusNotFound, nil, "", fmt.Errorf("Settings version %d not found", payload.FromVersion)
+		}
+		return http.StatusInternalServerError, nil, "", err
+	}
+
+	// versions of other chains are not comparable
+	query := controllers.DB.Where("blockchain_id = ?", from.BlockchainID)
+	if payload.ToVersion != 0 {
+		query = query.Where("id = ?", payload.ToVersion)
+	} else {
+		query = query.Where("active = true")
+	}
+	if err := query.First(&to).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return http.StatusNotFound, nil, "", errors.New("Settings version to compare with not found")
+		}
+		return http.StatusInternalServerError, nil, "", err
+	}
+
+	changes, err := handlers.DiffSettings(from.Settings, to.Settings)
+	if err != nil {
+		return http.StatusInternalServerError, nil, "", err
+	}
+
+	return http.StatusOK, changes, fmt.Sprintf("%d fields differ between versions %d and %d.", len(changes), from.ID, to.ID), nil
+}
+
+// rollbackSettings puts an old settings version through the current schema like an update does. A value
+// the schema rejects now fails the whole rollback, keys it does not know are dropped and keys the old
+// version lacks keep their active value
+func rollbackSettings(old, active []byte) ([]byte, error) {
+	var _old, _active map[string]json.RawMessage
+	if err := json.Unmarshal(old, &_old); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(active, &_active); err != nil {
+		return nil, err
+	}
+
+	merged := config.SettingsDefaults()
+	for _key := range merged {
+		if raw, ok := _old[_key]; ok {
+			value, err := config.ParseSetting(_key, raw)
+			if err != nil {
+				return nil, err
+			}
+			merged[_key] = value
+		} else if raw, ok := _active[_key]; ok {
+			// an active value the schema has since tightened falls back to its default
+			if value, err := config.ParseSetting(_key, raw); err == nil {
+				merged[_key] = value
+			}
+		}
+	}
+	if err := config.ValidateSettings(merged); err != nil {
+		return nil, err
+	}
+	return json.Marshal(&merged)
+}
+
+// RollbackSettings restores a prior settings version as a new version
+func RollbackSettings(_data []byte) (int, interface{}, string, error) {
+	var payload types.RollbackSettingsReqType
+
+	if err := utils.Parse(_data, &payload); err != nil {
+		return http.StatusBadRequest, nil, "", err
+	}
+
+	var restored models.Settings
+	if err := controllers.DB.Transaction(func(tx *gorm.DB) error {
+		var target models.Settings
+		if err := tx.First(&target, payload.Version).Error; err != nil {
+			return err
+		}
+
+		var active models.Settings
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			First(&active, "active = true and blockchain_id = ?", target.BlockchainID).Error; err != nil {
+			return err
+		}
+		if active.ID == target.ID {
+			return errors.New("Settings version is already active")
+		}
+
+		settingsByte, err := rollbackSettings(target.Settings, active.Settings)
+		if err != nil {
+			return fmt.Errorf("Settings version %d is not valid anymore: %v", target.ID, err)
+		}
+
+		// an old version that no longer decodes would stop the bot on reload
+		var settings handlers.PolygonSettings
+		if err := json.Unmarshal(settingsByte, &settings); err != nil {
+			return fmt.Errorf("Settings version %d is not valid anymore: %v", target.ID, err)
+		}
+
+		if err := tx.Model(&models.Settings{}).Where("id = ?", active.ID).Update("active", false).Error; err != nil {
+			return err
+		}
+
+		_true := true
+		restored = models.Settings{
+			Active:       &_true,
+			BlockchainID: target.BlockchainID,
+			Settings:     settingsByte,
+			RollbackOf:   &target.ID,
+			ModelExtended: models.ModelExtended{
+				CreatedBy: payload.UserID,
+				UpdatedBy: payload.UserID,
+			},
+		}
+		if err := tx.Create(&restored).Error; err != nil {
+			return err
+		}
+		return handlers.PublishSettingsChanged(tx, active, restored)
+	}); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return http.StatusNotFound, nil, "", err
+		}
+		return http.StatusBadRequest, nil, "", err
+	}
+
+	if err := handlers.ReloadSettings(int(*restored.BlockchainID)); err != nil {
+		log.Printf("Failed to reload settings after rollback: %v", err)
+		return http.StatusInternalServerError, nil, "", err
+	}
+
+	return http.StatusCreated, types.CreateUpdateBotSettingsRespType{ID: restored.ID}, fmt.Sprintf("Settings rolled back to version %d.", payload.Version), nil
+}
@@ -0,0 +1,46 @@
+package interfaces
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+func TestRollbackSettingsKeepsActiveValues(t *testing.T) {
+	// the old version predates deadline and still knows a setting that was dropped since
+	old := `{"gas_limit": 250000, "slippage": 10, "retired_setting": 1}`
+	active := `{"gas_limit": 400000, "slippage": 30, "deadline": 7, "gas_priority": 99999}`
+
+	merged, err := rollbackSettings([]byte(old), []byte(active))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var settings map[string]interface{}
+	if err := json.Unmarshal(merged, &settings); err != nil {
+		t.Fatal(err)
+	}
+
+	// gas_priority is active but over today's maximum, it goes back to its default
+	want := map[string]string{"gas_limit": "250000", "slippage": "10", "deadline": "7", "gas_priority": "30", "gas_fee_max": "500"}
+	for _key, _value := range want {
+		if fmt.Sprint(settings[_key]) != _value {
+			t.Fatalf("%s: want %s, got %v", _key, _value, settings[_key])
+		}
+	}
+	if _, ok := settings["retired_setting"]; ok {
+		t.Fatal("restored a setting the schema no longer knows")
+	}
+}
+
+func TestRollbackSettingsRefusesRejectedValues(t *testing.T) {
+	active := `{"gas_limit": 400000}`
+	for _, _old := range []string{
+		`{"gas_limit": 100}`,
+		`{"deadline": 2.5}`,
+		`{"target_value_min": 2000, "target_value_max": 1000}`,
+	} {
+		if _, err := rollbackSettings([]byte(_old), []byte(active)); err == nil {
+			t.Fatalf("rolled back to %s", _old)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package interfaces
+
+import (
+	"bot/controllers"
+	"bot/handlers"
+	"bot/models"
+	"bot/types"
+	"bot/utils"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrSweepNotFound = errors.New("Sweep not found")
+	ErrSweepClosed   = errors.New("Sweep is no longer waiting for this step")
+	ErrSweepStopped  = errors.New("KillSwitch is on, sweeps are paused")
+)
+
+// RequestSweep links a proposal with the owner approval request created for it
+func RequestSweep(_data []byte) (int, interface{}, string, error) {
+	var payload types.RequestSweepReqType
+
+	if err := utils.Parse(_data, &payload); err != nil {
+		return http.StatusBadRequest, nil, "", err
+	}
+
+	if handlers.KillSwitchOn() {
+		return http.StatusConflict, nil, "", ErrSweepStopped
+	}
+
+	if err := handlers.CheckSweepApproval(context.Background(), *payload.UserID, *payload.RequestID, *payload.SweepID); err != nil {
+		return sweepApprovalError(err)
+	}
+
+	now := time.Now()
+	result := controllers.DB.Model(&models.Sweep{}).
+		Where("uid = ? AND status = ?", *payload.SweepID, models.SweepProposed).
+		Updates(map[string]interface{}{
+			"status":              models.SweepRequested,
+			"approval_request_id": *payload.RequestID,
+			"requested_by":        *payload.UserID,
+			"requested_at":        now,
+		})
+	if result.Error != nil {
+		return http.StatusInternalServerError, nil, "", result.Error
+	}
+	if result.RowsAffected == 0 {
+		return http.StatusConflict, nil, "", ErrSweepClosed
+	}
+
+	return http.StatusOK, nil, fmt.Sprintf("Sweep %s waits for another owner approval.", *payload.SweepID), nil
+}
+
+// ExecuteSweep sends a sweep once its approval request was approved by an owner other than the requester
+func ExecuteSweep(_data []byte) (int, interface{}, string, error) {
+	var payload types.ExecuteSweepReqType
+
+	if err := utils.Parse(_data, &payload); err != nil {
+		return http.StatusBadRequest, nil, "", err
+	}
+
+	if handlers.KillSwitchOn() {
+		return http.StatusConflict, nil, "", ErrSweepStopped
+	}
+
+	var sweep models.Sweep
+	if err := controllers.DB.First(&sweep, "uid = ?", *payload.SweepID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return http.StatusNotFound, nil, "", ErrSweepNotFound
+		}
+		return http.StatusInternalServerError, nil, "", err
+	}
+	if sweep.ApprovalRequestID == nil || *sweep.ApprovalRequestID != *payload.RequestID ||
+		sweep.RequestedBy == nil || *sweep.RequestedBy != *payload.UserID {
+		return http.StatusForbidden, nil, "", handlers.ErrSweepApproval
+	}
+	if sweep.Status != models.SweepRequested || sweep.ApprovedBy != nil {
+		return http.StatusConflict, nil, "", ErrSweepClosed
+	}
+
+	// auth hands out an approval once and only for the sweep it was given for
+	approvedBy, err := handlers.ConsumeSweepApproval(context.Background(), *payload.UserID, *payload.RequestID, sweep.Uid)
+	if err != nil {
+		return sweepApprovalError(err)
+	}
+
+	// the guarded update makes sure a sweep is sent once
+	result := controllers.DB.Model(&models.Sweep{}).
+		Where("id = ? AND status = ? AND approved_by IS NULL", sweep.ID, models.SweepRequested).
+		Update("approved_by", approvedBy)
+	if result.Error != nil {
+		return http.StatusInternalServerError, nil, "", result.Error
+	}
+	if result.RowsAffected == 0 {
+		return http.StatusConflict, nil, "", ErrSweepClosed
+	}
+
+	go func() {
+		if err := handlers.SendSweep(sweep.ID); err != nil {
+			log.Printf("Sweep %s was not sent: %v", sweep.Uid, err)
+		}
+	}()
+
+	return http.StatusAccepted, nil, fmt.Sprintf("Sweep %s of %s %s is being sent.", sweep.Uid, sweep.UsdValue, sweep.TokenName), nil
+}
+
+// sweepApprovalError passes on what auth answered about an approval request
+func sweepApprovalError(err error) (int, interface{}, string, error) {
+	var authErr *handlers.AuthError
+	switch {
+	case errors.Is(err, handlers.ErrSweepApproval), errors.Is(err, handlers.ErrSweepApprover):
+		return http.StatusForbidden, nil, "", err
+	case errors.Is(err, handlers.ErrSweepApprovalClosed):
+		return http.StatusConflict, nil, "", err
+	case errors.As(err, &authErr):
+		return authErr.StatusCode, nil, "", err
+	}
+	return http.StatusBadGateway, nil, "", err
+}
+
+func RetrieveSweeps(_data []byte) (int, interface{}, string, error) {
+	var payload types.RetrieveSweepsReqType
+
+	if err := utils.Parse(_data, &payload); err != nil {
+		return http.StatusBadRequest, nil, "", err
+	}
+
+	query := controllers.DB.Preload("Wallet").Preload("ToWallet").Order("created_at DESC")
+	if payload.Status != nil {
+		if !payload.Status.IsValid() {
+			return http.StatusBadRequest, nil, "", fmt.Errorf("Unsupported sweep status: %v", *payload.Status)
+		}
+		query = query.Where("status = ?", *payload.Status)
+	}
+	limit := payload.Limit
+	if limit <= 0 {
+		limit = 20
+	}
+
+	var sweeps []models.Sweep
+	if err := query.Limit(limit).Offset(payload.Offset).Find(&sweeps).Error; err != nil {
+		return http.StatusInternalServerError, nil, "", err
+	}
+
+	return http.StatusOK, sweeps, "", nil
+}
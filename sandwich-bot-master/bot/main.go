@@ -2,18 +2,20 @@ package main
 
 import (
 	// _ "bot/docs"
-	_ "bot/config"
+	"bot/config"
 	"bot/controllers"
 	"bot/handlers"
 	"bot/interfaces"
 	"bot/middleware"
 	"bot/utils"
+	"context"
 	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
-	"time"
+	"os/signal"
+	"syscall"
 
 	"github.com/gin-gonic/gin"
 )
@@ -21,6 +23,25 @@ import (
 const apiVersion = "v1"
 
 func main() {
+	// an unkeyed chain could be rewritten and hashed again by anyone with database access
+	if config.AuditSecret == "" {
+		log.Fatal("AUDIT_SECRET is not set, refusing to keep an unkeyed audit log")
+	}
+
+	// one-off maintenance commands
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "encrypt-wallets":
+			controllers.ConnectDatabase()
+			encrypted, err := controllers.EncryptWalletKeys()
+			if err != nil {
+				log.Fatalf("Failed to encrypt wallet keys after %d wallets: %v", encrypted, err)
+			}
+			log.Printf("Encrypted %d wallet keys", encrypted)
+			return
+		}
+	}
+
 	r := gin.Default()
 
 	appPort := os.Getenv("APP_PORT")
@@ -49,12 +70,44 @@ func main() {
 		{
 			settings.GET("/retrieve_settings", middleware.Wrapper(interfaces.RetrieveSettings))
 			settings.PATCH("/update_settings", middleware.Wrapper(interfaces.UpdateSettings))
+			settings.GET("/retrieve_settings_schema", middleware.Wrapper(interfaces.RetrieveSettingsSchema))
+			settings.GET("/retrieve_settings_history", middleware.Wrapper(interfaces.RetrieveSettingsHistory))
+			settings.GET("/diff_settings", middleware.Wrapper(interfaces.DiffSettings))
+			settings.PATCH("/rollback_settings", middleware.Wrapper(interfaces.RollbackSettings))
 
 			settings.GET("/retrieve_wallet", middleware.Wrapper(interfaces.RetrieveWallet))
 			settings.PUT("/create_wallet", middleware.Wrapper(interfaces.CreateWallet))
+			settings.PUT("/rotate_wallet", middleware.Wrapper(interfaces.RotateWallet))
+			settings.GET("/retrieve_wallet_rotation", middleware.Wrapper(interfaces.RetrieveWalletRotation))
+			settings.POST("/resume_wallet_rotation", middleware.Wrapper(interfaces.ResumeWalletRotation))
+
+			settings.PATCH("/request_sweep", middleware.Wrapper(interfaces.RequestSweep))
+			settings.POST("/execute_sweep", middleware.Wrapper(interfaces.ExecuteSweep))
+			settings.GET("/retrieve_sweeps", middleware.Wrapper(interfaces.RetrieveSweeps))
+
+			settings.GET("/retrieve_allowances", middleware.Wrapper(interfaces.RetrieveAllowances))
+			settings.POST("/check_allowances", middleware.Wrapper(interfaces.CheckAllowances))
+			settings.POST("/revoke_allowances", middleware.Wrapper(interfaces.RevokeAllowances))
 
 			settings.GET("/retrieve_killswitch", middleware.Wrapper(interfaces.RetrieveKillSwitch))
 			settings.PATCH("/toggle_killswitch", middleware.Wrapper(interfaces.ToggleKillSwitch))
+
+			settings.GET("/retrieve_node_pool", middleware.Wrapper(interfaces.RetrieveNodePool))
+			settings.GET("/retrieve_prices", middleware.Wrapper(interfaces.RetrievePrices))
+			settings.GET("/retrieve_gas", middleware.Wrapper(interfaces.RetrieveGas))
+
+			// the outbox is how every event reaches telegram: events are leased rather than handed out, so
+			// one that telegram claimed and failed to deliver is claimed again instead of lost
+			settings.POST("/claim_events", middleware.Wrapper(interfaces.ClaimEvents))
+			settings.POST("/ack_events", middleware.Wrapper(interfaces.AckEvents))
+
+			settings.GET("/retrieve_audit_log", middleware.Wrapper(interfaces.RetrieveAuditLog))
+			settings.GET("/verify_audit_log", middleware.Wrapper(interfaces.VerifyAuditLog))
+			settings.GET("/export_audit_log", middleware.Wrapper(interfaces.ExportAuditLog))
+
+			settings.GET("/retrieve_portfolio", middleware.Wrapper(interfaces.RetrievePortfolio))
+			settings.GET("/retrieve_portfolio_history", middleware.Wrapper(interfaces.RetrievePortfolioHistory))
+			settings.GET("/retrieve_portfolio_chart", middleware.Wrapper(interfaces.RetrievePortfolioChart))
 		}
 		contracts := bot.Group("/")
 		contracts.Use()
@@ -72,47 +125,67 @@ func main() {
 		}
 	}
 
-	// Background tasks
-	// TODO -- possible memory leak
-	go func() {
-		for {
-			func() {
-				defer func() {
-					if r := recover(); r != nil {
-						log.Printf("Recovered in f: %v", r)
-					}
-				}()
-				ticker := time.NewTicker(5 * time.Second)
-				for ; true; <-ticker.C {
-					utils.GetPairPrice([]string{"matic-network", "ethereum"}, []string{"usd"})
-					if _, err := utils.GetGasPrice(); err != nil {
-						log.Print("Failed to retrieve gas price", err)
-					}
-				}
-			}()
-		}
-	}()
+	// Currently for polygon, there is no previous snapshot to fall back to yet
+	if err := handlers.UpdateGlobalSettings(1); err != nil {
+		log.Fatalf("Failed to load global settings: %v", err)
+	}
 
-	go func() {
-		// for {
-		// 	func() {
-		// 		defer func() {
-		// 			if r := recover(); r != nil {
-		// 				log.Printf("Recovered in f: %v", r)
-		// 				return // Exit the goroutine if a panic occurs
-		// 			}
-		// 		}()
-		// Currently for polygon
-		handlers.UpdateGlobalSettings(1)
-		handlers.Run("polygon")
-		// 	}()
-		// }
-	}()
+	// Background services share one root context, SIGINT and SIGTERM cancel it
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	supervisor := utils.NewSupervisor(ctx)
+	supervisor.Go("node_pool", handlers.RunNodePool)
+	supervisor.Go("price_oracle", handlers.RunPriceOracle)
+	supervisor.Go("gas_oracle", handlers.RunGasOracle)
+	// rotations and sweeps interrupted by a restart hold funds in flight, their receipts are tracked again
+	supervisor.Go("wallet_rotations", handlers.RunWalletRotations)
+	supervisor.Go("sweep_receipts", func(ctx context.Context) error {
+		handlers.ResumeSweeps()
+		return nil
+	})
+	supervisor.Go("receipt_tracker", handlers.RunReceiptTracker)
+	supervisor.Go("nonce_manager", handlers.RunNonceManager)
+	supervisor.Go("wallet_balancer", handlers.RunWalletBalancer)
+	supervisor.Go("portfolio", handlers.RunPortfolio)
+	supervisor.Go("allowance_monitor", handlers.RunAllowanceMonitor)
+	supervisor.Go("pre_approval", handlers.RunPreApprovement)
+	supervisor.Go("mempool_scanner", func(ctx context.Context) error {
+		return handlers.Run(ctx, "polygon")
+	})
 
 	r.NoRoute(func(c *gin.Context) {
 		c.AbortWithError(http.StatusNotFound, errors.New("Endpoint not found."))
 	})
 
-	r.Run(appPort)
+	if appPort == "" {
+		appPort = ":8080"
+	}
+	server := &http.Server{Addr: appPort, Handler: r}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Failed to serve: %v", err)
+		}
+	}()
+
+	<-ctx.Done()
+	stop()
+	log.Print("Shutting down")
 
+	// requests first, then services and in-flight attacks, connections last
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), config.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Failed to drain http server: %v", err)
+	}
+	if err := supervisor.Wait(shutdownCtx); err != nil {
+		log.Printf("Services did not stop in time: %v", err)
+	}
+	handlers.WaitInFlight(shutdownCtx)
+	if undrained := handlers.WalletTTX.Keys(); len(undrained) > 0 {
+		log.Printf("Attacks still in flight on shutdown: %v", undrained)
+	}
+	handlers.CloseClients()
+	controllers.CloseDatabase()
+	log.Print("Shut down")
 }
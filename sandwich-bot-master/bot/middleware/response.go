@@ -2,11 +2,12 @@ package middleware
 
 import (
 	"bot/utils"
+	"common/signature"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
-	"strings"
 
 	"github.com/gin-gonic/gin"
 )
@@ -26,14 +27,39 @@ func DecideErrorMessage(message string, err error) error {
 	return err
 }
 
-func _Permissions() bool {
+// permitted reports whether caller may make a request with _data, a user_id sent in the query or body
+// has to be the one the caller signed for
+func permitted(caller *signature.Caller, _data map[string]interface{}) bool {
+	if _userID, ok := _data["user_id"]; ok {
+		return caller.UserID != nil && sameUserID(_userID, *caller.UserID)
+	}
 	return true
 }
 
+// sameUserID compares a user_id from query or JSON payload with the signed one
+func sameUserID(value interface{}, userID uint) bool {
+	switch _v := value.(type) {
+	case float64:
+		return _v == float64(userID)
+	case string:
+		return _v == strconv.FormatUint(uint64(userID), 10)
+	}
+	return false
+}
+
 func Wrapper(callback func(_data []byte) (int, interface{}, string, error)) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		_data := map[string]interface{}{}
-		_, _isInternal := c.Get("internal_request")
+
+		caller, err := verifier.Verify(c.Request)
+		if err != nil {
+			c.AbortWithError(http.StatusUnauthorized, err)
+			return
+		}
+		c.Set("service", caller.Service)
+		if caller.UserID != nil {
+			c.Set("user_id", *caller.UserID)
+		}
 
 		switch c.Request.Method {
 		case "PUT", "POST", "PATCH":
@@ -57,39 +83,13 @@ func Wrapper(callback func(_data []byte) (int, interface{}, string, error)) gin.
 			_data["sort"] = pagination.Sort
 		}
 
-		if _isInternal {
-			if !strings.Contains(c.GetHeader("origin"), "bot") {
-				c.AbortWithError(http.StatusForbidden, errors.New("Forbidden."))
-				return
-			}
-		} else {
-			// Check permissions
-			permitted := _Permissions()
-
-			if !permitted {
-				c.AbortWithError(http.StatusForbidden, errors.New("Forbidden."))
-				return
-			}
-
-			// __data, err := json.Marshal(_data)
-			// if err != nil {
-			// 	c.AbortWithError(http.StatusForbidden, err)
-			// 	return
-			// }
-
-			// log request
-			// _logger := models.Logger{
-			// 	UserID:      int(_data["user_id"].(float64)),
-			// 	UserRole:    int(_data["user_role"].(float64)),
-			// 	RequestID:   int(_data["request_id"].(float64)),
-			// 	RequestPath: c.Request.URL.String(),
-			// 	Payload:     __data,
-			// 	Method:      c.Request.Method,
-			// 	UserAgent:   fmt.Sprintf("%v", _data["user_agent"]),
-			// 	ClientIP:    fmt.Sprintf("%v", _data["client_ip"]),
-			// }
-
-			// controllers.DB.Model(&models.Logger{}).Create(&_logger)
+		if !permitted(caller, _data) {
+			c.AbortWithError(http.StatusForbidden, errors.New("Forbidden."))
+			return
+		}
+		// handlers only ever see the user the request was signed for
+		if caller.UserID != nil {
+			_data["user_id"] = *caller.UserID
 		}
 
 		payload, err := json.Marshal(_data)
@@ -99,9 +99,16 @@ func Wrapper(callback func(_data []byte) (int, interface{}, string, error)) gin.
 		}
 
 		httpCode, data, message, err := callback(payload)
+		if err != nil {
+			err = DecideErrorMessage(message, err)
+		}
+		recordAudit(c, caller, _data, httpCode, err)
 
 		if err != nil {
-			c.AbortWithError(httpCode, DecideErrorMessage(message, err))
+			c.AbortWithError(httpCode, err)
+		} else if file, ok := data.(*utils.File); ok {
+			c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", file.Name))
+			c.Data(httpCode, file.ContentType, file.Content)
 		} else {
 			Response(c, httpCode, data, message, "success")
 		}
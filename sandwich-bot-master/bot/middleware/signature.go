@@ -0,0 +1,9 @@
+package middleware
+
+import (
+	"bot/config"
+	"common/signature"
+)
+
+// verifier checks every request bot serves, callers sign with the secret bot holds for them in SERVICE_SECRETS
+var verifier = signature.NewVerifier(config.ServiceSecrets, config.SignatureMaxSkew)
@@ -1,6 +1,10 @@
 package models
 
-import "gorm.io/datatypes"
+import (
+	"time"
+
+	"gorm.io/datatypes"
+)
 
 type Order struct {
 	Model
@@ -15,6 +19,9 @@ type Order struct {
 	Settings *datatypes.JSON `gorm:"not null" json:"settings"`
 	Receipt  *datatypes.JSON `json:"receipt"`
 
+	FinalizedAt *time.Time `json:"finalized_at"`
+	StuckAt     *time.Time `gorm:"index" json:"stuck_at"`
+
 	Transaction []Transaction `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE" json:"transactions"`
 }
 
@@ -44,6 +51,17 @@ type Transaction struct {
 	Type     TransactionType `gorm:"index;not null" json:"type"`
 	Receipt  *datatypes.JSON `json:"receipt"`
 	OrderID  *uint           `json:"order_id"`
+	// What the transaction was sent for, e.g. swap, sweep or revoke
+	Purpose *string `gorm:"index" json:"purpose"`
+
+	// sender and nonce tell a replaced transaction from a dropped one
+	From        *string    `gorm:"index" json:"from"`
+	Nonce       *uint64    `json:"nonce"`
+	BlockNumber *uint64    `json:"block_number"`
+	BlockHash   *string    `json:"block_hash"`
+	SentAt      *time.Time `json:"sent_at"`
+	MinedAt     *time.Time `json:"mined_at"`
+	FinalizedAt *time.Time `json:"finalized_at"`
 }
 
 func (Transaction) TableName() string {
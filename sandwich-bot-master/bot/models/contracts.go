@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 // White/Blacklisted cotracts
 type Contract struct {
 	ModelExtended
@@ -39,5 +41,33 @@ func (Coin) TableName() string {
 	return "bot_coins"
 }
 
+// Allowance is the last on-chain allowance seen for a wallet, token and spender.
+// Anything other than a current DEX router holding a non zero allowance is stale.
 type Allowance struct {
+	Model
+	BlockchainID
+	WalletID    *uint                `gorm:"uniqueIndex:idx_allowance_spender;not null" json:"wallet_id"`
+	Token       *string              `gorm:"uniqueIndex:idx_allowance_spender;not null" json:"token"`
+	Spender     *string              `gorm:"uniqueIndex:idx_allowance_spender;not null" json:"spender"`
+	Amount      *string              `gorm:"not null" json:"amount"`
+	SpenderType AllowanceSpenderType `gorm:"index;not null" json:"spender_type"`
+	Stale       bool                 `gorm:"index;not null;default:false" json:"stale"`
+	CheckedAt   *time.Time           `json:"checked_at"`
+	RevokeHash  *string              `json:"revoke_hash"`
+	Wallet      *Wallet              `gorm:"foreignKey:WalletID" json:"wallet,omitempty"`
+}
+
+func (Allowance) TableName() string {
+	return "bot_allowances"
+}
+
+// AllowanceCursor is the last block scanned for Approval events of a wallet
+type AllowanceCursor struct {
+	Model
+	WalletID *uint  `gorm:"uniqueIndex;not null" json:"wallet_id"`
+	Block    uint64 `gorm:"not null" json:"block"`
+}
+
+func (AllowanceCursor) TableName() string {
+	return "bot_allowance_cursors"
 }
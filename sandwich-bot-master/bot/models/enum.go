@@ -7,6 +7,15 @@ type ENUM interface {
 type TransactionType string
 type StatusType string
 type WalletType string
+type SignerType string
+type RotationStepType string
+type SweepStatusType string
+type AllowanceSpenderType string
+type SettingFieldType string
+type KillSwitchStateType string
+type NonceStatusType string
+type EventCategoryType string
+type EventStatusType string
 
 const (
 	// TransactionType
@@ -18,9 +27,59 @@ const (
 	Confirmed StatusType = "confirmed"
 	Reverted  StatusType = "reverted"
 	Fail      StatusType = "fail"
+	Dropped   StatusType = "dropped"
+	Replaced  StatusType = "replaced"
 	// WalletType
 	Withdrawal WalletType = "withdrawal"
 	Main       WalletType = "main"
+	// SignerType
+	LocalSigner    SignerType = "local"
+	KeystoreSigner SignerType = "keystore"
+	RemoteSigner   SignerType = "remote"
+	// RotationStepType
+	RotationRevoking   RotationStepType = "revoking"
+	RotationMoveERC20  RotationStepType = "move_erc20"
+	RotationMoveNative RotationStepType = "move_native"
+	RotationSwitching  RotationStepType = "switching"
+	RotationCompleted  RotationStepType = "completed"
+	// SweepStatusType
+	SweepProposed  SweepStatusType = "proposed"
+	SweepRequested SweepStatusType = "requested"
+	SweepSending   SweepStatusType = "sending"
+	SweepConfirmed SweepStatusType = "confirmed"
+	SweepFailed    SweepStatusType = "failed"
+	SweepExpired   SweepStatusType = "expired"
+	// AllowanceSpenderType
+	DEXSpender        AllowanceSpenderType = "dex"
+	RemovedDEXSpender AllowanceSpenderType = "removed_dex"
+	UnknownSpender    AllowanceSpenderType = "unknown"
+	// SettingFieldType
+	DecimalSetting SettingFieldType = "decimal"
+	IntegerSetting SettingFieldType = "integer"
+	FloatSetting   SettingFieldType = "float"
+	// KillSwitchStateType
+	KillSwitchDraining KillSwitchStateType = "draining"
+	KillSwitchStopped  KillSwitchStateType = "stopped"
+	KillSwitchRunning  KillSwitchStateType = "running"
+	// NonceStatusType
+	NonceReserved NonceStatusType = "reserved"
+	NonceSent     NonceStatusType = "sent"
+	NonceReleased NonceStatusType = "released"
+	NonceFilled   NonceStatusType = "filled"
+	NonceMined    NonceStatusType = "mined"
+	// EventCategoryType
+	SettingsChangedEvent  EventCategoryType = "settings_changed"
+	KillSwitchEvent       EventCategoryType = "kill_switch"
+	WalletBalanceLowEvent EventCategoryType = "wallet_balance_low"
+	RPCPoolDegradedEvent  EventCategoryType = "rpc_pool_degraded"
+	OrderStuckEvent       EventCategoryType = "order_stuck"
+	AllowanceChangedEvent EventCategoryType = "allowance_changed"
+	SweepProposedEvent    EventCategoryType = "sweep_proposed"
+	PriceDeviationEvent   EventCategoryType = "price_deviation"
+	// EventStatusType
+	EventPending   EventStatusType = "pending"
+	EventDelivered EventStatusType = "delivered"
+	EventFailed    EventStatusType = "failed"
 )
 
 var ValidWalletTypes = []WalletType{Withdrawal, Main}
@@ -34,6 +93,105 @@ func (wt WalletType) IsValid() bool {
 	return false
 }
 
+var ValidSignerTypes = []SignerType{LocalSigner, KeystoreSigner, RemoteSigner}
+
+func (st SignerType) IsValid() bool {
+	for _, _vst := range ValidSignerTypes {
+		if st == _vst {
+			return true
+		}
+	}
+	return false
+}
+
+var ValidRotationStepTypes = []RotationStepType{RotationRevoking, RotationMoveERC20, RotationMoveNative, RotationSwitching, RotationCompleted}
+
+func (rst RotationStepType) IsValid() bool {
+	for _, _vrst := range ValidRotationStepTypes {
+		if rst == _vrst {
+			return true
+		}
+	}
+	return false
+}
+
+var ValidSweepStatusTypes = []SweepStatusType{SweepProposed, SweepRequested, SweepSending, SweepConfirmed, SweepFailed, SweepExpired}
+
+func (sst SweepStatusType) IsValid() bool {
+	for _, _vsst := range ValidSweepStatusTypes {
+		if sst == _vsst {
+			return true
+		}
+	}
+	return false
+}
+
+var ValidAllowanceSpenderTypes = []AllowanceSpenderType{DEXSpender, RemovedDEXSpender, UnknownSpender}
+
+func (ast AllowanceSpenderType) IsValid() bool {
+	for _, _vast := range ValidAllowanceSpenderTypes {
+		if ast == _vast {
+			return true
+		}
+	}
+	return false
+}
+
+var ValidSettingFieldTypes = []SettingFieldType{DecimalSetting, IntegerSetting, FloatSetting}
+
+func (sft SettingFieldType) IsValid() bool {
+	for _, _vsft := range ValidSettingFieldTypes {
+		if sft == _vsft {
+			return true
+		}
+	}
+	return false
+}
+
+var ValidKillSwitchStateTypes = []KillSwitchStateType{KillSwitchDraining, KillSwitchStopped, KillSwitchRunning}
+
+func (ksst KillSwitchStateType) IsValid() bool {
+	for _, _vksst := range ValidKillSwitchStateTypes {
+		if ksst == _vksst {
+			return true
+		}
+	}
+	return false
+}
+
+var ValidNonceStatusTypes = []NonceStatusType{NonceReserved, NonceSent, NonceReleased, NonceFilled, NonceMined}
+
+func (nst NonceStatusType) IsValid() bool {
+	for _, _vnst := range ValidNonceStatusTypes {
+		if nst == _vnst {
+			return true
+		}
+	}
+	return false
+}
+
+var ValidEventCategoryTypes = []EventCategoryType{SettingsChangedEvent, KillSwitchEvent, WalletBalanceLowEvent, RPCPoolDegradedEvent, OrderStuckEvent, AllowanceChangedEvent, SweepProposedEvent, PriceDeviationEvent}
+
+func (ect EventCategoryType) IsValid() bool {
+	for _, _vect := range ValidEventCategoryTypes {
+		if ect == _vect {
+			return true
+		}
+	}
+	return false
+}
+
+var ValidEventStatusTypes = []EventStatusType{EventPending, EventDelivered, EventFailed}
+
+func (est EventStatusType) IsValid() bool {
+	for _, _vest := range ValidEventStatusTypes {
+		if est == _vest {
+			return true
+		}
+	}
+	return false
+}
+
 var ValidTransactionTypes = []TransactionType{Outbound, Inbound}
 
 func (tt TransactionType) IsValid() bool {
@@ -45,7 +203,7 @@ func (tt TransactionType) IsValid() bool {
 	return false
 }
 
-var ValidStatusTypes = []StatusType{Pending, Indexing, Confirmed, Reverted, Fail}
+var ValidStatusTypes = []StatusType{Pending, Indexing, Confirmed, Reverted, Fail, Dropped, Replaced}
 
 func (st StatusType) IsValid() bool {
 	for _, _vst := range ValidStatusTypes {
@@ -56,6 +214,27 @@ func (st StatusType) IsValid() bool {
 	return false
 }
 
+// StatusTransitions lists where orders and transactions may move from a status. Pending is sent but
+// not mined, indexing is mined but not deep enough to rule out a reorg, which sends it back to pending.
+var StatusTransitions = map[StatusType][]StatusType{
+	Pending:  {Indexing, Confirmed, Reverted, Fail, Dropped, Replaced},
+	Indexing: {Pending, Confirmed, Reverted, Fail},
+}
+
+func (st StatusType) CanTransition(to StatusType) bool {
+	for _, _to := range StatusTransitions[st] {
+		if to == _to {
+			return true
+		}
+	}
+	return false
+}
+
+// IsFinal tells whether a status can no longer change
+func (st StatusType) IsFinal() bool {
+	return len(StatusTransitions[st]) == 0
+}
+
 func Validate(e ENUM) bool {
 	return e.IsValid()
 }
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// Event is an outbox row for telegram subscribers. It is written together with the change it
+// reports and stays pending until telegram acknowledged its delivery
+type Event struct {
+	Model
+	Category EventCategoryType `gorm:"index;not null" json:"category"`
+	// an event is published once per key, publishers put what makes it distinct into it
+	DedupKey string          `gorm:"uniqueIndex;not null" json:"dedup_key"`
+	Payload  datatypes.JSON  `json:"payload"`
+	Status   EventStatusType `gorm:"index;not null;default:pending" json:"status"`
+	Attempts int             `gorm:"not null;default:0" json:"attempts"`
+	// claimed events are leased until then, an unacknowledged one is handed out again afterwards
+	NextAttemptAt time.Time  `gorm:"index;not null" json:"next_attempt_at"`
+	LastError     *string    `json:"last_error"`
+	DeliveredAt   *time.Time `json:"delivered_at"`
+}
+
+func (Event) TableName() string {
+	return "bot_events"
+}
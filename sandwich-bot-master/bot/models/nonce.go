@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// NonceReservation is a nonce handed out by the nonce manager. Rows outlive restarts, so a
+// nonce reserved but never sent is found and filled instead of blocking every later transaction
+type NonceReservation struct {
+	Model
+	Wallet  string          `gorm:"uniqueIndex:idx_nonce_reservation;not null" json:"wallet"`
+	Nonce   uint64          `gorm:"uniqueIndex:idx_nonce_reservation;not null" json:"nonce"`
+	Purpose string          `json:"purpose"`
+	Status  NonceStatusType `gorm:"index;not null;default:reserved" json:"status"`
+	Hash    *string         `json:"hash"`
+	SentAt  *time.Time      `json:"sent_at"`
+}
+
+func (NonceReservation) TableName() string {
+	return "bot_nonce_reservations"
+}
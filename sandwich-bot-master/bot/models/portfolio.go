@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// PortfolioSnapshot is what a wallet held at one snapshot round, every wallet of a round shares TakenAt
+type PortfolioSnapshot struct {
+	Model
+	WalletID *uint     `gorm:"index;not null" json:"wallet_id"`
+	TakenAt  time.Time `gorm:"index;not null" json:"taken_at"`
+	// sum of the holdings that had a price
+	UsdValue decimal.Decimal `gorm:"type:numeric" json:"usd_value"`
+	// false when a holding had no fresh price and is missing from UsdValue
+	Priced   bool               `json:"priced"`
+	Wallet   *Wallet            `gorm:"foreignKey:WalletID" json:"wallet,omitempty"`
+	Holdings []PortfolioHolding `gorm:"foreignKey:SnapshotID" json:"holdings"`
+}
+
+func (PortfolioSnapshot) TableName() string {
+	return "bot_portfolio_snapshots"
+}
+
+// PortfolioHolding is the balance of one asset in a snapshot, assets without balance are left out
+type PortfolioHolding struct {
+	Model
+	SnapshotID uint   `gorm:"index;not null" json:"snapshot_id"`
+	Asset      string `gorm:"not null" json:"asset"`
+	// nil for native MATIC
+	Token    *string          `json:"token"`
+	Balance  decimal.Decimal  `gorm:"type:numeric" json:"balance"`
+	PriceUsd *decimal.Decimal `gorm:"type:numeric" json:"price_usd"`
+	UsdValue decimal.Decimal  `gorm:"type:numeric" json:"usd_value"`
+}
+
+func (PortfolioHolding) TableName() string {
+	return "bot_portfolio_holdings"
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// WalletRotation moves everything from an old wallet to a new one. Every transaction
+// is recorded before broadcasting, so an interrupted rotation can be resumed safely.
+type WalletRotation struct {
+	ModelExtended
+	BlockchainID
+	Uid         string           `gorm:"uniqueIndex;not null" json:"rotation_id"`
+	Type        *WalletType      `gorm:"not null" json:"type"`
+	OldWalletID *uint            `gorm:"index;not null" json:"old_wallet_id"`
+	NewWalletID *uint            `gorm:"index;not null" json:"new_wallet_id"`
+	Step        RotationStepType `gorm:"default:revoking" json:"step"`
+	Transfers   datatypes.JSON   `json:"transfers"`
+	Error       *string          `json:"error"`
+	CompletedAt *time.Time       `json:"completed_at"`
+	OldWallet   *Wallet          `gorm:"foreignKey:OldWalletID" json:"old_wallet,omitempty"`
+	NewWallet   *Wallet          `gorm:"foreignKey:NewWalletID" json:"new_wallet,omitempty"`
+}
+
+func (WalletRotation) TableName() string {
+	return "bot_wallet_rotations"
+}
+
+// RotationTransfer is a single revoke or transfer of a rotation, keyed by its purpose
+type RotationTransfer struct {
+	Token   string `json:"token,omitempty"`
+	Spender string `json:"spender,omitempty"`
+	Amount  string `json:"amount,omitempty"`
+	Hash    string `json:"hash"`
+	RawTx   string `json:"raw_tx"`
+	Mined   bool   `json:"mined"`
+	Failed  bool   `json:"failed"`
+}
@@ -1,12 +1,16 @@
 package models
 
-import "gorm.io/datatypes"
+import (
+	"gorm.io/datatypes"
+)
 
 type Settings struct {
 	ModelExtended
 	Active       *bool          `gorm:"default:true" json:"active"`
 	BlockchainID *uint          `gorm:"not null" json:"blockchain_id"`
 	Settings     datatypes.JSON `gorm:"not null" json:"settings"`
+	// Version this one restored, empty for regular updates
+	RollbackOf *uint `json:"rollback_of"`
 }
 
 func (Settings) TableName() string {
@@ -17,10 +21,18 @@ type Wallet struct {
 	ModelExtended
 	BlockchainID
 	Active
-	Name       string      `gorm:"index" json:"name"`
-	PrivateKey *string     `gorm:"not null" json:"pk"`
-	Address    *string     `gorm:"uniqueIndex;not null" json:"address"`
-	Type       *WalletType `gorm:"not null" json:"type"`
+	Name    string      `gorm:"index" json:"name"`
+	Address *string     `gorm:"uniqueIndex;not null" json:"address"`
+	Type    *WalletType `gorm:"not null" json:"type"`
+	// Legacy plaintext key, emptied by the encrypt-wallets command
+	PrivateKey *string `json:"-"`
+	// Key sealed with its data key, data key wrapped with the KEK
+	SealedKey  *string `json:"-"`
+	WrappedKey *string `json:"-"`
+	KekID      *string `json:"-"`
+	// Where signing happens, SignerURI is the keystore file path or the remote signer URL
+	SignerType *SignerType `gorm:"default:local" json:"signer_type"`
+	SignerURI  *string     `json:"signer_uri"`
 }
 
 func (Wallet) TableName() string {
@@ -30,6 +42,9 @@ func (Wallet) TableName() string {
 type KillSwitch struct {
 	ModelExtended
 	IsOn *bool `gorm:"default:false" json:"is_on"`
+	// Set while switching, the summary is published as a kill_switch event once draining ended
+	State   *KillSwitchStateType `json:"state"`
+	Summary datatypes.JSON       `json:"summary"`
 }
 
 func (KillSwitch) TableName() string {
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/datatypes"
+)
+
+// Sweep is a ledger row of a profit transfer from a main wallet to the withdrawal wallet.
+// It is proposed by the balancer and sent only after an owner other than the requester approved it.
+type Sweep struct {
+	Model
+	BlockchainID
+	Uid               string          `gorm:"uniqueIndex;not null" json:"sweep_id"`
+	WalletID          *uint           `gorm:"index;not null" json:"wallet_id"`
+	ToWalletID        *uint           `gorm:"index;not null" json:"to_wallet_id"`
+	Token             *string         `gorm:"not null" json:"token"`
+	TokenName         string          `json:"token_name"`
+	Amount            *string         `gorm:"not null" json:"amount"`
+	UsdValue          decimal.Decimal `gorm:"type:numeric" json:"usd_value"`
+	WalletUsdValue    decimal.Decimal `gorm:"type:numeric" json:"wallet_usd_value"`
+	Status            SweepStatusType `gorm:"index;not null;default:proposed" json:"status"`
+	ApprovalRequestID *string         `gorm:"index" json:"approval_request_id"`
+	RequestedBy       *uint           `json:"requested_by"`
+	RequestedAt       *time.Time      `json:"requested_at"`
+	ApprovedBy        *uint           `json:"approved_by"`
+	Hash              *string         `gorm:"index" json:"hash"`
+	RawTx             *string         `json:"-"`
+	Receipt           *datatypes.JSON `json:"receipt"`
+	Error             *string         `json:"error"`
+	Wallet            *Wallet         `gorm:"foreignKey:WalletID" json:"wallet,omitempty"`
+	ToWallet          *Wallet         `gorm:"foreignKey:ToWalletID" json:"to_wallet,omitempty"`
+}
+
+func (Sweep) TableName() string {
+	return "bot_sweeps"
+}
@@ -0,0 +1,70 @@
+package types
+
+import "encoding/json"
+
+// Payloads of outbox events, telegram renders them per category
+
+type SettingsChangedEventType struct {
+	Version    uint                     `json:"version"`
+	UserID     *uint                    `json:"user_id"`
+	RollbackOf *uint                    `json:"rollback_of,omitempty"`
+	Changes    []SettingsChangeRespType `json:"changes"`
+}
+
+type KillSwitchEventType struct {
+	KillSwitchID uint  `json:"kill_switch_id"`
+	IsOn         bool  `json:"is_on"`
+	UserID       *uint `json:"user_id"`
+	// What happened to in-flight work, set once the switch settled
+	Summary json.RawMessage `json:"summary,omitempty"`
+}
+
+type WalletBalanceLowEventType struct {
+	Address string `json:"address"`
+	Balance string `json:"balance"`
+	Minimum string `json:"minimum"`
+}
+
+type RPCPoolDegradedEventType struct {
+	Role    string `json:"role"`
+	Healthy int    `json:"healthy"`
+	Total   int    `json:"total"`
+	// nodes that changed health in this probe
+	Ejected  map[string]string `json:"ejected,omitempty"`
+	Restored []string          `json:"restored,omitempty"`
+}
+
+type OrderStuckEventType struct {
+	OrderID uint   `json:"order_id"`
+	Status  string `json:"status"`
+	Hash    string `json:"hash"`
+	Since   string `json:"since"`
+}
+
+type AllowanceChangedEventType struct {
+	Wallet      string `json:"wallet"`
+	Token       string `json:"token"`
+	Spender     string `json:"spender"`
+	SpenderType string `json:"spender_type"`
+	From        string `json:"from"`
+	To          string `json:"to"`
+	AllowanceID uint   `json:"allowance_id"`
+}
+
+type SweepProposedEventType struct {
+	SweepID        string `json:"sweep_id"`
+	Wallet         string `json:"wallet"`
+	ToWallet       string `json:"to_wallet"`
+	TokenName      string `json:"token_name"`
+	Amount         string `json:"amount"`
+	UsdValue       string `json:"usd_value"`
+	WalletUsdValue string `json:"wallet_usd_value"`
+}
+
+type PriceDeviationEventType struct {
+	Asset     string `json:"asset"`
+	Source    string `json:"source"`
+	Price     string `json:"price"`
+	Median    string `json:"median"`
+	Deviation string `json:"deviation"`
+}
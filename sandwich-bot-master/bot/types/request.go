@@ -2,34 +2,26 @@ package types
 
 import (
 	"bot/models"
+	"encoding/json"
 
 	"github.com/shopspring/decimal"
 )
 
 type UpdateSettingsReqType struct {
-	GasFeeMax              *decimal.Decimal `json:"gas_fee_max,omitempty"`
-	GasLimit               *uint64          `json:"gas_limit,omitempty"`
-	GasPriority            *decimal.Decimal `json:"gas_priority,omitempty"`
-	TTXMaxLatency          *uint64          `json:"ttx_max_latency,omitempty"`
-	ExitGas                *decimal.Decimal `json:"exit_gas,omitempty"`
-	Slippage               *float64         `json:"slippage,omitempty"`
-	TargetValueMin         *decimal.Decimal `json:"target_value_min,omitempty"`
-	TargetValueMax         *decimal.Decimal `json:"target_value_max,omitempty"`
-	TargetGasMarkupAllowed *decimal.Decimal `json:"target_gas_markup_allowed,omitempty"`
-	UsdPerTrade            *decimal.Decimal `json:"usd_per_trade,omitempty"`
-	Deadline               *int             `json:"deadline,omitempty"`
-	DrawDown               *float64         `json:"draw_down,omitempty"`
-	GasTolerance           *float64         `json:"gas_tolerance,omitempty"`
-	WithdrawalThreshold    *decimal.Decimal `json:"withdrawal_threshold,omitempty"`
-	UserID                 *uint            `json:"user_id" validate:"required"`
+	UserRequiredType
+	// Values keyed by setting, checked against config.SettingsSchema
+	Settings map[string]json.RawMessage `json:"-"`
 }
 
 type CreateWalletReqType struct {
 	Address    *string            `json:"address" validate:"required"`
 	Name       string             `json:"name,omitempty"`
-	PrivateKey *string            `json:"pk" validate:"required"`
+	PrivateKey *string            `json:"pk,omitempty"`
 	WalletType *models.WalletType `json:"wallet_type" validate:"required"`
 	UserID     *uint              `json:"user_id" validate:"required"`
+	// Defaults to local, keystore and remote signers need SignerURI instead of pk
+	SignerType *models.SignerType `json:"signer_type,omitempty"`
+	SignerURI  *string            `json:"signer_uri,omitempty"`
 }
 
 type ToggleKillSwitchReqType struct {
@@ -100,3 +92,108 @@ type RetrieveWalletReqType struct {
 	UserRequiredType
 	WalletType *models.WalletType `json:"wallet_type" validate:"required"`
 }
+
+type RotateWalletReqType struct {
+	UserRequiredType
+	WalletType *models.WalletType `json:"wallet_type" validate:"required"`
+	// Wallet to rotate away from, may be omitted while a single wallet of the type is active
+	OldAddress *string `json:"old_address,omitempty"`
+	// New wallet, a local key is generated when neither address nor pk is given
+	Address    *string            `json:"address,omitempty"`
+	PrivateKey *string            `json:"pk,omitempty"`
+	Name       string             `json:"name,omitempty"`
+	SignerType *models.SignerType `json:"signer_type,omitempty"`
+	SignerURI  *string            `json:"signer_uri,omitempty"`
+}
+
+type WalletRotationReqType struct {
+	UserRequiredType
+	RotationID *string `json:"rotation_id" validate:"required"`
+}
+
+type RequestSweepReqType struct {
+	UserRequiredType
+	SweepID   *string `json:"sweep_id" validate:"required"`
+	RequestID *string `json:"request_id" validate:"required"`
+}
+
+type ExecuteSweepReqType struct {
+	UserRequiredType
+	SweepID   *string `json:"sweep_id" validate:"required"`
+	RequestID *string `json:"request_id" validate:"required"`
+}
+
+type RetrieveSweepsReqType struct {
+	UserRequiredType
+	Status *models.SweepStatusType `json:"status,omitempty"`
+	Limit  int                     `json:"limit,omitempty"`
+	Offset int                     `json:"offset,omitempty"`
+}
+
+type RetrieveAllowancesReqType struct {
+	UserRequiredType
+	Stale   *int    `json:"stale"`
+	Address *string `json:"address,omitempty"`
+	Limit   int     `json:"limit,omitempty"`
+	Offset  int     `json:"offset,omitempty"`
+}
+
+type RevokeAllowancesReqType struct {
+	UserRequiredType
+	AllowanceIDs []uint `json:"allowance_ids,omitempty"`
+	// Revokes every stale allowance when set
+	AllStale bool `json:"all_stale,omitempty"`
+}
+
+type ClaimEventsReqType struct {
+	Limit int `json:"limit" validate:"required"`
+}
+
+type EventFailureReqType struct {
+	ID    uint   `json:"id" validate:"required"`
+	Error string `json:"error"`
+}
+
+type AckEventsReqType struct {
+	Delivered []uint                `json:"delivered"`
+	Failed    []EventFailureReqType `json:"failed"`
+}
+
+type RetrieveSettingsHistoryReqType struct {
+	UserRequiredType
+	BlockchainType
+	Limit  int `json:"limit,omitempty"`
+	Offset int `json:"offset,omitempty"`
+}
+
+type DiffSettingsReqType struct {
+	UserRequiredType
+	FromVersion uint `json:"from_version" validate:"required"`
+	// Defaults to the active version
+	ToVersion uint `json:"to_version,omitempty"`
+}
+
+type RollbackSettingsReqType struct {
+	UserRequiredType
+	Version uint `json:"version" validate:"required"`
+}
+
+type RetrieveAuditLogReqType struct {
+	UserRequiredType
+	AuditUserID *uint   `json:"audit_user_id,omitempty"`
+	Action      *string `json:"action,omitempty"`
+	Limit       int     `json:"limit,omitempty"`
+	Offset      int     `json:"offset,omitempty"`
+}
+
+type RetrievePortfolioReqType struct {
+	UserRequiredType
+	WalletType *models.WalletType `json:"wallet_type,omitempty"`
+	WalletID   *uint              `json:"wallet_id,omitempty"`
+}
+
+type RetrievePortfolioHistoryReqType struct {
+	RetrievePortfolioReqType
+	// history of the last hours, a week by default
+	Hours int `json:"hours,omitempty" validate:"omitempty,min=1,max=2160"`
+}
@@ -1,7 +1,11 @@
 package types
 
 import (
+	"bot/models"
+	"bot/utils"
 	"time"
+
+	"github.com/shopspring/decimal"
 )
 
 type CreateUpdateBotSettingsRespType struct {
@@ -32,3 +36,66 @@ type RetrieveWalletRespType struct {
 	Name    *string `json:"name"`
 	// Type    *string `json:"type"`
 }
+
+type SettingsChangeRespType struct {
+	Field string      `json:"field"`
+	From  interface{} `json:"from"`
+	To    interface{} `json:"to"`
+}
+
+type RetrieveSettingsVersionRespType struct {
+	ID         uint      `json:"id"`
+	Active     *bool     `json:"active"`
+	RollbackOf *uint     `json:"rollback_of"`
+	CreatedAt  time.Time `json:"created_at"`
+	CreatedBy  *uint     `json:"created_by"`
+	// Fields changed against the previous version
+	Changes []SettingsChangeRespType `json:"changes"`
+}
+
+type NodeStatusRespType struct {
+	URL  string `json:"url"`
+	Role string `json:"role"`
+	// Unprobed nodes count as healthy
+	Healthy     bool       `json:"healthy"`
+	Reason      string     `json:"reason,omitempty"`
+	BlockNumber uint64     `json:"block_number"`
+	Lag         uint64     `json:"lag"`
+	LatencyMs   int64      `json:"latency_ms"`
+	ErrorRate   float64    `json:"error_rate"`
+	LastError   string     `json:"last_error,omitempty"`
+	CheckedAt   *time.Time `json:"checked_at"`
+}
+
+type RetrieveGasRespType struct {
+	utils.GasEstimate
+	FastGasPrice decimal.Decimal `json:"fast_gas_price"`
+	AgeSeconds   float64         `json:"age_seconds"`
+	// Stale estimates are refused by every consumer
+	Stale bool `json:"stale"`
+}
+
+type PortfolioPointRespType struct {
+	TakenAt  time.Time       `json:"taken_at"`
+	UsdValue decimal.Decimal `json:"usd_value"`
+	// false when a holding of the round had no price and is missing from UsdValue
+	Priced bool `json:"priced"`
+}
+
+type PortfolioChangeRespType struct {
+	// the snapshot round compared against
+	Since    time.Time       `json:"since"`
+	UsdValue decimal.Decimal `json:"usd_value"`
+	Change   decimal.Decimal `json:"change"`
+	// nil when there was nothing to compare against
+	Percent *decimal.Decimal `json:"percent"`
+}
+
+type RetrievePortfolioRespType struct {
+	TakenAt   *time.Time                 `json:"taken_at"`
+	UsdValue  decimal.Decimal            `json:"usd_value"`
+	Priced    bool                       `json:"priced"`
+	Change24h *PortfolioChangeRespType   `json:"change_24h"`
+	Change7d  *PortfolioChangeRespType   `json:"change_7d"`
+	Wallets   []models.PortfolioSnapshot `json:"wallets"`
+}
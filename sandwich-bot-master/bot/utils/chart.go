@@ -0,0 +1,141 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"time"
+)
+
+const chartMargin = 16
+
+var (
+	chartBackground = color.RGBA{0xff, 0xff, 0xff, 0xff}
+	chartGrid       = color.RGBA{0xe5, 0xe7, 0xeb, 0xff}
+	chartRising     = color.RGBA{0x16, 0xa3, 0x4a, 0xff}
+	chartFalling    = color.RGBA{0xdc, 0x26, 0x26, 0xff}
+)
+
+// ChartPoint is a value at a time
+type ChartPoint struct {
+	At    time.Time
+	Value float64
+}
+
+// LineChartPNG plots points over time with the area under the line shaded, green when the last value
+// is not below the first one and red otherwise. The chart has no text, the caller labels it
+func LineChartPNG(points []ChartPoint, width, height int) ([]byte, error) {
+	if len(points) < 2 {
+		return nil, errors.New("a chart needs at least two points")
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), &image.Uniform{chartBackground}, image.Point{}, draw.Src)
+	plot := image.Rect(chartMargin, chartMargin, width-chartMargin, height-chartMargin)
+
+	low, high := points[0].Value, points[0].Value
+	for _, _point := range points {
+		if _point.Value < low {
+			low = _point.Value
+		}
+		if _point.Value > high {
+			high = _point.Value
+		}
+	}
+	// a flat line is drawn in the middle, otherwise the values get some room above and below
+	padding := (high - low) * 0.05
+	if padding == 0 {
+		padding = 1
+	}
+	low, high = low-padding, high+padding
+
+	start, span := points[0].At, points[len(points)-1].At.Sub(points[0].At)
+	if span <= 0 {
+		span = 1
+	}
+	x := func(t time.Time) int {
+		return plot.Min.X + int(float64(plot.Dx())*float64(t.Sub(start))/float64(span))
+	}
+	y := func(value float64) int {
+		return plot.Max.Y - int(float64(plot.Dy())*(value-low)/(high-low))
+	}
+
+	for _i := 0; _i <= 4; _i++ {
+		gridY := plot.Min.Y + plot.Dy()*_i/4
+		for _x := plot.Min.X; _x <= plot.Max.X; _x++ {
+			img.Set(_x, gridY, chartGrid)
+		}
+	}
+
+	line := chartRising
+	if points[len(points)-1].Value < points[0].Value {
+		line = chartFalling
+	}
+	shade := color.RGBA{line.R/4 + 0xbf, line.G/4 + 0xbf, line.B/4 + 0xbf, 0xff}
+
+	for _i := 1; _i < len(points); _i++ {
+		x0, y0 := x(points[_i-1].At), y(points[_i-1].Value)
+		x1, y1 := x(points[_i].At), y(points[_i].Value)
+		for _x := x0; _x <= x1; _x++ {
+			top := y0
+			if x1 > x0 {
+				top = y0 + (y1-y0)*(_x-x0)/(x1-x0)
+			}
+			for _y := top; _y <= plot.Max.Y; _y++ {
+				img.Set(_x, _y, shade)
+			}
+		}
+	}
+	for _i := 1; _i < len(points); _i++ {
+		x0, y0 := x(points[_i-1].At), y(points[_i-1].Value)
+		x1, y1 := x(points[_i].At), y(points[_i].Value)
+		// two pixels thick
+		drawLine(img, x0, y0, x1, y1, line)
+		drawLine(img, x0, y0+1, x1, y1+1, line)
+	}
+
+	var buffer bytes.Buffer
+	if err := png.Encode(&buffer, img); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// drawLine is Bresenham's line algorithm
+func drawLine(img *image.RGBA, x0, y0, x1, y1 int, c color.Color) {
+	dx, dy := abs(x1-x0), -abs(y1-y0)
+	sx, sy := 1, 1
+	if x0 > x1 {
+		sx = -1
+	}
+	if y0 > y1 {
+		sy = -1
+	}
+
+	err := dx + dy
+	for {
+		img.Set(x0, y0, c)
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+		e2 := 2 * err
+		if e2 >= dy {
+			err += dy
+			x0 += sx
+		}
+		if e2 <= dx {
+			err += dx
+			y0 += sy
+		}
+	}
+}
+
+func abs(value int) int {
+	if value < 0 {
+		return -value
+	}
+	return value
+}
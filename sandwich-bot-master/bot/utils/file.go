@@ -0,0 +1,8 @@
+package utils
+
+// File is returned by a handler that answers with a download instead of the JSON response
+type File struct {
+	Name        string
+	ContentType string
+	Content     []byte
+}
@@ -0,0 +1,160 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/shopspring/decimal"
+)
+
+var (
+	ErrGasUnavailable = errors.New("gas estimate is unavailable")
+	ErrGasStale       = errors.New("gas estimate is stale")
+)
+
+// GasEstimate is the base fee of the next block and suggested priority fees, all in gwei
+type GasEstimate struct {
+	BaseFee     decimal.Decimal `json:"base_fee"`
+	SafeTip     decimal.Decimal `json:"safe_tip"`
+	StandardTip decimal.Decimal `json:"standard_tip"`
+	FastTip     decimal.Decimal `json:"fast_tip"`
+	Source      string          `json:"source"`
+	At          time.Time       `json:"at"`
+}
+
+// FastGasPrice is the gas price a fast transaction pays, base fee included
+func (e GasEstimate) FastGasPrice() decimal.Decimal {
+	return e.BaseFee.Add(e.FastTip)
+}
+
+type GasOracle interface {
+	Name() string
+	Estimate(ctx context.Context) (GasEstimate, error)
+}
+
+type FeeHistoryReader interface {
+	FeeHistory(ctx context.Context, blockCount uint64, lastBlock *big.Int, rewardPercentiles []float64) (*ethereum.FeeHistory, error)
+}
+
+// FeeHistoryGasOracle estimates fees with eth_feeHistory of our own nodes. The tip tiers are the
+// median over Blocks of the safe, standard and fast reward percentiles
+type FeeHistoryGasOracle struct {
+	Client      func() (FeeHistoryReader, error)
+	Blocks      uint64
+	Percentiles [3]float64
+}
+
+func (o FeeHistoryGasOracle) Name() string {
+	return "fee_history"
+}
+
+func (o FeeHistoryGasOracle) Estimate(ctx context.Context) (GasEstimate, error) {
+	client, err := o.Client()
+	if err != nil {
+		return GasEstimate{}, err
+	}
+	history, err := client.FeeHistory(ctx, o.Blocks, nil, o.Percentiles[:])
+	if err != nil {
+		return GasEstimate{}, err
+	}
+	// base fees run one block past the newest one, the last entry is the next block
+	if len(history.BaseFee) == 0 || len(history.Reward) == 0 {
+		return GasEstimate{}, errors.New("fee history is empty")
+	}
+
+	var tips [3]decimal.Decimal
+	for _i := range o.Percentiles {
+		var rewards []decimal.Decimal
+		for _, _block := range history.Reward {
+			if _i < len(_block) && _block[_i] != nil {
+				rewards = append(rewards, decimal.NewFromBigInt(_block[_i], -9))
+			}
+		}
+		if len(rewards) == 0 {
+			return GasEstimate{}, fmt.Errorf("fee history has no rewards at percentile %v", o.Percentiles[_i])
+		}
+		sort.Slice(rewards, func(i, j int) bool {
+			return rewards[i].LessThan(rewards[j])
+		})
+		tips[_i] = rewards[len(rewards)/2]
+	}
+
+	return GasEstimate{
+		BaseFee:     decimal.NewFromBigInt(history.BaseFee[len(history.BaseFee)-1], -9),
+		SafeTip:     tips[0],
+		StandardTip: tips[1],
+		FastTip:     tips[2],
+		Source:      o.Name(),
+		At:          time.Now(),
+	}, nil
+}
+
+// FixedGasOracle always returns the same estimate, a stand-in for development and tests
+type FixedGasOracle struct {
+	Fixed GasEstimate
+}
+
+func (o FixedGasOracle) Name() string {
+	return "fixed"
+}
+
+func (o FixedGasOracle) Estimate(ctx context.Context) (GasEstimate, error) {
+	estimate := o.Fixed
+	estimate.Source = o.Name()
+	estimate.At = time.Now()
+	return estimate, nil
+}
+
+// ParseGasFixture reads "base_fee=<gwei>,safe_tip=<gwei>,standard_tip=<gwei>,fast_tip=<gwei>"
+func ParseGasFixture(raw string) (GasEstimate, error) {
+	var estimate GasEstimate
+	fields := map[string]*decimal.Decimal{
+		"base_fee":     &estimate.BaseFee,
+		"safe_tip":     &estimate.SafeTip,
+		"standard_tip": &estimate.StandardTip,
+		"fast_tip":     &estimate.FastTip,
+	}
+	for _, _pair := range strings.Split(raw, ",") {
+		key, rawValue, found := strings.Cut(strings.TrimSpace(_pair), "=")
+		field, ok := fields[key]
+		if !found || !ok {
+			return GasEstimate{}, fmt.Errorf("malformed gas fixture %q", _pair)
+		}
+		value, err := decimal.NewFromString(rawValue)
+		if err != nil {
+			return GasEstimate{}, fmt.Errorf("malformed gas fixture %q: %v", _pair, err)
+		}
+		*field = value
+	}
+	if !estimate.BaseFee.IsPositive() {
+		return GasEstimate{}, errors.New("gas fixture needs a positive base_fee")
+	}
+	return estimate, nil
+}
+
+// FallbackGasOracle returns the estimate of the first source that answers
+type FallbackGasOracle struct {
+	Sources []GasOracle
+}
+
+func (o FallbackGasOracle) Name() string {
+	return "fallback"
+}
+
+func (o FallbackGasOracle) Estimate(ctx context.Context) (GasEstimate, error) {
+	var errs []error
+	for _, _source := range o.Sources {
+		estimate, err := _source.Estimate(ctx)
+		if err == nil {
+			return estimate, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %v", _source.Name(), err))
+	}
+	return GasEstimate{}, fmt.Errorf("%w: %v", ErrGasUnavailable, errors.Join(errs...))
+}
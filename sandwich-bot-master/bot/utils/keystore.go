@@ -0,0 +1,150 @@
+package utils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Wallet keys are sealed with their own data key (DEK), data keys are wrapped with the
+// key encryption key (KEK). The KEK never touches the database, it is read from
+// WALLET_KEK_FILE or WALLET_KEK as 32 hex encoded bytes.
+
+var ErrNoKEK = errors.New("wallet key encryption key is not configured, set WALLET_KEK_FILE or WALLET_KEK")
+
+var (
+	kek     []byte
+	kekErr  error
+	kekOnce sync.Once
+)
+
+func loadKEK() ([]byte, error) {
+	kekOnce.Do(func() {
+		raw := os.Getenv("WALLET_KEK")
+		if path := os.Getenv("WALLET_KEK_FILE"); path != "" {
+			file, err := os.ReadFile(path)
+			if err != nil {
+				kekErr = fmt.Errorf("failed to read WALLET_KEK_FILE: %w", err)
+				return
+			}
+			raw = string(file)
+		}
+		if raw == "" {
+			kekErr = ErrNoKEK
+			return
+		}
+
+		kek, kekErr = hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(raw), "0x"))
+		if kekErr == nil && len(kek) != 32 {
+			kekErr = fmt.Errorf("wallet key encryption key must be 32 bytes, got %d", len(kek))
+		}
+	})
+	return kek, kekErr
+}
+
+// KEKID identifies the KEK a data key was wrapped with without revealing it
+var KEKID = func() (string, error) {
+	key, err := loadKEK()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(append([]byte("kek-id:"), key...))
+	return hex.EncodeToString(sum[:8]), nil
+}
+
+func sealAESGCM(key, plaintext []byte) (string, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(gcm.Seal(nonce, nonce, plaintext, nil)), nil
+}
+
+func openAESGCM(key []byte, sealed string) ([]byte, error) {
+	data, err := hex.DecodeString(sealed)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("sealed data is too short")
+	}
+	return gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+}
+
+// SealPrivateKey encrypts privateKey with a fresh data key and wraps the data key with the KEK
+var SealPrivateKey = func(privateKey string) (sealedKey, wrappedKey, kekID string, err error) {
+	key, err := loadKEK()
+	if err != nil {
+		return "", "", "", err
+	}
+	if kekID, err = KEKID(); err != nil {
+		return "", "", "", err
+	}
+
+	dek := make([]byte, 32)
+	if _, err = rand.Read(dek); err != nil {
+		return "", "", "", err
+	}
+	defer wipe(dek)
+
+	if sealedKey, err = sealAESGCM(dek, []byte(privateKey)); err != nil {
+		return "", "", "", err
+	}
+	if wrappedKey, err = sealAESGCM(key, dek); err != nil {
+		return "", "", "", err
+	}
+
+	return sealedKey, wrappedKey, kekID, nil
+}
+
+// OpenPrivateKey unwraps the data key and decrypts the wallet key. Result should not be kept around.
+var OpenPrivateKey = func(sealedKey, wrappedKey, kekID string) ([]byte, error) {
+	key, err := loadKEK()
+	if err != nil {
+		return nil, err
+	}
+	currentID, err := KEKID()
+	if err != nil {
+		return nil, err
+	}
+	if kekID != currentID {
+		return nil, fmt.Errorf("wallet key was wrapped with KEK %s, configured KEK is %s", kekID, currentID)
+	}
+
+	dek, err := openAESGCM(key, wrappedKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+	defer wipe(dek)
+
+	return openAESGCM(dek, sealedKey)
+}
+
+func wipe(b []byte) {
+	for _i := range b {
+		b[_i] = 0
+	}
+}
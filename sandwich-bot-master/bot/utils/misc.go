@@ -4,142 +4,18 @@ import (
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"encoding/hex"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"log"
 	"math/big"
-	"net/http"
 	"strconv"
 	"strings"
-	"sync"
-	"time"
 
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/oklog/ulid/v2"
 	"github.com/shopspring/decimal"
 )
 
-// PriceInfo holds the price data and the last update timestamp
-
-type SafePairPrice struct {
-	Data       map[string]*PriceInfo
-	LastUpdate time.Time
-}
-
-type PriceInfo struct {
-	PairPrice  float64
-	Processing bool
-	Mutex      sync.Mutex
-}
-
-func (spp *SafePairPrice) ToggleLock(from string, processing bool) {
-	priceInfo, ok := spp.Data[from]
-	if !ok {
-		// If the key is not present in the map, create a new PriceInfo
-		priceInfo = &PriceInfo{
-			Processing: processing,
-		}
-	} else {
-		priceInfo.Mutex.Lock()
-		defer priceInfo.Mutex.Unlock()
-		priceInfo.Processing = processing
-	}
-	spp.Data[from] = priceInfo
-}
-
-// Global variable to hold the price
-
-var PairPriceInfo SafePairPrice
-
-func RetrievePairPrice(from, to []string) {
-	_from := strings.Join(from, ",")
-	_to := strings.Join(to, ",")
-
-	url := fmt.Sprintf("https://api.coingecko.com/api/v3/simple/price?ids=%s&vs_currencies=%s", _from, _to)
-
-	for _, _f := range from {
-		PairPriceInfo.ToggleLock(_f, true)
-	}
-
-	resp, err := http.Get(url)
-	if err != nil {
-		log.Printf("Failed to fetch %s-%s price: %v", from, to, err)
-		return
-	}
-	defer resp.Body.Close()
-
-	bodyBytes, err := io.ReadAll(resp.Body)
-	if err != nil {
-		log.Printf("Failed to read response body: %v", err)
-		return
-	}
-
-	// log.Printf("Response Body: %s", string(bodyBytes))
-
-	var result map[string]map[string]float64
-
-	if err := json.Unmarshal(bodyBytes, &result); err != nil {
-		log.Printf("Failed to decode response: %v", err)
-		return
-	}
-
-	for _, _f := range from {
-		if usdtPrice, ok := result[_f]["usd"]; ok {
-			priceInfo, ok := PairPriceInfo.Data[_f]
-			if !ok {
-				log.Printf("Price info not found for %s", _f)
-				continue
-			}
-			priceInfo.Mutex.Lock()
-			priceInfo.PairPrice = usdtPrice
-			priceInfo.Mutex.Unlock()
-			// log.Printf("Updated %s price: %f USDT", _f, usdtPrice)
-		} else {
-			log.Printf("%s price in USDT not found in response", _f)
-		}
-	}
-
-	PairPriceInfo.LastUpdate = time.Now()
-
-	for _, _f := range from {
-		PairPriceInfo.ToggleLock(_f, false)
-	}
-}
-
-// GetMaticPrice checks if the current price is older than 5 seconds and fetches a new one if necessary
-func GetPairPrice(from, to []string) SafePairPrice {
-	if PairPriceInfo.Data == nil {
-		PairPriceInfo.Data = make(map[string]*PriceInfo)
-	}
-	for _, _f := range from {
-		if _, exists := PairPriceInfo.Data[_f]; !exists {
-			PairPriceInfo.Data[_f] = &PriceInfo{}
-		}
-		PairPriceInfo.Data[_f].Mutex.Lock()
-		defer PairPriceInfo.Data[_f].Mutex.Unlock()
-	}
-
-	if time.Since(PairPriceInfo.LastUpdate) > 20*time.Second {
-		// Price is older than 5 seconds, fetch a new one
-		// Background task
-		_from := []string{}
-		for _, _f := range from {
-			if !PairPriceInfo.Data[_f].Processing {
-				_from = append(_from, _f)
-			}
-		}
-		if len(_from) > 0 {
-			// fmt.Println("CALL IS MADE")
-			go RetrievePairPrice(_from, to)
-		}
-	}
-
-	// Price is recent, return it
-	return PairPriceInfo
-}
-
 var MapContains = func(myMap map[string]string, value string) (*string, *string, bool) {
 
 	for _k, _v := range myMap {
@@ -287,3 +163,7 @@ var StringToInt32 = func(s string) *int32 {
 	i32 := int32(i)
 	return &i32
 }
+
+var StringToPointer = func(s string) *string {
+	return &s
+}
@@ -1,74 +1,106 @@
 package utils
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
-	"io/ioutil"
+	"errors"
+	"fmt"
 	"net/http"
-	"os"
-	"sync"
+	"net/url"
 	"time"
+
+	"github.com/shopspring/decimal"
 )
 
-type GasPriceDataType struct {
-	LastUpdated time.Time
-	Result      Result
-	mu          sync.Mutex
+// Result is a Polygonscan response, result holds the reason instead of data when status is not 1
+type Result struct {
+	Status  string          `json:"status"`
+	Message string          `json:"message"`
+	Result  json.RawMessage `json:"result"`
 }
 
-type Result struct {
-	Status string `json:"status"`
-	Result struct {
-		SafeGasPrice    string `json:"SafeGasPrice"`
-		ProposeGasPrice string `json:"ProposeGasPrice"`
-		FastGasPrice    string `json:"FastGasPrice"`
-		SuggestBaseFee  string `json:"suggestBaseFee"`
-		UsdPrice        string `json:"UsdPrice"`
-	} `json:"result"`
+type GasOracleResult struct {
+	SafeGasPrice    string `json:"SafeGasPrice"`
+	ProposeGasPrice string `json:"ProposeGasPrice"`
+	FastGasPrice    string `json:"FastGasPrice"`
+	SuggestBaseFee  string `json:"suggestBaseFee"`
+	UsdPrice        string `json:"UsdPrice"`
 }
 
-var GasPriceData GasPriceDataType
+// PolygonscanGasOracle reads the Polygonscan gas tracker, its gas prices include the base fee
+type PolygonscanGasOracle struct {
+	BaseURL string
+	APIKey  string
+	Client  *http.Client
+}
 
-func GetGasPrice() (*Result, error) {
-	GasPriceData.mu.Lock()
-	defer GasPriceData.mu.Unlock()
+func (o PolygonscanGasOracle) Name() string {
+	return "polygonscan"
+}
 
-	// If the gas price data is less than 5 seconds old, return it
-	if time.Since(GasPriceData.LastUpdated) < 10*time.Second {
-		return &GasPriceData.Result, nil
+func (o PolygonscanGasOracle) Estimate(ctx context.Context) (GasEstimate, error) {
+	client := o.Client
+	if client == nil {
+		client = http.DefaultClient
 	}
 
-	// log.Println("request to polygonscan for gas price")
-	polygonscan_api_key := os.Getenv("POLYGONSCAN_API_KEY")
-	resp, err := http.Get("https://api.polygonscan.com/api?module=gastracker&action=gasoracle&apikey=" + polygonscan_api_key)
+	query := url.Values{"module": {"gastracker"}, "action": {"gasoracle"}, "apikey": {o.APIKey}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, o.BaseURL+"?"+query.Encode(), nil)
 	if err != nil {
-		return nil, err
+		return GasEstimate{}, err
 	}
-	defer resp.Body.Close()
-
-	bodyBytes, err := ioutil.ReadAll(resp.Body)
+	resp, err := client.Do(req)
 	if err != nil {
-		return nil, err
+		return GasEstimate{}, err
 	}
-
-	// bodyString := string(bodyBytes)
-	// fmt.Println("PolyScan Gas: ", bodyString)
-	resp.Body = ioutil.NopCloser(bytes.NewBuffer(bodyBytes))
-
 	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return GasEstimate{}, fmt.Errorf("polygonscan responded %s", resp.Status)
+	}
 
 	var result Result
-	// bodyBytes, _ := ioutil.ReadAll(resp.Body)
-	// bodyString := string(bodyBytes)
-	// fmt.Println(bodyString)
-	// resp.Body = ioutil.NopCloser(bytes.NewBuffer(bodyBytes))
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, err
+		return GasEstimate{}, err
+	}
+	if result.Status != "1" {
+		return GasEstimate{}, fmt.Errorf("polygonscan: %s %s", result.Message, result.Result)
+	}
+	var gasOracle GasOracleResult
+	if err := json.Unmarshal(result.Result, &gasOracle); err != nil {
+		return GasEstimate{}, err
 	}
 
-	// Update the gas price data and its last updated time
-	GasPriceData.Result = result
-	GasPriceData.LastUpdated = time.Now()
+	var baseFee, safe, propose, fast decimal.Decimal
+	for _, _field := range []struct {
+		name  string
+		raw   string
+		value *decimal.Decimal
+	}{
+		{"suggestBaseFee", gasOracle.SuggestBaseFee, &baseFee},
+		{"SafeGasPrice", gasOracle.SafeGasPrice, &safe},
+		{"ProposeGasPrice", gasOracle.ProposeGasPrice, &propose},
+		{"FastGasPrice", gasOracle.FastGasPrice, &fast},
+	} {
+		if _field.raw == "" {
+			return GasEstimate{}, fmt.Errorf("polygonscan: %s is missing", _field.name)
+		}
+		if *_field.value, err = decimal.NewFromString(_field.raw); err != nil {
+			return GasEstimate{}, fmt.Errorf("polygonscan: malformed %s %q", _field.name, _field.raw)
+		}
+	}
+	if !baseFee.IsPositive() {
+		return GasEstimate{}, errors.New("polygonscan: base fee is not positive")
+	}
 
-	return &GasPriceData.Result, nil
+	tip := func(gasPrice decimal.Decimal) decimal.Decimal {
+		return decimal.Max(gasPrice.Sub(baseFee), decimal.Zero)
+	}
+	return GasEstimate{
+		BaseFee:     baseFee,
+		SafeTip:     tip(safe),
+		StandardTip: tip(propose),
+		FastTip:     tip(fast),
+		Source:      o.Name(),
+		At:          time.Now(),
+	}, nil
 }
@@ -0,0 +1,113 @@
+package utils
+
+import (
+	"bot/config"
+	"context"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// Service is a long running task owned by a Supervisor. It returns once ctx is cancelled,
+// an error or a panic restarts it, returning nil earlier means the work is done for good
+type Service func(ctx context.Context) error
+
+// Supervisor runs services under one root context and waits for all of them on shutdown
+type Supervisor struct {
+	ctx context.Context
+	wg  sync.WaitGroup
+}
+
+func NewSupervisor(ctx context.Context) *Supervisor {
+	return &Supervisor{ctx: ctx}
+}
+
+// Go starts service and restarts it with exponential backoff until the root context is cancelled.
+// The backoff is reset once the service ran longer than the maximum backoff
+func (s *Supervisor) Go(name string, service Service) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		backoff := config.SupervisorMinBackoff
+		for {
+			started := time.Now()
+			err := runService(s.ctx, service)
+			if s.ctx.Err() != nil {
+				log.Printf("Service %s stopped", name)
+				return
+			}
+			if err == nil {
+				log.Printf("Service %s finished", name)
+				return
+			}
+
+			if time.Since(started) > config.SupervisorMaxBackoff {
+				backoff = config.SupervisorMinBackoff
+			}
+			log.Printf("Service %s failed: %v. Restarting in %s", name, err, backoff)
+			if SleepContext(s.ctx, backoff) != nil {
+				log.Printf("Service %s stopped", name)
+				return
+			}
+			if backoff *= 2; backoff > config.SupervisorMaxBackoff {
+				backoff = config.SupervisorMaxBackoff
+			}
+		}
+	}()
+}
+
+// Wait blocks until every service returned or ctx expired
+func (s *Supervisor) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func runService(ctx context.Context, service Service) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v\n%s", r, debug.Stack())
+		}
+	}()
+	return service(ctx)
+}
+
+// Every calls fn right away and then on every tick of interval until ctx is cancelled
+func Every(ctx context.Context, interval time.Duration, fn func()) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		fn()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// SleepContext sleeps for d, it returns early with the context error once ctx is cancelled
+func SleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
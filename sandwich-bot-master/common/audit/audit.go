@@ -0,0 +1,254 @@
+// Package audit keeps the append-only audit logs of auth, bot and telegram. Each service stores its
+// log in a table of its own and keys the hash chain with a secret of its own
+package audit
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+const (
+	// appends racing for the same previous entry lose on its unique prev_hash and try again
+	appendAttempts = 5
+	redacted       = "[redacted]"
+)
+
+var (
+	// without a key anyone with write access to the table could rewrite entries and hash them again
+	ErrNoKey = errors.New("audit log key is not set")
+
+	// stops the walk over the audit log at the first broken entry
+	errBroken = errors.New("audit log is broken")
+
+	secretKeys     = []string{"pk", "mnemonic", "words", "phrase", "seed", "password", "secret", "signature"}
+	secretSuffixes = []string{"_key", "_secret", "_password", "_token"}
+)
+
+// Entry is a row of the append-only audit log. Every entry hashes the one before it, so editing
+// or deleting a row breaks the chain from there on
+type Entry struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `gorm:"index;not null" json:"created_at"`
+	UserID    *uint     `gorm:"index" json:"user_id"`
+	TgID      *int      `gorm:"index" json:"tg_id"`
+	Action    string    `gorm:"index;not null" json:"action"`
+	Method    string    `json:"method"`
+	// secrets are redacted before the payload is stored
+	Payload datatypes.JSON `json:"payload"`
+	// success, denied or error
+	Result string  `gorm:"not null" json:"result"`
+	Error  *string `json:"error"`
+	// unique, so two entries can never follow the same one
+	PrevHash string `gorm:"uniqueIndex;not null" json:"prev_hash"`
+	Hash     string `gorm:"uniqueIndex;not null" json:"hash"`
+}
+
+type Verification struct {
+	Valid    bool   `json:"valid"`
+	Entries  int64  `json:"entries"`
+	HeadHash string `json:"head_hash"`
+	// first entry whose link or hash does not match
+	BrokenAt *uint `json:"broken_at,omitempty"`
+}
+
+// Chain is the audit log kept in Table, entries are hashed with HMAC-SHA256 under Key
+type Chain struct {
+	Table string
+	Key   []byte
+}
+
+// Append links entry to the last one of the audit log and writes it
+func (c Chain) Append(db *gorm.DB, entry Entry) error {
+	if len(c.Key) == 0 {
+		return ErrNoKey
+	}
+
+	var err error
+	for _attempt := 0; _attempt < appendAttempts; _attempt++ {
+		var last []Entry
+		if err = db.Table(c.Table).Order("id DESC").Limit(1).Find(&last).Error; err != nil {
+			return err
+		}
+
+		entry.ID = 0
+		entry.PrevHash = ""
+		if len(last) > 0 {
+			entry.PrevHash = last[0].Hash
+		}
+		// stored with microsecond precision, the hash has to survive the round trip
+		entry.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+		if entry.Hash, err = c.Hash(entry); err != nil {
+			return err
+		}
+
+		if err = db.Table(c.Table).Create(&entry).Error; err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// Hash hashes an entry together with the hash of the entry before it
+func (c Chain) Hash(entry Entry) (string, error) {
+	payload, err := canonicalJSON(entry.Payload)
+	if err != nil {
+		return "", err
+	}
+
+	raw, err := json.Marshal([]interface{}{
+		entry.PrevHash,
+		entry.CreatedAt.UTC().Format(time.RFC3339Nano),
+		entry.UserID,
+		entry.TgID,
+		entry.Action,
+		entry.Method,
+		json.RawMessage(payload),
+		entry.Result,
+		entry.Error,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	mac := hmac.New(sha256.New, c.Key)
+	mac.Write(raw)
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// Verify walks the audit log from its first entry and reports the first one that does not link to
+// its predecessor or whose content does not match its hash
+func (c Chain) Verify(db *gorm.DB) (Verification, error) {
+	result := Verification{Valid: true}
+	if len(c.Key) == 0 {
+		return result, ErrNoKey
+	}
+
+	var entries []Entry
+	err := db.Table(c.Table).Order("id").FindInBatches(&entries, 500, func(tx *gorm.DB, batch int) error {
+		for _, _entry := range entries {
+			hash, err := c.Hash(_entry)
+			if err != nil {
+				return err
+			}
+			if _entry.PrevHash != result.HeadHash || !hmac.Equal([]byte(hash), []byte(_entry.Hash)) {
+				id := _entry.ID
+				result.Valid = false
+				result.BrokenAt = &id
+				return errBroken
+			}
+			result.HeadHash = _entry.Hash
+			result.Entries++
+		}
+		return nil
+	}).Error
+	if err != nil && !errors.Is(err, errBroken) {
+		return result, err
+	}
+	return result, nil
+}
+
+// canonicalJSON sorts keys and drops whitespace, Postgres does not keep a JSON document as written
+func canonicalJSON(raw []byte) ([]byte, error) {
+	if len(raw) == 0 {
+		return []byte("null"), nil
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return nil, err
+	}
+	return json.Marshal(value)
+}
+
+// Payload redacts secrets from a request payload and encodes it for an audit entry
+func Payload(payload map[string]interface{}) ([]byte, error) {
+	raw, err := json.Marshal(redact(payload))
+	if err != nil {
+		return nil, err
+	}
+	return canonicalJSON(raw)
+}
+
+func redact(value interface{}) interface{} {
+	switch _value := value.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(_value))
+		for _k, _v := range _value {
+			if secretKey(_k) {
+				result[_k] = redacted
+				continue
+			}
+			result[_k] = redact(_v)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(_value))
+		for _i, _v := range _value {
+			result[_i] = redact(_v)
+		}
+		return result
+	}
+	return value
+}
+
+func secretKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, _secret := range secretKeys {
+		if key == _secret {
+			return true
+		}
+	}
+	for _, _suffix := range secretSuffixes {
+		if strings.HasSuffix(key, _suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// CSV renders entries with one column per field, the payload stays JSON
+func CSV(entries []Entry) ([]byte, error) {
+	var buffer bytes.Buffer
+	writer := csv.NewWriter(&buffer)
+	writer.Write([]string{"id", "created_at", "user_id", "tg_id", "action", "method", "payload", "result", "error", "prev_hash", "hash"})
+
+	for _, _entry := range entries {
+		var userID, tgID, _error string
+		if _entry.UserID != nil {
+			userID = fmt.Sprint(*_entry.UserID)
+		}
+		if _entry.TgID != nil {
+			tgID = fmt.Sprint(*_entry.TgID)
+		}
+		if _entry.Error != nil {
+			_error = *_entry.Error
+		}
+		writer.Write([]string{
+			fmt.Sprint(_entry.ID),
+			_entry.CreatedAt.UTC().Format(time.RFC3339Nano),
+			userID,
+			tgID,
+			_entry.Action,
+			_entry.Method,
+			string(_entry.Payload),
+			_entry.Result,
+			_error,
+			_entry.PrevHash,
+			_entry.Hash,
+		})
+	}
+
+	writer.Flush()
+	return buffer.Bytes(), writer.Error()
+}
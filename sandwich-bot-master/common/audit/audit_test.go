@@ -0,0 +1,119 @@
+package audit
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newTestChain(t *testing.T) (*gorm.DB, Chain) {
+	t.Helper()
+	dsn := fmt.Sprintf("file:%s?mode=memory&cache=shared", strings.ReplaceAll(t.Name(), "/", "_"))
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	chain := Chain{Table: "test_audit_log", Key: []byte("test-key")}
+	if err := db.Table(chain.Table).AutoMigrate(&Entry{}); err != nil {
+		t.Fatal(err)
+	}
+	return db, chain
+}
+
+func appendEntries(t *testing.T, db *gorm.DB, chain Chain, actions ...string) {
+	t.Helper()
+	for _, _action := range actions {
+		payload, err := Payload(map[string]interface{}{"action": _action})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := chain.Append(db, Entry{Action: _action, Method: "POST", Payload: payload, Result: "success"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestChainVerify(t *testing.T) {
+	db, chain := newTestChain(t)
+	appendEntries(t, db, chain, "create_wallet", "rotate_wallet", "toggle_killswitch")
+
+	verification, err := chain.Verify(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var last Entry
+	db.Table(chain.Table).Last(&last)
+	if !verification.Valid || verification.Entries != 3 || verification.HeadHash != last.Hash {
+		t.Fatalf("verification: %+v", verification)
+	}
+
+	// another key does not verify the chain
+	if verification, _ := (Chain{Table: chain.Table, Key: []byte("other-key")}).Verify(db); verification.Valid {
+		t.Fatal("chain verified under another key")
+	}
+}
+
+func TestChainDetectsRewrite(t *testing.T) {
+	db, chain := newTestChain(t)
+	appendEntries(t, db, chain, "create_wallet", "rotate_wallet", "toggle_killswitch")
+
+	var entry Entry
+	db.Table(chain.Table).First(&entry, 2)
+	entry.Action = "retrieve_wallet"
+	// rehashing the rewritten entry takes the key, a plain hash or a guessed key breaks the chain
+	forged, err := (Chain{Key: []byte("guessed-key")}).Hash(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Table(chain.Table).Where("id = ?", entry.ID).Updates(map[string]interface{}{"action": entry.Action, "hash": forged}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	verification, err := chain.Verify(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verification.Valid || verification.BrokenAt == nil || *verification.BrokenAt != 2 || verification.Entries != 1 {
+		t.Fatalf("verification: %+v", verification)
+	}
+}
+
+func TestChainRequiresKey(t *testing.T) {
+	db, chain := newTestChain(t)
+	chain.Key = nil
+
+	if err := chain.Append(db, Entry{Action: "create_wallet", Result: "success"}); !errors.Is(err, ErrNoKey) {
+		t.Fatalf("want ErrNoKey, got %v", err)
+	}
+	if _, err := chain.Verify(db); !errors.Is(err, ErrNoKey) {
+		t.Fatalf("want ErrNoKey, got %v", err)
+	}
+}
+
+func TestPayloadRedactsSecrets(t *testing.T) {
+	payload, err := Payload(map[string]interface{}{
+		"name":       "main",
+		"pk":         "0xsecret",
+		"wallets":    []interface{}{map[string]interface{}{"address": "0xabc", "private_key": "0xsecret"}},
+		"Auth_Token": "token",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"Auth_Token":"[redacted]","name":"main","pk":"[redacted]","wallets":[{"address":"0xabc","private_key":"[redacted]"}]}`
+	if string(payload) != want {
+		t.Fatalf("payload: %s", payload)
+	}
+}
@@ -0,0 +1,18 @@
+module common
+
+go 1.20
+
+require (
+	github.com/shopspring/decimal v1.3.1
+	gorm.io/datatypes v1.2.0
+	gorm.io/driver/sqlite v1.4.3
+	gorm.io/gorm v1.25.7
+)
+
+require (
+	github.com/go-sql-driver/mysql v1.7.0 // indirect
+	github.com/jinzhu/inflection v1.0.0 // indirect
+	github.com/jinzhu/now v1.1.5 // indirect
+	github.com/mattn/go-sqlite3 v1.14.15 // indirect
+	gorm.io/driver/mysql v1.4.7 // indirect
+)
@@ -0,0 +1,210 @@
+// Package price quotes USD prices of assets for auth and bot. Every source is an Oracle, Median
+// combines several of them and TWAP smooths one that samples spot prices
+package price
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+var (
+	ErrUnavailable = errors.New("price is unavailable")
+	ErrStale       = errors.New("price is stale")
+)
+
+// Quote is the USD price of an asset, assets are named by their CoinGecko id
+type Quote struct {
+	Asset  string          `json:"asset"`
+	Price  decimal.Decimal `json:"price"`
+	Source string          `json:"source"`
+	At     time.Time       `json:"at"`
+}
+
+// Oracle returns USD prices of assets. Assets a source cannot price are left out of the result
+type Oracle interface {
+	Name() string
+	Prices(ctx context.Context, assets []string) (map[string]Quote, error)
+}
+
+// CoinGecko reads prices from the CoinGecko simple price API
+type CoinGecko struct {
+	BaseURL string
+	Client  *http.Client
+}
+
+func (o CoinGecko) Name() string {
+	return "coingecko"
+}
+
+func (o CoinGecko) Prices(ctx context.Context, assets []string) (map[string]Quote, error) {
+	client := o.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	query := url.Values{"ids": {strings.Join(assets, ",")}, "vs_currencies": {"usd"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, o.BaseURL+"/simple/price?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("coingecko responded %s", resp.Status)
+	}
+
+	// numbers are kept as written so prices are not rounded through float64
+	var result map[string]map[string]json.Number
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	quotes := map[string]Quote{}
+	for _, _asset := range assets {
+		raw, ok := result[_asset]["usd"]
+		if !ok {
+			continue
+		}
+		price, err := decimal.NewFromString(raw.String())
+		if err != nil {
+			return nil, fmt.Errorf("malformed %s price %q: %v", _asset, raw, err)
+		}
+		quotes[_asset] = Quote{Asset: _asset, Price: price, Source: o.Name(), At: now}
+	}
+	return quotes, nil
+}
+
+// Static returns fixed prices, for development and tests without price APIs
+type Static struct {
+	Quotes map[string]decimal.Decimal
+}
+
+func (o Static) Name() string {
+	return "static"
+}
+
+func (o Static) Prices(ctx context.Context, assets []string) (map[string]Quote, error) {
+	now := time.Now()
+	quotes := map[string]Quote{}
+	for _, _asset := range assets {
+		if price, ok := o.Quotes[_asset]; ok {
+			quotes[_asset] = Quote{Asset: _asset, Price: price, Source: o.Name(), At: now}
+		}
+	}
+	return quotes, nil
+}
+
+// ParseFixtures reads "<asset>=<price>" pairs separated by commas
+func ParseFixtures(raw string) (map[string]decimal.Decimal, error) {
+	fixtures := map[string]decimal.Decimal{}
+	for _, _pair := range strings.Split(raw, ",") {
+		if strings.TrimSpace(_pair) == "" {
+			continue
+		}
+		asset, rawPrice, found := strings.Cut(strings.TrimSpace(_pair), "=")
+		if !found || asset == "" {
+			return nil, fmt.Errorf("malformed price fixture %q", _pair)
+		}
+		price, err := decimal.NewFromString(rawPrice)
+		if err != nil {
+			return nil, fmt.Errorf("malformed price fixture %q: %v", _pair, err)
+		}
+		fixtures[asset] = price
+	}
+	return fixtures, nil
+}
+
+// Deviation is a source quoting an asset further from the median than allowed
+type Deviation struct {
+	Asset     string          `json:"asset"`
+	Source    string          `json:"source"`
+	Price     decimal.Decimal `json:"price"`
+	Median    decimal.Decimal `json:"median"`
+	Deviation decimal.Decimal `json:"deviation"`
+}
+
+// Median asks every source and returns the median of the quotes younger than MaxStaleness.
+// OnDeviation receives the quotes deviating more than MaxDeviation from the median after every call
+type Median struct {
+	Sources      []Oracle
+	MaxStaleness time.Duration
+	MaxDeviation decimal.Decimal
+	OnDeviation  func([]Deviation)
+}
+
+func (o Median) Name() string {
+	return "median"
+}
+
+func (o Median) Prices(ctx context.Context, assets []string) (map[string]Quote, error) {
+	results := make([]map[string]Quote, len(o.Sources))
+	errs := make([]error, len(o.Sources))
+	var wg sync.WaitGroup
+	for _i, _source := range o.Sources {
+		wg.Add(1)
+		go func(i int, source Oracle) {
+			defer wg.Done()
+			if results[i], errs[i] = source.Prices(ctx, assets); errs[i] != nil {
+				errs[i] = fmt.Errorf("%s: %v", source.Name(), errs[i])
+			}
+		}(_i, _source)
+	}
+	wg.Wait()
+
+	now := time.Now()
+	quotes := map[string]Quote{}
+	deviations := []Deviation{}
+	for _, _asset := range assets {
+		var fresh []Quote
+		for _, _result := range results {
+			if quote, ok := _result[_asset]; ok && now.Sub(quote.At) <= o.MaxStaleness && quote.Price.IsPositive() {
+				fresh = append(fresh, quote)
+			}
+		}
+		if len(fresh) == 0 {
+			continue
+		}
+
+		sort.Slice(fresh, func(i, j int) bool {
+			return fresh[i].Price.LessThan(fresh[j].Price)
+		})
+		median := fresh[len(fresh)/2].Price
+		if len(fresh)%2 == 0 {
+			median = median.Add(fresh[len(fresh)/2-1].Price).Div(decimal.NewFromInt(2))
+		}
+		// the median is as old as its oldest input
+		at := fresh[0].At
+		for _, _quote := range fresh {
+			if _quote.At.Before(at) {
+				at = _quote.At
+			}
+			deviation := _quote.Price.Sub(median).Abs().Div(median)
+			if deviation.GreaterThan(o.MaxDeviation) {
+				deviations = append(deviations, Deviation{Asset: _asset, Source: _quote.Source, Price: _quote.Price, Median: median, Deviation: deviation})
+			}
+		}
+		quotes[_asset] = Quote{Asset: _asset, Price: median, Source: o.Name(), At: at}
+	}
+
+	if o.OnDeviation != nil {
+		o.OnDeviation(deviations)
+	}
+	if len(quotes) == 0 {
+		return nil, fmt.Errorf("%w: %v", ErrUnavailable, errors.Join(errs...))
+	}
+	return quotes, nil
+}
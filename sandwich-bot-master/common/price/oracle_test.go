@@ -0,0 +1,162 @@
+package price
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// coinGeckoStandIn serves /simple/price from a fixed body, the way CoinGecko writes it
+type coinGeckoStandIn struct {
+	mu     sync.Mutex
+	status int
+	body   string
+	query  string
+}
+
+func (cg *coinGeckoStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	cg.mu.Lock()
+	defer cg.mu.Unlock()
+	if r.URL.Path != "/simple/price" {
+		http.NotFound(w, r)
+		return
+	}
+	cg.query = r.URL.RawQuery
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(cg.status)
+	fmt.Fprint(w, cg.body)
+}
+
+func newCoinGecko(t *testing.T, status int, body string) (*coinGeckoStandIn, CoinGecko) {
+	t.Helper()
+	standIn := &coinGeckoStandIn{status: status, body: body}
+	server := httptest.NewServer(standIn)
+	t.Cleanup(server.Close)
+	return standIn, CoinGecko{BaseURL: server.URL, Client: server.Client()}
+}
+
+// fixedOracle quotes prices taken at a given time, to feed the median stale quotes
+type fixedOracle struct {
+	name   string
+	quotes map[string]string
+	at     time.Time
+	err    error
+}
+
+func (o fixedOracle) Name() string {
+	return o.name
+}
+
+func (o fixedOracle) Prices(ctx context.Context, assets []string) (map[string]Quote, error) {
+	if o.err != nil {
+		return nil, o.err
+	}
+	quotes := map[string]Quote{}
+	for _, _asset := range assets {
+		if price, ok := o.quotes[_asset]; ok {
+			quotes[_asset] = Quote{Asset: _asset, Price: decimal.RequireFromString(price), Source: o.name, At: o.at}
+		}
+	}
+	return quotes, nil
+}
+
+func TestCoinGeckoOracle(t *testing.T) {
+	standIn, oracle := newCoinGecko(t, http.StatusOK, `{"matic-network":{"usd":0.712345678901234567},"ethereum":{"usd":3100.5}}`)
+
+	quotes, err := oracle.Prices(context.Background(), []string{"matic-network", "ethereum", "bitcoin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(standIn.query, "ids=matic-network%2Cethereum%2Cbitcoin") || !strings.Contains(standIn.query, "vs_currencies=usd") {
+		t.Fatalf("query: %s", standIn.query)
+	}
+	// prices are not rounded through float64
+	if quote := quotes["matic-network"]; quote.Price.String() != "0.712345678901234567" || quote.Source != "coingecko" {
+		t.Fatalf("matic quote: %+v", quote)
+	}
+	if quote := quotes["ethereum"]; !quote.Price.Equal(decimal.RequireFromString("3100.5")) {
+		t.Fatalf("ethereum quote: %+v", quote)
+	}
+	if _, ok := quotes["bitcoin"]; ok {
+		t.Fatal("asset missing from the response was quoted")
+	}
+}
+
+func TestCoinGeckoOracleErrors(t *testing.T) {
+	_, oracle := newCoinGecko(t, http.StatusTooManyRequests, `{"status":{"error_code":429}}`)
+	if _, err := oracle.Prices(context.Background(), []string{"ethereum"}); err == nil || !strings.Contains(err.Error(), "429") {
+		t.Fatalf("rate limited: %v", err)
+	}
+
+	_, oracle = newCoinGecko(t, http.StatusOK, `{"ethereum":{"usd":"n/a"}}`)
+	if _, err := oracle.Prices(context.Background(), []string{"ethereum"}); err == nil {
+		t.Fatal("malformed price was accepted")
+	}
+}
+
+func TestMedianOracle(t *testing.T) {
+	_, coinGecko := newCoinGecko(t, http.StatusOK, `{"ethereum":{"usd":3000},"matic-network":{"usd":0.70}}`)
+	now := time.Now()
+
+	var deviations []Deviation
+	oracle := Median{
+		Sources: []Oracle{
+			coinGecko,
+			fixedOracle{name: "dex_twap", quotes: map[string]string{"ethereum": "3010", "matic-network": "0.71"}, at: now.Add(-time.Second)},
+			fixedOracle{name: "static", quotes: map[string]string{"ethereum": "3400"}, at: now},
+		},
+		MaxStaleness: time.Minute,
+		MaxDeviation: decimal.NewFromFloat(0.02),
+		OnDeviation:  func(d []Deviation) { deviations = d },
+	}
+
+	quotes, err := oracle.Prices(context.Background(), []string{"ethereum", "matic-network"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// odd count takes the middle quote, even count the mean of both middle quotes
+	if quote := quotes["ethereum"]; !quote.Price.Equal(decimal.NewFromInt(3010)) || quote.Source != "median" {
+		t.Fatalf("ethereum median: %+v", quote)
+	}
+	if quote := quotes["matic-network"]; !quote.Price.Equal(decimal.RequireFromString("0.705")) {
+		t.Fatalf("matic median: %+v", quote)
+	}
+	// the median is as old as its oldest input
+	if quote := quotes["ethereum"]; !quote.At.Equal(now.Add(-time.Second)) {
+		t.Fatalf("median time: %v, want %v", quote.At, now.Add(-time.Second))
+	}
+
+	if len(deviations) != 1 || deviations[0].Asset != "ethereum" || deviations[0].Source != "static" || !deviations[0].Median.Equal(decimal.NewFromInt(3010)) {
+		t.Fatalf("deviations: %+v", deviations)
+	}
+}
+
+func TestMedianOracleStaleness(t *testing.T) {
+	now := time.Now()
+	stale := fixedOracle{name: "stale", quotes: map[string]string{"ethereum": "1000"}, at: now.Add(-2 * time.Minute)}
+	fresh := fixedOracle{name: "fresh", quotes: map[string]string{"ethereum": "3000"}, at: now}
+
+	oracle := Median{Sources: []Oracle{stale, fresh}, MaxStaleness: time.Minute, MaxDeviation: decimal.NewFromFloat(0.02)}
+	quotes, err := oracle.Prices(context.Background(), []string{"ethereum"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if quote := quotes["ethereum"]; !quote.Price.Equal(decimal.NewFromInt(3000)) {
+		t.Fatalf("stale quote went into the median: %+v", quote)
+	}
+
+	// only stale quotes and failing sources leave nothing to price
+	failing := fixedOracle{name: "failing", err: errors.New("timeout")}
+	oracle.Sources = []Oracle{stale, failing}
+	if _, err := oracle.Prices(context.Background(), []string{"ethereum"}); !errors.Is(err, ErrUnavailable) || !strings.Contains(err.Error(), "failing: timeout") {
+		t.Fatalf("want ErrUnavailable with the source error, got %v", err)
+	}
+}
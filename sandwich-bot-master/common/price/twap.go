@@ -0,0 +1,74 @@
+package price
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// SpotFunc returns the current price of the assets it can price, with the error of the ones it could not
+type SpotFunc func(ctx context.Context, assets []string) (map[string]decimal.Decimal, error)
+
+type sample struct {
+	price decimal.Decimal
+	at    time.Time
+}
+
+// TWAP samples spot prices on every call and returns the time weighted average of the samples within window
+type TWAP struct {
+	name    string
+	window  time.Duration
+	spot    SpotFunc
+	mu      sync.Mutex
+	samples map[string][]sample
+}
+
+func NewTWAP(name string, window time.Duration, spot SpotFunc) *TWAP {
+	return &TWAP{name: name, window: window, spot: spot, samples: map[string][]sample{}}
+}
+
+func (o *TWAP) Name() string {
+	return o.name
+}
+
+func (o *TWAP) Prices(ctx context.Context, assets []string) (map[string]Quote, error) {
+	spots, err := o.spot(ctx, assets)
+	if len(spots) == 0 && err != nil {
+		return nil, err
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	now := time.Now()
+	quotes := map[string]Quote{}
+	for _asset, _price := range spots {
+		samples := append(o.samples[_asset], sample{price: _price, at: now})
+		for len(samples) > 1 && now.Sub(samples[0].at) > o.window {
+			samples = samples[1:]
+		}
+		o.samples[_asset] = samples
+		quotes[_asset] = Quote{Asset: _asset, Price: timeWeighted(samples, now), Source: o.name, At: now}
+	}
+	return quotes, nil
+}
+
+// timeWeighted averages samples, each weighted by how long it was the latest one
+func timeWeighted(samples []sample, now time.Time) decimal.Decimal {
+	weighted, total := decimal.Zero, decimal.Zero
+	for _i, _sample := range samples {
+		end := now
+		if _i+1 < len(samples) {
+			end = samples[_i+1].at
+		}
+		weight := decimal.NewFromInt(end.Sub(_sample.at).Milliseconds())
+		weighted = weighted.Add(_sample.price.Mul(weight))
+		total = total.Add(weight)
+	}
+	if total.IsZero() {
+		return samples[len(samples)-1].price
+	}
+	return weighted.Div(total)
+}
@@ -0,0 +1,54 @@
+package price
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestTimeWeighted(t *testing.T) {
+	now := time.Now()
+	samples := []sample{
+		{price: decimal.NewFromInt(1), at: now.Add(-4 * time.Second)},
+		{price: decimal.NewFromInt(3), at: now.Add(-time.Second)},
+	}
+	// 1 was the latest for three seconds, 3 for one
+	if average := timeWeighted(samples, now); !average.Equal(decimal.RequireFromString("1.5")) {
+		t.Fatalf("average: %s", average)
+	}
+	if average := timeWeighted(samples[1:2], samples[1].at); !average.Equal(decimal.NewFromInt(3)) {
+		t.Fatalf("single sample: %s", average)
+	}
+}
+
+func TestTWAP(t *testing.T) {
+	spots := map[string]decimal.Decimal{"matic-network": decimal.NewFromInt(2)}
+	spotErr := errors.New("weth: no pair against the stable coin")
+	oracle := NewTWAP("dex_twap", time.Minute, func(ctx context.Context, assets []string) (map[string]decimal.Decimal, error) {
+		return spots, spotErr
+	})
+
+	// assets the spot source could price are quoted despite the others failing
+	quotes, err := oracle.Prices(context.Background(), []string{"matic-network", "weth"})
+	if err != nil || len(quotes) != 1 || !quotes["matic-network"].Price.Equal(decimal.NewFromInt(2)) || quotes["matic-network"].Source != "dex_twap" {
+		t.Fatalf("quotes %+v: %v", quotes, err)
+	}
+
+	// samples outside the window are dropped, the latest one is always kept
+	oracle.samples["matic-network"][0].at = time.Now().Add(-2 * time.Minute)
+	spots["matic-network"] = decimal.NewFromInt(4)
+	if _, err := oracle.Prices(context.Background(), []string{"matic-network"}); err != nil {
+		t.Fatal(err)
+	}
+	if samples := oracle.samples["matic-network"]; len(samples) != 1 || !samples[0].price.Equal(decimal.NewFromInt(4)) {
+		t.Fatalf("samples: %+v", samples)
+	}
+
+	spots = nil
+	if _, err := oracle.Prices(context.Background(), []string{"matic-network"}); !errors.Is(err, spotErr) {
+		t.Fatalf("want the spot error, got %v", err)
+	}
+}
@@ -0,0 +1,171 @@
+// Package signature signs the requests auth, bot and telegram send each other and verifies them on
+// arrival. Every service signs with a secret of its own, the receiver knows the secret of each caller
+package signature
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Headers of a signed internal request
+const (
+	HeaderService   = "X-Service-Name"
+	HeaderTimestamp = "X-Timestamp"
+	HeaderNonce     = "X-Nonce"
+	HeaderUserID    = "X-User-ID"
+	HeaderSignature = "X-Signature"
+)
+
+var (
+	ErrUnsignedRequest  = errors.New("Request is not signed.")
+	ErrInvalidSignature = errors.New("Invalid request signature.")
+	ErrStaleRequest     = errors.New("Request timestamp is outside of the accepted window.")
+	ErrReplayedRequest  = errors.New("Request nonce was already used.")
+)
+
+// Caller is the service that signed a request and the user it signed the request for, if any
+type Caller struct {
+	Service string
+	UserID  *uint
+}
+
+// Payload is the canonical string both sides sign
+func Payload(method, requestURI, timestamp, nonce, userID string, body []byte) string {
+	bodyHash := sha256.Sum256(body)
+	return strings.Join([]string{method, requestURI, timestamp, nonce, userID, hex.EncodeToString(bodyHash[:])}, "\n")
+}
+
+func Sign(secret, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignRequest adds service identity, timestamp, nonce and signature to request. body has to be exactly
+// what is sent, the user id is taken from an X-User-ID header set before.
+func SignRequest(request *http.Request, body []byte, service, secret string) error {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	_nonce := hex.EncodeToString(nonce)
+	request.Header.Set(HeaderService, service)
+	request.Header.Set(HeaderTimestamp, timestamp)
+	request.Header.Set(HeaderNonce, _nonce)
+	request.Header.Set(HeaderSignature, Sign(secret, Payload(request.Method, request.URL.RequestURI(), timestamp, _nonce, request.Header.Get(HeaderUserID), body)))
+	return nil
+}
+
+// Verifier accepts requests signed by the services it has a secret of, within maxSkew of its clock
+type Verifier struct {
+	secrets map[string]string
+	maxSkew time.Duration
+	nonces  nonceStore
+}
+
+func NewVerifier(secrets map[string]string, maxSkew time.Duration) *Verifier {
+	return &Verifier{secrets: secrets, maxSkew: maxSkew, nonces: nonceStore{seen: map[string]time.Time{}}}
+}
+
+// Verify authenticates the calling service and leaves the request body readable
+func (v *Verifier) Verify(request *http.Request) (*Caller, error) {
+	service := request.Header.Get(HeaderService)
+	timestamp := request.Header.Get(HeaderTimestamp)
+	nonce := request.Header.Get(HeaderNonce)
+	signature := request.Header.Get(HeaderSignature)
+	userID := request.Header.Get(HeaderUserID)
+
+	if service == "" || timestamp == "" || nonce == "" || signature == "" {
+		return nil, ErrUnsignedRequest
+	}
+
+	secret, ok := v.secrets[service]
+	if !ok {
+		return nil, ErrInvalidSignature
+	}
+
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, ErrStaleRequest
+	}
+	now := time.Now()
+	if skew := now.Sub(time.Unix(unix, 0)); skew > v.maxSkew || skew < -v.maxSkew {
+		return nil, ErrStaleRequest
+	}
+
+	var body []byte
+	if request.Body != nil {
+		if body, err = io.ReadAll(request.Body); err != nil {
+			return nil, err
+		}
+		request.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	expected := Sign(secret, Payload(request.Method, request.RequestURI, timestamp, nonce, userID, body))
+	if !hmac.Equal([]byte(expected), []byte(strings.ToLower(signature))) {
+		return nil, ErrInvalidSignature
+	}
+
+	// checked after the signature so forged requests cannot burn nonces. A timestamp is accepted
+	// maxSkew either side of now, so a nonce is remembered for twice that
+	if !v.nonces.use(service+":"+nonce, now, 2*v.maxSkew) {
+		return nil, ErrReplayedRequest
+	}
+
+	caller := &Caller{Service: service}
+	if userID != "" {
+		_userID, err := strconv.ParseUint(userID, 10, 64)
+		if err != nil {
+			return nil, ErrInvalidSignature
+		}
+		_uint := uint(_userID)
+		caller.UserID = &_uint
+	}
+
+	return caller, nil
+}
+
+type usedNonce struct {
+	nonce  string
+	usedAt time.Time
+}
+
+type nonceStore struct {
+	sync.Mutex
+	seen map[string]time.Time
+	// nonces in the order they were used, which is also the order they expire in
+	queue []usedNonce
+}
+
+// use remembers nonce and reports false when it was seen within ttl. Only the expired front of the
+// queue is dropped, so a request does not pay for every nonce the store holds
+func (ns *nonceStore) use(nonce string, now time.Time, ttl time.Duration) bool {
+	ns.Lock()
+	defer ns.Unlock()
+
+	expired := 0
+	for expired < len(ns.queue) && now.Sub(ns.queue[expired].usedAt) > ttl {
+		delete(ns.seen, ns.queue[expired].nonce)
+		expired++
+	}
+	ns.queue = ns.queue[expired:]
+
+	if _, exists := ns.seen[nonce]; exists {
+		return false
+	}
+	ns.seen[nonce] = now
+	ns.queue = append(ns.queue, usedNonce{nonce: nonce, usedAt: now})
+	return true
+}
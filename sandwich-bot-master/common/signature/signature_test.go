@@ -0,0 +1,119 @@
+package signature
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// signedRequest builds a request signed at the given time, body is what the signature covers
+func signedRequest(service, secret, userID, nonce string, at time.Time, body string) *http.Request {
+	request := httptest.NewRequest("POST", "/auth/api/v1/approve_request?x=1", strings.NewReader(body))
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	request.Header.Set(HeaderService, service)
+	request.Header.Set(HeaderTimestamp, timestamp)
+	request.Header.Set(HeaderNonce, nonce)
+	if userID != "" {
+		request.Header.Set(HeaderUserID, userID)
+	}
+	request.Header.Set(HeaderSignature, Sign(secret, Payload("POST", "/auth/api/v1/approve_request?x=1", timestamp, nonce, userID, []byte(body))))
+	return request
+}
+
+func TestVerify(t *testing.T) {
+	verifier := NewVerifier(map[string]string{"telegram": "secret"}, time.Minute)
+	now := time.Now()
+	// the nonce of this one is used before the cases run
+	replayed := signedRequest("telegram", "secret", "7", "used", now, `{}`)
+	if _, err := verifier.Verify(signedRequest("telegram", "secret", "7", "used", now, `{}`)); err != nil {
+		t.Fatal(err)
+	}
+	tampered := signedRequest("telegram", "secret", "7", "tampered", now, `{"amount":1}`)
+	tampered.Body = io.NopCloser(strings.NewReader(`{"amount":100}`))
+	forgedUser := signedRequest("telegram", "secret", "7", "forged-user", now, `{}`)
+	forgedUser.Header.Set(HeaderUserID, "8")
+	unsigned := signedRequest("telegram", "secret", "", "unsigned", now, `{}`)
+	unsigned.Header.Del(HeaderSignature)
+
+	cases := []struct {
+		name    string
+		request *http.Request
+		want    error
+	}{
+		{"valid", signedRequest("telegram", "secret", "7", "valid", now, `{}`), nil},
+		{"valid within skew", signedRequest("telegram", "secret", "", "early", now.Add(-50*time.Second), `{}`), nil},
+		{"too old", signedRequest("telegram", "secret", "", "old", now.Add(-2*time.Minute), `{}`), ErrStaleRequest},
+		{"from the future", signedRequest("telegram", "secret", "", "future", now.Add(2*time.Minute), `{}`), ErrStaleRequest},
+		{"replayed", replayed, ErrReplayedRequest},
+		{"tampered body", tampered, ErrInvalidSignature},
+		{"forged user", forgedUser, ErrInvalidSignature},
+		{"wrong secret", signedRequest("telegram", "other", "", "wrong-secret", now, `{}`), ErrInvalidSignature},
+		{"unknown service", signedRequest("stranger", "secret", "", "stranger", now, `{}`), ErrInvalidSignature},
+		{"unsigned", unsigned, ErrUnsignedRequest},
+	}
+	for _, _case := range cases {
+		t.Run(_case.name, func(t *testing.T) {
+			caller, err := verifier.Verify(_case.request)
+			if !errors.Is(err, _case.want) {
+				t.Fatalf("want %v, got %v", _case.want, err)
+			}
+			if err != nil {
+				return
+			}
+			if caller.Service != "telegram" {
+				t.Fatalf("caller: %+v", caller)
+			}
+			// the body stays readable for the handler
+			if body, _ := io.ReadAll(_case.request.Body); string(body) != `{}` {
+				t.Fatalf("body: %q", body)
+			}
+		})
+	}
+}
+
+func TestVerifyUserID(t *testing.T) {
+	verifier := NewVerifier(map[string]string{"bot": "secret"}, time.Minute)
+	caller, err := verifier.Verify(signedRequest("bot", "secret", "7", "user", time.Now(), `{}`))
+	if err != nil || caller.UserID == nil || *caller.UserID != 7 {
+		t.Fatalf("caller %+v: %v", caller, err)
+	}
+	if _, err := verifier.Verify(signedRequest("bot", "secret", "seven", "bad-user", time.Now(), `{}`)); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("want ErrInvalidSignature, got %v", err)
+	}
+}
+
+func TestSignRequest(t *testing.T) {
+	verifier := NewVerifier(map[string]string{"bot": "secret"}, time.Minute)
+	request := httptest.NewRequest("GET", "/auth/api/v1/retrieve_approval_request?request_id=r-1", nil)
+	request.Header.Set(HeaderUserID, "3")
+	if err := SignRequest(request, nil, "bot", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	if caller, err := verifier.Verify(request); err != nil || *caller.UserID != 3 {
+		t.Fatalf("caller %+v: %v", caller, err)
+	}
+}
+
+func TestNonceStoreExpiry(t *testing.T) {
+	store := nonceStore{seen: map[string]time.Time{}}
+	now := time.Now()
+	for _i := 0; _i < 100; _i++ {
+		store.use(strconv.Itoa(_i), now.Add(time.Duration(_i)*time.Second), time.Minute)
+	}
+	if store.use("99", now.Add(100*time.Second), time.Minute) {
+		t.Fatal("nonce used twice within its window")
+	}
+
+	// only the nonces of the last minute are still held
+	if !store.use("0", now.Add(100*time.Second), time.Minute) {
+		t.Fatal("expired nonce was refused")
+	}
+	if len(store.seen) != 61 || len(store.queue) != 61 {
+		t.Fatalf("store holds %d nonces, queue %d", len(store.seen), len(store.queue))
+	}
+}
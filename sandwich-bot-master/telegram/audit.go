@@ -0,0 +1,331 @@
+package main
+
+import (
+	"common/audit"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"telegram/controllers"
+	"telegram/handlers"
+	"telegram/models"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"gorm.io/gorm"
+)
+
+const (
+	auditSuccess = "success"
+	auditDenied  = "denied"
+	auditError   = "error"
+
+	// entries /audit lists, newest first
+	auditViewLimit = 15
+	// rows of one telegram CSV export, the services cap theirs the same
+	auditExportLimit = 10000
+	// Telegram refuses longer callback data
+	maxCallbackData = 64
+)
+
+// auditServices keep an audit log each, telegram its own and auth and bot one behind their endpoints
+var auditServices = []string{"auth", "bot", "telegram"}
+
+func auditResult(err error) string {
+	if err != nil {
+		return auditError
+	}
+	return auditSuccess
+}
+
+// recordAudit appends an update handled by an administrative route to the telegram audit log
+func recordAudit(c *updateContext, _route route, result string, err error) {
+	action := strings.TrimSuffix(_route.key, ":")
+	if c.update.Message != nil && c.update.Message.IsCommand() {
+		action = "/" + action
+	}
+
+	data := c.data
+	if _route.secret {
+		data = "[redacted]"
+	}
+	payload, _err := audit.Payload(map[string]interface{}{
+		"chat_id": c.chatID,
+		"data":    data,
+	})
+	if _err != nil {
+		log.Printf("Failed to encode %s for the audit log: %v", action, _err)
+		return
+	}
+
+	entry := models.AuditEntry{
+		Action:  action,
+		Method:  auditMethod(c),
+		Payload: payload,
+		Result:  result,
+	}
+	if c.user != nil {
+		userID := c.user.ID
+		entry.UserID = &userID
+	}
+	if c.tgID != 0 {
+		tgID := c.tgID
+		entry.TgID = &tgID
+	}
+	if err != nil {
+		_error := err.Error()
+		entry.Error = &_error
+	}
+
+	if _err := controllers.AppendAudit(entry); _err != nil {
+		log.Printf("Failed to append %s to the audit log: %v", action, _err)
+	}
+}
+
+// auditMethod names the kind of update, the telegram counterpart of an HTTP method
+func auditMethod(c *updateContext) string {
+	switch {
+	case c.update.CallbackQuery != nil:
+		return "callback"
+	case c.update.Message != nil && c.update.Message.IsCommand():
+		return "command"
+	}
+	return "message"
+}
+
+// auditFilter narrows an audit log down to one service, user and action
+type auditFilter struct {
+	service string
+	userID  *uint
+	action  string
+}
+
+// parseAuditFilter reads /audit [auth|bot|telegram] [user id] [action] in any order
+func parseAuditFilter(arguments []string) (auditFilter, error) {
+	filter := auditFilter{service: "telegram"}
+	for _, _argument := range arguments {
+		if _argument == "" || _argument == "-" {
+			continue
+		}
+		if isAuditService(_argument) {
+			filter.service = _argument
+			continue
+		}
+		if userID, err := strconv.ParseUint(_argument, 10, 64); err == nil {
+			_userID := uint(userID)
+			filter.userID = &_userID
+			continue
+		}
+		if filter.action != "" {
+			return filter, fmt.Errorf("unexpected argument %s, use /audit [auth|bot|telegram] [user id] [action]", _argument)
+		}
+		filter.action = _argument
+	}
+	return filter, nil
+}
+
+func isAuditService(service string) bool {
+	for _, _service := range auditServices {
+		if _service == service {
+			return true
+		}
+	}
+	return false
+}
+
+func (f auditFilter) payload(userID uint) map[string]interface{} {
+	payload := map[string]interface{}{"user_id": userID}
+	if f.userID != nil {
+		payload["audit_user_id"] = *f.userID
+	}
+	if f.action != "" {
+		payload["action"] = f.action
+	}
+	return payload
+}
+
+// callbackData encodes the filter for the export button, empty when it does not fit
+func (f auditFilter) callbackData() string {
+	userID := ""
+	if f.userID != nil {
+		userID = fmt.Sprint(*f.userID)
+	}
+	data := strings.Join([]string{"audit_export:" + f.service, userID, f.action}, ":")
+	if len(data) > maxCallbackData {
+		return ""
+	}
+	return data
+}
+
+func (f auditFilter) query(tx *gorm.DB) *gorm.DB {
+	query := tx.Model(&models.AuditEntry{})
+	if f.userID != nil {
+		query = query.Where("user_id = ?", *f.userID)
+	}
+	if f.action != "" {
+		query = query.Where("action = ?", f.action)
+	}
+	return query
+}
+
+// sendAuditLog lists the latest entries of an audit log together with the state of its hash chain
+func sendAuditLog(c *updateContext) error {
+	filter, err := parseAuditFilter(strings.Fields(c.update.Message.CommandArguments()))
+	if err != nil {
+		return err
+	}
+
+	var verification map[string]interface{}
+	var entries []interface{}
+	if filter.service == "telegram" {
+		_verification, err := controllers.VerifyAuditLog()
+		if err != nil {
+			return err
+		}
+		verification = map[string]interface{}{
+			"valid":     _verification.Valid,
+			"entries":   _verification.Entries,
+			"broken_at": _verification.BrokenAt,
+		}
+
+		var _entries []models.AuditEntry
+		if err := filter.query(controllers.DB).Order("id DESC").Limit(auditViewLimit).Find(&_entries).Error; err != nil {
+			return err
+		}
+		for _, _entry := range _entries {
+			entries = append(entries, map[string]interface{}{
+				"id":         _entry.ID,
+				"created_at": _entry.CreatedAt,
+				"user_id":    _entry.UserID,
+				"tg_id":      _entry.TgID,
+				"action":     _entry.Action,
+				"result":     _entry.Result,
+				"error":      _entry.Error,
+			})
+		}
+	} else {
+		_response, err := handlers.GenericRequest("GET", filter.service, "verify_audit_log", map[string]interface{}{
+			"user_id": c.userID(),
+		})
+		if err != nil {
+			return err
+		}
+		if verification, _ = _response.Data.(map[string]interface{}); verification == nil {
+			return errors.New(orMessage(_response.Message, "failed to verify the audit log"))
+		}
+
+		payload := filter.payload(c.userID())
+		payload["limit"] = auditViewLimit
+		if _response, err = handlers.GenericRequest("GET", filter.service, "retrieve_audit_log", payload); err != nil {
+			return err
+		}
+		entries, _ = _response.Data.([]interface{})
+	}
+
+	text := fmt.Sprintf("Audit log of %s: ", filter.service)
+	if valid, _ := verification["valid"].(bool); valid {
+		text += fmt.Sprintf("chain intact over %v entries.", verification["entries"])
+	} else {
+		text += fmt.Sprintf("⚠️ chain broken at entry %v!", formatAuditValue(verification["broken_at"]))
+	}
+	if len(entries) == 0 {
+		text += "\nNo entries match."
+	}
+	for _, _entry := range entries {
+		entry, ok := _entry.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		createdAt := formatAuditValue(entry["created_at"])
+		if t, ok := entry["created_at"].(time.Time); ok {
+			createdAt = t.UTC().Format(time.RFC3339)
+		}
+		text += fmt.Sprintf("\n#%v %s user %s (tg %s) %v: %v",
+			formatAuditValue(entry["id"]), createdAt, formatAuditValue(entry["user_id"]), formatAuditValue(entry["tg_id"]), entry["action"], entry["result"])
+		if entry["error"] != nil {
+			text += fmt.Sprintf(", %s", formatAuditValue(entry["error"]))
+		}
+	}
+
+	msg := tgbotapi.NewMessage(c.chatID, text)
+	if data := filter.callbackData(); data != "" {
+		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("Export CSV", data),
+			),
+		)
+	}
+	c.bot.Send(msg)
+	return nil
+}
+
+// exportAuditLog sends the audit log the export button was made for as a CSV document
+func exportAuditLog(c *updateContext) error {
+	parts := strings.SplitN(c.data, ":", 3)
+	if len(parts) != 3 || !isAuditService(parts[0]) {
+		return errors.New("invalid audit export")
+	}
+	filter, err := parseAuditFilter(parts)
+	if err != nil {
+		return err
+	}
+
+	var content []byte
+	if filter.service == "telegram" {
+		var entries []audit.Entry
+		if err := filter.query(controllers.DB).Order("id DESC").Limit(auditExportLimit).Find(&entries).Error; err != nil {
+			return err
+		}
+		for _i, _j := 0, len(entries)-1; _i < _j; _i, _j = _i+1, _j-1 {
+			entries[_i], entries[_j] = entries[_j], entries[_i]
+		}
+		if content, err = audit.CSV(entries); err != nil {
+			return err
+		}
+	} else if content, err = handlers.DownloadRequest(filter.service, "export_audit_log", filter.payload(c.userID())); err != nil {
+		return err
+	}
+
+	document := tgbotapi.NewDocumentUpload(c.chatID, tgbotapi.FileBytes{
+		Name:  fmt.Sprintf("%s_audit_log_%s.csv", filter.service, time.Now().UTC().Format("20060102T150405Z")),
+		Bytes: content,
+	})
+	if _, err := c.bot.Send(document); err != nil {
+		return fmt.Errorf("failed to send the export: %w", err)
+	}
+	return nil
+}
+
+// formatAuditValue prints JSON numbers without exponent and missing values as -
+func formatAuditValue(value interface{}) string {
+	switch _value := value.(type) {
+	case nil:
+		return "-"
+	case float64:
+		return strconv.FormatFloat(_value, 'f', -1, 64)
+	case *uint:
+		if _value == nil {
+			return "-"
+		}
+		return fmt.Sprint(*_value)
+	case *int:
+		if _value == nil {
+			return "-"
+		}
+		return fmt.Sprint(*_value)
+	case *string:
+		if _value == nil {
+			return "-"
+		}
+		return *_value
+	}
+	return fmt.Sprint(value)
+}
+
+func orMessage(message, fallback string) string {
+	if message != "" {
+		return message
+	}
+	return fallback
+}
@@ -19,9 +19,24 @@ type TelegramConfig struct {
 	LogDirectory string `json:"log_directory"`
 	MaxLogSize   int64  `json:"max_log_size"`
 	Debug        bool   `json:"debug"`
+	// Identity and HMAC secret used to sign requests to auth and bot
+	ServiceName   string `json:"service_name"`
+	ServiceSecret string `json:"service_secret"`
+	// HMAC key of the audit log hash chain, entries can not be rewritten and hashed again without it
+	AuditSecret string `json:"audit_secret"`
+	// Updates are received on webhook_listen when webhook_url is set, long polling is used otherwise.
+	// Telegram sends webhook_secret in the X-Telegram-Bot-Api-Secret-Token header
+	WebhookURL    string `json:"webhook_url"`
+	WebhookListen string `json:"webhook_listen"`
+	WebhookSecret string `json:"webhook_secret"`
+	// Bot API server used instead of api.telegram.org, e.g. a local or a fake one
+	BotAPIURL string `json:"bot_api_url"`
 }
 
-func init() {
+var ErrWebhookSecret = errors.New("webhook_secret is required with webhook_url, anyone knowing webhook_url could send updates otherwise")
+
+// Load reads .env.json, main calls it before anything else uses Telegram
+func Load() {
 	file, err := os.ReadFile(".env.json")
 	if err != nil {
 		log.Fatalf("Error loading .env.json file: %v", err)
@@ -30,6 +45,30 @@ func init() {
 	if err := json.Unmarshal(file, &Telegram); err != nil {
 		log.Fatalf("Error unmarshalling .env.json: %v", err)
 	}
+
+	if Telegram.ServiceName == "" {
+		Telegram.ServiceName = "telegram"
+	}
+	if Telegram.ServiceSecret == "" {
+		log.Println("Warning: service_secret is not set, auth and bot will reject internal requests")
+	}
+	if Telegram.AuditSecret == "" {
+		log.Println("Warning: audit_secret is not set, administrative actions will not be audited")
+	}
+	if Telegram.WebhookURL != "" && Telegram.WebhookListen == "" {
+		Telegram.WebhookListen = ":8443"
+	}
+	if err := Telegram.Validate(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// Validate refuses settings the bot must not start with
+func (tc TelegramConfig) Validate() error {
+	if tc.WebhookURL != "" && tc.WebhookSecret == "" {
+		return ErrWebhookSecret
+	}
+	return nil
 }
 
 var InternalEndpoint = func(_service, path string, args ...interface{}) (*url.URL, error) {
@@ -0,0 +1,23 @@
+package controllers
+
+import (
+	"common/audit"
+	"telegram/config"
+	"telegram/models"
+)
+
+// auditLog is the hash chain of telegram_audit_log, keyed with audit_secret
+func auditLog() audit.Chain {
+	return audit.Chain{Table: models.AuditEntry{}.TableName(), Key: []byte(config.Telegram.AuditSecret)}
+}
+
+// AppendAudit links entry to the last one of the audit log and writes it
+func AppendAudit(entry models.AuditEntry) error {
+	return auditLog().Append(DB, audit.Entry(entry))
+}
+
+// VerifyAuditLog walks the audit log from its first entry and reports the first one that does not
+// link to its predecessor or whose content does not match its hash
+func VerifyAuditLog() (audit.Verification, error) {
+	return auditLog().Verify(DB)
+}
@@ -3,6 +3,7 @@ package controllers
 import (
 	"fmt"
 	"os"
+	"telegram/models"
 
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
@@ -10,6 +11,18 @@ import (
 
 var DB *gorm.DB
 
+// Models are migrated on every start
+var Models = []interface{}{
+	&models.UpdateOffset{},
+	&models.Conversation{},
+	&models.Subscription{},
+	&models.EventDelivery{},
+	&models.AuditEntry{},
+	// &models.BotSettings{},
+	// &models.Contract{},
+	// &models.KillSwitch{},
+}
+
 func ConnectDatabase() {
 	var err error
 
@@ -30,9 +43,5 @@ func ConnectDatabase() {
 		panic("Failed to connect to database!")
 	}
 
-	DB.AutoMigrate(
-	// &models.BotSettings{},
-	// &models.Contract{},
-	// &models.KillSwitch{},
-	)
+	DB.AutoMigrate(Models...)
 }
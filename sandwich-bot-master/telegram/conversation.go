@@ -0,0 +1,354 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"telegram/controllers"
+	"telegram/models"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// a conversation nobody answers for this long is dropped, every answer extends it
+	conversationTimeout       = 10 * time.Minute
+	conversationCheckInterval = time.Minute
+	// answers an optional step
+	skipAnswer = "-"
+)
+
+// stepType decides how the answer to a step is validated and normalized
+type stepType string
+
+const (
+	textStep        stepType = "text"
+	integerStep     stepType = "integer"
+	numberStep      stepType = "number"
+	addressStep     stepType = "address"
+	addressListStep stepType = "address_list"
+	privateKeyStep  stepType = "private_key"
+	wordsStep       stepType = "words"
+)
+
+var (
+	addressPattern    = regexp.MustCompile(`^0x[0-9a-fA-F]{40}$`)
+	privateKeyPattern = regexp.MustCompile(`^(0x)?[0-9a-fA-F]{64}$`)
+)
+
+// flowStep is one question of a flow, its answer is stored under key
+type flowStep struct {
+	key      string
+	kind     stepType
+	optional bool
+	// prompt may use the flow data and the answers collected so far
+	prompt func(data map[string]string) (string, error)
+	// validate checks a normalized answer further, e.g. against a range
+	validate func(value string, data map[string]string) error
+	// answers of secret steps are never written to the database, so a secret step has to be the last one
+	secret bool
+}
+
+// conversationFlow is a multi-step dialog, finish runs once every step is answered
+type conversationFlow struct {
+	// checked when the flow starts and again on every answer
+	permission string
+	steps      []flowStep
+	finish     func(c *updateContext, data map[string]string) error
+}
+
+var conversationFlows = map[string]*conversationFlow{}
+
+// registerFlow makes a flow available to startConversation
+func registerFlow(name string, flow *conversationFlow) {
+	for _i, _step := range flow.steps {
+		if _step.secret && _i != len(flow.steps)-1 {
+			panic(fmt.Sprintf("flow %s: secret step %s is not the last one", name, _step.key))
+		}
+	}
+	conversationFlows[name] = flow
+}
+
+func staticPrompt(text string) func(map[string]string) (string, error) {
+	return func(map[string]string) (string, error) {
+		return text, nil
+	}
+}
+
+// startConversation puts the chat at the first step of a flow and asks its question. A conversation
+// the chat was in is dropped
+func startConversation(bot *tgbotapi.BotAPI, chatID int64, tgID int, name string, data map[string]string) error {
+	flow, ok := conversationFlows[name]
+	if !ok {
+		return fmt.Errorf("unknown flow %s", name)
+	}
+	if data == nil {
+		data = map[string]string{}
+	}
+
+	conversation := &models.Conversation{
+		ChatID: chatID,
+		TgID:   tgID,
+		Flow:   name,
+	}
+	return advanceConversation(bot, conversation, flow, flow.steps[0], data)
+}
+
+// advanceConversation stores the conversation at step and asks its question
+func advanceConversation(bot *tgbotapi.BotAPI, conversation *models.Conversation, flow *conversationFlow, step flowStep, data map[string]string) error {
+	prompt, err := step.prompt(data)
+	if err != nil {
+		return err
+	}
+
+	rawData, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	conversation.Step = step.key
+	conversation.Data = rawData
+	conversation.ExpiresAt = time.Now().Add(conversationTimeout)
+	if err := controllers.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "chat_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"tg_id", "flow", "step", "data", "expires_at", "updated_at"}),
+	}).Create(conversation).Error; err != nil {
+		return err
+	}
+
+	if step.optional {
+		prompt += fmt.Sprintf(" (send %s to skip)", skipAnswer)
+	}
+	sendPrompt(bot, conversation.ChatID, prompt)
+	return nil
+}
+
+func sendPrompt(bot *tgbotapi.BotAPI, chatID int64, text string) {
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ReplyMarkup = tgbotapi.ForceReply{
+		ForceReply: true,
+		Selective:  true,
+	}
+	bot.Send(msg)
+}
+
+// loadConversation is the conversation of a chat, nil when it is in none
+func loadConversation(chatID int64) (*models.Conversation, error) {
+	// most messages are outside of a conversation, Find does not log them as missing records
+	var conversations []models.Conversation
+	if err := controllers.DB.Limit(1).Find(&conversations, "chat_id = ?", chatID).Error; err != nil {
+		return nil, err
+	}
+	if len(conversations) == 0 {
+		return nil, nil
+	}
+	return &conversations[0], nil
+}
+
+func endConversation(chatID int64) error {
+	return controllers.DB.Delete(&models.Conversation{}, "chat_id = ?", chatID).Error
+}
+
+// converse hands a message to the conversation of its chat, messages outside of one are ignored
+func (r *Router) converse(c *updateContext) {
+	conversation, err := loadConversation(c.chatID)
+	if err != nil {
+		log.Printf("Failed to load conversation of chat %d: %v", c.chatID, err)
+		return
+	}
+	if conversation == nil || conversation.TgID != c.tgID {
+		return
+	}
+
+	if time.Now().After(conversation.ExpiresAt) {
+		if err := endConversation(c.chatID); err != nil {
+			log.Printf("Failed to end conversation of chat %d: %v", c.chatID, err)
+		}
+		c.reply("This conversation timed out, please start it again.")
+		return
+	}
+
+	flow, ok := conversationFlows[conversation.Flow]
+	if !ok {
+		endConversation(c.chatID)
+		c.reply("This conversation is no longer supported, please start it again.")
+		return
+	}
+
+	secret := false
+	for _, _step := range flow.steps {
+		if _step.key == conversation.Step {
+			secret = _step.secret
+		}
+	}
+
+	c.data = c.update.Message.Text
+	r.run(c, route{key: conversation.Flow + ":" + conversation.Step, permission: flow.permission, secret: secret, handle: func(c *updateContext) error {
+		return answerStep(c, conversation, flow)
+	}})
+}
+
+// answerStep validates the answer to the current step and moves on to the next one, or finishes the flow
+func answerStep(c *updateContext, conversation *models.Conversation, flow *conversationFlow) error {
+	data := map[string]string{}
+	if err := json.Unmarshal(conversation.Data, &data); err != nil {
+		return err
+	}
+
+	current := -1
+	for _i, _step := range flow.steps {
+		if _step.key == conversation.Step {
+			current = _i
+			break
+		}
+	}
+	if current < 0 {
+		endConversation(c.chatID)
+		return fmt.Errorf("unknown step %s, please start again", conversation.Step)
+	}
+	step := flow.steps[current]
+
+	value, err := parseAnswer(step, c.data, data)
+	if err != nil {
+		// the conversation stays at the step until it gets a valid answer
+		c.reply(fmt.Sprintf("Invalid answer: %v, please try again or send /cancel.", err))
+		return nil
+	}
+	data[step.key] = value
+
+	if current+1 < len(flow.steps) {
+		return advanceConversation(c.bot, conversation, flow, flow.steps[current+1], data)
+	}
+
+	// ended before finishing, a failed finish is started over instead of retried with stale answers
+	if err := endConversation(c.chatID); err != nil {
+		return err
+	}
+	return flow.finish(c, data)
+}
+
+// parseAnswer validates an answer by the type of its step and returns it normalized
+func parseAnswer(step flowStep, answer string, data map[string]string) (string, error) {
+	value := strings.TrimSpace(answer)
+	if value == "" {
+		return "", errors.New("the answer is empty")
+	}
+	if step.optional && value == skipAnswer {
+		return "", nil
+	}
+
+	switch step.kind {
+	case integerStep:
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			return "", errors.New("the answer should be a whole number")
+		}
+	case numberStep:
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return "", errors.New("the answer should be a number")
+		}
+	case addressStep:
+		if !addressPattern.MatchString(value) {
+			return "", errors.New("the answer should be an address, 0x followed by 40 hex characters")
+		}
+		value = strings.ToLower(value)
+	case addressListStep:
+		var addresses []string
+		for _, _address := range strings.Split(value, ",") {
+			if _address = strings.TrimSpace(_address); _address == "" {
+				continue
+			}
+			if !addressPattern.MatchString(_address) {
+				return "", fmt.Errorf("%s is not an address", _address)
+			}
+			addresses = append(addresses, strings.ToLower(_address))
+		}
+		if len(addresses) == 0 {
+			return "", errors.New("no contracts were provided")
+		}
+		value = strings.Join(addresses, ",")
+	case privateKeyStep:
+		if !privateKeyPattern.MatchString(value) {
+			return "", errors.New("the answer should be a private key, 64 hex characters")
+		}
+	case wordsStep:
+		value = strings.Join(strings.Fields(strings.ToLower(value)), " ")
+	}
+
+	if step.validate != nil {
+		if err := step.validate(value, data); err != nil {
+			return "", err
+		}
+	}
+	return value, nil
+}
+
+func cancelConversation(c *updateContext) error {
+	conversation, err := loadConversation(c.chatID)
+	if err != nil {
+		return err
+	}
+	if conversation == nil || conversation.TgID != c.tgID {
+		c.reply("There is nothing to cancel.")
+		return nil
+	}
+
+	if err := endConversation(c.chatID); err != nil {
+		return err
+	}
+	c.reply("Cancelled.")
+	return nil
+}
+
+// resumeConversations asks the current question of every conversation again after a restart
+func resumeConversations(bot *tgbotapi.BotAPI) {
+	var conversations []models.Conversation
+	if err := controllers.DB.Find(&conversations, "expires_at > ?", time.Now()).Error; err != nil {
+		log.Printf("Failed to resume conversations: %v", err)
+		return
+	}
+
+	for _, _conversation := range conversations {
+		flow, ok := conversationFlows[_conversation.Flow]
+		if !ok {
+			continue
+		}
+		data := map[string]string{}
+		json.Unmarshal(_conversation.Data, &data)
+		for _, _step := range flow.steps {
+			if _step.key != _conversation.Step {
+				continue
+			}
+			if prompt, err := _step.prompt(data); err == nil {
+				sendPrompt(bot, _conversation.ChatID, prompt)
+			}
+		}
+	}
+}
+
+// expireConversations drops conversations nobody answered in time and tells their chats
+func expireConversations(bot *tgbotapi.BotAPI) {
+	ticker := time.NewTicker(conversationCheckInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		var conversations []models.Conversation
+		if err := controllers.DB.Find(&conversations, "expires_at <= ?", time.Now()).Error; err != nil {
+			log.Printf("Failed to expire conversations: %v", err)
+			continue
+		}
+
+		for _, _conversation := range conversations {
+			// answered meanwhile when the expiry moved
+			result := controllers.DB.Delete(&models.Conversation{}, "chat_id = ? AND expires_at = ?", _conversation.ChatID, _conversation.ExpiresAt)
+			if result.Error != nil || result.RowsAffected == 0 {
+				continue
+			}
+			bot.Send(tgbotapi.NewMessage(_conversation.ChatID, "This conversation timed out, please start it again."))
+		}
+	}
+}
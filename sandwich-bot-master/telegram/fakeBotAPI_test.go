@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+const fakeBotID = 1
+
+// fakeSentMessage is a message the bot sent through the fake Bot API
+type fakeSentMessage struct {
+	MessageID   int             `json:"message_id"`
+	ChatID      int64           `json:"chat_id"`
+	Text        string          `json:"text"`
+	ParseMode   string          `json:"parse_mode,omitempty"`
+	ReplyMarkup json.RawMessage `json:"reply_markup,omitempty"`
+	// file name and content of a sent document or photo, Text holds its caption
+	Document        string `json:"document,omitempty"`
+	DocumentContent []byte `json:"document_content,omitempty"`
+}
+
+// fakeBotAPI is an in-memory Bot API server to run the bot against end to end. Updates pushed to it
+// are served by getUpdates or posted to the webhook the bot set, messages the bot sends are recorded
+type fakeBotAPI struct {
+	token string
+
+	mu            sync.Mutex
+	updates       []tgbotapi.Update
+	nextUpdateID  int
+	nextMessageID int
+	sent          []fakeSentMessage
+	webhookURL    string
+	webhookSecret string
+	// closed and replaced whenever an update is pushed, wakes up long polls
+	pushed chan struct{}
+}
+
+func newFakeBotAPI(token string) *fakeBotAPI {
+	return &fakeBotAPI{
+		token:        token,
+		nextUpdateID: 1,
+		pushed:       make(chan struct{}),
+	}
+}
+
+// PushUpdate queues update for the bot, or posts it to the webhook when one is set. The update id is
+// assigned when it is not set
+func (f *fakeBotAPI) PushUpdate(update tgbotapi.Update) (int, error) {
+	f.mu.Lock()
+	if update.UpdateID == 0 {
+		update.UpdateID = f.nextUpdateID
+	}
+	if update.UpdateID >= f.nextUpdateID {
+		f.nextUpdateID = update.UpdateID + 1
+	}
+	webhookURL, webhookSecret := f.webhookURL, f.webhookSecret
+	if webhookURL == "" {
+		f.updates = append(f.updates, update)
+		close(f.pushed)
+		f.pushed = make(chan struct{})
+	}
+	f.mu.Unlock()
+
+	if webhookURL == "" {
+		return update.UpdateID, nil
+	}
+
+	body, err := json.Marshal(update)
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequest("POST", webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if webhookSecret != "" {
+		req.Header.Set("X-Telegram-Bot-Api-Secret-Token", webhookSecret)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return update.UpdateID, nil
+}
+
+// Sent is every message the bot sent so far, oldest first
+func (f *fakeBotAPI) Sent() []fakeSentMessage {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]fakeSentMessage(nil), f.sent...)
+}
+
+func (f *fakeBotAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token, method, found := strings.Cut(strings.TrimPrefix(r.URL.Path, "/bot"), "/")
+	if !found || !strings.HasPrefix(r.URL.Path, "/bot") {
+		fakeAPIError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	if token != f.token {
+		fakeAPIError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		fakeAPIError(w, http.StatusBadRequest, "Bad Request: "+err.Error())
+		return
+	}
+
+	switch method {
+	case "getMe":
+		fakeAPIResult(w, tgbotapi.User{ID: fakeBotID, IsBot: true, FirstName: "Fake", UserName: "fake_bot"})
+	case "getUpdates":
+		f.serveGetUpdates(w, r)
+	case "sendMessage":
+		f.serveSendMessage(w, r)
+	case "sendDocument":
+		f.serveSendFile(w, r, "document")
+	case "sendPhoto":
+		f.serveSendFile(w, r, "photo")
+	case "answerCallbackQuery":
+		fakeAPIResult(w, true)
+	case "setWebhook":
+		f.mu.Lock()
+		f.webhookURL = r.Form.Get("url")
+		f.webhookSecret = r.Form.Get("secret_token")
+		f.mu.Unlock()
+		fakeAPIResult(w, true)
+	case "deleteWebhook":
+		f.mu.Lock()
+		f.webhookURL, f.webhookSecret = "", ""
+		f.mu.Unlock()
+		fakeAPIResult(w, true)
+	default:
+		fakeAPIError(w, http.StatusNotFound, "Not Found: method not found")
+	}
+}
+
+// serveGetUpdates drops updates below offset like Telegram does and long polls for timeout seconds
+func (f *fakeBotAPI) serveGetUpdates(w http.ResponseWriter, r *http.Request) {
+	offset, _ := strconv.Atoi(r.Form.Get("offset"))
+	limit, _ := strconv.Atoi(r.Form.Get("limit"))
+	if limit <= 0 || limit > 100 {
+		limit = 100
+	}
+	timeout, _ := strconv.Atoi(r.Form.Get("timeout"))
+	deadline := time.After(time.Duration(timeout) * time.Second)
+
+	for {
+		f.mu.Lock()
+		if f.webhookURL != "" {
+			f.mu.Unlock()
+			fakeAPIError(w, http.StatusConflict, "Conflict: can't use getUpdates method while webhook is active")
+			return
+		}
+		pending := f.updates[:0]
+		for _, _update := range f.updates {
+			if _update.UpdateID >= offset {
+				pending = append(pending, _update)
+			}
+		}
+		f.updates = pending
+		if len(pending) > limit {
+			pending = pending[:limit]
+		}
+		result := append([]tgbotapi.Update{}, pending...)
+		pushed := f.pushed
+		f.mu.Unlock()
+
+		if len(result) > 0 {
+			fakeAPIResult(w, result)
+			return
+		}
+		select {
+		case <-pushed:
+		case <-deadline:
+			fakeAPIResult(w, result)
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func (f *fakeBotAPI) serveSendMessage(w http.ResponseWriter, r *http.Request) {
+	chatID, err := strconv.ParseInt(r.Form.Get("chat_id"), 10, 64)
+	if err != nil {
+		fakeAPIError(w, http.StatusBadRequest, "Bad Request: chat not found")
+		return
+	}
+	text := r.Form.Get("text")
+	if text == "" {
+		fakeAPIError(w, http.StatusBadRequest, "Bad Request: message text is empty")
+		return
+	}
+
+	f.mu.Lock()
+	f.nextMessageID++
+	sent := fakeSentMessage{
+		MessageID: f.nextMessageID,
+		ChatID:    chatID,
+		Text:      text,
+		ParseMode: r.Form.Get("parse_mode"),
+	}
+	if markup := r.Form.Get("reply_markup"); markup != "" {
+		sent.ReplyMarkup = json.RawMessage(markup)
+	}
+	f.sent = append(f.sent, sent)
+	f.mu.Unlock()
+
+	fakeAPIResult(w, tgbotapi.Message{
+		MessageID: sent.MessageID,
+		From:      &tgbotapi.User{ID: fakeBotID, IsBot: true, FirstName: "Fake", UserName: "fake_bot"},
+		Date:      int(time.Now().Unix()),
+		Chat:      &tgbotapi.Chat{ID: chatID},
+		Text:      text,
+	})
+}
+
+// serveSendFile records an uploaded document or photo, files sent by file id or URL are refused
+func (f *fakeBotAPI) serveSendFile(w http.ResponseWriter, r *http.Request, field string) {
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		fakeAPIError(w, http.StatusBadRequest, "Bad Request: "+err.Error())
+		return
+	}
+	chatID, err := strconv.ParseInt(r.FormValue("chat_id"), 10, 64)
+	if err != nil {
+		fakeAPIError(w, http.StatusBadRequest, "Bad Request: chat not found")
+		return
+	}
+	file, header, err := r.FormFile(field)
+	if err != nil {
+		fakeAPIError(w, http.StatusBadRequest, "Bad Request: there is no "+field+" in the request")
+		return
+	}
+	defer file.Close()
+	content, err := io.ReadAll(file)
+	if err != nil {
+		fakeAPIError(w, http.StatusBadRequest, "Bad Request: "+err.Error())
+		return
+	}
+
+	f.mu.Lock()
+	f.nextMessageID++
+	sent := fakeSentMessage{
+		MessageID:       f.nextMessageID,
+		ChatID:          chatID,
+		Text:            r.FormValue("caption"),
+		Document:        header.Filename,
+		DocumentContent: content,
+	}
+	f.sent = append(f.sent, sent)
+	f.mu.Unlock()
+
+	message := tgbotapi.Message{
+		MessageID: sent.MessageID,
+		From:      &tgbotapi.User{ID: fakeBotID, IsBot: true, FirstName: "Fake", UserName: "fake_bot"},
+		Date:      int(time.Now().Unix()),
+		Chat:      &tgbotapi.Chat{ID: chatID},
+		Caption:   sent.Text,
+	}
+	fileID := fmt.Sprintf("fake-%d", sent.MessageID)
+	if field == "photo" {
+		message.Photo = &[]tgbotapi.PhotoSize{{FileID: fileID, FileSize: len(content)}}
+	} else {
+		message.Document = &tgbotapi.Document{FileID: fileID, FileName: header.Filename, FileSize: len(content)}
+	}
+	fakeAPIResult(w, message)
+}
+
+func fakeAPIResult(w http.ResponseWriter, result interface{}) {
+	raw, err := json.Marshal(result)
+	if err != nil {
+		fakeAPIError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeFakeJSON(w, http.StatusOK, tgbotapi.APIResponse{Ok: true, Result: raw})
+}
+
+func fakeAPIError(w http.ResponseWriter, status int, description string) {
+	writeFakeJSON(w, status, tgbotapi.APIResponse{ErrorCode: status, Description: description})
+}
+
+func writeFakeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"telegram/handlers"
+)
+
+// registerFlows registers the multi-step dialogs of the bot, they are started by the buttons in routes.go
+func registerFlows() {
+	// data: key, type of the setting
+	registerFlow("setting", &conversationFlow{
+		permission: "update_settings",
+		steps: []flowStep{{
+			key:  "value",
+			kind: numberStep,
+			prompt: func(data map[string]string) (string, error) {
+				field, err := settingField(data["key"])
+				if err != nil {
+					return "", err
+				}
+
+				prompt := fmt.Sprintf("Please enter the new value for %v: %v, %v", field["title"], field["description"], field["type"])
+				if field["min"] != nil || field["max"] != nil {
+					prompt += fmt.Sprintf(" from %v to %v", orAny(field["min"]), orAny(field["max"]))
+				}
+				return prompt + fmt.Sprintf(" %v (default %v)", field["unit"], field["default"]), nil
+			},
+			// ranges are validated by the bot against its settings schema
+			validate: func(value string, data map[string]string) error {
+				if _, err := strconv.ParseInt(value, 10, 64); data["type"] == "integer" && err != nil {
+					return fmt.Errorf("%s should be a whole number", data["key"])
+				}
+				return nil
+			},
+		}},
+		finish: func(c *updateContext, data map[string]string) error {
+			_response, err := handlers.BotRequest("PATCH", "update_settings", map[string]interface{}{
+				"user_id":   c.userID(),
+				data["key"]: data["value"],
+			})
+			if err != nil {
+				return err
+			}
+
+			c.reply(_response.Message)
+			return nil
+		},
+	})
+
+	// data: list, either whitelist or blacklist
+	registerFlow("list_contracts", &conversationFlow{
+		permission: "manage_contracts",
+		steps: []flowStep{{
+			key:  "contracts",
+			kind: addressListStep,
+			prompt: func(data map[string]string) (string, error) {
+				return fmt.Sprintf("Please enter contracts to %s:", data["list"]), nil
+			},
+		}},
+		finish: func(c *updateContext, data map[string]string) error {
+			_payload := map[string]interface{}{
+				"user_id": c.userID(),
+				"address": strings.Split(data["contracts"], ","),
+			}
+			if data["list"] == "blacklist" {
+				_payload["blacklist"] = true
+			}
+
+			_response, err := handlers.GenericRequest("PUT", "bot", "create_contract", _payload)
+			if err != nil {
+				return err
+			}
+
+			c.replyMarkdown(_response.Message)
+			return nil
+		},
+	})
+
+	registerFlow("find_contract", &conversationFlow{
+		permission: "find_contract",
+		steps: []flowStep{{
+			key:    "address",
+			kind:   textStep,
+			prompt: staticPrompt("Please enter contract address:"),
+		}},
+		finish: func(c *updateContext, data map[string]string) error {
+			_response, err := handlers.GenericRequest("GET", "bot", "retrieve_contract", map[string]interface{}{
+				"user_id":         c.userID(),
+				"address_partial": data["address"],
+			})
+			if err != nil {
+				return err
+			}
+
+			c.replyMarkdown(_response.Message)
+			return nil
+		},
+	})
+
+	registerFlow("add_DEX", &conversationFlow{
+		permission: "manage_contracts",
+		steps: []flowStep{
+			{key: "address", kind: addressStep, prompt: staticPrompt("Please enter the router address of the DEX:")},
+			{key: "name", kind: textStep, prompt: staticPrompt("Please enter the name of the DEX (uniswapv3 or quickswap):")},
+		},
+		finish: func(c *updateContext, data map[string]string) error {
+			return manageDEXOrCoin(c, "PUT", "connect_dex", map[string]interface{}{
+				"address": data["address"],
+				"type":    data["name"],
+			})
+		},
+	})
+
+	registerFlow("add_coin", &conversationFlow{
+		permission: "manage_contracts",
+		steps: []flowStep{
+			{key: "address", kind: addressStep, prompt: staticPrompt("Please enter the contract address of the coin:")},
+			{
+				key:    "decimals",
+				kind:   integerStep,
+				prompt: staticPrompt("Please enter the decimals of the coin (6 or 18):"),
+				validate: func(value string, data map[string]string) error {
+					if decimals, _ := strconv.Atoi(value); decimals < 0 || decimals > 36 {
+						return fmt.Errorf("decimals should be from 0 to 36")
+					}
+					return nil
+				},
+			},
+			{key: "name", kind: textStep, prompt: staticPrompt("Please enter the name of the coin (usdt or dai):")},
+		},
+		finish: func(c *updateContext, data map[string]string) error {
+			decimals, _ := strconv.ParseInt(data["decimals"], 10, 32)
+			return manageDEXOrCoin(c, "PUT", "connect_coin", map[string]interface{}{
+				"address":  data["address"],
+				"decimals": int32(decimals),
+				"name":     data["name"],
+			})
+		},
+	})
+
+	for _, _resource := range []string{"DEX", "coin"} {
+		endpoint := "delete_" + strings.ToLower(_resource)
+		registerFlow("delete_"+_resource, &conversationFlow{
+			permission: "manage_contracts",
+			steps: []flowStep{{
+				key:    "address",
+				kind:   addressStep,
+				prompt: staticPrompt(fmt.Sprintf("Please enter the %s contract address to delete from the system:", _resource)),
+			}},
+			finish: func(c *updateContext, data map[string]string) error {
+				return manageDEXOrCoin(c, "DELETE", endpoint, map[string]interface{}{
+					"address": data["address"],
+				})
+			},
+		})
+	}
+
+	// data: wallet_type main or withdrawal. The address is part of the approval request, owners
+	// approve the wallet it names
+	registerFlow("wallet_request", &conversationFlow{
+		permission: "set_wallet",
+		steps: []flowStep{
+			{
+				key:  "address",
+				kind: addressStep,
+				prompt: func(data map[string]string) (string, error) {
+					return fmt.Sprintf("Please enter the address of the new %s wallet:", data["wallet_type"]), nil
+				},
+			},
+			{key: "name", kind: textStep, optional: true, prompt: staticPrompt("Please enter a name for the wallet, e.g. metamask")},
+		},
+		finish: func(c *updateContext, data map[string]string) error {
+			_payload := map[string]interface{}{"address": data["address"]}
+			if data["name"] != "" {
+				_payload["name"] = data["name"]
+			}
+			return createApprovalRequest(c, fmt.Sprintf("set_%s_wallet", data["wallet_type"]), _payload)
+		},
+	})
+
+	// data: request_id of the approved request, wallet_type main or withdrawal, address and name the
+	// request was approved for
+	registerFlow("wallet", &conversationFlow{
+		permission: "set_wallet",
+		steps: []flowStep{{
+			key:    "pk",
+			kind:   privateKeyStep,
+			secret: true,
+			prompt: func(data map[string]string) (string, error) {
+				return fmt.Sprintf("Please enter the private key of the %s wallet %s (request %s):", data["wallet_type"], data["address"], data["request_id"]), nil
+			},
+		}},
+		finish: func(c *updateContext, data map[string]string) error {
+			// approval is single use, a failed wallet creation requires a new request
+			if _, _, err := handlers.ApprovalRequest("POST", "consume_approval_request", map[string]interface{}{
+				"user_id":    c.userID(),
+				"request_id": data["request_id"],
+				"action":     fmt.Sprintf("set_%s_wallet", data["wallet_type"]),
+				"payload":    map[string]interface{}{"address": data["address"]},
+			}); err != nil {
+				return err
+			}
+
+			_payload := map[string]interface{}{
+				"blockchain_id": 1,
+				"address":       data["address"],
+				"pk":            data["pk"],
+				"wallet_type":   data["wallet_type"],
+				"user_id":       c.userID(),
+			}
+			if data["name"] != "" {
+				_payload["name"] = data["name"]
+			}
+
+			_response, err := handlers.GenericRequest("PUT", "bot", "create_wallet", _payload)
+			if err != nil {
+				return err
+			}
+
+			c.reply(_response.Message)
+			return nil
+		},
+	})
+
+	// data: challenge_id, indexes of the requested words
+	registerFlow("access", &conversationFlow{
+		permission: userAccess,
+		steps: []flowStep{{
+			key:  "words",
+			kind: wordsStep,
+			prompt: func(data map[string]string) (string, error) {
+				return fmt.Sprintf("Please provide words from mnemonic phrase at indexes %s, sepparated by space:", strings.Join(strings.Split(data["indexes"], ","), " and ")), nil
+			},
+			validate: func(value string, data map[string]string) error {
+				if expected := len(strings.Split(data["indexes"], ",")); len(strings.Fields(value)) != expected {
+					return fmt.Errorf("%d words are expected", expected)
+				}
+				return nil
+			},
+			secret: true,
+		}},
+		finish: func(c *updateContext, data map[string]string) error {
+			if _, err := handlers.VerifyAccessChallenge(map[string]interface{}{
+				"tg_id":        c.tgID,
+				"challenge_id": data["challenge_id"],
+				"words":        strings.Fields(data["words"]),
+			}); err != nil {
+				c.reply(err.Error())
+				return nil
+			}
+
+			c.reply("Thank you, now you have access to create/update bot settings for 15 minutes.")
+			return nil
+		},
+	})
+}
+
+func manageDEXOrCoin(c *updateContext, method, endpoint string, _payload map[string]interface{}) error {
+	_payload["user_id"] = c.userID()
+	_payload["blockchain_id"] = 1
+
+	_response, err := handlers.GenericRequest(method, "bot", endpoint, _payload)
+	if err != nil {
+		return err
+	}
+
+	c.replyMarkdown(_response.Message)
+	return nil
+}
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"telegram/config"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// NewBot connects to the Bot API, to the server at bot_api_url when it is configured
+func NewBot() (*tgbotapi.BotAPI, error) {
+	client := &http.Client{}
+	if config.Telegram.BotAPIURL != "" {
+		base, err := url.Parse(config.Telegram.BotAPIURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bot_api_url: %w", err)
+		}
+		client.Transport = &botAPITransport{base: base, next: http.DefaultTransport}
+	}
+
+	bot, err := tgbotapi.NewBotAPIWithClient(config.Telegram.BotToken, client)
+	if err != nil {
+		return nil, err
+	}
+	bot.Debug = config.Telegram.Debug
+	return bot, nil
+}
+
+var (
+	sharedBotMu sync.Mutex
+	sharedBot   *tgbotapi.BotAPI
+)
+
+// SharedBot is a bot connected once and reused by every caller, a failed connection is retried on the next call
+func SharedBot() (*tgbotapi.BotAPI, error) {
+	sharedBotMu.Lock()
+	defer sharedBotMu.Unlock()
+
+	if sharedBot == nil {
+		bot, err := NewBot()
+		if err != nil {
+			return nil, err
+		}
+		sharedBot = bot
+	}
+	return sharedBot, nil
+}
+
+// botAPITransport sends the requests the library addresses to api.telegram.org to base instead,
+// the endpoint is a constant of the library
+type botAPITransport struct {
+	base *url.URL
+	next http.RoundTripper
+}
+
+func (t *botAPITransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Host != "api.telegram.org" {
+		return t.next.RoundTrip(req)
+	}
+
+	req = req.Clone(req.Context())
+	req.URL.Scheme = t.base.Scheme
+	req.URL.Host = t.base.Host
+	req.URL.Path = strings.TrimSuffix(t.base.Path, "/") + req.URL.Path
+	req.Host = t.base.Host
+	return t.next.RoundTrip(req)
+}
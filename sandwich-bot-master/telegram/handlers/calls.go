@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
@@ -66,24 +67,171 @@ var (
 		return nil, errors.New("internal error while creating the user")
 	}
 
-	CreateAccess = func(payload map[string]interface{}) (interface{}, error) {
-		endpoint, err := config.InternalEndpoint("auth", "create_access")
+	CreateAccessChallenge = func(payload map[string]interface{}) (string, []int, error) {
+		endpoint, err := config.InternalEndpoint("auth", "create_access_challenge")
 		if err != nil {
-			return nil, err
+			return "", nil, err
 		}
 
 		__resp, _respCode, _err := utils.InternalRouter(endpoint.String(), "PUT", nil, payload)
 		if _err != nil {
-			return nil, err
+			return "", nil, _err
+		}
+
+		if _respCode != http.StatusCreated || __resp == nil {
+			if __resp != nil && __resp.Message != "" {
+				return "", nil, errors.New(__resp.Message)
+			}
+			return "", nil, errors.New("internal error while creating access challenge")
+		}
+
+		data, ok := __resp.Data.(map[string]interface{})
+		if !ok {
+			return "", nil, errors.New("malformed response from auth service create_access_challenge")
+		}
+
+		challengeID, ok := data["challenge_id"].(string)
+		if !ok {
+			return "", nil, errors.New("malformed response from auth service create_access_challenge")
+		}
+
+		var indexes []int
+		if _indexes, ok := data["indexes"].([]interface{}); ok {
+			for _, _i := range _indexes {
+				if index, ok := _i.(float64); ok {
+					indexes = append(indexes, int(index))
+				}
+			}
+		}
+
+		return challengeID, indexes, nil
+	}
+
+	VerifyAccessChallenge = func(payload map[string]interface{}) (string, error) {
+		endpoint, err := config.InternalEndpoint("auth", "verify_access_challenge")
+		if err != nil {
+			return "", err
+		}
+
+		__resp, _respCode, _err := utils.InternalRouter(endpoint.String(), "POST", nil, payload)
+		if _err != nil {
+			return "", _err
 		}
 
 		if _respCode != http.StatusCreated || __resp == nil {
-			return nil, errors.New("internal error while creating access")
+			if __resp != nil && __resp.Message != "" {
+				return "", errors.New(__resp.Message)
+			}
+			return "", errors.New("internal error while verifying access challenge")
+		}
+
+		return __resp.Message, nil
+	}
+
+	// ApprovalRequest calls one of the auth approval endpoints and returns the approval request data
+	ApprovalRequest = func(method, endppoint string, payload map[string]interface{}) (map[string]interface{}, string, error) {
+		endpoint, err := config.InternalEndpoint("auth", endppoint)
+		if err != nil {
+			return nil, "", err
+		}
+
+		__resp, _respCode, _err := utils.InternalRouter(endpoint.String(), method, nil, payload)
+		if _err != nil {
+			return nil, "", _err
+		}
+
+		if (_respCode != http.StatusOK && _respCode != http.StatusCreated) || __resp == nil {
+			if __resp != nil && __resp.Message != "" {
+				return nil, "", errors.New(__resp.Message)
+			}
+			return nil, "", fmt.Errorf("internal error while calling auth service %s", endppoint)
+		}
+
+		request, ok := __resp.Data.(map[string]interface{})
+		if !ok {
+			return nil, "", fmt.Errorf("malformed response from auth service %s", endppoint)
+		}
+
+		return request, __resp.Message, nil
+	}
+
+	CheckPermission = func(tgID int, action string) (bool, string, error) {
+		endpoint, err := config.InternalEndpoint("auth", "check_permission", map[string]interface{}{
+			"tg_id":  tgID,
+			"action": action,
+		})
+		if err != nil {
+			return false, "", err
+		}
+
+		__resp, _respCode, _err := utils.InternalRouter(endpoint.String(), "GET", nil, nil)
+		if _err != nil {
+			return false, "", _err
+		}
+
+		if _respCode != http.StatusOK || __resp == nil {
+			if __resp != nil && __resp.Message != "" {
+				return false, "", errors.New(__resp.Message)
+			}
+			return false, "", errors.New("internal error while checking permission")
+		}
+
+		data, ok := __resp.Data.(map[string]interface{})
+		if !ok {
+			return false, "", errors.New("malformed response from auth service check_permission")
+		}
+
+		allowed, _ := data["allowed"].(bool)
+		reason, _ := data["reason"].(string)
+
+		return allowed, reason, nil
+	}
+
+	// BotRequest calls the bot service, error statuses become errors
+	BotRequest = func(method, endppoint string, payload map[string]interface{}) (*utils.Response, error) {
+		endpoint, err := config.InternalEndpoint("bot", endppoint)
+		if err != nil {
+			return nil, err
+		}
+
+		__resp, _respCode, _err := utils.InternalRouter(endpoint.String(), method, nil, payload)
+		if _err != nil {
+			return nil, _err
+		}
+
+		if _respCode < http.StatusOK || _respCode >= http.StatusMultipleChoices || __resp == nil {
+			if __resp != nil && __resp.Message != "" {
+				return nil, errors.New(__resp.Message)
+			}
+			return nil, fmt.Errorf("internal error while calling bot service %s", endppoint)
 		}
 
 		return __resp, nil
 	}
 
+	// DownloadRequest GETs a file from a service endpoint, payload is sent as query parameters
+	DownloadRequest = func(service, endppoint string, payload map[string]interface{}) ([]byte, error) {
+		endpoint, err := config.InternalEndpoint(service, endppoint, payload)
+		if err != nil {
+			return nil, err
+		}
+
+		body, _respCode, err := utils.InternalDownload(endpoint.String())
+		if err != nil {
+			return nil, err
+		}
+
+		if _respCode != http.StatusOK {
+			var __resp utils.Response
+			if json.Unmarshal(body, &__resp) == nil && __resp.Message != "" {
+				return nil, errors.New(__resp.Message)
+			}
+			return nil, fmt.Errorf("internal error while downloading from %s service %s", service, endppoint)
+		}
+
+		return body, nil
+	}
+
 	GenericRequest = func(method, service, endppoint string, payload map[string]interface{}) (*utils.Response, error) {
 		endpoint, err := config.InternalEndpoint(service, endppoint)
 		if err != nil {
@@ -23,20 +23,20 @@ var (
 		Ico:     "⚠️",
 		Type:    "warning",
 	}
-	ErrNoOwnerAccess = ErrorType{
-		Message: "Owner role and multisig access are required. ",
+	ErrNoPermission = ErrorType{
+		Message: "Your role does not allow this action.",
 		Prefix:  "",
 		Ico:     "⚠️",
 		Type:    "warning",
 	}
-	ErrNoAdminOrOwnerAccess = ErrorType{
-		Message: "Admin role or owner role is required.",
+	ErrUserInactive = ErrorType{
+		Message: "Your account is deactivated.",
 		Prefix:  "",
 		Ico:     "⚠️",
 		Type:    "warning",
 	}
-	ErrNoMultisig = ErrorType{
-		Message: "Multisig access is required",
+	ErrApprovalRequired = ErrorType{
+		Message: "Approved request is required. Please start the action again to request owners approval.",
 		Prefix:  "",
 		Ico:     "⚠️",
 		Type:    "warning",
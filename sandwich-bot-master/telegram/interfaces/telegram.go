@@ -3,7 +3,7 @@ package interfaces
 import (
 	"fmt"
 	"net/http"
-	"telegram/config"
+	"telegram/handlers"
 	"telegram/types"
 	"telegram/utils"
 
@@ -21,8 +21,7 @@ func SendMessageToChannel(_data []byte) (int, interface{}, string, error) {
 		return http.StatusBadRequest, nil, "", err
 	}
 
-	botToken := config.Telegram.BotToken
-	bot, err := tgbotapi.NewBotAPI(botToken)
+	bot, err := handlers.SharedBot()
 	if err != nil {
 		return http.StatusInternalServerError, nil, "", fmt.Errorf("failed to create bot: %v", err)
 	}
@@ -1,20 +1,17 @@
 package main
 
 import (
-	"errors"
 	"fmt"
 	"log"
-	"regexp"
-	"strconv"
+	"net/url"
 	"strings"
+	"sync"
 	"telegram/config"
 	"telegram/controllers"
 	"telegram/handlers"
-	"telegram/types"
-	"telegram/utils"
+	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
-	"github.com/shopspring/decimal"
 )
 
 func sendStartMenu(bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
@@ -29,6 +26,7 @@ func sendStartMenu(bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
 		),
 		tgbotapi.NewInlineKeyboardRow(
 			tgbotapi.NewInlineKeyboardButtonData("System Wallets", "systemWallets"),
+			tgbotapi.NewInlineKeyboardButtonData("Settings History", "settingsHistory"),
 		),
 		tgbotapi.NewInlineKeyboardRow(
 			// tgbotapi.NewInlineKeyboardButtonData("DEX", "DEX"),
@@ -37,6 +35,10 @@ func sendStartMenu(bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
 		),
 		tgbotapi.NewInlineKeyboardRow(
 			tgbotapi.NewInlineKeyboardButtonData("Kill Switch", "killSwitch"),
+			tgbotapi.NewInlineKeyboardButtonData("Node Pool", "nodePool"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("Alerts", "alerts"),
 		),
 	)
 
@@ -47,1102 +49,415 @@ func sendStartMenu(bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
 
 }
 
-func main() {
-
-	log.Printf("ChannelID: %d\n", config.Telegram.ChannelID)
-	log.Printf("APIEndpoint: %s\n", config.Telegram.APIEndpoint)
-	log.Printf("AppSecret: %s\n", config.Telegram.AppSecret)
-	log.Printf("logDirectory: %s\n", config.Telegram.LogDirectory)
-	log.Printf("maxLogSize: %d\n", config.Telegram.MaxLogSize)
-	log.Printf("Debug: %v\n", config.Telegram.Debug)
-
-	controllers.ConnectDatabase()
-	controllers.Seed()
-
-	// logFile, err := utils.GetLogFile()
-	// if err != nil {
-	// 	log.Fatal(err)
-	// }
-	// defer logFile.Close()
-
-	// log.SetOutput(logFile)
-
-	// log.Println("Bot starting")
-
-	bot, err := tgbotapi.NewBotAPI(config.Telegram.BotToken)
-
+// permitted asks auth whether the telegram user may perform action and explains a refusal in chatID
+func permitted(bot *tgbotapi.BotAPI, chatID int64, tgID int, action string) bool {
+	allowed, reason, err := handlers.CheckPermission(tgID, action)
 	if err != nil {
-		log.Println("Failed to initialize Telegram BOT API:", err)
-		main()
+		msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("Error: %v", err))
+		bot.Send(msg)
+		return false
+	}
+	if allowed {
+		return true
 	}
 
-	bot.Debug = config.Telegram.Debug
-
-	var latestUpdateID int
+	errType := handlers.ErrNoPermission
+	switch reason {
+	case "access":
+		errType = handlers.ErrNoAccess
+	case "inactive":
+		errType = handlers.ErrUserInactive
+	}
+	msg := tgbotapi.NewMessage(chatID, handlers.HandleError(errType))
+	bot.Send(msg)
+	return false
+}
 
-	for {
-		u := tgbotapi.NewUpdate(latestUpdateID)
-		u.Timeout = 10
+// sendApprovalRequest asks owners in the channel and the current chat to decide on a pending request
+func sendApprovalRequest(bot *tgbotapi.BotAPI, chatID int64, request map[string]interface{}, message string) {
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("Approve", fmt.Sprintf("approve_request:%v", request["request_id"])),
+			tgbotapi.NewInlineKeyboardButtonData("Reject", fmt.Sprintf("reject_request:%v", request["request_id"])),
+		),
+	)
 
-		updates, err := bot.GetUpdates(u)
-		if err != nil {
-			log.Println("Failed to get updates from telegram", err)
-			log.Println("Restarting bot...")
-			main()
+	text := fmt.Sprintf("%s\nAction: %v", message, request["action"])
+	if payload, ok := request["payload"].(map[string]interface{}); ok && payload["address"] != nil {
+		text += fmt.Sprintf(", address %v", payload["address"])
+	}
+	text += ". Owners have to approve it with their own access before it expires."
+	for _, _chatID := range []int64{chatID, config.Telegram.ChannelID} {
+		if _chatID == 0 {
+			continue
 		}
+		msg := tgbotapi.NewMessage(_chatID, text)
+		msg.ReplyMarkup = keyboard
+		bot.Send(msg)
+	}
+}
 
-		for _, update := range updates {
-			if update.UpdateID >= latestUpdateID {
-				latestUpdateID = update.UpdateID + 1
-				var tgID int
-				fmt.Println("UPDATE\n",
-					"Channel Post", update.ChannelPost != nil, "\n",
-					"Edited Message", update.EditedMessage != nil, "\n",
-					"InlineQuery", update.InlineQuery != nil, "\n",
-					"CallbackQuery", update.CallbackQuery != nil, "\n",
-					"Message", update.Message != nil, "\n",
-					"ChosenInlineResult", update.ChosenInlineResult != nil, "\n",
-					"ShippingQuery", update.ShippingQuery != nil, "\n",
-					"PreCheckoutQuery", update.PreCheckoutQuery != nil)
-				if update.CallbackQuery != nil {
-					tgID = update.CallbackQuery.From.ID
-				} else if update.Message != nil {
-					tgID = update.Message.From.ID
-				} else {
-					log.Println("Could not determine the type of message or its sender.")
-					continue
-				}
-				//  && update.Message.IsCommand() {
-				// } else if update.Message != nil && update.Message.ReplyToMessage != nil {
-				// 	tgID = update.Message.From.ID
-				// } else {
-				// 	log.Println("Could not determine the type of message or its sender.")
-				// }
-
-				var userData map[string]interface{}
-				var quickAccessUserData *types.QuickAccessUserDataType
-				if tgID != 0 {
-					_qParams := map[string]interface{}{
-						"tg_id": tgID,
-					}
-
-					_user, err := handlers.RetrieveUser(_qParams)
-					if err == nil {
-						user, ok := _user.(*utils.Response)
-						if ok {
-							userData, ok = user.Data.(map[string]interface{})
-							if !ok {
-								log.Printf("Failed to cast user.Data to map[string]inerface{} tg_id: %v", tgID)
-							}
-						} else {
-							log.Printf("Failed to cast user to utils.Response tg_id: %v", tgID)
-						}
-						quickAccessUserData = &types.QuickAccessUserDataType{}
-						var __resp *utils.Response
-						if __resp, err = handlers.GenericRequest("GET", "auth", "retrieve_multisig", map[string]interface{}{}); err != nil {
-							msg := tgbotapi.NewMessage(update.Message.Chat.ID, fmt.Sprintf("Error: %v", err))
-							bot.Send(msg)
-							continue
-						}
-
-						dataMap, ok := __resp.Data.(map[string]interface{})
-						if !ok {
-							fmt.Println("Error: Data is not a map[string]interface{}")
-							return // or handle the error appropriately
-						}
-
-						// Extract the "multisig" field
-						multisig, ok := dataMap["multisig"].(bool)
-						if !ok {
-							fmt.Println("Error: 'multisig' field is either missing or not a string")
-							return // or handle the error appropriately
-						}
-						quickAccessUserData.Multisig = multisig
-
-						mnemonicData, ok := userData["mnemonic"].(map[string]interface{})
-						if ok {
-							quickAccessUserData.Mnemonic, ok = mnemonicData["phrase"].(string)
-							if !ok {
-								log.Printf("Mnemonic Phrase not found for user with tg_id: %v", tgID)
-							}
-						} else {
-							log.Printf("Mnemonic not found for user with tg_id: %v", tgID)
-						}
-
-						userID, ok := userData["id"]
-						if ok {
-							userIDFloat, ok := userID.(float64)
-							if ok {
-								quickAccessUserData.ID = uint(userIDFloat)
-							} else {
-								log.Printf("ID not found or casting to float64 failed for user with tg_id: %v", tgID)
-							}
-						} else {
-							log.Printf("ID not found for user with tg_id: %v", tgID)
-						}
-
-						tgData, ok := userData["telegram"].([]interface{})
-						if ok {
-							for _, _tg := range tgData {
-								if tgID, ok := _tg.(map[string]interface{})["telegram_id"].(float64); ok {
-									quickAccessUserData.TGiD = append(quickAccessUserData.TGiD, int(tgID))
-								} else {
-									log.Printf("Telegram not found for user with tg_id: %v", tgID)
-								}
-							}
-						} else {
-							log.Printf("Telegram not found for user with tg_id: %v", tgID)
-						}
-
-						accessData, ok := userData["access"].([]interface{})
-						if ok {
-							if len(accessData) > 0 {
-								quickAccessUserData.HasAccess = true
-							}
-						} else {
-							log.Printf("Access not found for user with tg_id: %v", tgID)
-						}
-
-						roleData, ok := userData["role"].([]interface{})
-						if ok {
-							for _, _rd := range roleData {
-								if roleTitle, ok := _rd.(map[string]interface{})["title"].(string); ok {
-									quickAccessUserData.Role = append(quickAccessUserData.Role, roleTitle)
-									switch roleTitle {
-									case "admin":
-										quickAccessUserData.IsAdmin = true
-									case "owner":
-										quickAccessUserData.IsOwner = true
-									}
-								} else {
-									log.Printf("Error parsing user roles for user with tg_id: %v", tgID)
-								}
-							}
-						} else {
-							// some error
-
-						}
-					}
-				}
-
-				fmt.Println("Message", update.Message != nil, "\n", "Callback", update.CallbackQuery != nil)
-				// log.Println(update.Message.IsCommand(), update.Message.Command())
-				if quickAccessUserData == nil {
-
-					if update.CallbackQuery != nil && update.CallbackQuery.Data == "register" {
-
-					} else if update.Message != nil {
-
-					} else if update.Message != nil && update.Message.IsCommand() && update.Message.Command() == "start" {
-
-					} else {
-						var message *tgbotapi.Message
-						if update.Message != nil {
-							message = update.Message
-						} else if update.CallbackQuery != nil {
-							message = update.CallbackQuery.Message
-						}
-
-						msg := tgbotapi.NewMessage(message.Chat.ID, handlers.HandleError(handlers.ErrUserNotFound))
-						bot.Send(msg)
-						continue
-					}
-				}
-
-				if update.Message != nil && update.Message.ReplyToMessage != nil {
-					// response = "Please enter contract adddress:"
-					if strings.Contains(update.Message.ReplyToMessage.Text, "Please enter contract address:") {
-						if !quickAccessUserData.HasAccess {
-							msg := tgbotapi.NewMessage(update.Message.Chat.ID, handlers.HandleError(handlers.ErrNoAccess))
-							bot.Send(msg)
-							continue
-						}
-						if !quickAccessUserData.IsAdmin && !quickAccessUserData.IsOwner {
-							msg := tgbotapi.NewMessage(update.Message.Chat.ID, handlers.HandleError(handlers.ErrNoAdminOrOwnerAccess))
-							bot.Send(msg)
-							continue
-						}
-						_payload := map[string]interface{}{
-							"user_id":         quickAccessUserData.ID,
-							"address_partial": update.Message.Text,
-						}
-						var _response *utils.Response
-						if _response, err = handlers.GenericRequest("GET", "bot", "retrieve_contract", _payload); err != nil {
-							msg := tgbotapi.NewMessage(update.Message.Chat.ID, fmt.Sprintf("Error: %v", err))
-							bot.Send(msg)
-							continue
-						}
-
-						msg := tgbotapi.NewMessage(update.Message.Chat.ID, _response.Message)
-						msg.ParseMode = "Markdown"
-						bot.Send(msg)
-						continue
-					}
-					if strings.Contains(update.Message.ReplyToMessage.Text, "contract data with comma as delimiter to") || strings.Contains(update.Message.ReplyToMessage.Text, "contract address to") {
-						if !quickAccessUserData.HasAccess {
-							msg := tgbotapi.NewMessage(update.Message.Chat.ID, handlers.HandleError(handlers.ErrNoAccess))
-							bot.Send(msg)
-							continue
-						}
-						if !quickAccessUserData.IsAdmin && !quickAccessUserData.IsOwner {
-							msg := tgbotapi.NewMessage(update.Message.Chat.ID, handlers.HandleError(handlers.ErrNoAdminOrOwnerAccess))
-							bot.Send(msg)
-							continue
-						}
-
-						response := strings.Split(update.Message.Text, ",")
-
-						endpoint := ""
-						method := ""
-						_payload := map[string]interface{}{
-							"user_id":       quickAccessUserData.ID,
-							"blockchain_id": 1,
-						}
-
-						if strings.Contains(update.Message.ReplyToMessage.Text, " add ") {
-							endpoint += "connect"
-							method = "PUT"
-						} else if strings.Contains(update.Message.ReplyToMessage.Text, " delete ") {
-							endpoint += "delete"
-							method = "DELETE"
-						}
-
-						if strings.Contains(update.Message.ReplyToMessage.Text, "DEX") {
-							endpoint += "_dex"
-							if method == "PUT" {
-								fmt.Println(response)
-								if len(response) < 2 {
-									msg := tgbotapi.NewMessage(update.Message.Chat.ID, "Inccorect data provided. Expected dex router address and name.")
-									bot.Send(msg)
-									continue
-								}
-								_payload["type"] = strings.TrimSpace(response[1])
-								_payload["address"] = strings.TrimSpace(response[0])
-							} else if method == "DELETE" {
-								if len(response) < 1 {
-									msg := tgbotapi.NewMessage(update.Message.Chat.ID, "Inccorect data provided. Expected dex router address.")
-									bot.Send(msg)
-									continue
-								}
-								_payload["address"] = strings.TrimSpace(response[0])
-							}
-						} else if strings.Contains(update.Message.ReplyToMessage.Text, "coin") {
-							endpoint += "_coin"
-							fmt.Println(method, endpoint)
-							if method == "PUT" {
-								fmt.Println(response)
-								if len(response) < 3 {
-									msg := tgbotapi.NewMessage(update.Message.Chat.ID, "Inccorect data provided. Expected coin contract address, decimals and name.")
-									bot.Send(msg)
-									continue
-								}
-								_payload["address"] = strings.TrimSpace(response[0])
-								_payload["name"] = strings.TrimSpace(response[2])
-								decimals, err := strconv.ParseInt(strings.TrimSpace(response[1]), 10, 32)
-								if err == nil {
-									_payload["decimals"] = int32(decimals)
-								}
-								if err != nil {
-									msg := tgbotapi.NewMessage(update.Message.Chat.ID, fmt.Sprintf("Error: %v", err))
-									bot.Send(msg)
-									continue
-								}
-							} else if method == "DELETE" {
-								if len(response) < 1 {
-									msg := tgbotapi.NewMessage(update.Message.Chat.ID, "Inccorect data provided. Expected dex router address.")
-									bot.Send(msg)
-									continue
-								}
-								_payload["address"] = strings.TrimSpace(response[0])
-							}
-						}
-
-						var _response *utils.Response
-						if _response, err = handlers.GenericRequest(method, "bot", endpoint, _payload); err != nil {
-							msg := tgbotapi.NewMessage(update.Message.Chat.ID, fmt.Sprintf("Error: %v", err))
-							bot.Send(msg)
-							continue
-						}
-
-						fmt.Println(_response.Message)
-
-						msg := tgbotapi.NewMessage(update.Message.Chat.ID, _response.Message)
-						msg.ParseMode = "Markdown"
-						bot.Send(msg)
-					}
-					// Updte Settings Flow
-					if strings.Contains(update.Message.ReplyToMessage.Text, "Please enter contracts to") {
-						if !quickAccessUserData.HasAccess {
-							msg := tgbotapi.NewMessage(update.Message.Chat.ID, handlers.HandleError(handlers.ErrNoAccess))
-							bot.Send(msg)
-							continue
-						}
-						if !quickAccessUserData.IsAdmin && !quickAccessUserData.IsOwner {
-							msg := tgbotapi.NewMessage(update.Message.Chat.ID, handlers.HandleError(handlers.ErrNoAdminOrOwnerAccess))
-							bot.Send(msg)
-							continue
-						}
-
-						response := strings.Replace(update.Message.ReplyToMessage.Text, "Please enter contracts to", "", -1)
-						response = strings.TrimSpace(strings.ToLower(strings.Replace(response, ":", "", -1)))
-						contractsRaw := strings.Split(update.Message.Text, ",")
-						var _contracts []string
-						for _, contract := range contractsRaw {
-							_contracts = append(_contracts, strings.TrimSpace(contract))
-						}
-
-						if len(_contracts) == 0 {
-							msg := tgbotapi.NewMessage(update.Message.Chat.ID, "No contracts were provided.")
-							bot.Send(msg)
-							continue
-						}
-
-						_payload := map[string]interface{}{
-							"user_id": quickAccessUserData.ID,
-							"address": _contracts,
-						}
-
-						if strings.Contains(response, "black") {
-							_payload["blacklist"] = true
-						}
-
-						log.Println("PAYLOAD", _payload)
-
-						var _response *utils.Response
-						if _response, err = handlers.GenericRequest("PUT", "bot", "create_contract", _payload); err != nil {
-							msg := tgbotapi.NewMessage(update.Message.Chat.ID, fmt.Sprintf("Error: %v", err))
-							bot.Send(msg)
-							continue
-						}
-
-						fmt.Println(_response.Message)
-
-						msg := tgbotapi.NewMessage(update.Message.Chat.ID, _response.Message)
-						msg.ParseMode = "Markdown"
-						bot.Send(msg)
-					}
-					if strings.Contains(update.Message.ReplyToMessage.Text, "wallet credentials") {
-						if !quickAccessUserData.IsOwner {
-							msg := tgbotapi.NewMessage(update.CallbackQuery.Message.Chat.ID, handlers.HandleError(handlers.ErrNoOwnerAccess))
-							bot.Send(msg)
-							continue
-						}
-						if !quickAccessUserData.Multisig {
-							msg := tgbotapi.NewMessage(update.CallbackQuery.Message.Chat.ID, handlers.HandleError(handlers.ErrNoMultisig))
-							bot.Send(msg)
-							continue
-						}
-
-						response := strings.Split(update.Message.ReplyToMessage.Text, " ")
-						wallet := strings.Split(update.Message.Text, ",")
-						if len(wallet) < 2 {
-							msg := tgbotapi.NewMessage(update.Message.Chat.ID, "Error: wallet address or private key is missing, please provide wallet credentials with comma as a delimeter. Address, private key, name (optional, ex: metamask)")
-							bot.Send(msg)
-							continue
-						}
-
-						_payload := map[string]interface{}{
-							"blockchain_id": 1,
-							"address":       strings.TrimSpace(wallet[0]),
-							"pk":            strings.TrimSpace(wallet[1]),
-							"wallet_type":   "main",
-							"user_id":       quickAccessUserData.ID,
-						}
-						if len(wallet) > 2 {
-							_payload["name"] = strings.TrimSpace(wallet[2])
-						}
-						if response[2] == "withdrawal" {
-							_payload["wallet_type"] = "withdrawal"
-						}
-
-						var _response *utils.Response
-						if _response, err = handlers.GenericRequest("PUT", "bot", "create_wallet", _payload); err != nil {
-							msg := tgbotapi.NewMessage(update.Message.Chat.ID, fmt.Sprintf("Error: %v", err))
-							bot.Send(msg)
-							continue
-						}
-
-						msg := tgbotapi.NewMessage(update.Message.Chat.ID, _response.Message)
-						bot.Send(msg)
-						continue
-					}
-					if strings.Contains(update.Message.ReplyToMessage.Text, "Please enter the new value for") {
-						if !quickAccessUserData.HasAccess {
-							msg := tgbotapi.NewMessage(update.Message.Chat.ID, handlers.HandleError(handlers.ErrNoAccess))
-							bot.Send(msg)
-							continue
-						}
-						if !quickAccessUserData.IsAdmin && !quickAccessUserData.IsOwner {
-							msg := tgbotapi.NewMessage(update.Message.Chat.ID, handlers.HandleError(handlers.ErrNoAdminOrOwnerAccess))
-							bot.Send(msg)
-							continue
-						}
-
-						response := strings.Replace(update.Message.ReplyToMessage.Text, "Please enter the new value for", "", -1)
-						response = strings.TrimSpace(strings.ToLower(strings.Replace(response, ":", "", -1)))
-						responseSlice := strings.Split(response, " ")
-						responseDB := strings.Join(responseSlice, "_")
-
-						_payload := map[string]interface{}{
-							"user_id": quickAccessUserData.ID,
-						}
-						var err error
-
-						switch responseDB {
-						case "gas_fee_max", "exit_gas", "gas_priority", "target_value_min", "target_value_max", "target_gas_markup_allowed", "usd_per_trade", "withdrawal_threshold":
-							_payload[responseDB], err = decimal.NewFromString(update.Message.Text)
-							fmt.Println("PAYLOAD", _payload[responseDB])
-							if err != nil {
-								log.Printf("Failed to convert to decimal.Decimal: %v", err)
-							}
-						case "gas_limit", "ttx_max_latency":
-							_payload[responseDB], err = strconv.ParseUint(update.Message.Text, 10, 64)
-							if err != nil {
-								msg := tgbotapi.NewMessage(update.Message.Chat.ID, fmt.Sprintf("Incorrect value provided. Value should be unsigned integer: %v", err))
-								bot.Send(msg)
-								continue
-							}
-						case "slippage", "draw_down", "gas_tolerance":
-							_payload[responseDB], err = strconv.ParseFloat(update.Message.Text, 64)
-							if err != nil {
-								msg := tgbotapi.NewMessage(update.Message.Chat.ID, fmt.Sprintf("Incorrect value provided. Value should be a float number: %v", err))
-								bot.Send(msg)
-								continue
-							}
-						case "deadline":
-							_payload[responseDB], err = strconv.Atoi(update.Message.Text)
-							if err != nil {
-								msg := tgbotapi.NewMessage(update.Message.Chat.ID, fmt.Sprintf("Incorrect value provided. Value should be an integer: %v", err))
-								bot.Send(msg)
-								continue
-							}
-						}
-
-						var _response *utils.Response
-						if _response, err = handlers.GenericRequest("PATCH", "bot", "update_settings", _payload); err != nil {
-							msg := tgbotapi.NewMessage(update.Message.Chat.ID, fmt.Sprintf("Error: %v", err))
-							bot.Send(msg)
-							continue
-						}
-
-						fmt.Println("RESP MESSAGE", _response.Message)
-
-						msg := tgbotapi.NewMessage(update.Message.Chat.ID, _response.Message)
-						bot.Send(msg)
-					}
-
-					// CREATE ACCESS Flow
-					if strings.Contains(update.Message.ReplyToMessage.Text, "Please provide words from mnemonic phrase at indexes") {
-						// Handle password input
-
-						indexesText := regexp.MustCompile(`\d+`).FindAllString(update.Message.ReplyToMessage.Text, -1)
-						var indexes []int
-						for _, indexText := range indexesText {
-							index, err := strconv.Atoi(indexText)
-							if err != nil {
-								log.Printf("Error converting index to integer: %v\n", err)
-								continue
-							}
-							indexes = append(indexes, index)
-						}
-
-						_mnemonicPartials := strings.Split(strings.TrimSpace(update.Message.Text), " ")
-						if len(_mnemonicPartials) != 2 {
-							msg := tgbotapi.NewMessage(update.Message.Chat.ID, "Provided details are incorrect.")
-							bot.Send(msg)
-							continue
-						}
-
-						mnemonicWords := strings.Split(fmt.Sprintf("%v", quickAccessUserData.Mnemonic), " ")
-
-						if mnemonicWords[indexes[0]-1] == _mnemonicPartials[0] && mnemonicWords[indexes[1]-1] == _mnemonicPartials[1] {
-							// Print the extracted values
-							_payload := map[string]interface{}{
-								"user_id": quickAccessUserData.ID,
-							}
-							_, _err := handlers.CreateAccess(_payload)
-							if _err != nil {
-								msg := tgbotapi.NewMessage(update.Message.Chat.ID, _err.Error())
-								bot.Send(msg)
-								continue
-							}
-
-							msg := tgbotapi.NewMessage(update.Message.Chat.ID, "Thank you, now you have access to create/update bot settings for 15 minutes.")
-							bot.Send(msg)
-						} else {
-							msg := tgbotapi.NewMessage(update.Message.Chat.ID, "Provided details are incorrect.")
-							bot.Send(msg)
-						}
-					}
-				}
-
-				if update.Message != nil && update.Message.IsCommand() {
-
-					switch update.Message.Command() {
-					case "start":
-						sendStartMenu(bot, update.Message)
-					default:
-						// Process user input here
-						response := "Hi Command👋"
-						msg := tgbotapi.NewMessage(update.Message.Chat.ID, response)
-						bot.Send(msg)
-					}
-				}
-				if update.ChannelPost != nil && update.ChannelPost.Chat.ID == config.Telegram.ChannelID {
-					switch update.ChannelPost.Text {
-					case "/start":
-					default:
-						response := "Hi Channel 👋"
-						msg := tgbotapi.NewMessage(update.ChannelPost.Chat.ID, response)
-						bot.Send(msg)
-					}
-				}
-				if update.CallbackQuery != nil {
-					callbackData := update.CallbackQuery.Data
-					callbackConfig := tgbotapi.NewCallback(update.CallbackQuery.ID, "")
-					bot.AnswerCallbackQuery(callbackConfig)
-
-					switch callbackData {
-					case "set_main_wallet", "set_withdrawal_wallet":
-						if !quickAccessUserData.IsOwner {
-							msg := tgbotapi.NewMessage(update.CallbackQuery.Message.Chat.ID, handlers.HandleError(handlers.ErrNoOwnerAccess))
-							bot.Send(msg)
-							continue
-						}
-						if !quickAccessUserData.Multisig {
-							msg := tgbotapi.NewMessage(update.CallbackQuery.Message.Chat.ID, handlers.HandleError(handlers.ErrNoMultisig))
-							bot.Send(msg)
-							continue
-						}
-						callbackDataParts := strings.Split(callbackData, "_")
-
-						response := fmt.Sprintf("Please enter %s wallet credentials in set order sepparated by comma. E.g.: address, private key, name (optional, e.g.: metamask)", callbackDataParts[1])
-
-						msg := tgbotapi.NewMessage(update.CallbackQuery.Message.Chat.ID, response)
-						msg.ReplyMarkup = tgbotapi.ForceReply{
-							ForceReply: true,
-							Selective:  true,
-						}
-						bot.Send(msg)
-
-					case "set_gas_fee_max", "set_gas_limit", "set_ttx_max_latency", "set_gas_priority", "set_exit_gas", "set_target_value_min", "set_target_value_max", "set_target_gas_markup_allowed", "set_usd_per_trade", "set_draw_down", "set_gas_tolerance", "set_withdrawal_threshold", "set_deadline":
-						if !quickAccessUserData.HasAccess {
-							msg := tgbotapi.NewMessage(update.CallbackQuery.Message.Chat.ID, handlers.HandleError(handlers.ErrNoAccess))
-							bot.Send(msg)
-							continue
-						}
-						if !quickAccessUserData.IsAdmin && !quickAccessUserData.IsOwner {
-							msg := tgbotapi.NewMessage(update.CallbackQuery.Message.Chat.ID, handlers.HandleError(handlers.ErrNoAdminOrOwnerAccess))
-							bot.Send(msg)
-							continue
-						}
-
-						callbackDataParts := strings.Split(callbackData, "_")
-						callbackDataParts = callbackDataParts[1:]
-
-						for i, part := range callbackDataParts {
-							callbackDataParts[i] = strings.Title(part)
-						}
-
-						// var fieldValueMap map[string]interface{}
-
-						// currentValue := ""
-						// if len(fieldValueMap) > 0 {
-						// 	for _, _v := range fieldValueMap {
-						// 		currentValue = fmt.Sprintf("%v", _v)
-						// 	}
-						// }
-
-						// interim := fmt.Sprintf("**_⚙️ Current value for %v: ", strings.Join(callbackDataParts, " ")) + currentValue + "_**"
-						// msg := tgbotapi.NewMessage(update.CallbackQuery.Message.Chat.ID, interim)
-						// msg.ParseMode = "Markdown"
-						// bot.Send(msg)
-
-						response := "Please enter the new value for "
-						response += strings.Join(callbackDataParts, " ") + ":"
-
-						msg := tgbotapi.NewMessage(update.CallbackQuery.Message.Chat.ID, response)
-						msg.ReplyMarkup = tgbotapi.ForceReply{
-							ForceReply: true,
-							Selective:  true,
-						}
-						bot.Send(msg)
-					case "currentSettings":
-
-						_payload := map[string]interface{}{
-							"user_id": quickAccessUserData.ID,
-						}
-
-						var _response *utils.Response
-						if _response, err = handlers.GenericRequest("GET", "bot", "retrieve_settings", _payload); err != nil {
-							msg := tgbotapi.NewMessage(update.CallbackQuery.Message.Chat.ID, fmt.Sprintf("Error: %v", err))
-							bot.Send(msg)
-							continue
-						}
-
-						fmt.Println(_response.Data)
-
-						// select user
-
-						settingsMap, ok := _response.Data.(map[string]interface{})
-						if !ok {
-							msg := tgbotapi.NewMessage(update.CallbackQuery.Message.Chat.ID, "Error: failed to bind bot response to map")
-							bot.Send(msg)
-							continue
-							// handle the error
-						}
-						// if err := json.Unmarshal(currentSettings.Settings, &settingsMap); err != nil {
-						// 	log.Printf("Error unmarshalling settings: %v\n", err)
-						// 	continue
-						// }
-
-						message := "```\n"
-						message += fmt.Sprintf("%-25s | %s\n", "Key", "Value")
-						message += strings.Repeat("-", 50) + "\n"
-
-						for _k, _v := range settingsMap["settings"].(map[string]interface{}) {
-							keyParts := strings.Split(_k, "_")
-							formattedKey := strings.Title(strings.Join(keyParts, " "))
-							valueStr := fmt.Sprintf("%v", _v)
-							// if strings.Contains(strings.ToLower(_k), "wallet") && len(valueStr) > 7 {
-							// 	valueStr = valueStr[:3] + "..." + valueStr[len(valueStr)-4:]
-							// } else if len(valueStr) > 20 {
-							// 	valueStr = valueStr[:17] + "..."
-							// }
-							message += fmt.Sprintf("%-25s | %s\n", formattedKey, valueStr)
-						}
-
-						_qParams := map[string]interface{}{
-							"id": settingsMap["created_by"],
-						}
-						var createdByUsername interface{}
-						_user, err := handlers.RetrieveUser(_qParams)
-						if err == nil {
-							user, ok := _user.(*utils.Response)
-							if !ok {
-								msg := tgbotapi.NewMessage(update.CallbackQuery.Message.Chat.ID, errors.New("cannot convert user interface{}").Error())
-								bot.Send(msg)
-								continue
-							}
-
-							for _, _v := range user.Data.(map[string]interface{})["telegram"].([]interface{}) {
-								_vMap, ok := _v.(map[string]interface{}) // Type assertion to map
-								if !ok {
-									continue // Handle the case where the assertion fails
-								}
-								createdByUsername = "@"
-								username, ok := _vMap["username"].(string)
-								if ok && username != "" && username != "0" {
-									createdByUsername = "@" + username
-									break
-								}
-							}
-						} else {
-							createdByUsername = "default"
-						}
-
-						message += "```"
+// runApprovedAction continues an action once its approval request reached the quorum
+func runApprovedAction(bot *tgbotapi.BotAPI, chatID int64, request map[string]interface{}) {
+	action, _ := request["action"].(string)
+	requestID, _ := request["request_id"].(string)
+	requestedBy, _ := request["requested_by"].(float64)
+	requesterChatID := chatID
+	requesterTgID := 0
+	if requestedTg, ok := request["requested_tg_id"].(float64); ok {
+		requesterChatID = int64(requestedTg)
+		requesterTgID = int(requestedTg)
+	}
 
-						message += fmt.Sprintf("\nCreated By: %v", createdByUsername)
+	switch action {
+	case "set_main_wallet", "set_withdrawal_wallet":
+		// credentials are collected from the requester only, the approval is consumed together with them
+		payload, _ := request["payload"].(map[string]interface{})
+		data := map[string]string{
+			"request_id":  requestID,
+			"wallet_type": strings.Split(action, "_")[1],
+			"address":     fmt.Sprint(payload["address"]),
+		}
+		if name, ok := payload["name"].(string); ok {
+			data["name"] = name
+		}
+		if err := startConversation(bot, requesterChatID, requesterTgID, "wallet", data); err != nil {
+			msg := tgbotapi.NewMessage(requesterChatID, fmt.Sprintf("Error: %v", err))
+			bot.Send(msg)
+		}
+	case "rotate_main_wallet", "rotate_withdrawal_wallet":
+		if _, _, err := handlers.ApprovalRequest("POST", "consume_approval_request", map[string]interface{}{
+			"user_id":    uint(requestedBy),
+			"request_id": requestID,
+			"action":     action,
+		}); err != nil {
+			msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("Error: %v", err))
+			bot.Send(msg)
+			return
+		}
 
-						msg := tgbotapi.NewMessage(update.CallbackQuery.Message.Chat.ID, message)
-						msg.ParseMode = "Markdown"
-						bot.Send(msg)
-					case "whiteListContract", "blackListContract":
-						if !quickAccessUserData.HasAccess {
-							msg := tgbotapi.NewMessage(update.CallbackQuery.Message.Chat.ID, handlers.HandleError(handlers.ErrNoAccess))
-							bot.Send(msg)
-							continue
-						}
-						if !quickAccessUserData.IsAdmin && !quickAccessUserData.IsOwner {
-							msg := tgbotapi.NewMessage(update.CallbackQuery.Message.Chat.ID, handlers.HandleError(handlers.ErrNoAdminOrOwnerAccess))
-							bot.Send(msg)
-							continue
-						}
-						response := ""
-						action := ""
-						if strings.Contains(callbackData, "white") {
-							response = "Please enter contracts to whitelist: "
-							action = "create"
-						} else if strings.Contains(callbackData, "black") {
-							response = "Please enter contracts to blacklist: "
-							action = "delete"
-						} else {
-							msg := tgbotapi.NewMessage(update.CallbackQuery.Message.Chat.ID, "internal error")
-							bot.Send(msg)
-							continue
-						}
+		// the bot generates the new key, funds move in the background
+		_response, err := handlers.GenericRequest("PUT", "bot", "rotate_wallet", map[string]interface{}{
+			"user_id":     uint(requestedBy),
+			"wallet_type": strings.Split(action, "_")[1],
+		})
+		if err != nil {
+			msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("Error: %v", err))
+			bot.Send(msg)
+			return
+		}
 
-						tip := "**_👋 Tip: multiple contracts can be entered at the same time using comma as a delimeter_**"
-						msg := tgbotapi.NewMessage(update.CallbackQuery.Message.Chat.ID, tip)
-						msg.ParseMode = "Markdown"
-						bot.Send(msg)
+		msg := tgbotapi.NewMessage(chatID, _response.Message)
+		bot.Send(msg)
+		if requesterChatID != chatID {
+			msg := tgbotapi.NewMessage(requesterChatID, _response.Message)
+			bot.Send(msg)
+		}
+	case "sweep_profit":
+		payload, _ := request["payload"].(map[string]interface{})
+		sweepID, _ := payload["sweep_id"].(string)
+
+		// the bot consumes the approval itself and learns from auth who confirmed it
+		_response, err := handlers.BotRequest("POST", "execute_sweep", map[string]interface{}{
+			"user_id":    uint(requestedBy),
+			"sweep_id":   sweepID,
+			"request_id": requestID,
+		})
+		if err != nil {
+			msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("Error: %v", err))
+			bot.Send(msg)
+			return
+		}
 
-						fmt.Println(action)
+		msg := tgbotapi.NewMessage(chatID, _response.Message)
+		bot.Send(msg)
+		if requesterChatID != chatID {
+			msg := tgbotapi.NewMessage(requesterChatID, _response.Message)
+			bot.Send(msg)
+		}
+	case "set_kill_switch_on", "set_kill_switch_off":
+		if _, _, err := handlers.ApprovalRequest("POST", "consume_approval_request", map[string]interface{}{
+			"user_id":    uint(requestedBy),
+			"request_id": requestID,
+			"action":     action,
+		}); err != nil {
+			msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("Error: %v", err))
+			bot.Send(msg)
+			return
+		}
 
-						msg = tgbotapi.NewMessage(update.CallbackQuery.Message.Chat.ID, response)
-						msg.ReplyMarkup = tgbotapi.ForceReply{
-							ForceReply: true,
-							Selective:  true,
-						}
-						bot.Send(msg)
-					case "listContracts", "findContracts", "listBlacklisted", "listWhitelisted":
-						if !quickAccessUserData.HasAccess {
-							msg := tgbotapi.NewMessage(update.CallbackQuery.Message.Chat.ID, handlers.HandleError(handlers.ErrNoAccess))
-							bot.Send(msg)
-							continue
-						}
-						if strings.Contains(callbackData, "find") {
-							response := "Please enter contract address:"
+		_response, err := handlers.GenericRequest("PATCH", "bot", "toggle_killswitch", map[string]interface{}{
+			"user_id": uint(requestedBy),
+			"is_on":   action == "set_kill_switch_on",
+		})
+		if err != nil {
+			msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("Error: %v", err))
+			bot.Send(msg)
+			return
+		}
 
-							tip := "**_👋 Tip: partial contract address can be used to locate contract in the system _**"
-							msg := tgbotapi.NewMessage(update.CallbackQuery.Message.Chat.ID, tip)
-							msg.ParseMode = "Markdown"
-							bot.Send(msg)
+		msg := tgbotapi.NewMessage(chatID, _response.Message)
+		bot.Send(msg)
+		if requesterChatID != chatID {
+			msg := tgbotapi.NewMessage(requesterChatID, _response.Message)
+			bot.Send(msg)
+		}
+	default:
+		msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("Approval request %s is approved.", requestID))
+		bot.Send(msg)
+	}
+}
 
-							msg = tgbotapi.NewMessage(update.CallbackQuery.Message.Chat.ID, response)
-							msg.ReplyMarkup = tgbotapi.ForceReply{
-								ForceReply: true,
-								Selective:  true,
-							}
-							bot.Send(msg)
-						} else if strings.Contains(callbackData, "list") {
-							_payload := map[string]interface{}{
-								"user_id": quickAccessUserData.ID,
-							}
-							switch {
-							case strings.Contains(callbackData, "Contract"):
-								keyboard := tgbotapi.NewInlineKeyboardMarkup(
-									tgbotapi.NewInlineKeyboardRow(
-										tgbotapi.NewInlineKeyboardButtonData("Blacklisted", "listBlacklisted"),
-										tgbotapi.NewInlineKeyboardButtonData("Whitelisted", "listWhitelisted"),
-									),
-									tgbotapi.NewInlineKeyboardRow(
-										tgbotapi.NewInlineKeyboardButtonData("Back", "go_back"),
-									),
-								)
+var announceOnce sync.Once
 
-								msg := tgbotapi.NewMessage(update.CallbackQuery.Message.Chat.ID, "Choose an option to list:")
-								msg.ReplyMarkup = keyboard
-								bot.Send(msg)
-								continue
-							case strings.Contains(callbackData, "Black"):
-								_payload["blacklisted"] = 1
-							}
+// settingsSchema fetches the settings schema published by the bot
+func settingsSchema() ([]map[string]interface{}, error) {
+	_response, err := handlers.BotRequest("GET", "retrieve_settings_schema", map[string]interface{}{})
+	if err != nil {
+		return nil, err
+	}
 
-							var _response *utils.Response
-							if _response, err = handlers.GenericRequest("GET", "bot", "retrieve_contract", _payload); err != nil {
-								msg := tgbotapi.NewMessage(update.CallbackQuery.Message.Chat.ID, fmt.Sprintf("Error: %v", err))
-								bot.Send(msg)
-								continue
-							}
+	_schema, _ := _response.Data.([]interface{})
+	schema := []map[string]interface{}{}
+	for _, _field := range _schema {
+		if field, ok := _field.(map[string]interface{}); ok {
+			schema = append(schema, field)
+		}
+	}
+	return schema, nil
+}
 
-							msg := tgbotapi.NewMessage(update.CallbackQuery.Message.Chat.ID, _response.Message)
-							msg.ParseMode = "Markdown"
-							bot.Send(msg)
-						} else {
-							msg := tgbotapi.NewMessage(update.CallbackQuery.Message.Chat.ID, "internal error")
-							bot.Send(msg)
-						}
+func settingField(key string) (map[string]interface{}, error) {
+	schema, err := settingsSchema()
+	if err != nil {
+		return nil, err
+	}
+	for _, _field := range schema {
+		if _field["key"] == key {
+			return _field, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown setting %s", key)
+}
 
-					case "getAccess":
-						// msg := tgbotapi.NewMessage(update.Message.Chat.ID, "Hello! Please enter some information:")
-						_one, _two := utils.GenerateTwoUniqueRandomNumbers(1, 24)
-						_one = 1
-						_two = 2
-						msg := tgbotapi.NewMessage(update.CallbackQuery.Message.Chat.ID, fmt.Sprintf("Please provide words from mnemonic phrase at indexes %v and %v, sepparated by space:", _one, _two))
-						msg.ReplyMarkup = tgbotapi.ForceReply{
-							ForceReply: true,
-							Selective:  true,
-						}
-						bot.Send(msg)
+func orAny(bound interface{}) interface{} {
+	if bound == nil {
+		return "any"
+	}
+	return bound
+}
 
-					case "setSettings":
-						keyboard := tgbotapi.NewInlineKeyboardMarkup(
-							tgbotapi.NewInlineKeyboardRow(
-								tgbotapi.NewInlineKeyboardButtonData("Gas Fee Max", "set_gas_fee_max"),
-								tgbotapi.NewInlineKeyboardButtonData("Exit Gas (%)", "set_exit_gas"),
-								// tgbotapi.NewInlineKeyboardButtonData("Gas Limit", "set_gas_limit"),
-							),
-							// tgbotapi.NewInlineKeyboardRow(
-							// tgbotapi.NewInlineKeyboardButtonData("Gas Priority", "set_gas_priority"),
-							// ),
-							// tgbotapi.NewInlineKeyboardRow(
-							// 	tgbotapi.NewInlineKeyboardButtonData("Deadline (mm)", "set_deadline"),
-							// ),
-							tgbotapi.NewInlineKeyboardRow(
-								tgbotapi.NewInlineKeyboardButtonData("Target Value Min", "set_target_value_min"),
-								tgbotapi.NewInlineKeyboardButtonData("Target Value Max", "set_target_value_max"),
-							),
-							tgbotapi.NewInlineKeyboardRow(
-								tgbotapi.NewInlineKeyboardButtonData("Target Gas Markup Allowed (%)", "set_target_gas_markup_allowed"),
-							),
-							tgbotapi.NewInlineKeyboardRow(
-								tgbotapi.NewInlineKeyboardButtonData("TTX Max Latency (ms)", "set_ttx_max_latency"),
-							),
-							tgbotapi.NewInlineKeyboardRow(
-								tgbotapi.NewInlineKeyboardButtonData("USD Per Trade (%)", "set_usd_per_trade"),
-								tgbotapi.NewInlineKeyboardButtonData("Draw Down (%)", "set_draw_down"),
-							),
-							tgbotapi.NewInlineKeyboardRow(
-								tgbotapi.NewInlineKeyboardButtonData("Gas Tolerance (%)", "set_gas_tolerance"),
-								tgbotapi.NewInlineKeyboardButtonData("Withdrawal Threshold", "set_withdrawal_threshold"),
-							),
-							tgbotapi.NewInlineKeyboardRow(
-								tgbotapi.NewInlineKeyboardButtonData("Main Wallet", "set_main_wallet"),
-								tgbotapi.NewInlineKeyboardButtonData("Withdrawal Wallet", "set_withdrawal_wallet"),
-							),
-							tgbotapi.NewInlineKeyboardRow(
-								tgbotapi.NewInlineKeyboardButtonData("Back", "go_back"),
-							),
-						)
+// formatSettingsChanges renders field changes returned by the bot, one per line
+func formatSettingsChanges(changes []interface{}) string {
+	text := ""
+	for _, _change := range changes {
+		change, ok := _change.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		field, _ := change["field"].(string)
+		text += fmt.Sprintf("\n  %s: %v → %v", strings.Title(strings.ReplaceAll(field, "_", " ")), change["from"], change["to"])
+	}
+	return text
+}
 
-						msg := tgbotapi.NewMessage(update.CallbackQuery.Message.Chat.ID, "Choose an option:")
-						msg.ReplyMarkup = keyboard
-						bot.Send(msg)
-					case "go_back":
-						sendStartMenu(bot, update.CallbackQuery.Message)
-					case "set_kill_switch_on", "set_kill_switch_off":
-						if !quickAccessUserData.IsOwner {
-							msg := tgbotapi.NewMessage(update.CallbackQuery.Message.Chat.ID, handlers.HandleError(handlers.ErrNoOwnerAccess))
-							bot.Send(msg)
-							continue
-						}
+// sendSettingsHistory lists recent settings versions with diff and rollback buttons for inactive ones
+func sendSettingsHistory(bot *tgbotapi.BotAPI, chatID int64, userID uint) {
+	_response, err := handlers.BotRequest("GET", "retrieve_settings_history", map[string]interface{}{
+		"user_id":       userID,
+		"blockchain_id": 1,
+		"limit":         10,
+	})
+	if err != nil {
+		msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("Error: %v", err))
+		bot.Send(msg)
+		return
+	}
 
-						ks := strings.Split(callbackData, "_")
-						state := ks[len(ks)-1]
+	versions, _ := _response.Data.([]interface{})
+	if len(versions) == 0 {
+		msg := tgbotapi.NewMessage(chatID, "No settings versions found.")
+		bot.Send(msg)
+		return
+	}
 
-						_payload := map[string]interface{}{
-							"user_id": quickAccessUserData.ID,
-						}
-						switch state {
-						case "on":
-							_payload["is_on"] = true
-						case "off":
-							_payload["is_on"] = false
-						}
+	var rows [][]tgbotapi.InlineKeyboardButton
+	text := "Settings history:\n"
+	for _, _version := range versions {
+		version, ok := _version.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		text += fmt.Sprintf("\n#%v by user %v at %v", version["id"], version["created_by"], version["created_at"])
+		if version["rollback_of"] != nil {
+			text += fmt.Sprintf(", rollback to #%v", version["rollback_of"])
+		}
+		if active, _ := version["active"].(bool); active {
+			text += " (active)"
+		} else {
+			rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("Diff #%v", version["id"]), fmt.Sprintf("diff_settings:%v", version["id"])),
+				tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("Rollback #%v", version["id"]), fmt.Sprintf("rollback_settings:%v", version["id"])),
+			))
+		}
+		changes, _ := version["changes"].([]interface{})
+		text += formatSettingsChanges(changes) + "\n"
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("Back", "go_back"),
+	))
 
-						var _response *utils.Response
-						if _response, err = handlers.GenericRequest("PATCH", "bot", "toggle_killswitch", _payload); err != nil {
-							msg := tgbotapi.NewMessage(update.CallbackQuery.Message.Chat.ID, fmt.Sprintf("Error: %v", err))
-							bot.Send(msg)
-							continue
-						}
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	bot.Send(msg)
+}
 
-						msg := tgbotapi.NewMessage(update.CallbackQuery.Message.Chat.ID, _response.Message)
-						//  fmt.Sprintf("Kill Switch is %v", state))
-						bot.Send(msg)
+// sendNodePool shows the health of every RPC node, only hosts are shown as paths may carry api keys
+func sendNodePool(bot *tgbotapi.BotAPI, chatID int64, userID uint) {
+	_response, err := handlers.BotRequest("GET", "retrieve_node_pool", map[string]interface{}{
+		"user_id": userID,
+	})
+	if err != nil {
+		msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("Error: %v", err))
+		bot.Send(msg)
+		return
+	}
 
-					case "killSwitch":
-						// if !quickAccessUserData.HasAccess {
-						// 	msg := tgbotapi.NewMessage(update.CallbackQuery.Message.Chat.ID, handlers.HandleError(handlers.ErrNoAccess))
-						// 	bot.Send(msg)
-						// 	continue
-						// }
-						if !quickAccessUserData.IsAdmin && !quickAccessUserData.IsOwner {
-							msg := tgbotapi.NewMessage(update.CallbackQuery.Message.Chat.ID, handlers.HandleError(handlers.ErrNoAdminOrOwnerAccess))
-							bot.Send(msg)
-							continue
-						}
-						keyboard := tgbotapi.NewInlineKeyboardMarkup(
-							tgbotapi.NewInlineKeyboardRow(
-								tgbotapi.NewInlineKeyboardButtonData("On", "set_kill_switch_on"),
-								tgbotapi.NewInlineKeyboardButtonData("Off", "set_kill_switch_off"),
-							),
-							tgbotapi.NewInlineKeyboardRow(
-								tgbotapi.NewInlineKeyboardButtonData("Back", "go_back"),
-							),
-						)
+	nodes, _ := _response.Data.([]interface{})
+	if len(nodes) == 0 {
+		msg := tgbotapi.NewMessage(chatID, "No nodes configured.")
+		bot.Send(msg)
+		return
+	}
 
-						msg := tgbotapi.NewMessage(update.CallbackQuery.Message.Chat.ID, "Please, confirm that you want to activate kill switch, which will stop all bot operations:")
-						msg.ReplyMarkup = keyboard
-						bot.Send(msg)
-					case "register":
-						userMnemonic, err := handlers.CreateUser(map[string]interface{}{
-							"tg_id":      update.CallbackQuery.From.ID,
-							"first_name": update.CallbackQuery.From.FirstName,
-							"last_name":  update.CallbackQuery.From.LastName,
-							"username":   update.CallbackQuery.From.UserName,
-						})
-						if err != nil {
-							msg := tgbotapi.NewMessage(update.CallbackQuery.Message.Chat.ID, "⚠️ Warning: failed to register, "+err.Error())
-							bot.Send(msg)
-							continue
-						}
+	text := "Node pool:\n"
+	for _, _node := range nodes {
+		node, ok := _node.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		host := fmt.Sprint(node["url"])
+		if nodeURL, err := url.Parse(host); err == nil && nodeURL.Host != "" {
+			host = nodeURL.Host
+		}
+		state := "✅"
+		if healthy, _ := node["healthy"].(bool); !healthy {
+			state = fmt.Sprintf("❌ %v", node["reason"])
+		}
+		errorRate, _ := node["error_rate"].(float64)
+		text += fmt.Sprintf("\n%s %s (%v)\n  block %v, lag %v, %vms, errors %.0f%%",
+			state, host, node["role"], node["block_number"], node["lag"], node["latency_ms"], errorRate*100)
+	}
 
-						tip := "**_👋 Tip: Please, save the mnemonic phrase and then delete the message afterwards. _**"
-						msg := tgbotapi.NewMessage(update.CallbackQuery.Message.Chat.ID, tip)
-						msg.ParseMode = "Markdown"
-						bot.Send(msg)
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("Refresh", "nodePool"),
+			tgbotapi.NewInlineKeyboardButtonData("Back", "go_back"),
+		),
+	)
+	bot.Send(msg)
+}
 
-						message := fmt.Sprintf("`%s`", userMnemonic)
-						msg = tgbotapi.NewMessage(update.CallbackQuery.Message.Chat.ID, message)
-						msg.ParseMode = "Markdown"
-						bot.Send(msg)
+// sendAllowances lists stale allowances of the system wallets with a revoke button each
+func sendAllowances(bot *tgbotapi.BotAPI, chatID int64, userID uint) {
+	_response, err := handlers.BotRequest("GET", "retrieve_allowances", map[string]interface{}{
+		"user_id": userID,
+		"stale":   1,
+	})
+	if err != nil {
+		msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("Error: %v", err))
+		bot.Send(msg)
+		return
+	}
 
-						msg = tgbotapi.NewMessage(update.CallbackQuery.Message.Chat.ID, "Registration successful")
-						msg.ParseMode = "Markdown"
-						bot.Send(msg)
-					case "systemWallets":
-						if !quickAccessUserData.HasAccess {
-							msg := tgbotapi.NewMessage(update.CallbackQuery.Message.Chat.ID, handlers.HandleError(handlers.ErrNoAccess))
-							bot.Send(msg)
-							continue
-						}
-						if !quickAccessUserData.IsAdmin && !quickAccessUserData.IsOwner {
-							msg := tgbotapi.NewMessage(update.CallbackQuery.Message.Chat.ID, handlers.HandleError(handlers.ErrNoAdminOrOwnerAccess))
-							bot.Send(msg)
-							continue
-						}
-						keyboard := tgbotapi.NewInlineKeyboardMarkup(
-							tgbotapi.NewInlineKeyboardRow(
-								tgbotapi.NewInlineKeyboardButtonData("Main", "main_wallet"),
-								tgbotapi.NewInlineKeyboardButtonData("Withdrawal", "withdrawal_wallet"),
-							),
-							tgbotapi.NewInlineKeyboardRow(
-								tgbotapi.NewInlineKeyboardButtonData("Back", "go_back"),
-							),
-						)
+	allowances, _ := _response.Data.([]interface{})
+	if len(allowances) == 0 {
+		msg := tgbotapi.NewMessage(chatID, "No stale allowances.")
+		bot.Send(msg)
+		return
+	}
 
-						msg := tgbotapi.NewMessage(update.CallbackQuery.Message.Chat.ID, "Please select the type of wallet for which you would like to view information:")
-						msg.ReplyMarkup = keyboard
-						bot.Send(msg)
-					case "main_wallet", "withdrawal_wallet":
-						if !quickAccessUserData.HasAccess {
-							msg := tgbotapi.NewMessage(update.CallbackQuery.Message.Chat.ID, handlers.HandleError(handlers.ErrNoAccess))
-							bot.Send(msg)
-							continue
-						}
-						if !quickAccessUserData.IsAdmin && !quickAccessUserData.IsOwner {
-							msg := tgbotapi.NewMessage(update.CallbackQuery.Message.Chat.ID, handlers.HandleError(handlers.ErrNoAdminOrOwnerAccess))
-							bot.Send(msg)
-							continue
-						}
+	var rows [][]tgbotapi.InlineKeyboardButton
+	text := "Stale allowances:\n"
+	for _, _allowance := range allowances {
+		allowance, ok := _allowance.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		text += fmt.Sprintf("\n#%v %v: token %v, spender %v (%v)", allowance["id"], allowance["amount"], allowance["token"], allowance["spender"], allowance["spender_type"])
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("Revoke #%v", allowance["id"]), fmt.Sprintf("revoke_allowance:%v", allowance["id"])),
+		))
+	}
+	rows = append(rows,
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("Revoke All Stale", "revoke_stale_allowances"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("Back", "go_back"),
+		),
+	)
 
-						_message := strings.Split(callbackData, "_")
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	bot.Send(msg)
+}
 
-						_payload := map[string]interface{}{
-							"user_id":     quickAccessUserData.ID,
-							"wallet_type": _message[0],
-						}
+// revokeAllowances asks the bot to revoke the given allowances, or every stale one when ids are empty
+func revokeAllowances(bot *tgbotapi.BotAPI, chatID int64, userID uint, ids ...uint) {
+	payload := map[string]interface{}{"user_id": userID}
+	if len(ids) > 0 {
+		payload["allowance_ids"] = ids
+	} else {
+		payload["all_stale"] = true
+	}
 
-						var _response *utils.Response
-						if _response, err = handlers.GenericRequest("GET", "bot", "retrieve_wallet", _payload); err != nil {
-							msg := tgbotapi.NewMessage(update.CallbackQuery.Message.Chat.ID, fmt.Sprintf("Error: %v", err))
-							bot.Send(msg)
-							continue
-						}
+	_response, err := handlers.BotRequest("POST", "revoke_allowances", payload)
+	if err != nil {
+		msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("Error: %v", err))
+		bot.Send(msg)
+		return
+	}
 
-						msg := tgbotapi.NewMessage(update.CallbackQuery.Message.Chat.ID, _response.Message)
-						msg.ParseMode = "Markdown"
-						bot.Send(msg)
-					case "DEX", "coin":
-						capitalizedCallbckData := strings.Title(callbackData)
-						keyboard := tgbotapi.NewInlineKeyboardMarkup(
-							tgbotapi.NewInlineKeyboardRow(
-								tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("List %ss", capitalizedCallbckData), fmt.Sprintf("list_%ss", callbackData)),
-							),
-							tgbotapi.NewInlineKeyboardRow(
-								tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("Add %s", capitalizedCallbckData), fmt.Sprintf("add_%ss", callbackData)),
-								tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("Delete %s", capitalizedCallbckData), fmt.Sprintf("delete_%ss", callbackData)),
-							),
-							tgbotapi.NewInlineKeyboardRow(
-								tgbotapi.NewInlineKeyboardButtonData("Back", "go_back"),
-							),
-						)
-						msg := tgbotapi.NewMessage(update.CallbackQuery.Message.Chat.ID, "Please select action")
-						msg.ReplyMarkup = keyboard
-						bot.Send(msg)
-					case "add_DEXs", "add_coins", "delete_DEXs", "delete_coins":
-						if !quickAccessUserData.HasAccess {
-							msg := tgbotapi.NewMessage(update.CallbackQuery.Message.Chat.ID, handlers.HandleError(handlers.ErrNoAccess))
-							bot.Send(msg)
-							continue
-						}
-						fmt.Println("DELTE COIN", quickAccessUserData.IsAdmin, quickAccessUserData.IsOwner)
-						if !quickAccessUserData.IsAdmin && !quickAccessUserData.IsOwner {
-							msg := tgbotapi.NewMessage(update.CallbackQuery.Message.Chat.ID, handlers.HandleError(handlers.ErrNoAdminOrOwnerAccess))
-							bot.Send(msg)
-							continue
-						}
-						commandSlice := strings.Split(callbackData, "_")
-						message := "Please provide"
-						if commandSlice[0] == "add" {
-							message += fmt.Sprintf(" %s contract data with comma as delimiter to %s", commandSlice[1][:len(commandSlice[1])-1], commandSlice[0])
-							message += " into the system."
-						} else {
-							message += fmt.Sprintf(" %s contract address to %s", commandSlice[1][:len(commandSlice[1])-1], commandSlice[0])
-							message += " from the system."
-						}
+	msg := tgbotapi.NewMessage(chatID, _response.Message)
+	bot.Send(msg)
+}
 
-						if !strings.Contains(callbackData, "delete") {
-							if strings.Contains(callbackData, "DEX") {
-								message += " E.g.: address, name (uniswapv3 or quickswap)"
-							} else {
-								message += " E.g.: address, decimals (6 or 18), name (usdt or dai)"
-							}
-						}
+func main() {
+	config.Load()
 
-						msg := tgbotapi.NewMessage(update.CallbackQuery.Message.Chat.ID, message)
-						msg.ReplyMarkup = tgbotapi.ForceReply{
-							ForceReply: true,
-							Selective:  true,
-						}
-						bot.Send(msg)
-					case "list_DEXs", "list_coins":
-						if !quickAccessUserData.HasAccess {
-							msg := tgbotapi.NewMessage(update.CallbackQuery.Message.Chat.ID, handlers.HandleError(handlers.ErrNoAccess))
-							bot.Send(msg)
-							continue
-						}
+	log.Printf("ChannelID: %d\n", config.Telegram.ChannelID)
+	log.Printf("APIEndpoint: %s\n", config.Telegram.APIEndpoint)
+	log.Printf("AppSecret: %s\n", config.Telegram.AppSecret)
+	log.Printf("logDirectory: %s\n", config.Telegram.LogDirectory)
+	log.Printf("maxLogSize: %d\n", config.Telegram.MaxLogSize)
+	log.Printf("Debug: %v\n", config.Telegram.Debug)
 
-						resource := ""
-						if strings.Contains(callbackData, "DEX") {
-							resource = "dex"
-						} else if strings.Contains(callbackData, "coin") {
-							resource = "coin"
-						}
+	controllers.ConnectDatabase()
+	controllers.Seed()
 
-						_payload := map[string]interface{}{
-							"user_id":       quickAccessUserData.ID,
-							"blockchain_id": 1,
-						}
+	var bot *tgbotapi.BotAPI
+	for {
+		var err error
+		if bot, err = handlers.SharedBot(); err == nil {
+			break
+		}
+		log.Println("Failed to initialize Telegram BOT API:", err)
+		time.Sleep(pollRetryDelay)
+	}
 
-						var _response *utils.Response
-						if _response, err = handlers.GenericRequest("GET", "bot", "retrieve_"+resource, _payload); err != nil {
-							msg := tgbotapi.NewMessage(update.CallbackQuery.Message.Chat.ID, fmt.Sprintf("Error: %v", err))
-							bot.Send(msg)
-							continue
-						}
+	announceOnce.Do(func() {
+		go deliverEvents(bot)
+	})
 
-						msg := tgbotapi.NewMessage(update.CallbackQuery.Message.Chat.ID, _response.Message)
-						msg.ParseMode = "Markdown"
-						bot.Send(msg)
-					case "contract":
-						keyboard := tgbotapi.NewInlineKeyboardMarkup(
-							tgbotapi.NewInlineKeyboardRow(
-								tgbotapi.NewInlineKeyboardButtonData("List Contracts", "listContracts"),
-								tgbotapi.NewInlineKeyboardButtonData("Find Contract", "findContracts"),
-							),
-							tgbotapi.NewInlineKeyboardRow(
-								tgbotapi.NewInlineKeyboardButtonData("Whitelist Contract", "whiteListContract"),
-								tgbotapi.NewInlineKeyboardButtonData("Blacklist Contract", "blackListContract"),
-							),
-							tgbotapi.NewInlineKeyboardRow(
-								tgbotapi.NewInlineKeyboardButtonData("Back", "go_back"),
-							),
-						)
-						msg := tgbotapi.NewMessage(update.CallbackQuery.Message.Chat.ID, "Please select action")
-						msg.ReplyMarkup = keyboard
-						bot.Send(msg)
-					default:
-						response := "Hi Callback 👋" + callbackData
-						msg := tgbotapi.NewMessage(update.CallbackQuery.Message.Chat.ID, response)
-						bot.Send(msg)
-					}
+	router := NewRouter()
+	registerRoutes(router)
+	resumeConversations(bot)
+	go expireConversations(bot)
 
-				}
-			}
-		}
+	if config.Telegram.WebhookURL != "" {
+		log.Fatal(serveWebhook(bot, router))
 	}
+	poll(bot, router)
 }
@@ -0,0 +1,10 @@
+package models
+
+import "common/audit"
+
+// AuditEntry is a row of the append-only audit log, see common/audit for how entries are chained
+type AuditEntry audit.Entry
+
+func (AuditEntry) TableName() string {
+	return "telegram_audit_log"
+}
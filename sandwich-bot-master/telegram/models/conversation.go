@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// Conversation is the step a chat is at in a multi-step flow and the answers given so far. There is
+// at most one per chat, starting another flow replaces it
+type Conversation struct {
+	ChatID int64 `gorm:"primaryKey;autoIncrement:false"`
+	// only the telegram user that started the flow advances it
+	TgID      int
+	Flow      string
+	Step      string
+	Data      datatypes.JSON
+	ExpiresAt time.Time `gorm:"index"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (Conversation) TableName() string {
+	return "telegram_conversations"
+}
@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// Subscription is an event category a chat receives alerts for
+type Subscription struct {
+	ID       uint   `gorm:"primaryKey"`
+	ChatID   int64  `gorm:"uniqueIndex:idx_subscription;not null"`
+	Category string `gorm:"uniqueIndex:idx_subscription;not null"`
+	// the telegram user that subscribed, alerts stop once it loses the receive_alerts permission
+	TgID int `gorm:"not null"`
+	// alerts of a muted subscription are dropped until then
+	MutedUntil *time.Time
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+func (Subscription) TableName() string {
+	return "telegram_subscriptions"
+}
+
+// EventDelivery records an event sent to a chat, so a redelivered event skips the chats it reached
+type EventDelivery struct {
+	EventID   uint      `gorm:"primaryKey;autoIncrement:false"`
+	ChatID    int64     `gorm:"primaryKey;autoIncrement:false"`
+	CreatedAt time.Time `gorm:"index"`
+}
+
+func (EventDelivery) TableName() string {
+	return "telegram_event_deliveries"
+}
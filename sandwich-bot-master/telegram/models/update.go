@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// UpdateOffset is the id of the first update a bot has not handled yet, it survives restarts so
+// neither polling nor webhook redeliveries run an update twice
+type UpdateOffset struct {
+	BotID     int `gorm:"primaryKey;autoIncrement:false"`
+	Offset    int
+	UpdatedAt time.Time
+}
+
+func (UpdateOffset) TableName() string {
+	return "telegram_update_offsets"
+}
@@ -0,0 +1,397 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"telegram/config"
+	"telegram/controllers"
+	"telegram/handlers"
+	"telegram/models"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	eventPollInterval = 5 * time.Second
+	eventClaimLimit   = 20
+	alertMuteDuration = time.Hour
+	// Telegram allows about 30 messages a second overall, one a second per chat and 20 a minute per group
+	globalSendInterval = time.Second / 25
+	chatSendInterval   = time.Second
+	groupSendInterval  = 3 * time.Second
+)
+
+// alertCategories are the bot event categories chats can subscribe to, in menu order
+var alertCategories = []struct {
+	category string
+	title    string
+}{
+	{"settings_changed", "Settings Changed"},
+	{"kill_switch", "Kill Switch"},
+	{"wallet_balance_low", "Wallet Balance Low"},
+	{"rpc_pool_degraded", "RPC Pool Degraded"},
+	{"order_stuck", "Order Stuck"},
+	{"allowance_changed", "Allowance Changed"},
+	{"sweep_proposed", "Sweep Proposed"},
+	{"price_deviation", "Price Deviation"},
+}
+
+// channelCategories are posted to the channel whether it subscribed to them or not
+var channelCategories = map[string]bool{
+	"kill_switch":       true,
+	"order_stuck":       true,
+	"allowance_changed": true,
+	"sweep_proposed":    true,
+	"price_deviation":   true,
+}
+
+func alertTitle(category string) (string, bool) {
+	for _, _category := range alertCategories {
+		if _category.category == category {
+			return _category.title, true
+		}
+	}
+	return "", false
+}
+
+// sendLimiter spaces out messages to stay within the Bot API limits
+type sendLimiter struct {
+	mu    sync.Mutex
+	next  time.Time
+	chats map[int64]time.Time
+}
+
+// wait blocks until a message may be sent to chatID and reserves the slot
+func (l *sendLimiter) wait(chatID int64) {
+	l.mu.Lock()
+	now := time.Now()
+	at := l.next
+	if chatAt := l.chats[chatID]; chatAt.After(at) {
+		at = chatAt
+	}
+	if at.Before(now) {
+		at = now
+	}
+	l.next = at.Add(globalSendInterval)
+	// group chat ids are negative
+	interval := chatSendInterval
+	if chatID < 0 {
+		interval = groupSendInterval
+	}
+	l.chats[chatID] = at.Add(interval)
+	l.mu.Unlock()
+
+	time.Sleep(time.Until(at))
+}
+
+// pause holds every message back, Telegram asks for it with retry_after
+func (l *sendLimiter) pause(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if at := time.Now().Add(d); at.After(l.next) {
+		l.next = at
+	}
+}
+
+// deliverEvents claims events published by the bot and sends them to the chats subscribed to their
+// category. An event is acknowledged once every subscriber got it, a failed one is retried by the bot
+// later and skips the chats it reached already
+func deliverEvents(bot *tgbotapi.BotAPI) {
+	limiter := &sendLimiter{chats: map[int64]time.Time{}}
+
+	ticker := time.NewTicker(eventPollInterval)
+	defer ticker.Stop()
+
+	for ; true; <-ticker.C {
+		_response, err := handlers.BotRequest("POST", "claim_events", map[string]interface{}{
+			"limit": eventClaimLimit,
+		})
+		if err != nil {
+			log.Printf("Failed to claim events: %v", err)
+			continue
+		}
+
+		events, _ := _response.Data.([]interface{})
+		if len(events) == 0 {
+			continue
+		}
+
+		// permissions are checked once per subscriber and round
+		allowed := map[int]bool{}
+		delivered := []uint{}
+		failed := []map[string]interface{}{}
+		for _, _event := range events {
+			event, ok := _event.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			id, _ := event["id"].(float64)
+			if err := deliverEvent(bot, limiter, uint(id), event, allowed); err != nil {
+				log.Printf("Failed to deliver event %v: %v", id, err)
+				failed = append(failed, map[string]interface{}{"id": uint(id), "error": err.Error()})
+				continue
+			}
+			delivered = append(delivered, uint(id))
+		}
+
+		if _, err := handlers.BotRequest("POST", "ack_events", map[string]interface{}{
+			"delivered": delivered,
+			"failed":    failed,
+		}); err != nil {
+			// the events are claimed again once their lease ends, deliveries keep them from repeating
+			log.Printf("Failed to acknowledge events: %v", err)
+		}
+	}
+}
+
+// deliverEvent sends an event to every unmuted subscriber still allowed to receive alerts, and to the
+// channel for channelCategories
+func deliverEvent(bot *tgbotapi.BotAPI, limiter *sendLimiter, id uint, event map[string]interface{}, allowed map[int]bool) error {
+	category, _ := event["category"].(string)
+	payload, _ := event["payload"].(map[string]interface{})
+	text, markup := formatEvent(category, payload)
+
+	var subscriptions []models.Subscription
+	if err := controllers.DB.Find(&subscriptions, "category = ? AND (muted_until IS NULL OR muted_until <= ?)", category, time.Now()).Error; err != nil {
+		return err
+	}
+	if config.Telegram.ChannelID != 0 && channelCategories[category] {
+		// the channel has no subscriber to check permissions of, its members are the owners
+		subscriptions = append([]models.Subscription{{ChatID: config.Telegram.ChannelID}}, subscriptions...)
+	}
+
+	var deliveries []models.EventDelivery
+	if err := controllers.DB.Find(&deliveries, "event_id = ?", id).Error; err != nil {
+		return err
+	}
+	reached := map[int64]bool{}
+	for _, _delivery := range deliveries {
+		reached[_delivery.ChatID] = true
+	}
+
+	var firstErr error
+	for _, _subscription := range subscriptions {
+		if reached[_subscription.ChatID] {
+			continue
+		}
+
+		if _subscription.TgID != 0 {
+			permitted, checked := allowed[_subscription.TgID]
+			if !checked {
+				ok, _, err := handlers.CheckPermission(_subscription.TgID, "receive_alerts")
+				if err != nil {
+					return err
+				}
+				permitted = ok
+				allowed[_subscription.TgID] = ok
+			}
+			if !permitted {
+				continue
+			}
+		}
+
+		limiter.wait(_subscription.ChatID)
+		msg := tgbotapi.NewMessage(_subscription.ChatID, text)
+		if markup != nil {
+			msg.ReplyMarkup = markup
+		}
+		if _, err := bot.Send(msg); err != nil {
+			var apiErr tgbotapi.Error
+			if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+				// the rest of the chats get the event when it is retried
+				limiter.pause(time.Duration(apiErr.RetryAfter) * time.Second)
+				return err
+			}
+			if errors.As(err, &apiErr) && strings.HasPrefix(apiErr.Message, "Forbidden") {
+				// the bot was blocked or removed from the chat
+				log.Printf("Dropping subscriptions of chat %d: %v", _subscription.ChatID, err)
+				controllers.DB.Delete(&models.Subscription{}, "chat_id = ?", _subscription.ChatID)
+				continue
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+
+		reached[_subscription.ChatID] = true
+		if err := controllers.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.EventDelivery{
+			EventID: id,
+			ChatID:  _subscription.ChatID,
+		}).Error; err != nil {
+			log.Printf("Failed to record delivery of event %d to chat %d: %v", id, _subscription.ChatID, err)
+		}
+	}
+	return firstErr
+}
+
+// formatEvent renders an event payload, allowance changes come with a button to revoke them and
+// sweep proposals with one to request them
+func formatEvent(category string, payload map[string]interface{}) (string, interface{}) {
+	switch category {
+	case "settings_changed":
+		text := fmt.Sprintf("⚙️ Settings version %v is active", payload["version"])
+		if payload["rollback_of"] != nil {
+			text += fmt.Sprintf(", rolled back to version %v", payload["rollback_of"])
+		}
+		changes, _ := payload["changes"].([]interface{})
+		return text + "." + formatSettingsChanges(changes), nil
+	case "kill_switch":
+		on, _ := payload["is_on"].(bool)
+		summary, ok := payload["summary"].(map[string]interface{})
+		switch {
+		case ok && on:
+			return fmt.Sprintf("🛑 KillSwitch is on, trading stopped.\nIn-flight attacks: %v\nStill busy after %.0fs: %v\nExpired sweeps: %v\nCancelled approvals: %v",
+				summary["in_flight"], summary["drain_seconds"], summary["undrained"], summary["expired_sweeps"], summary["cancelled_approvals"]), nil
+		case ok:
+			return "✅ KillSwitch is off, trading restarted.", nil
+		case on:
+			return "🛑 Kill switch turned on.", nil
+		}
+		return "🛑 Kill switch turned off.", nil
+	case "wallet_balance_low":
+		return fmt.Sprintf("⛽ Wallet %v holds %v MATIC, below the minimum of %v.", payload["address"], payload["balance"], payload["minimum"]), nil
+	case "rpc_pool_degraded":
+		text := fmt.Sprintf("📡 %v RPC pool has %v of %v healthy nodes.", payload["role"], payload["healthy"], payload["total"])
+		if ejected, ok := payload["ejected"].(map[string]interface{}); ok {
+			for _node, _reason := range ejected {
+				text += fmt.Sprintf("\n  Ejected %s: %v", _node, _reason)
+			}
+		}
+		if restored, ok := payload["restored"].([]interface{}); ok {
+			for _, _node := range restored {
+				text += fmt.Sprintf("\n  Restored %v", _node)
+			}
+		}
+		return text, nil
+	case "order_stuck":
+		return fmt.Sprintf("⏳ Order %v is stuck %v since %v, transaction %v.", payload["order_id"], payload["status"], payload["since"], payload["hash"]), nil
+	case "allowance_changed":
+		icon := "🔑"
+		if payload["spender_type"] == "unknown" && payload["from"] == "0" {
+			icon = "⚠️"
+		}
+		text := fmt.Sprintf("%s Wallet %v allowance of %v spender %v for token %v changed from %v to %v.", icon,
+			payload["wallet"], payload["spender_type"], payload["spender"], payload["token"], payload["from"], payload["to"])
+		if payload["to"] == "0" {
+			return text, nil
+		}
+		return text, tgbotapi.NewInlineKeyboardMarkup(
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("Revoke", fmt.Sprintf("revoke_allowance:%v", payload["allowance_id"])),
+			),
+		)
+	case "sweep_proposed":
+		return fmt.Sprintf("Main wallet %v holds $%v, above the withdrawal threshold.\nProposed sweep %v: %v %v ($%v) to withdrawal wallet %v.",
+				payload["wallet"], payload["wallet_usd_value"], payload["sweep_id"], payload["amount"], payload["token_name"], payload["usd_value"], payload["to_wallet"]),
+			tgbotapi.NewInlineKeyboardMarkup(
+				tgbotapi.NewInlineKeyboardRow(
+					tgbotapi.NewInlineKeyboardButtonData("Request Sweep", fmt.Sprintf("request_sweep:%v", payload["sweep_id"])),
+				),
+			)
+	case "price_deviation":
+		deviation, _ := strconv.ParseFloat(fmt.Sprint(payload["deviation"]), 64)
+		return fmt.Sprintf("⚠️ %v price from %v is %v USD, %.2f%% off the median %v USD.",
+			payload["asset"], payload["source"], payload["price"], deviation*100, payload["median"]), nil
+	}
+	return fmt.Sprintf("%s: %v", category, payload), nil
+}
+
+// sendAlertsMenu lists the alert categories with the subscription and mute state of the chat
+func sendAlertsMenu(c *updateContext) error {
+	var subscriptions []models.Subscription
+	if err := controllers.DB.Find(&subscriptions, "chat_id = ?", c.chatID).Error; err != nil {
+		return err
+	}
+	subscribed := map[string]models.Subscription{}
+	for _, _subscription := range subscriptions {
+		subscribed[_subscription.Category] = _subscription
+	}
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, _category := range alertCategories {
+		subscription, ok := subscribed[_category.category]
+		if !ok {
+			rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData(_category.title, "subscribe:"+_category.category),
+			))
+			continue
+		}
+
+		mute := tgbotapi.NewInlineKeyboardButtonData("Mute 1h", "mute:"+_category.category)
+		if subscription.MutedUntil != nil && subscription.MutedUntil.After(time.Now()) {
+			mute = tgbotapi.NewInlineKeyboardButtonData("Unmute", "unmute:"+_category.category)
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("✅ "+_category.title, "unsubscribe:"+_category.category),
+			mute,
+		))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("Back", "go_back"),
+	))
+
+	msg := tgbotapi.NewMessage(c.chatID, "Alerts this chat receives, tap a category to subscribe or unsubscribe:")
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	c.bot.Send(msg)
+	return nil
+}
+
+func toggleSubscription(subscribe bool) routeHandler {
+	return func(c *updateContext) error {
+		if _, ok := alertTitle(c.data); !ok {
+			return errors.New("unknown alert category")
+		}
+
+		if subscribe {
+			if err := controllers.DB.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "chat_id"}, {Name: "category"}},
+				DoUpdates: clause.AssignmentColumns([]string{"tg_id", "updated_at"}),
+			}).Create(&models.Subscription{
+				ChatID:   c.chatID,
+				Category: c.data,
+				TgID:     c.tgID,
+			}).Error; err != nil {
+				return err
+			}
+		} else if err := controllers.DB.Delete(&models.Subscription{}, "chat_id = ? AND category = ?", c.chatID, c.data).Error; err != nil {
+			return err
+		}
+
+		return sendAlertsMenu(c)
+	}
+}
+
+// muteSubscription mutes a subscribed category for d, a zero d unmutes it
+func muteSubscription(d time.Duration) routeHandler {
+	return func(c *updateContext) error {
+		title, ok := alertTitle(c.data)
+		if !ok {
+			return errors.New("unknown alert category")
+		}
+
+		var mutedUntil *time.Time
+		if d > 0 {
+			until := time.Now().Add(d)
+			mutedUntil = &until
+		}
+		result := controllers.DB.Model(&models.Subscription{}).
+			Where("chat_id = ? AND category = ?", c.chatID, c.data).
+			Update("muted_until", mutedUntil)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			c.reply(fmt.Sprintf("This chat is not subscribed to %s alerts.", title))
+			return nil
+		}
+
+		return sendAlertsMenu(c)
+	}
+}
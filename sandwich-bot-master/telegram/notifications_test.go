@@ -0,0 +1,77 @@
+package main
+
+import (
+	"strings"
+	"telegram/config"
+	"telegram/controllers"
+	"telegram/models"
+	"testing"
+	"time"
+)
+
+const testChannelID = int64(-1002)
+
+func TestDeliverEventToChannel(t *testing.T) {
+	tb := newTestBot(t)
+	tb.registered(true, "")
+	config.Telegram.ChannelID = testChannelID
+	if err := controllers.DB.Create(&models.Subscription{ChatID: testChatID, Category: "sweep_proposed", TgID: testTgID}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	limiter := &sendLimiter{chats: map[int64]time.Time{}}
+	sweep := map[string]interface{}{
+		"category": "sweep_proposed",
+		"payload": map[string]interface{}{
+			"sweep_id": "swp-1", "wallet": "0xmain", "to_wallet": "0xwithdrawal", "token_name": "USDC",
+			"amount": "500000000", "usd_value": "500", "wallet_usd_value": "1500",
+		},
+	}
+	if err := deliverEvent(tb.bot, limiter, 1, sweep, map[int]bool{}); err != nil {
+		t.Fatal(err)
+	}
+
+	sent := tb.api.Sent()
+	if len(sent) != 2 || sent[0].ChatID != testChannelID || sent[1].ChatID != testChatID {
+		t.Fatalf("sent: %+v", sent)
+	}
+	if !strings.Contains(sent[0].Text, "Proposed sweep swp-1: 500000000 USDC ($500)") || !strings.Contains(string(sent[0].ReplyMarkup), `"callback_data":"request_sweep:swp-1"`) {
+		t.Fatalf("sweep proposal: %+v", sent[0])
+	}
+
+	// a retried event skips the chats it reached
+	if err := deliverEvent(tb.bot, limiter, 1, sweep, map[int]bool{}); err != nil {
+		t.Fatal(err)
+	}
+	if sent := tb.api.Sent(); len(sent) != 2 {
+		t.Fatalf("event was delivered twice: %+v", sent)
+	}
+
+	// categories outside channelCategories only reach subscribers
+	settings := map[string]interface{}{"category": "settings_changed", "payload": map[string]interface{}{"version": 3}}
+	if err := deliverEvent(tb.bot, limiter, 2, settings, map[int]bool{}); err != nil {
+		t.Fatal(err)
+	}
+	if sent := tb.api.Sent(); len(sent) != 2 {
+		t.Fatalf("settings change reached the channel: %+v", sent[2:])
+	}
+}
+
+func TestFormatKillSwitchEvent(t *testing.T) {
+	text, _ := formatEvent("kill_switch", map[string]interface{}{"is_on": true})
+	if text != "🛑 Kill switch turned on." {
+		t.Fatalf("toggle: %q", text)
+	}
+
+	text, _ = formatEvent("kill_switch", map[string]interface{}{"is_on": true, "summary": map[string]interface{}{
+		"on": true, "in_flight": 2, "drain_seconds": 12.4, "undrained": []interface{}{"0xabc"}, "expired_sweeps": 1, "cancelled_approvals": 3,
+	}})
+	if !strings.Contains(text, "Still busy after 12s: [0xabc]") || !strings.Contains(text, "Cancelled approvals: 3") {
+		t.Fatalf("summary: %q", text)
+	}
+
+	text, _ = formatEvent("kill_switch", map[string]interface{}{"is_on": false, "summary": map[string]interface{}{"on": false}})
+	if text != "✅ KillSwitch is off, trading restarted." {
+		t.Fatalf("off summary: %q", text)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"telegram/handlers"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// hours of history the portfolio chart covers
+const portfolioChartHours = 7 * 24
+
+// sendPortfolio sends the latest holdings of the wallets of walletType, all wallets when it is empty,
+// followed by a chart of their value over the last week
+func sendPortfolio(c *updateContext, walletType string) error {
+	payload := map[string]interface{}{"user_id": c.userID()}
+	if walletType != "" {
+		payload["wallet_type"] = walletType
+	}
+
+	_response, err := handlers.GenericRequest("GET", "bot", "retrieve_portfolio", payload)
+	if err != nil {
+		return err
+	}
+	if _response == nil {
+		return errors.New("failed to retrieve the portfolio")
+	}
+	portfolio, ok := _response.Data.(map[string]interface{})
+	if !ok {
+		return errors.New(orMessage(_response.Message, "failed to retrieve the portfolio"))
+	}
+	if portfolio["taken_at"] == nil {
+		c.reply(orMessage(_response.Message, "No portfolio snapshot was taken yet"))
+		return nil
+	}
+	c.reply(formatPortfolio(portfolio))
+
+	payload["hours"] = portfolioChartHours
+	chart, err := handlers.DownloadRequest("bot", "retrieve_portfolio_chart", payload)
+	if err != nil {
+		// a fresh install has a single snapshot round, the holdings alone are all there is to show
+		return nil
+	}
+	photo := tgbotapi.NewPhotoUpload(c.chatID, tgbotapi.FileBytes{
+		Name:  fmt.Sprintf("portfolio_%s.png", time.Now().UTC().Format("20060102T150405Z")),
+		Bytes: chart,
+	})
+	photo.Caption = "Portfolio value in USD over the last 7 days"
+	if _, err := c.bot.Send(photo); err != nil {
+		return fmt.Errorf("failed to send the chart: %w", err)
+	}
+	return nil
+}
+
+// formatPortfolio prints the total with its changes and the holdings of every wallet
+func formatPortfolio(portfolio map[string]interface{}) string {
+	text := fmt.Sprintf("💼 Portfolio: $%s", formatUSD(portfolio["usd_value"]))
+	if priced, _ := portfolio["priced"].(bool); !priced {
+		text += " (some holdings have no price)"
+	}
+	text += fmt.Sprintf("\nAs of %s", formatPortfolioTime(portfolio["taken_at"]))
+	text += "\n24h: " + formatPortfolioChange(portfolio["change_24h"])
+	text += "\n7d: " + formatPortfolioChange(portfolio["change_7d"])
+
+	wallets, _ := portfolio["wallets"].([]interface{})
+	for _, _wallet := range wallets {
+		snapshot, ok := _wallet.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name := fmt.Sprintf("wallet %v", formatAuditValue(snapshot["wallet_id"]))
+		if wallet, ok := snapshot["wallet"].(map[string]interface{}); ok {
+			name = fmt.Sprintf("%v wallet %v", wallet["type"], wallet["address"])
+		}
+		text += fmt.Sprintf("\n\n%s: $%s", name, formatUSD(snapshot["usd_value"]))
+
+		holdings, _ := snapshot["holdings"].([]interface{})
+		if len(holdings) == 0 {
+			text += "\n  empty"
+		}
+		for _, _holding := range holdings {
+			holding, ok := _holding.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			asset := strings.ToUpper(fmt.Sprint(holding["asset"]))
+			if holding["price_usd"] == nil {
+				text += fmt.Sprintf("\n  %v %s, no price", holding["balance"], asset)
+				continue
+			}
+			text += fmt.Sprintf("\n  %v %s × $%v = $%s", holding["balance"], asset, holding["price_usd"], formatUSD(holding["usd_value"]))
+		}
+	}
+	return text
+}
+
+// formatPortfolioChange prints a change as signed dollars and percent, n/a without enough history
+func formatPortfolioChange(value interface{}) string {
+	change, ok := value.(map[string]interface{})
+	if !ok {
+		return "n/a"
+	}
+	text := fmt.Sprintf("%s$%s", changeSign(change["change"]), strings.TrimPrefix(formatUSD(change["change"]), "-"))
+	if change["percent"] != nil {
+		text += fmt.Sprintf(" (%s%s%%)", changeSign(change["percent"]), strings.TrimPrefix(fmt.Sprint(change["percent"]), "-"))
+	}
+	return text
+}
+
+func changeSign(value interface{}) string {
+	if strings.HasPrefix(fmt.Sprint(value), "-") {
+		return "-"
+	}
+	return "+"
+}
+
+// formatUSD rounds a decimal the bot sends as JSON string to cents
+func formatUSD(value interface{}) string {
+	amount, err := strconv.ParseFloat(fmt.Sprint(value), 64)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return strconv.FormatFloat(amount, 'f', 2, 64)
+}
+
+func formatPortfolioTime(value interface{}) string {
+	if takenAt, err := time.Parse(time.RFC3339Nano, fmt.Sprint(value)); err == nil {
+		return takenAt.UTC().Format("2006-01-02 15:04 UTC")
+	}
+	return fmt.Sprint(value)
+}
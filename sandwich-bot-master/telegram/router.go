@@ -0,0 +1,261 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"runtime/debug"
+	"strings"
+	"telegram/handlers"
+	"telegram/types"
+	"telegram/utils"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+const (
+	// publicAccess routes also serve telegram users that did not register yet
+	publicAccess = "public"
+	// userAccess routes serve any registered user, other routes name the auth permission they require
+	userAccess = "user"
+)
+
+// updateContext is what a route gets to handle one update
+type updateContext struct {
+	bot    *tgbotapi.BotAPI
+	update tgbotapi.Update
+	// chat the update came from, replies go there
+	chatID int64
+	tgID   int
+	// nil for users that did not register yet
+	user *types.QuickAccessUserDataType
+	// the command, callback data or reply text that matched the route
+	data string
+}
+
+type routeHandler func(c *updateContext) error
+
+type route struct {
+	// matched against the command or the callback data
+	key        string
+	permission string
+	handle     routeHandler
+	// the data of secret routes stays out of the audit log
+	secret bool
+}
+
+// Router dispatches telegram updates to the handler registered for them. The permission a route
+// declares is checked before the handler runs, an error it returns is reported in the chat
+type Router struct {
+	commands         map[string]route
+	callbacks        map[string]route
+	callbackPrefixes []route
+	// answers commands, callbacks and channel posts nothing is registered for
+	fallback func(c *updateContext)
+}
+
+func NewRouter() *Router {
+	return &Router{
+		commands:  map[string]route{},
+		callbacks: map[string]route{},
+	}
+}
+
+// Command registers a handler for a /command
+func (r *Router) Command(command, permission string, handle routeHandler) {
+	r.commands[command] = route{key: command, permission: permission, handle: handle}
+}
+
+// Callback registers a handler for exact callback data, all of datas share it
+func (r *Router) Callback(permission string, handle routeHandler, datas ...string) {
+	for _, _data := range datas {
+		r.callbacks[_data] = route{key: _data, permission: permission, handle: handle}
+	}
+}
+
+// CallbackPrefix registers a handler for callback data starting with prefix, e.g. "revoke_allowance:",
+// the data handed to it has the prefix removed
+func (r *Router) CallbackPrefix(prefix, permission string, handle routeHandler) {
+	r.callbackPrefixes = append(r.callbackPrefixes, route{key: prefix, permission: permission, handle: handle})
+}
+
+// Handle runs the route matching update. A panicking handler only loses its own update
+func (r *Router) Handle(bot *tgbotapi.BotAPI, update tgbotapi.Update) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			log.Printf("Update %d panicked: %v\n%s", update.UpdateID, recovered, debug.Stack())
+		}
+	}()
+
+	c := &updateContext{bot: bot, update: update}
+	switch {
+	case update.CallbackQuery != nil:
+		bot.AnswerCallbackQuery(tgbotapi.NewCallback(update.CallbackQuery.ID, ""))
+		c.tgID = update.CallbackQuery.From.ID
+		c.data = update.CallbackQuery.Data
+		if update.CallbackQuery.Message != nil {
+			c.chatID = update.CallbackQuery.Message.Chat.ID
+		}
+	case update.Message != nil:
+		c.tgID = update.Message.From.ID
+		c.chatID = update.Message.Chat.ID
+	case update.ChannelPost != nil:
+		c.chatID = update.ChannelPost.Chat.ID
+		c.data = update.ChannelPost.Text
+		r.fallback(c)
+		return
+	default:
+		log.Printf("Update %d has no message or callback to handle", update.UpdateID)
+		return
+	}
+	c.user = quickAccessUser(c.tgID)
+
+	if update.CallbackQuery != nil {
+		if _route, ok := r.callbacks[c.data]; ok {
+			r.run(c, _route)
+			return
+		}
+		for _, _route := range r.callbackPrefixes {
+			if strings.HasPrefix(c.data, _route.key) {
+				c.data = strings.TrimPrefix(c.data, _route.key)
+				r.run(c, _route)
+				return
+			}
+		}
+		r.fallback(c)
+		return
+	}
+
+	// other messages answer the conversation the chat is in
+	if !update.Message.IsCommand() {
+		r.converse(c)
+		return
+	}
+	c.data = update.Message.Command()
+	if _route, ok := r.commands[c.data]; ok {
+		r.run(c, _route)
+		return
+	}
+	r.fallback(c)
+}
+
+func (r *Router) run(c *updateContext, _route route) {
+	switch _route.permission {
+	case publicAccess:
+	case userAccess:
+		if c.user == nil {
+			c.reply(handlers.HandleError(handlers.ErrUserNotFound))
+			return
+		}
+	default:
+		// routes that require a permission are the administrative ones, they are audited
+		if c.user == nil {
+			c.reply(handlers.HandleError(handlers.ErrUserNotFound))
+			recordAudit(c, _route, auditDenied, nil)
+			return
+		}
+		if !permitted(c.bot, c.chatID, c.tgID, _route.permission) {
+			recordAudit(c, _route, auditDenied, nil)
+			return
+		}
+	}
+
+	err := _route.handle(c)
+	if err != nil {
+		c.reply(fmt.Sprintf("Error: %v", err))
+	}
+	if _route.permission != publicAccess && _route.permission != userAccess {
+		recordAudit(c, _route, auditResult(err), err)
+	}
+}
+
+func (c *updateContext) userID() uint {
+	if c.user == nil {
+		return 0
+	}
+	return c.user.ID
+}
+
+// message is the message the update is about, the one holding the keyboard for callbacks
+func (c *updateContext) message() *tgbotapi.Message {
+	if c.update.CallbackQuery != nil {
+		return c.update.CallbackQuery.Message
+	}
+	return c.update.Message
+}
+
+func (c *updateContext) reply(text string) {
+	c.bot.Send(tgbotapi.NewMessage(c.chatID, text))
+}
+
+func (c *updateContext) replyMarkdown(text string) {
+	msg := tgbotapi.NewMessage(c.chatID, text)
+	msg.ParseMode = "Markdown"
+	c.bot.Send(msg)
+}
+
+// converse starts a flow in the chat of the update, see startConversation
+func (c *updateContext) converse(flow string, data map[string]string) error {
+	return startConversation(c.bot, c.chatID, c.tgID, flow, data)
+}
+
+// quickAccessUser looks the telegram user up in auth, nil when it is not registered
+func quickAccessUser(tgID int) *types.QuickAccessUserDataType {
+	if tgID == 0 {
+		return nil
+	}
+
+	_user, err := handlers.RetrieveUser(map[string]interface{}{
+		"tg_id": tgID,
+	})
+	if err != nil {
+		return nil
+	}
+
+	var userData map[string]interface{}
+	user, ok := _user.(*utils.Response)
+	if ok {
+		userData, ok = user.Data.(map[string]interface{})
+		if !ok {
+			log.Printf("Failed to cast user.Data to map[string]inerface{} tg_id: %v", tgID)
+		}
+	} else {
+		log.Printf("Failed to cast user to utils.Response tg_id: %v", tgID)
+	}
+
+	quickAccessUserData := &types.QuickAccessUserDataType{}
+	if userID, ok := userData["id"].(float64); ok {
+		quickAccessUserData.ID = uint(userID)
+	} else {
+		log.Printf("ID not found for user with tg_id: %v", tgID)
+	}
+
+	if tgData, ok := userData["telegram"].([]interface{}); ok {
+		for _, _tg := range tgData {
+			if _tgID, ok := _tg.(map[string]interface{})["telegram_id"].(float64); ok {
+				quickAccessUserData.TGiD = append(quickAccessUserData.TGiD, int(_tgID))
+			} else {
+				log.Printf("Telegram not found for user with tg_id: %v", tgID)
+			}
+		}
+	} else {
+		log.Printf("Telegram not found for user with tg_id: %v", tgID)
+	}
+
+	if accessData, ok := userData["access"].([]interface{}); ok {
+		quickAccessUserData.HasAccess = len(accessData) > 0
+	} else {
+		log.Printf("Access not found for user with tg_id: %v", tgID)
+	}
+
+	if roleData, ok := userData["role"].([]interface{}); ok {
+		for _, _rd := range roleData {
+			if roleTitle, ok := _rd.(map[string]interface{})["title"].(string); ok {
+				quickAccessUserData.Role = append(quickAccessUserData.Role, roleTitle)
+			} else {
+				log.Printf("Error parsing user roles for user with tg_id: %v", tgID)
+			}
+		}
+	}
+
+	return quickAccessUserData
+}
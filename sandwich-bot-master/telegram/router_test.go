@@ -0,0 +1,368 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"telegram/config"
+	"telegram/controllers"
+	"telegram/handlers"
+	"telegram/models"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const (
+	testChatID = int64(1001)
+	testTgID   = 42
+	testUserID = 7
+)
+
+// serviceCall is a request the bot sent to auth or bot, path is /<service>/api/v1/<endpoint>
+type serviceCall struct {
+	method  string
+	path    string
+	query   url.Values
+	payload map[string]interface{}
+}
+
+type serviceReply struct {
+	status  int
+	data    interface{}
+	message string
+}
+
+// servicesStandIn answers internal requests to auth and bot from replies keyed by "<method> <path>"
+type servicesStandIn struct {
+	mu      sync.Mutex
+	replies map[string]serviceReply
+	calls   []serviceCall
+}
+
+func (ss *servicesStandIn) reply(method, path string, reply serviceReply) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	ss.replies[method+" "+path] = reply
+}
+
+func (ss *servicesStandIn) called(method, path string) []serviceCall {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	var calls []serviceCall
+	for _, _call := range ss.calls {
+		if _call.method == method && _call.path == path {
+			calls = append(calls, _call)
+		}
+	}
+	return calls
+}
+
+func (ss *servicesStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	call := serviceCall{method: r.Method, path: r.URL.Path, query: r.URL.Query(), payload: map[string]interface{}{}}
+	json.NewDecoder(r.Body).Decode(&call.payload)
+
+	ss.mu.Lock()
+	ss.calls = append(ss.calls, call)
+	reply, ok := ss.replies[r.Method+" "+r.URL.Path]
+	ss.mu.Unlock()
+
+	status := "success"
+	if !ok {
+		reply = serviceReply{status: http.StatusNotFound, message: "Endpoint not found."}
+	}
+	if reply.status >= http.StatusBadRequest {
+		status = "error"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(reply.status)
+	json.NewEncoder(w).Encode(map[string]interface{}{"status": status, "data": reply.data, "message": reply.message})
+}
+
+// testBot is the router wired to a fake Bot API and to stand-ins of auth and bot
+type testBot struct {
+	t        *testing.T
+	bot      *tgbotapi.BotAPI
+	api      *fakeBotAPI
+	services *servicesStandIn
+	router   *Router
+	offset   int
+}
+
+func newTestBot(t *testing.T) *testBot {
+	t.Helper()
+
+	dsn := fmt.Sprintf("file:%s?mode=memory&cache=shared", strings.ReplaceAll(t.Name(), "/", "_"))
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(controllers.Models...); err != nil {
+		t.Fatal(err)
+	}
+
+	api := newFakeBotAPI("test-token")
+	apiServer := httptest.NewServer(api)
+	services := &servicesStandIn{replies: map[string]serviceReply{}}
+	servicesServer := httptest.NewServer(services)
+	servicesURL, _ := url.Parse(servicesServer.URL)
+
+	previousDB, previousConfig, previousEndpoint := controllers.DB, config.Telegram, config.InternalEndpoint
+	controllers.DB = db
+	config.Telegram = config.TelegramConfig{
+		BotToken:      "test-token",
+		ServiceName:   "telegram",
+		ServiceSecret: "test-secret",
+		AuditSecret:   "test-audit-secret",
+		BotAPIURL:     apiServer.URL,
+	}
+	config.InternalEndpoint = func(service, path string, args ...interface{}) (*url.URL, error) {
+		endpoint, err := previousEndpoint(service, path, args...)
+		if err != nil {
+			return nil, err
+		}
+		endpoint.Host = servicesURL.Host
+		return endpoint, nil
+	}
+	t.Cleanup(func() {
+		controllers.DB, config.Telegram, config.InternalEndpoint = previousDB, previousConfig, previousEndpoint
+		servicesServer.Close()
+		apiServer.Close()
+		sqlDB.Close()
+	})
+
+	bot, err := handlers.NewBot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := NewRouter()
+	registerRoutes(router)
+
+	return &testBot{t: t, bot: bot, api: api, services: services, router: router}
+}
+
+// registered makes auth know the test user and answer its permission checks with allowed
+func (tb *testBot) registered(allowed bool, reason string) {
+	tb.services.reply("GET", "/auth/api/v1/retrieve_user", serviceReply{status: http.StatusOK, data: map[string]interface{}{
+		"id":       testUserID,
+		"telegram": []interface{}{map[string]interface{}{"telegram_id": testTgID}},
+		"access":   []interface{}{map[string]interface{}{"id": 1}},
+		"role":     []interface{}{map[string]interface{}{"title": "admin"}},
+	}})
+	tb.services.reply("GET", "/auth/api/v1/check_permission", serviceReply{status: http.StatusOK, data: map[string]interface{}{
+		"allowed": allowed,
+		"reason":  reason,
+	}})
+}
+
+// deliver pushes update to the fake Bot API and handles what getUpdates returns, like poll does
+func (tb *testBot) deliver(update tgbotapi.Update) {
+	tb.t.Helper()
+	if _, err := tb.api.PushUpdate(update); err != nil {
+		tb.t.Fatal(err)
+	}
+	updates, err := tb.bot.GetUpdates(tgbotapi.NewUpdate(tb.offset))
+	if err != nil {
+		tb.t.Fatal(err)
+	}
+	for _, _update := range updates {
+		tb.router.Handle(tb.bot, _update)
+		tb.offset = _update.UpdateID + 1
+	}
+}
+
+func (tb *testBot) command(command string) {
+	tb.deliver(tgbotapi.Update{Message: &tgbotapi.Message{
+		From:     &tgbotapi.User{ID: testTgID},
+		Chat:     &tgbotapi.Chat{ID: testChatID},
+		Text:     "/" + command,
+		Entities: &[]tgbotapi.MessageEntity{{Type: "bot_command", Length: len(command) + 1}},
+	}})
+}
+
+func (tb *testBot) text(text string) {
+	tb.deliver(tgbotapi.Update{Message: &tgbotapi.Message{
+		From: &tgbotapi.User{ID: testTgID},
+		Chat: &tgbotapi.Chat{ID: testChatID},
+		Text: text,
+	}})
+}
+
+func (tb *testBot) press(data string) {
+	tb.deliver(tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{
+		ID:      "callback",
+		From:    &tgbotapi.User{ID: testTgID},
+		Message: &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: testChatID}},
+		Data:    data,
+	}})
+}
+
+// lastSent is the last message the bot sent, it fails the test when there is none
+func (tb *testBot) lastSent() fakeSentMessage {
+	tb.t.Helper()
+	sent := tb.api.Sent()
+	if len(sent) == 0 {
+		tb.t.Fatal("the bot sent nothing")
+	}
+	return sent[len(sent)-1]
+}
+
+func (tb *testBot) audit() []models.AuditEntry {
+	tb.t.Helper()
+	var entries []models.AuditEntry
+	if err := controllers.DB.Order("id").Find(&entries).Error; err != nil {
+		tb.t.Fatal(err)
+	}
+	return entries
+}
+
+func TestRouterPublicAndUserRoutes(t *testing.T) {
+	tb := newTestBot(t)
+
+	tb.command("start")
+	if sent := tb.lastSent(); sent.ChatID != testChatID || sent.Text != "Choose an option:" || !strings.Contains(string(sent.ReplyMarkup), `"callback_data":"register"`) {
+		t.Fatalf("start menu: %+v", sent)
+	}
+
+	// auth does not know the user, user routes refuse it
+	tb.press("currentSettings")
+	if sent := tb.lastSent(); sent.Text != handlers.HandleError(handlers.ErrUserNotFound) {
+		t.Fatalf("unregistered user: %q", sent.Text)
+	}
+	if calls := tb.services.called("GET", "/auth/api/v1/retrieve_user"); len(calls) == 0 || calls[0].query.Get("tg_id") != fmt.Sprint(testTgID) {
+		t.Fatalf("retrieve_user calls: %+v", calls)
+	}
+	// only administrative routes are audited
+	if entries := tb.audit(); len(entries) != 0 {
+		t.Fatalf("audit entries: %+v", entries)
+	}
+}
+
+func TestRouterPermissionDenied(t *testing.T) {
+	tb := newTestBot(t)
+	tb.registered(false, "access")
+
+	tb.press("set_setting:gas_limit")
+
+	if sent := tb.lastSent(); sent.Text != handlers.HandleError(handlers.ErrNoAccess) {
+		t.Fatalf("denied user: %q", sent.Text)
+	}
+	if calls := tb.services.called("GET", "/auth/api/v1/check_permission"); len(calls) != 1 || calls[0].query.Get("action") != "update_settings" {
+		t.Fatalf("check_permission calls: %+v", calls)
+	}
+	if calls := tb.services.called("GET", "/bot/api/v1/retrieve_settings_schema"); len(calls) != 0 {
+		t.Fatal("a denied route ran its handler")
+	}
+	if entries := tb.audit(); len(entries) != 1 || entries[0].Action != "set_setting" || entries[0].Result != auditDenied {
+		t.Fatalf("audit entries: %+v", entries)
+	}
+}
+
+func TestRouterUnknownCallback(t *testing.T) {
+	tb := newTestBot(t)
+	tb.registered(true, "")
+
+	tb.press("no_such_button")
+	if sent := tb.lastSent(); sent.Text != "Hi Callback 👋no_such_button" {
+		t.Fatalf("unknown callback: %q", sent.Text)
+	}
+	if calls := tb.services.called("GET", "/auth/api/v1/check_permission"); len(calls) != 0 {
+		t.Fatalf("unknown callback checked permissions: %+v", calls)
+	}
+}
+
+func TestSettingFlow(t *testing.T) {
+	tb := newTestBot(t)
+	tb.registered(true, "")
+	tb.services.reply("GET", "/bot/api/v1/retrieve_settings_schema", serviceReply{status: http.StatusOK, data: []interface{}{map[string]interface{}{
+		"key":         "gas_limit",
+		"title":       "Gas Limit",
+		"description": "gas of an attack transaction",
+		"type":        "integer",
+		"min":         21000,
+		"unit":        "gas",
+		"default":     300000,
+	}}})
+	tb.services.reply("PATCH", "/bot/api/v1/update_settings", serviceReply{status: http.StatusOK, message: "Settings updated."})
+
+	tb.press("set_setting:gas_limit")
+	prompt := tb.lastSent()
+	if !strings.HasPrefix(prompt.Text, "Please enter the new value for Gas Limit") || !strings.Contains(prompt.Text, "from 21000 to any") || !strings.Contains(string(prompt.ReplyMarkup), `"force_reply":true`) {
+		t.Fatalf("prompt: %+v", prompt)
+	}
+
+	// an invalid answer keeps the conversation at its step
+	tb.text("a lot")
+	if sent := tb.lastSent(); !strings.HasPrefix(sent.Text, "Invalid answer: the answer should be a number") {
+		t.Fatalf("invalid answer: %q", sent.Text)
+	}
+	tb.text("2.5")
+	if sent := tb.lastSent(); !strings.HasPrefix(sent.Text, "Invalid answer: gas_limit should be a whole number") {
+		t.Fatalf("fractional answer: %q", sent.Text)
+	}
+
+	tb.text("350000")
+	if sent := tb.lastSent(); sent.Text != "Settings updated." {
+		t.Fatalf("finish: %q", sent.Text)
+	}
+	calls := tb.services.called("PATCH", "/bot/api/v1/update_settings")
+	if len(calls) != 1 || calls[0].payload["gas_limit"] != "350000" || calls[0].payload["user_id"] != float64(testUserID) {
+		t.Fatalf("update_settings calls: %+v", calls)
+	}
+
+	// the flow is over, later messages start nothing
+	sent := len(tb.api.Sent())
+	tb.text("400000")
+	if len(tb.api.Sent()) != sent || len(tb.services.called("PATCH", "/bot/api/v1/update_settings")) != 1 {
+		t.Fatal("a finished conversation took another answer")
+	}
+
+	// each step is audited under the flow, denials and answers alike
+	var actions []string
+	for _, _entry := range tb.audit() {
+		actions = append(actions, _entry.Action+"="+_entry.Result)
+	}
+	if len(actions) != 4 || actions[0] != "set_setting="+auditSuccess || actions[3] != "setting:value="+auditSuccess {
+		t.Fatalf("audit actions: %v", actions)
+	}
+}
+
+func TestCancelConversation(t *testing.T) {
+	tb := newTestBot(t)
+	tb.registered(true, "")
+	tb.services.reply("GET", "/bot/api/v1/retrieve_settings_schema", serviceReply{status: http.StatusOK, data: []interface{}{map[string]interface{}{
+		"key":  "deadline",
+		"type": "integer",
+	}}})
+
+	tb.command("cancel")
+	if sent := tb.lastSent(); sent.Text != "There is nothing to cancel." {
+		t.Fatalf("cancel without conversation: %q", sent.Text)
+	}
+
+	tb.press("set_setting:deadline")
+	tb.command("cancel")
+	conversation, err := loadConversation(testChatID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conversation != nil {
+		t.Fatalf("conversation survived /cancel: %+v", conversation)
+	}
+	tb.text("1000")
+	if calls := tb.services.called("PATCH", "/bot/api/v1/update_settings"); len(calls) != 0 {
+		t.Fatalf("cancelled flow finished: %+v", calls)
+	}
+}
@@ -0,0 +1,531 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"telegram/config"
+	"telegram/handlers"
+	"telegram/utils"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// registerRoutes wires every command, button and prompt of the bot with the permission it requires
+func registerRoutes(r *Router) {
+	r.Command("start", publicAccess, func(c *updateContext) error {
+		sendStartMenu(c.bot, c.message())
+		return nil
+	})
+
+	// multi-step flows, see flows.go
+	registerFlows()
+	r.Command("cancel", publicAccess, cancelConversation)
+
+	// menus
+	r.Callback(userAccess, func(c *updateContext) error {
+		sendStartMenu(c.bot, c.message())
+		return nil
+	}, "go_back")
+	r.Callback(userAccess, sendCurrentSettings, "currentSettings")
+	r.Callback(userAccess, sendSetSettingsMenu, "setSettings")
+	r.Callback(userAccess, sendContractMenu, "contract")
+	r.Callback(userAccess, sendDEXOrCoinMenu, "DEX", "coin")
+	r.Callback("view_wallets", sendSystemWalletsMenu, "systemWallets")
+	r.Callback("kill_switch_menu", sendKillSwitchMenu, "killSwitch")
+
+	// access
+	r.Callback(publicAccess, register, "register")
+	r.Callback(userAccess, createAccessChallenge, "getAccess")
+
+	// actions that owners approve first
+	r.Callback("set_wallet", func(c *updateContext) error {
+		return c.converse("wallet_request", map[string]string{"wallet_type": strings.Split(c.data, "_")[1]})
+	}, "set_main_wallet", "set_withdrawal_wallet")
+	r.Callback("set_wallet", requestApproval, "rotate_main_wallet", "rotate_withdrawal_wallet")
+	r.Callback("set_kill_switch", requestApproval, "set_kill_switch_on", "set_kill_switch_off")
+	r.CallbackPrefix("request_sweep:", "sweep_profit", requestSweep)
+	r.CallbackPrefix("approve_request:", "approve_request", decideApprovalRequest("approve_request"))
+	r.CallbackPrefix("reject_request:", "approve_request", decideApprovalRequest("reject_request"))
+
+	// contracts, DEXs and coins
+	r.Callback("manage_contracts", promptContracts, "whiteListContract", "blackListContract")
+	r.Callback("list_contracts", listContracts, "listContracts", "findContracts", "listBlacklisted", "listWhitelisted")
+	r.Callback("manage_contracts", promptDEXsAndCoins, "add_DEXs", "add_coins", "delete_DEXs", "delete_coins")
+	r.Callback("list_contracts", listDEXsAndCoins, "list_DEXs", "list_coins")
+
+	// wallets
+	r.Callback("view_wallets", sendWallet, "main_wallet", "withdrawal_wallet")
+	r.Callback("view_wallets", func(c *updateContext) error {
+		return sendPortfolio(c, "")
+	}, "portfolio")
+	r.Callback("manage_allowances", func(c *updateContext) error {
+		sendAllowances(c.bot, c.chatID, c.userID())
+		return nil
+	}, "allowances")
+	r.Callback("manage_allowances", func(c *updateContext) error {
+		revokeAllowances(c.bot, c.chatID, c.userID())
+		return nil
+	}, "revoke_stale_allowances")
+	r.CallbackPrefix("revoke_allowance:", "manage_allowances", func(c *updateContext) error {
+		allowanceID, err := strconv.ParseUint(c.data, 10, 64)
+		if err != nil {
+			return errors.New("invalid allowance")
+		}
+		revokeAllowances(c.bot, c.chatID, c.userID(), uint(allowanceID))
+		return nil
+	})
+
+	// settings
+	r.CallbackPrefix("set_setting:", "update_settings", promptSetting)
+	r.Callback("update_settings", func(c *updateContext) error {
+		sendSettingsHistory(c.bot, c.chatID, c.userID())
+		return nil
+	}, "settingsHistory")
+	r.CallbackPrefix("diff_settings:", "update_settings", diffOrRollbackSettings("diff_settings"))
+	r.CallbackPrefix("rollback_settings:", "update_settings", diffOrRollbackSettings("rollback_settings"))
+
+	r.Callback("view_nodes", func(c *updateContext) error {
+		sendNodePool(c.bot, c.chatID, c.userID())
+		return nil
+	}, "nodePool")
+
+	// alerts, see notifications.go
+	r.Callback("receive_alerts", sendAlertsMenu, "alerts")
+	r.CallbackPrefix("subscribe:", "receive_alerts", toggleSubscription(true))
+	r.CallbackPrefix("unsubscribe:", "receive_alerts", toggleSubscription(false))
+	r.CallbackPrefix("mute:", "receive_alerts", muteSubscription(alertMuteDuration))
+	r.CallbackPrefix("unmute:", "receive_alerts", muteSubscription(0))
+
+	// audit logs, see audit.go
+	r.Command("audit", "view_audit_log", sendAuditLog)
+	r.CallbackPrefix("audit_export:", "view_audit_log", exportAuditLog)
+
+	r.fallback = func(c *updateContext) {
+		switch {
+		case c.update.ChannelPost != nil:
+			if c.chatID == config.Telegram.ChannelID && c.data != "/start" {
+				c.reply("Hi Channel 👋")
+			}
+		case c.update.CallbackQuery != nil:
+			if c.user == nil {
+				c.reply(handlers.HandleError(handlers.ErrUserNotFound))
+				return
+			}
+			c.reply("Hi Callback 👋" + c.data)
+		default:
+			c.reply("Hi Command👋")
+		}
+	}
+}
+
+func sendCurrentSettings(c *updateContext) error {
+	_response, err := handlers.GenericRequest("GET", "bot", "retrieve_settings", map[string]interface{}{
+		"user_id": c.userID(),
+	})
+	if err != nil {
+		return err
+	}
+
+	settingsMap, ok := _response.Data.(map[string]interface{})
+	if !ok {
+		return errors.New("failed to bind bot response to map")
+	}
+	settings, _ := settingsMap["settings"].(map[string]interface{})
+
+	message := "```\n"
+	message += fmt.Sprintf("%-25s | %s\n", "Key", "Value")
+	message += strings.Repeat("-", 50) + "\n"
+	for _k, _v := range settings {
+		formattedKey := strings.Title(strings.Join(strings.Split(_k, "_"), " "))
+		message += fmt.Sprintf("%-25s | %v\n", formattedKey, _v)
+	}
+	message += "```"
+
+	var createdByUsername interface{} = "default"
+	if _user, err := handlers.RetrieveUser(map[string]interface{}{
+		"id": settingsMap["created_by"],
+	}); err == nil {
+		user, ok := _user.(*utils.Response)
+		if !ok {
+			return errors.New("cannot convert user interface{}")
+		}
+
+		userData, _ := user.Data.(map[string]interface{})
+		telegrams, _ := userData["telegram"].([]interface{})
+		for _, _v := range telegrams {
+			_vMap, ok := _v.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			createdByUsername = "@"
+			if username, ok := _vMap["username"].(string); ok && username != "" && username != "0" {
+				createdByUsername = "@" + username
+				break
+			}
+		}
+	}
+	message += fmt.Sprintf("\nCreated By: %v", createdByUsername)
+
+	c.replyMarkdown(message)
+	return nil
+}
+
+func sendSetSettingsMenu(c *updateContext) error {
+	schema, err := settingsSchema()
+	if err != nil {
+		return err
+	}
+
+	// two settings per row, in schema order
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _i := 0; _i < len(schema); _i += 2 {
+		end := _i + 2
+		if end > len(schema) {
+			end = len(schema)
+		}
+		var row []tgbotapi.InlineKeyboardButton
+		for _, _field := range schema[_i:end] {
+			row = append(row, tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("%v (%v)", _field["title"], _field["unit"]), fmt.Sprintf("set_setting:%v", _field["key"])))
+		}
+		rows = append(rows, row)
+	}
+	rows = append(rows,
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("Main Wallet", "set_main_wallet"),
+			tgbotapi.NewInlineKeyboardButtonData("Withdrawal Wallet", "set_withdrawal_wallet"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("Rotate Main Wallet", "rotate_main_wallet"),
+			tgbotapi.NewInlineKeyboardButtonData("Rotate Withdrawal Wallet", "rotate_withdrawal_wallet"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("Allowances", "allowances"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("Back", "go_back"),
+		),
+	)
+
+	msg := tgbotapi.NewMessage(c.chatID, "Choose an option:")
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	c.bot.Send(msg)
+	return nil
+}
+
+func promptSetting(c *updateContext) error {
+	field, err := settingField(c.data)
+	if err != nil {
+		return err
+	}
+
+	return c.converse("setting", map[string]string{
+		"key":  c.data,
+		"type": fmt.Sprintf("%v", field["type"]),
+	})
+}
+
+func diffOrRollbackSettings(action string) routeHandler {
+	return func(c *updateContext) error {
+		version, err := strconv.ParseUint(c.data, 10, 64)
+		if err != nil {
+			return errors.New("invalid settings version")
+		}
+
+		var _response *utils.Response
+		if action == "diff_settings" {
+			_response, err = handlers.BotRequest("GET", "diff_settings", map[string]interface{}{
+				"user_id":      c.userID(),
+				"from_version": version,
+			})
+		} else {
+			_response, err = handlers.BotRequest("PATCH", "rollback_settings", map[string]interface{}{
+				"user_id": c.userID(),
+				"version": version,
+			})
+		}
+		if err != nil {
+			return err
+		}
+
+		text := _response.Message
+		if changes, ok := _response.Data.([]interface{}); ok {
+			text += formatSettingsChanges(changes)
+		}
+		c.reply(text)
+		return nil
+	}
+}
+
+func sendContractMenu(c *updateContext) error {
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("List Contracts", "listContracts"),
+			tgbotapi.NewInlineKeyboardButtonData("Find Contract", "findContracts"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("Whitelist Contract", "whiteListContract"),
+			tgbotapi.NewInlineKeyboardButtonData("Blacklist Contract", "blackListContract"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("Back", "go_back"),
+		),
+	)
+	msg := tgbotapi.NewMessage(c.chatID, "Please select action")
+	msg.ReplyMarkup = keyboard
+	c.bot.Send(msg)
+	return nil
+}
+
+func promptContracts(c *updateContext) error {
+	list := "whitelist"
+	if strings.Contains(c.data, "black") {
+		list = "blacklist"
+	}
+
+	c.replyMarkdown("**_👋 Tip: multiple contracts can be entered at the same time using comma as a delimeter_**")
+	return c.converse("list_contracts", map[string]string{"list": list})
+}
+
+func listContracts(c *updateContext) error {
+	switch c.data {
+	case "findContracts":
+		c.replyMarkdown("**_👋 Tip: partial contract address can be used to locate contract in the system _**")
+		return c.converse("find_contract", nil)
+	case "listContracts":
+		keyboard := tgbotapi.NewInlineKeyboardMarkup(
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("Blacklisted", "listBlacklisted"),
+				tgbotapi.NewInlineKeyboardButtonData("Whitelisted", "listWhitelisted"),
+			),
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("Back", "go_back"),
+			),
+		)
+		msg := tgbotapi.NewMessage(c.chatID, "Choose an option to list:")
+		msg.ReplyMarkup = keyboard
+		c.bot.Send(msg)
+		return nil
+	}
+
+	_payload := map[string]interface{}{
+		"user_id": c.userID(),
+	}
+	if c.data == "listBlacklisted" {
+		_payload["blacklisted"] = 1
+	}
+
+	_response, err := handlers.GenericRequest("GET", "bot", "retrieve_contract", _payload)
+	if err != nil {
+		return err
+	}
+
+	c.replyMarkdown(_response.Message)
+	return nil
+}
+
+func sendDEXOrCoinMenu(c *updateContext) error {
+	capitalizedCallbckData := strings.Title(c.data)
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("List %ss", capitalizedCallbckData), fmt.Sprintf("list_%ss", c.data)),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("Add %s", capitalizedCallbckData), fmt.Sprintf("add_%ss", c.data)),
+			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("Delete %s", capitalizedCallbckData), fmt.Sprintf("delete_%ss", c.data)),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("Back", "go_back"),
+		),
+	)
+	msg := tgbotapi.NewMessage(c.chatID, "Please select action")
+	msg.ReplyMarkup = keyboard
+	c.bot.Send(msg)
+	return nil
+}
+
+func promptDEXsAndCoins(c *updateContext) error {
+	// add_DEXs starts add_DEX
+	return c.converse(strings.TrimSuffix(c.data, "s"), nil)
+}
+
+func listDEXsAndCoins(c *updateContext) error {
+	resource := "coin"
+	if strings.Contains(c.data, "DEX") {
+		resource = "dex"
+	}
+
+	_response, err := handlers.GenericRequest("GET", "bot", "retrieve_"+resource, map[string]interface{}{
+		"user_id":       c.userID(),
+		"blockchain_id": 1,
+	})
+	if err != nil {
+		return err
+	}
+
+	c.replyMarkdown(_response.Message)
+	return nil
+}
+
+func sendSystemWalletsMenu(c *updateContext) error {
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("Main", "main_wallet"),
+			tgbotapi.NewInlineKeyboardButtonData("Withdrawal", "withdrawal_wallet"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("Portfolio", "portfolio"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("Back", "go_back"),
+		),
+	)
+
+	msg := tgbotapi.NewMessage(c.chatID, "Please select the type of wallet for which you would like to view information:")
+	msg.ReplyMarkup = keyboard
+	c.bot.Send(msg)
+	return nil
+}
+
+func sendWallet(c *updateContext) error {
+	_response, err := handlers.GenericRequest("GET", "bot", "retrieve_wallet", map[string]interface{}{
+		"user_id":     c.userID(),
+		"wallet_type": strings.Split(c.data, "_")[0],
+	})
+	if err != nil {
+		return err
+	}
+
+	if _response == nil {
+		return errors.New("failed to retrieve the wallet")
+	}
+
+	c.replyMarkdown(_response.Message)
+	return sendPortfolio(c, strings.Split(c.data, "_")[0])
+}
+
+func sendKillSwitchMenu(c *updateContext) error {
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("On", "set_kill_switch_on"),
+			tgbotapi.NewInlineKeyboardButtonData("Off", "set_kill_switch_off"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("Back", "go_back"),
+		),
+	)
+
+	msg := tgbotapi.NewMessage(c.chatID, "Please, confirm that you want to activate kill switch, which will stop all bot operations:")
+	msg.ReplyMarkup = keyboard
+	c.bot.Send(msg)
+	return nil
+}
+
+func register(c *updateContext) error {
+	from := c.update.CallbackQuery.From
+	userMnemonic, err := handlers.CreateUser(map[string]interface{}{
+		"tg_id":      from.ID,
+		"first_name": from.FirstName,
+		"last_name":  from.LastName,
+		"username":   from.UserName,
+	})
+	if err != nil {
+		c.reply("⚠️ Warning: failed to register, " + err.Error())
+		return nil
+	}
+
+	c.replyMarkdown("**_👋 Tip: Please, save the mnemonic phrase and then delete the message afterwards. _**")
+	c.replyMarkdown(fmt.Sprintf("`%s`", userMnemonic))
+	c.replyMarkdown("Registration successful")
+	return nil
+}
+
+func createAccessChallenge(c *updateContext) error {
+	challengeID, indexes, err := handlers.CreateAccessChallenge(map[string]interface{}{
+		"tg_id": c.tgID,
+	})
+	if err != nil {
+		return err
+	}
+
+	_indexes := []string{}
+	for _, _i := range indexes {
+		_indexes = append(_indexes, strconv.Itoa(_i))
+	}
+
+	return c.converse("access", map[string]string{
+		"challenge_id": challengeID,
+		"indexes":      strings.Join(_indexes, ","),
+	})
+}
+
+// requestApproval opens an approval request for the action named by the callback
+func requestApproval(c *updateContext) error {
+	return createApprovalRequest(c, c.data, nil)
+}
+
+// createApprovalRequest asks owners to approve action, it runs right away when the quorum is met
+func createApprovalRequest(c *updateContext, action string, payload map[string]interface{}) error {
+	_payload := map[string]interface{}{
+		"user_id": c.userID(),
+		"tg_id":   c.tgID,
+		"action":  action,
+	}
+	if payload != nil {
+		_payload["payload"] = payload
+	}
+	request, message, err := handlers.ApprovalRequest("PUT", "create_approval_request", _payload)
+	if err != nil {
+		return err
+	}
+
+	if request["status"] == "approved" {
+		runApprovedAction(c.bot, c.chatID, request)
+		return nil
+	}
+	sendApprovalRequest(c.bot, c.chatID, request, message)
+	return nil
+}
+
+func requestSweep(c *updateContext) error {
+	request, message, err := handlers.ApprovalRequest("PUT", "create_approval_request", map[string]interface{}{
+		"user_id": c.userID(),
+		"tg_id":   c.tgID,
+		"action":  "sweep_profit",
+		"payload": map[string]interface{}{"sweep_id": c.data},
+	})
+	if err != nil {
+		return err
+	}
+
+	if _, err := handlers.BotRequest("PATCH", "request_sweep", map[string]interface{}{
+		"user_id":    c.userID(),
+		"sweep_id":   c.data,
+		"request_id": request["request_id"],
+	}); err != nil {
+		return err
+	}
+
+	sendApprovalRequest(c.bot, c.chatID, request, message)
+	return nil
+}
+
+func decideApprovalRequest(decision string) routeHandler {
+	return func(c *updateContext) error {
+		request, message, err := handlers.ApprovalRequest("POST", decision, map[string]interface{}{
+			"user_id":    c.userID(),
+			"tg_id":      c.tgID,
+			"request_id": c.data,
+		})
+		if err != nil {
+			return err
+		}
+
+		c.reply(message)
+		if request["status"] == "approved" {
+			runApprovedAction(c.bot, c.chatID, request)
+		}
+		return nil
+	}
+}
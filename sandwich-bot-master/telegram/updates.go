@@ -0,0 +1,136 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"telegram/config"
+	"telegram/controllers"
+	"telegram/models"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	pollTimeout    = 10
+	pollRetryDelay = 3 * time.Second
+	// webhook updates waiting for the worker, Telegram redelivers the ones it could not post
+	webhookQueueSize = 100
+)
+
+// loadOffset is the first update the bot has not handled yet
+func loadOffset(botID int) int {
+	var offset models.UpdateOffset
+	if err := controllers.DB.First(&offset, "bot_id = ?", botID).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("Failed to load update offset: %v", err)
+		}
+		return 0
+	}
+	return offset.Offset
+}
+
+func saveOffset(botID, offset int) {
+	if err := controllers.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "bot_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"offset", "updated_at"}),
+	}).Create(&models.UpdateOffset{BotID: botID, Offset: offset}).Error; err != nil {
+		log.Printf("Failed to save update offset %d: %v", offset, err)
+	}
+}
+
+// poll long polls for updates, the offset is saved after each update so a restart resumes after it
+func poll(bot *tgbotapi.BotAPI, router *Router) {
+	if _, err := bot.RemoveWebhook(); err != nil {
+		log.Printf("Failed to remove webhook: %v", err)
+	}
+
+	offset := loadOffset(bot.Self.ID)
+	for {
+		u := tgbotapi.NewUpdate(offset)
+		u.Timeout = pollTimeout
+
+		updates, err := bot.GetUpdates(u)
+		if err != nil {
+			log.Println("Failed to get updates from telegram", err)
+			time.Sleep(pollRetryDelay)
+			continue
+		}
+
+		for _, update := range updates {
+			if update.UpdateID < offset {
+				continue
+			}
+			router.Handle(bot, update)
+			offset = update.UpdateID + 1
+			saveOffset(bot.Self.ID, offset)
+		}
+	}
+}
+
+// serveWebhook registers webhook_url with Telegram and handles the updates posted to it. Updates are
+// handled one at a time in the order they arrive, like with polling
+func serveWebhook(bot *tgbotapi.BotAPI, router *Router) error {
+	if err := config.Telegram.Validate(); err != nil {
+		return err
+	}
+	if _, err := bot.MakeRequest("setWebhook", url.Values{
+		"url":          {config.Telegram.WebhookURL},
+		"secret_token": {config.Telegram.WebhookSecret},
+	}); err != nil {
+		return fmt.Errorf("failed to set webhook: %w", err)
+	}
+
+	queue := make(chan tgbotapi.Update, webhookQueueSize)
+	go func() {
+		offset := loadOffset(bot.Self.ID)
+		for update := range queue {
+			if update.UpdateID < offset {
+				log.Printf("Skipping redelivered update %d", update.UpdateID)
+				continue
+			}
+			router.Handle(bot, update)
+			offset = update.UpdateID + 1
+			saveOffset(bot.Self.ID, offset)
+		}
+	}()
+
+	log.Printf("Receiving updates on %s", config.Telegram.WebhookListen)
+	return http.ListenAndServe(config.Telegram.WebhookListen, webhookHandler(config.Telegram.WebhookSecret, queue))
+}
+
+func webhookHandler(secret string, queue chan<- tgbotapi.Update) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		// an empty secret would match requests without the header
+		token := r.Header.Get("X-Telegram-Bot-Api-Secret-Token")
+		if secret == "" || subtle.ConstantTimeCompare([]byte(token), []byte(secret)) != 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var update tgbotapi.Update
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		select {
+		case queue <- update:
+			w.WriteHeader(http.StatusOK)
+		default:
+			// Telegram retries it later
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	})
+}
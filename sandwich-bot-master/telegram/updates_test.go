@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"telegram/config"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+func TestWebhookSecretRequired(t *testing.T) {
+	settings := config.TelegramConfig{WebhookURL: "https://bot.example/webhook"}
+	if err := settings.Validate(); !errors.Is(err, config.ErrWebhookSecret) {
+		t.Fatalf("want ErrWebhookSecret, got %v", err)
+	}
+	settings.WebhookSecret = "secret"
+	if err := settings.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	// long polling needs no secret
+	if err := (config.TelegramConfig{}).Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWebhookHandler(t *testing.T) {
+	for _, _case := range []struct {
+		name    string
+		secret  string
+		updates int
+	}{
+		{name: "matching secret", secret: "secret", updates: 1},
+		{name: "wrong secret", secret: "other"},
+		// an empty secret on either side is never a match
+		{name: "no secret", secret: ""},
+	} {
+		t.Run(_case.name, func(t *testing.T) {
+			tb := newTestBot(t)
+			queue := make(chan tgbotapi.Update, 1)
+			server := httptest.NewServer(webhookHandler("secret", queue))
+			defer server.Close()
+
+			// the fake Bot API posts pushed updates to the webhook with the secret it was given
+			if _, err := tb.bot.MakeRequest("setWebhook", url.Values{"url": {server.URL}, "secret_token": {_case.secret}}); err != nil {
+				t.Fatal(err)
+			}
+			_, err := tb.api.PushUpdate(tgbotapi.Update{Message: &tgbotapi.Message{Text: "hi"}})
+			if _case.updates == 0 && err == nil {
+				t.Fatal("webhook accepted an update without the right secret")
+			}
+			if len(queue) != _case.updates {
+				t.Fatalf("queued %d updates, want %d", len(queue), _case.updates)
+			}
+		})
+	}
+
+	// a handler serving without a secret refuses everything
+	queue := make(chan tgbotapi.Update, 1)
+	recorder := httptest.NewRecorder()
+	webhookHandler("", queue).ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/", nil))
+	if recorder.Code != http.StatusUnauthorized || len(queue) != 0 {
+		t.Fatalf("handler without secret answered %d", recorder.Code)
+	}
+}
@@ -2,12 +2,14 @@ package utils
 
 import (
 	"bytes"
+	"common/signature"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
 )
 
 type Response struct {
@@ -32,6 +34,13 @@ func InternalRouter(endpoint, method string, headers, payload interface{}) (*Res
 		payload = map[string]interface{}{}
 	}
 
+	// acting user travels signed next to the payload
+	if _payload, ok := payload.(map[string]interface{}); ok && _payload["user_id"] != nil {
+		headersMap[signature.HeaderUserID] = fmt.Sprintf("%v", _payload["user_id"])
+	} else if _url, err := url.Parse(endpoint); err == nil && _url.Query().Get("user_id") != "" {
+		headersMap[signature.HeaderUserID] = _url.Query().Get("user_id")
+	}
+
 	_payload, _err := json.Marshal(payload)
 	if _err != nil {
 		return nil, 0, _err
@@ -46,7 +55,38 @@ func InternalRouter(endpoint, method string, headers, payload interface{}) (*Res
 	return resp, *respCode, err
 }
 
+// InternalDownload GETs an endpoint that answers with a file, errors still come as a JSON response.
+// The acting user is taken from the user_id query parameter
+func InternalDownload(endpoint string) ([]byte, int, error) {
+	headersMap := map[string]interface{}{}
+	if _url, err := url.Parse(endpoint); err == nil && _url.Query().Get("user_id") != "" {
+		headersMap[signature.HeaderUserID] = _url.Query().Get("user_id")
+	}
+
+	body, respCode, err := ForwardRawRequest("GET", endpoint, &headersMap, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	return body, *respCode, nil
+}
+
 func ForwardRequest(httpMethod string, url string, headers *map[string]interface{}, payload []byte) (*Response, *int, error) {
+	_body, respCode, err := ForwardRawRequest(httpMethod, url, headers, payload)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var resp Response
+
+	if _err := json.Unmarshal(_body, &resp); _err != nil {
+		return nil, nil, err
+	}
+
+	return &resp, respCode, nil
+}
+
+// ForwardRawRequest signs and sends a request and returns the response body as is
+func ForwardRawRequest(httpMethod string, url string, headers *map[string]interface{}, payload []byte) ([]byte, *int, error) {
 	_http := &http.Client{}
 
 	var request *http.Request
@@ -61,6 +101,7 @@ func ForwardRequest(httpMethod string, url string, headers *map[string]interface
 		if err != nil {
 			return nil, nil, err
 		}
+		payload = nil
 	}
 
 	if headers != nil {
@@ -69,6 +110,10 @@ func ForwardRequest(httpMethod string, url string, headers *map[string]interface
 		}
 	}
 
+	if err := SignRequest(request, payload); err != nil {
+		return nil, nil, err
+	}
+
 	response, err := _http.Do(request)
 	fmt.Println("Error request", err)
 	if err != nil {
@@ -77,17 +122,11 @@ func ForwardRequest(httpMethod string, url string, headers *map[string]interface
 
 	defer response.Body.Close()
 
-	var resp Response
-
 	_body, err := io.ReadAll(response.Body)
 
 	if err != nil {
 		return nil, nil, err
 	}
 
-	if _err := json.Unmarshal(_body, &resp); _err != nil {
-		return nil, nil, err
-	}
-
-	return &resp, &response.StatusCode, nil
+	return _body, &response.StatusCode, nil
 }
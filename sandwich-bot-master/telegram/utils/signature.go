@@ -0,0 +1,13 @@
+package utils
+
+import (
+	"common/signature"
+	"net/http"
+	"telegram/config"
+)
+
+// SignRequest signs request for auth and bot middleware. body has to be exactly what is sent, user id
+// is taken from the already set X-User-ID header.
+func SignRequest(request *http.Request, body []byte) error {
+	return signature.SignRequest(request, body, config.Telegram.ServiceName, config.Telegram.ServiceSecret)
+}